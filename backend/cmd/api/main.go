@@ -1,194 +1,261 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"flash-sale-backend/internal/config"
 	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/grpc"
 	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/reconcile"
+	"flash-sale-backend/internal/tracing"
 )
 
 func main() {
-	fmt.Println("🚀 Starting Flash Sale Backend...")
+	// Structured logs: JSON by default, LOG_FORMAT=text for local reading
+	var logHandler slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	if config.String("LOG_FORMAT", "json") == "text" {
+		logHandler = slog.NewTextHandler(os.Stdout, nil)
+	}
+	slog.SetDefault(slog.New(logHandler))
+
+	slog.Info("🚀 Starting Flash Sale Backend...")
 
 	// 1. Initialize Database Connection
-	database.ConnectDB()
+	if err := database.ConnectDB(); err != nil {
+		slog.Error("❌ PostgreSQL connection failed", "error", err)
+		os.Exit(1)
+	}
 
 	// 2. Run Migrations to Create Tables
-	database.CreateTables()
+	if err := database.Migrate(); err != nil {
+		slog.Error("❌ Migrations failed", "error", err)
+		os.Exit(1)
+	}
+
+	// 3. Initialize Redis Connection (seeding writes stock keys)
+	if err := database.ConnectRedis(); err != nil {
+		slog.Error("❌ Redis connection failed", "error", err)
+		os.Exit(1)
+	}
 
-	// 3. Seed Initial Data
+	// 4. Seed Initial Data
 	database.SeedDatabase()
 
-	// 4. Initialize Redis Connection
-	database.ConnectRedis()
+	// Purchases call their Lua scripts by SHA (EVALSHA) from here on
+	handlers.LoadScripts(context.Background())
 
-	r := gin.Default()
+	// Cancelled on Ctrl+C / SIGTERM; background jobs stop with it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// OpenTelemetry: exports spans only when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		slog.Error("❌ Tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	go handlers.RunQueueAdmitter(ctx)
+	go reconcile.Run(ctx)
+	go handlers.RunEventHub(ctx)
+
+	// The order writer drains its queue after ctx is cancelled, so wait for
+	// it before closing the pool
+	orderWriterDone := make(chan struct{})
+	go func() {
+		handlers.RunOrderWriter(ctx)
+		close(orderWriterDone)
+	}()
+	go handlers.RunStockSubscriber(ctx)
+	go handlers.RunLowStockWatcher(ctx)
+
+	// gRPC purchases use the same pools, so wait for that server too
+	grpcDone := make(chan struct{})
+	go func() {
+		grpc.Run(ctx)
+		close(grpcDone)
+	}()
+
+	// A server span per request, request ids + structured request logs
+	// instead of Gin's default logger, and a recovery that counts a panicking
+	// purchase as failed
+	r := gin.New()
+	r.Use(tracing.Middleware(), handlers.RequestID(), handlers.RequestLogger(), handlers.Recovery())
 
 	// CORS for frontend
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://127.0.0.1:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "up",
-			"message": "✅ System is running smoothly",
-		})
-	})
-
-	// Get products
-	r.GET("/products", func(c *gin.Context) {
-		rows, err := database.DB.Query(c, "SELECT id, name, quantity FROM products")
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Database error"})
-			return
-		}
-		defer rows.Close()
-
-		var products []map[string]interface{}
-		for rows.Next() {
-			var id, quantity int
-			var name string
-			rows.Scan(&id, &name, &quantity)
-
-			products = append(products, map[string]interface{}{
-				"id":       id,
-				"name":     name,
-				"quantity": quantity,
-			})
-		}
+	r.Use(cors.New(corsConfig()))
+
+	// gzip for clients that accept it, above GZIP_MIN_BYTES (ENABLE_GZIP)
+	r.Use(handlers.Gzip())
+
+	// Bodies sent to POST/PUT/PATCH must be JSON (415 otherwise)
+	r.Use(handlers.RequireJSON())
 
-		c.JSON(200, products)
-	})
+	// Health checks: /health/live = process up, /health/ready = dependencies reachable
+	r.GET("/health", handlers.Health)
+	r.GET("/health/live", handlers.Live)
+	r.GET("/health/ready", handlers.Ready)
+	r.GET("/openapi.json", handlers.OpenAPI) // OpenAPI 3 spec for clients and generators
+
+	// Sign up, then exchange username/password for a JWT
+	r.POST("/auth/register", handlers.Register)
+	r.POST("/auth/login", handlers.Login)
+
+	// Products
+	r.GET("/products", handlers.ListProducts)
+	r.GET("/products/search", handlers.SearchProducts) // ?q= name match, case-insensitive
+	r.GET("/products/:id", handlers.GetProduct)
+	r.GET("/products/:id/stock", handlers.GetProductStock) // Cheap stock read for polling
+	r.GET("/sale/countdown", handlers.SaleCountdown)       // Server clock + sale window for countdowns
 
 	// ============================================
 	// 🎯 THREE PURCHASE MODES
 	// ============================================
-	r.POST("/purchase", handlers.PurchaseProduct)               // Default (Redis+Postgres)
-	r.POST("/purchase/naive", handlers.PurchaseNaive)           // Mode 1: Naive (Race Condition)
-	r.POST("/purchase/postgres", handlers.PurchasePostgresLock) // Mode 2: PostgreSQL Lock
-	r.POST("/purchase/redis", handlers.PurchaseRedisPostgres)   // Mode 3: Redis + PostgreSQL
+	// Every purchase route counts toward /stats' in_flight, caps the body at
+	// MAX_BODY_BYTES, is rate limited per IP, takes the buyer from the
+	// required Bearer token, honors the waiting-room token, shares the global
+	// sale limit, and honors the Idempotency-Key header (after the limit, so
+	// a throttled 429 isn't stored as the key's answer)
+	purchase := r.Group("/purchase", handlers.InFlight(), handlers.LimitBody(), handlers.RateLimit(), handlers.Authenticate(), handlers.RequireQueueToken(), handlers.GlobalRateLimit(), handlers.Idempotency())
+	purchase.POST("", handlers.PurchaseProduct)                            // Default (Redis+Postgres)
+	purchase.POST("/naive", handlers.PurchaseNaive)                        // Mode 1: Naive (Race Condition)
+	purchase.POST("/postgres", handlers.PurchasePostgresLock)              // Mode 2: PostgreSQL Lock
+	purchase.POST("/postgres-nowait", handlers.PurchasePostgresLockNoWait) // Mode 2 with NOWAIT: fail fast when locked
+	purchase.POST("/redis", handlers.PurchaseRedisPostgres)                // Mode 3: Redis + PostgreSQL
+	purchase.POST("/cart", handlers.PurchaseCart)                          // Several products, all or nothing
+	purchase.POST("/payment", handlers.PurchaseWithPayment)                // Mode 3 plus a payment step that can fail
+	purchase.POST("/fair", handlers.PurchaseFair)                          // Strict arrival order via a Redis sorted set
+	purchase.POST("/serializable", handlers.PurchaseSerializable)          // SERIALIZABLE transaction, retried on 40001
+
+	// Waitlist for sold-out products; restocks notify it in order
+	r.POST("/waitlist", handlers.LimitBody(), handlers.Authenticate(), handlers.JoinWaitlist)
+
+	// Virtual waiting room
+	r.POST("/queue/join", handlers.JoinQueue)
+	r.GET("/queue/status", handlers.QueueStatus)
 
 	// ============================================
 	// 📊 STATS ENDPOINT FOR DASHBOARD
 	// ============================================
-	r.GET("/stats", func(c *gin.Context) {
-		// Get current stock from both DB and Redis
-		var dbStock int
-		database.DB.QueryRow(c, "SELECT quantity FROM products WHERE id=1").Scan(&dbStock)
-
-		redisStock, _ := database.Rdb.Get(c, "product:1:stock").Int()
-
-		// Get order count
-		var orderCount int
-		database.DB.QueryRow(c, "SELECT COUNT(*) FROM orders").Scan(&orderCount)
-
-		stats := handlers.GetStats()
-		stats["db_stock"] = dbStock
-		stats["redis_stock"] = redisStock
-		stats["order_count"] = orderCount
+	r.GET("/stats", handlers.ShowStats)
+	r.POST("/stats/focus", handlers.SetStatsFocus)
+	r.POST("/stats/reset", handlers.ResetStatsOnly) // Counters only; stock and orders stay
+	r.GET("/stats/history", handlers.StatsHistory)  // Runs saved at reset with PERSIST_STATS
+	r.GET("/stats/compare", handlers.CompareStats)  // Modes ranked by avg latency, with a safe flag
+	r.GET("/stats/stream", handlers.StatsStream)    // Server-Sent Events, one snapshot per second
 
-		c.JSON(200, stats)
-	})
+	// Prometheus scrape endpoint
+	r.GET("/metrics", handlers.Metrics)
 
 	// View all orders
-	r.GET("/orders", func(c *gin.Context) {
-		rows, err := database.DB.Query(c, "SELECT id, user_id, product_id, status, created_at FROM orders ORDER BY id DESC LIMIT 100")
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Database error"})
-			return
-		}
-		defer rows.Close()
-
-		var orders []map[string]interface{}
-		for rows.Next() {
-			var id, userID, productID int
-			var status string
-			var createdAt interface{}
-			rows.Scan(&id, &userID, &productID, &status, &createdAt)
-
-			orders = append(orders, map[string]interface{}{
-				"id":         id,
-				"user_id":    userID,
-				"product_id": productID,
-				"status":     status,
-				"created_at": createdAt,
-			})
-		}
+	r.GET("/orders", handlers.ListOrders)
+	r.GET("/orders/summary", handlers.OrdersSummary) // Counts by status, product and minute
+	r.GET("/orders/export", handlers.ExportOrders)   // Download as ?format=csv or json
+	r.GET("/ws/orders", handlers.OrderFeed)          // WebSocket: one event per new order
 
-		c.JSON(200, gin.H{
-			"total_orders": len(orders),
-			"orders":       orders,
-		})
-	})
+	// Fulfilment and cancels (admin token required)
+	r.POST("/orders/:id/status", handlers.RequireAdmin(), handlers.UpdateOrderStatus)
 
 	// Reset everything
-	r.POST("/reset", func(c *gin.Context) {
-		// Reset Postgres
-		_, err := database.DB.Exec(c, "UPDATE products SET quantity = 100 WHERE id = 1")
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to reset DB"})
-			return
-		}
-		database.DB.Exec(c, "DELETE FROM orders")
-
-		// Reset Redis - explicitly set to 100 (fixes any negative values)
-		err = database.Rdb.Set(c, "product:1:stock", 100, 0).Err()
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to reset Redis"})
-			return
-		}
+	r.POST("/reset", handlers.ResetAll)
 
-		// Reset Stats
-		handlers.ResetStats()
+	// Sync Redis with Postgres (useful if Redis gets out of sync)
+	r.POST("/sync-redis", handlers.SyncRedis)
+
+	// Last Redis/Postgres drift check from the background reconciler
+	r.GET("/reconcile/status", handlers.ReconcileStatus)
+
+	// Teaching aid: replays Naive mode's read -> sleep window (read-only)
+	r.GET("/debug/race", handlers.DebugRace)
+
+	// PostgreSQL pool counters for tuning DB_MAX_CONNS (admin token required)
+	r.GET("/debug/pool", handlers.RequireAdmin(), handlers.PoolStats)
+
+	// Demo: fire a burst of purchases from inside the server (admin token required)
+	r.POST("/demo/stampede", handlers.RequireAdmin(), handlers.Stampede)
+
+	// Admin: requires X-Admin-Token matching ADMIN_TOKEN
+	admin := r.Group("/admin", handlers.RequireAdmin())
+	admin.POST("/tokens", handlers.MintTokens) // Bearer tokens for synthetic buyers (load tests)
+	admin.POST("/products", handlers.CreateProduct)
+	admin.POST("/products/:id/stock", handlers.AdjustStock)
+	admin.POST("/products/:id/limit", handlers.SetUserLimit)
+	admin.GET("/redis/:id", handlers.InspectRedis) // Raw stock key, TTL and existence
+	admin.GET("/rate", handlers.GetGlobalRate)
+	admin.POST("/rate", handlers.SetGlobalRate) // Change GLOBAL_SALE_RPS without a restart
+
+	addr := config.ListenAddr()
+	slog.Info("🎯 Server running", "addr", addr)
+	// Listed from the router itself so the banner can't fall behind the routes
+	var routes []string
+	for _, route := range r.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+	slog.Info("📊 Dashboard API ready", "routes", routes, "grpc", "flashsale.v1.PurchaseService/Purchase")
 
-		c.JSON(200, gin.H{"message": "✅ Stock reset to 100, orders cleared, stats reset!"})
-	})
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: r,
+	}
 
-	// Sync Redis with Postgres (useful if Redis gets out of sync)
-	r.POST("/sync-redis", func(c *gin.Context) {
-		var dbStock int
-		err := database.DB.QueryRow(c, "SELECT quantity FROM products WHERE id=1").Scan(&dbStock)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to read DB stock"})
-			return
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("❌ Failed to start server", "error", err)
+			os.Exit(1)
 		}
+	}()
 
-		// Ensure stock is never negative
-		if dbStock < 0 {
-			dbStock = 0
-		}
+	// Wait for Ctrl+C / SIGTERM, then let in-flight purchases finish
+	// before closing the pools they depend on.
+	<-ctx.Done()
 
-		err = database.Rdb.Set(c, "product:1:stock", dbStock, 0).Err()
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to sync Redis"})
-			return
-		}
+	slog.Info("🛑 Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("⚠️ Forced shutdown", "error", err)
+	}
+
+	<-grpcDone
+	<-orderWriterDone
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("⚠️ Failed to flush traces", "error", err)
+	}
+	database.CloseDB()
+	database.CloseRedis()
+	slog.Info("✅ Server stopped")
+}
+
+// corsConfig allows the dashboard origins listed in CORS_ORIGINS (comma
+// separated, default the local dev server). "*" allows any origin, which
+// Gin only permits without credentials.
+func corsConfig() cors.Config {
+	cfg := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "traceparent", "tracestate", "Idempotency-Key", "X-Queue-Token", "If-None-Match", handlers.AdminTokenHeader, handlers.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "ETag", handlers.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}
 
-		c.JSON(200, gin.H{"message": "✅ Redis synced with PostgreSQL", "stock": dbStock})
-	})
-
-	fmt.Println("🎯 Server running on http://localhost:8080")
-	fmt.Println("📊 Dashboard API ready!")
-	fmt.Println("")
-	fmt.Println("Available endpoints:")
-	fmt.Println("  POST /purchase/naive    - Mode 1: Naive (Shows Race Condition)")
-	fmt.Println("  POST /purchase/postgres - Mode 2: PostgreSQL Locking")
-	fmt.Println("  POST /purchase/redis    - Mode 3: Redis + PostgreSQL (Fastest)")
-	fmt.Println("  GET  /stats             - Live statistics")
-	fmt.Println("  POST /reset             - Reset stock to 100")
-
-	if err := r.Run(":8080"); err != nil {
-		fmt.Printf("❌ Failed to start server: %v\n", err)
+	origins := config.List("CORS_ORIGINS", []string{"http://localhost:3000", "http://127.0.0.1:3000"})
+	if slices.Contains(origins, "*") {
+		cfg.AllowAllOrigins = true
+		cfg.AllowCredentials = false
+		return cfg
 	}
+	cfg.AllowOrigins = origins
+	return cfg
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// runMainEnv makes the test binary run main() instead of the tests, so a
+// test can start the real server as a child process and signal it
+const runMainEnv = "FLASH_SALE_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// freePort returns a TCP port nothing is listening on right now
+func freePort(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	return port
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	mr := miniredis.RunT(t)
+	port := freePort(t)
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(),
+		runMainEnv+"=1",
+		"DATABASE_URL="+dsn,
+		"REDIS_HOST="+mr.Host(),
+		"REDIS_PORT="+mr.Port(),
+		"APP_HOST=127.0.0.1",
+		"APP_PORT="+port,
+		"GRPC_PORT=0",
+		"LOG_FORMAT=text",
+	)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	live := "http://127.0.0.1:" + port + "/health/live"
+	for deadline := time.Now().Add(20 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if resp, err := http.Get(live); err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			<-done
+			t.Fatalf("server never came up:\n%s", out.String())
+		}
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("exit: %v\n%s", err, out.String())
+		}
+	case <-time.After(15 * time.Second):
+		cmd.Process.Kill()
+		<-done
+		t.Fatalf("still running 15s after SIGTERM:\n%s", out.String())
+	}
+	for _, want := range []string{"PostgreSQL pool closed", "Redis client closed", "Server stopped"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("shutdown log is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCORSConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         string
+		origins     []string
+		allowAll    bool
+		credentials bool
+	}{
+		{"unset", "", []string{"http://localhost:3000", "http://127.0.0.1:3000"}, false, true},
+		{"list", " https://dash.example.com, https://staging.example.com ,", []string{"https://dash.example.com", "https://staging.example.com"}, false, true},
+		{"wildcard", "*", nil, true, false},
+		{"wildcard in a list", "https://dash.example.com,*", nil, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CORS_ORIGINS", tc.env)
+			cfg := corsConfig()
+			if !slices.Equal(cfg.AllowOrigins, tc.origins) || cfg.AllowAllOrigins != tc.allowAll || cfg.AllowCredentials != tc.credentials {
+				t.Fatalf("origins %q, all %v, credentials %v; want %q, %v, %v",
+					cfg.AllowOrigins, cfg.AllowAllOrigins, cfg.AllowCredentials, tc.origins, tc.allowAll, tc.credentials)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("gin rejects the config: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NOTE: .env is loaded by the godotenv/autoload import in the database package,
+// which runs before main(), so values from backend/.env apply to everything here.
+
+// String returns the env var, or def when it is unset or empty
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Int returns the env var parsed as an int, or def when unset or invalid
+func Int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("⚠️ Invalid value, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+// ListenAddr builds the HTTP listen address from APP_HOST (default: all
+// interfaces) and APP_PORT (default 8080)
+func ListenAddr() string {
+	return net.JoinHostPort(String("APP_HOST", ""), String("APP_PORT", "8080"))
+}
+
+// Bool returns the env var parsed as a bool ("true", "1", ...), or def when unset or invalid
+func Bool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("⚠️ Invalid value, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return b
+}
+
+// Duration returns the env var parsed as a Go duration ("30s", "5m"), or def when unset or invalid
+func Duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("⚠️ Invalid value, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return d
+}
+
+// List returns the env var split on commas with blanks dropped, or def when unset or empty
+func List(key string, def []string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return def
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		host, port string
+		want       string
+	}{
+		{"", "", ":8080"},
+		{"", "9000", ":9000"},
+		{"127.0.0.1", "", "127.0.0.1:8080"},
+		{"127.0.0.1", "9000", "127.0.0.1:9000"},
+		{"::1", "9000", "[::1]:9000"},
+	}
+	for _, tt := range tests {
+		t.Setenv("APP_HOST", tt.host)
+		t.Setenv("APP_PORT", tt.port)
+		if got := ListenAddr(); got != tt.want {
+			t.Errorf("APP_HOST=%q APP_PORT=%q: ListenAddr() = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCatalogFile(t *testing.T) {
+	tests := []struct {
+		name, json string
+		wantErr    string // "" for a valid catalog
+	}{
+		{"valid", `[{"name": "A", "price": 1.5, "quantity": 3}, {"name": "B", "price": 0, "quantity": 0, "max_per_user": 1}]`, ""},
+		{"sale window", `[{"name": "A", "price": 1, "quantity": 1, "sale_start": "2026-01-01T00:00:00Z", "sale_end": "2026-01-02T00:00:00Z"}]`, ""},
+		{"not JSON", `{`, "parse"},
+		{"not an array", `{"name": "A"}`, "parse"},
+		{"no name", `[{"price": 1, "quantity": 1}]`, "product #1 needs a name"},
+		{"negative price", `[{"name": "A", "price": 1, "quantity": 1}, {"name": "B", "price": -1, "quantity": 1}]`, "product #2"},
+		{"negative quantity", `[{"name": "A", "price": 1, "quantity": -1}]`, "product #1"},
+		{"inverted window", `[{"name": "A", "price": 1, "quantity": 1, "sale_start": "2026-01-02T00:00:00Z", "sale_end": "2026-01-01T00:00:00Z"}]`, "sale_end must be after sale_start"},
+		{"negative limit", `[{"name": "A", "price": 1, "quantity": 1, "max_per_user": -1}]`, "max_per_user"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "catalog.json")
+		if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SEED_FILE", path)
+
+		catalog, err := loadCatalog()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr == "" && len(catalog) == 0:
+			t.Errorf("%s: empty catalog", tt.name)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: err = %v, want one mentioning %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	t.Setenv("SEED_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := loadCatalog(); err == nil || !strings.Contains(err.Error(), "read") {
+		t.Errorf("missing file: err = %v, want a read error", err)
+	}
+}
+
+func TestGeneratedCatalog(t *testing.T) {
+	t.Setenv("SEED_FILE", "")
+	SetSeedSize(t, 1, 100)
+	catalog, err := loadCatalog()
+	if err != nil || len(catalog) != 1 || catalog[0].Name != defaultProductName || catalog[0].Quantity != 100 {
+		t.Fatalf("default catalog = %+v, %v; want one %s with 100", catalog, err, defaultProductName)
+	}
+
+	SetSeedSize(t, 5, 20)
+	catalog, err = loadCatalog()
+	if err != nil || len(catalog) != 5 {
+		t.Fatalf("catalog = %+v, %v; want 5 products", catalog, err)
+	}
+	names := map[string]bool{}
+	for _, p := range catalog {
+		if p.Quantity != 20 || p.Price != defaultProductPrice {
+			t.Fatalf("product %+v, want 20 at %v", p, defaultProductPrice)
+		}
+		names[p.Name] = true
+	}
+	if len(names) != 5 {
+		t.Fatalf("names = %v, want 5 distinct", names)
+	}
+
+	for _, size := range [][2]int{{0, 10}, {-1, 10}, {3, -1}} {
+		SetSeedSize(t, size[0], size[1])
+		if _, err := loadCatalog(); err == nil {
+			t.Errorf("count %d, stock %d: no error", size[0], size[1])
+		}
+	}
+}
@@ -2,50 +2,129 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"flash-sale-backend/internal/config"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	_ "github.com/joho/godotenv/autoload" 
+	_ "github.com/joho/godotenv/autoload"
 )
 
-
 var DB *pgxpool.Pool
 
-func ConnectDB() {
+// StatementTimeout is the server-side cap on every statement, set as each
+// connection's statement_timeout (DB_STATEMENT_TIMEOUT_MS; 0 = none)
+var StatementTimeout = time.Duration(config.Int("DB_STATEMENT_TIMEOUT_MS", 0)) * time.Millisecond
+
+// queryCanceled is Postgres SQLSTATE query_canceled, raised by statement_timeout
+const queryCanceled = "57014"
+
+// IsStatementTimeout reports whether err is Postgres cancelling a statement
+// that ran past statement_timeout
+func IsStatementTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == queryCanceled
+}
+
+// ConnectDB creates the global pool and waits for Postgres to answer
+func ConnectDB() error {
 	// 1. Build the connection string (DSN)
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+	dsn, err := postgresDSN()
+	if err != nil {
+		return err
+	}
 
 	// 2. Configure the Pool
-	config, err := pgxpool.ParseConfig(dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		log.Fatalf("❌ Config error: %v\n", err)
+		return fmt.Errorf("parse postgres config: %w", err)
+	}
+	applyPoolSettings(poolConfig)
+	if simDBLatency > 0 {
+		poolConfig.ConnConfig.Tracer = dbLatencyTracer{}
+		slog.Info("🐢 Simulating PostgreSQL latency per query", "latency", simDBLatency)
 	}
+	slog.Info("🏊 Pool", "max_conns", poolConfig.MaxConns, "min_conns", poolConfig.MinConns,
+		"max_conn_lifetime", poolConfig.MaxConnLifetime, "statement_timeout", StatementTimeout)
 
 	// 3. Connect (Create the Pool)
-	conn, err := pgxpool.NewWithConfig(context.Background(), config)
+	conn, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		log.Fatalf("❌ Connection error: %v\n", err)
+		return fmt.Errorf("create postgres pool: %w", err)
+	}
+
+	// 4. Test the connection (Ping), retrying while Postgres starts up
+	if err := pingWithRetry("PostgreSQL", conn.Ping); err != nil {
+		conn.Close()
+		return err
 	}
 
 	DB = conn // Assign to global variable
 
-	// 4. Test the connection (Ping)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	slog.Info("✅ Connected to PostgreSQL successfully!")
+	return nil
+}
 
-	err = DB.Ping(ctx)
-	if err != nil {
-		log.Fatalf("❌ Database unresponsive: %v\n", err)
+// postgresDSN returns DATABASE_URL when set, otherwise assembles the DSN from
+// DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, DB_NAME and DB_SSLMODE (default
+// "disable"; managed Postgres usually wants "require")
+func postgresDSN() (string, error) {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn, nil
 	}
 
-	fmt.Println("✅ Connected to PostgreSQL successfully!")
+	var missing []string
+	for _, key := range []string{"DB_USER", "DB_HOST", "DB_PORT", "DB_NAME"} {
+		if os.Getenv(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("postgres config: set DATABASE_URL or %s", strings.Join(missing, ", "))
+	}
+
+	// url.URL escapes any special characters in the password
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")),
+		Host:     net.JoinHostPort(os.Getenv("DB_HOST"), os.Getenv("DB_PORT")),
+		Path:     os.Getenv("DB_NAME"),
+		RawQuery: url.Values{"sslmode": {config.String("DB_SSLMODE", "disable")}}.Encode(),
+	}
+	return dsn.String(), nil
+}
+
+// applyPoolSettings overrides pgxpool's defaults with DB_MAX_CONNS, DB_MIN_CONNS
+// and DB_MAX_CONN_LIFETIME (a Go duration like "30m") when they are set, and
+// starts every session with DB_STATEMENT_TIMEOUT_MS as its statement_timeout
+func applyPoolSettings(poolConfig *pgxpool.Config) {
+	poolConfig.MaxConns = int32(config.Int("DB_MAX_CONNS", int(poolConfig.MaxConns)))
+	poolConfig.MinConns = int32(config.Int("DB_MIN_CONNS", int(poolConfig.MinConns)))
+	poolConfig.MaxConnLifetime = config.Duration("DB_MAX_CONN_LIFETIME", poolConfig.MaxConnLifetime)
+
+	if poolConfig.MinConns > poolConfig.MaxConns {
+		slog.Warn("⚠️ DB_MIN_CONNS exceeds DB_MAX_CONNS, clamping", "min_conns", poolConfig.MinConns, "max_conns", poolConfig.MaxConns)
+		poolConfig.MinConns = poolConfig.MaxConns
+	}
+
+	if StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(StatementTimeout.Milliseconds(), 10)
+	}
+}
+
+// CloseDB releases every connection in the pool. Safe to call if never connected.
+func CloseDB() {
+	if DB != nil {
+		DB.Close()
+		slog.Info("👋 PostgreSQL pool closed")
+	}
 }
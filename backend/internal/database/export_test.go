@@ -0,0 +1,11 @@
+package database
+
+import "testing"
+
+// SetSeedSize overrides SEED_PRODUCT_COUNT and SEED_PRODUCT_STOCK for the
+// rest of the test; both are read once at startup
+func SetSeedSize(t testing.TB, count, stock int) {
+	prevCount, prevStock := seedProductCount, seedProductStock
+	t.Cleanup(func() { seedProductCount, seedProductStock = prevCount, prevStock })
+	seedProductCount, seedProductStock = count, stock
+}
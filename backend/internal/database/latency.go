@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"flash-sale-backend/internal/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 🐢 SIMULATED NETWORK LATENCY
+// ============================================
+// On a laptop Postgres and Redis answer in microseconds, which hides the
+// difference between modes that make one round trip and modes that make
+// several. SIM_DB_LATENCY_MS / SIM_REDIS_LATENCY_MS add a delay before every
+// query / command (a pipeline counts as one round trip), as if the stores
+// were in another datacenter. The wait gives up as soon as the request's
+// context is done.
+
+var (
+	simDBLatency    = time.Duration(config.Int("SIM_DB_LATENCY_MS", 0)) * time.Millisecond
+	simRedisLatency = time.Duration(config.Int("SIM_REDIS_LATENCY_MS", 0)) * time.Millisecond
+)
+
+// simulateLatency waits d, or until ctx is done
+func simulateLatency(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dbLatencyTracer delays each query. A tracer can't fail the query itself,
+// but pgx sees the same cancelled context right after and gives up.
+type dbLatencyTracer struct{}
+
+func (dbLatencyTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	simulateLatency(ctx, simDBLatency)
+	return ctx
+}
+
+func (dbLatencyTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// redisLatencyHook delays each command and each pipeline
+type redisLatencyHook struct{}
+
+func (redisLatencyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (redisLatencyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := simulateLatency(ctx, simRedisLatency); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (redisLatencyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := simulateLatency(ctx, simRedisLatency); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
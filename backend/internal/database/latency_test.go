@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSimulateLatency(t *testing.T) {
+	start := time.Now()
+	if err := simulateLatency(context.Background(), 30*time.Millisecond); err != nil || time.Since(start) < 30*time.Millisecond {
+		t.Fatalf("waited %s (%v), want 30ms", time.Since(start), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := simulateLatency(ctx, time.Second); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waited %s (%v), want to give up with the context after 20ms", time.Since(start), err)
+	}
+}
+
+// withSimLatency sets SIM_DB_LATENCY_MS / SIM_REDIS_LATENCY_MS for the test
+func withSimLatency(t *testing.T, db, redis time.Duration) {
+	prevDB, prevRedis := simDBLatency, simRedisLatency
+	t.Cleanup(func() { simDBLatency, simRedisLatency = prevDB, prevRedis })
+	simDBLatency, simRedisLatency = db, redis
+}
+
+func TestRedisLatencyHook(t *testing.T) {
+	withSimLatency(t, 0, 40*time.Millisecond)
+	mr := miniredis.RunT(t)
+	prev := Rdb
+	Rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	Rdb.AddHook(redisLatencyHook{})
+	t.Cleanup(func() {
+		Rdb.Close()
+		Rdb = prev
+	})
+	mr.Set(StockKey(1), "5")
+
+	start := time.Now()
+	if stock, err := GetStock(context.Background(), 1); err != nil || stock != 5 {
+		t.Fatalf("GetStock = %d, %v; want 5", stock, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("GetStock took %s, want at least the simulated 40ms", elapsed)
+	}
+
+	// A pipeline is one round trip
+	start = time.Now()
+	_, err := Rdb.Pipelined(context.Background(), func(p redis.Pipeliner) error {
+		for range 3 {
+			p.Get(context.Background(), StockKey(1))
+		}
+		return nil
+	})
+	if elapsed := time.Since(start); err != nil || elapsed < 40*time.Millisecond || elapsed >= 120*time.Millisecond {
+		t.Fatalf("pipeline took %s (%v), want one 40ms delay", elapsed, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Rdb.Set(ctx, StockKey(1), "0", 0).Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v for a cancelled request, want context.Canceled", err)
+	}
+	if got, _ := mr.Get(StockKey(1)); got != "5" {
+		t.Fatalf("stock = %s, want 5: a cancelled command must not run", got)
+	}
+}
+
+func TestDBLatencyTracer(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	withSimLatency(t, 40*time.Millisecond, 0)
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.Tracer = dbLatencyTracer{}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Three queries, three delays
+	start := time.Now()
+	for range 3 {
+		var one int
+		if err := pool.QueryRow(context.Background(), "SELECT 1").Scan(&one); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond {
+		t.Fatalf("3 queries took %s, want at least 3 × 40ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var one int
+	if err := pool.QueryRow(ctx, "SELECT 1").Scan(&one); err == nil {
+		t.Fatal("query ran although its context ended during the simulated delay")
+	}
+}
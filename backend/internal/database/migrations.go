@@ -3,61 +3,186 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+
+	"flash-sale-backend/internal/config"
 )
 
-func CreateTables() {
-	// 1. Define the SQL Queries
-	// We use "IF NOT EXISTS" so it doesn't crash if we run it twice.
-	queries := []string{
-		// Users Table
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) NOT NULL,
-			email VARCHAR(100) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);`,
-
-		// Products Table (The Inventory)
-		// notice "quantity" - this is what we will lock later!
-		// NOTE: No CHECK constraint on quantity - this allows Naive mode to
-		// demonstrate overselling (quantity going negative) to show the danger
-		// of race conditions. In production, you WOULD want this constraint!
-		`CREATE TABLE IF NOT EXISTS products (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(100) NOT NULL,
-			price DECIMAL(10, 2) NOT NULL,
-			quantity INT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);`,
-
-		// Orders Table
-		`CREATE TABLE IF NOT EXISTS orders (
-			id SERIAL PRIMARY KEY,
-			user_id INT,
-			product_id INT REFERENCES products(id),
-			status VARCHAR(20) DEFAULT 'pending',
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);`,
-
-		// Drop CHECK constraint on quantity if it exists (for demo purposes)
-		// This allows Naive mode to show overselling with negative quantity
-		`DO $$ 
-		BEGIN
-			ALTER TABLE products DROP CONSTRAINT IF EXISTS products_quantity_check;
-		EXCEPTION
-			WHEN undefined_object THEN NULL;
-		END $$;`,
+// migration is one schema change. Versions are applied in order and each
+// exactly once; never edit or renumber one that has shipped, add a new one.
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations is the whole schema history. The early ones keep their IF NOT
+// EXISTS so databases created before schema_migrations existed adopt them
+// without errors.
+var migrations = []migration{
+	{1, "create users", `CREATE TABLE IF NOT EXISTS users (
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(50) NOT NULL,
+		email VARCHAR(100) UNIQUE NOT NULL,
+		password_hash VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`},
+
+	// Products Table (The Inventory)
+	// notice "quantity" - this is what we will lock later!
+	// NOTE: No CHECK constraint on quantity - this allows Naive mode to
+	// demonstrate overselling (quantity going negative) to show the danger
+	// of race conditions. In production, you WOULD want this constraint!
+	{2, "create products", `CREATE TABLE IF NOT EXISTS products (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		price DECIMAL(10, 2) NOT NULL,
+		quantity INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`},
+
+	{3, "create orders", `CREATE TABLE IF NOT EXISTS orders (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		product_id INT REFERENCES products(id),
+		status VARCHAR(20) DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`},
+
+	// Stock each product was seeded with, restored by /reset
+	{4, "products initial_quantity", `ALTER TABLE products ADD COLUMN IF NOT EXISTS initial_quantity INT;`},
+
+	// Optional sale window per product; NULL = unbounded on that side
+	{5, "products sale window", `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_start TIMESTAMPTZ;
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_end TIMESTAMPTZ;`},
+
+	// Stats snapshots saved at each reset (PERSIST_STATS)
+	{6, "create stat_runs", `CREATE TABLE IF NOT EXISTS stat_runs (
+		id SERIAL PRIMARY KEY,
+		mode VARCHAR(32) NOT NULL,
+		requests BIGINT NOT NULL,
+		success BIGINT NOT NULL,
+		failed BIGINT NOT NULL,
+		oversells BIGINT NOT NULL,
+		p50_latency_ms DOUBLE PRECISION NOT NULL,
+		p95_latency_ms DOUBLE PRECISION NOT NULL,
+		p99_latency_ms DOUBLE PRECISION NOT NULL,
+		recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`},
+
+	// Units per order row (carts can buy several of one product)
+	{7, "orders quantity", `ALTER TABLE orders ADD COLUMN IF NOT EXISTS quantity INT NOT NULL DEFAULT 1;`},
+
+	// Dead letters: Redis compensations (reservation releases) that failed,
+	// so the key is off by delta until someone re-applies it
+	{8, "create compensation_failures", `CREATE TABLE compensation_failures (
+		id SERIAL PRIMARY KEY,
+		product_id INT NOT NULL,
+		user_id INT NOT NULL,
+		redis_key TEXT NOT NULL,
+		delta INT NOT NULL,
+		error TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`},
+
+	// Per-product cap on units per user; NULL = the global MAX_PER_USER
+	{9, "products max_per_user", `ALTER TABLE products ADD COLUMN max_per_user INT CHECK (max_per_user >= 0);`},
+
+	// orders.created_at was the server's local wall clock with no zone, which
+	// read back as UTC whenever the server's TimeZone wasn't. Existing rows are
+	// taken to be in the zone of the session running the migration.
+	{10, "orders created_at timestamptz", `
+		ALTER TABLE orders
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+			ALTER COLUMN created_at SET DEFAULT NOW();`},
+}
+
+// migrationLockID is the advisory lock that keeps instances starting at the
+// same time from applying a migration twice
+const migrationLockID = 727001
+
+// Migrate applies every migration not yet recorded in schema_migrations,
+// each in its own transaction together with its bookkeeping row, then sets
+// the stock CHECK constraint to match ENFORCE_STOCK_CONSTRAINT.
+func Migrate() error {
+	ctx := context.Background()
+	_, err := DB.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
 	}
 
-	// 2. Execute each query
-	for _, query := range queries {
-		_, err := DB.Exec(context.Background(), query)
+	applied := 0
+	for _, m := range migrations {
+		ok, err := applyMigration(ctx, m)
 		if err != nil {
-			log.Fatalf("❌ Failed to create table: %v\nQuery: %s", err, query)
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if ok {
+			slog.Info("🧱 Applied migration", "version", m.Version, "name", m.Name)
+			applied++
 		}
 	}
 
-	fmt.Println("✅ Database tables checked/created successfully!")
+	// Not a migration: the constraint follows the setting on every start
+	if _, err := DB.Exec(ctx, stockConstraintQuery()); err != nil {
+		return fmt.Errorf("stock constraint: %w", err)
+	}
+
+	slog.Info("✅ Database schema up to date", "version", migrations[len(migrations)-1].Version, "applied", applied)
+	return nil
+}
+
+// applyMigration runs m unless it is already recorded, reporting whether it ran
+func applyMigration(ctx context.Context, m migration) (bool, error) {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return false, err
+	}
+	var done bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=$1)", m.Version).Scan(&done)
+	if err != nil || done {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, m.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// stockConstraintQuery drops the quantity CHECK constraint so Naive mode can
+// show overselling, or with ENFORCE_STOCK_CONSTRAINT=true adds it so the DB
+// itself refuses to go negative. NOT VALID skips rows a past demo already
+// drove negative; every new write is still checked.
+func stockConstraintQuery() string {
+	if config.Bool("ENFORCE_STOCK_CONSTRAINT", false) {
+		return `DO $$
+		BEGIN
+			ALTER TABLE products ADD CONSTRAINT products_quantity_check CHECK (quantity >= 0) NOT VALID;
+		EXCEPTION
+			WHEN duplicate_object THEN NULL;
+		END $$;`
+	}
+
+	// Drop CHECK constraint on quantity if it exists (for demo purposes)
+	// This allows Naive mode to show overselling with negative quantity
+	return `DO $$ 
+		BEGIN
+			ALTER TABLE products DROP CONSTRAINT IF EXISTS products_quantity_check;
+		EXCEPTION
+			WHEN undefined_object THEN NULL;
+		END $$;`
 }
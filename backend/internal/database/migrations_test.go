@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration #%d has version %d, want %d: versions run 1, 2, 3, ...", i+1, m.Version, i+1)
+		}
+		if m.Name == "" || m.SQL == "" {
+			t.Fatalf("migration %d needs a name and SQL", m.Version)
+		}
+	}
+}
+
+// testDB points DB at TEST_DATABASE_URL for the test, skipping without it
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := DB
+	DB = pool
+	t.Cleanup(func() {
+		pool.Close()
+		DB = prev
+	})
+}
+
+func TestMigrateTwice(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	// A migration that fails if it ever runs a second time
+	probe := migration{len(migrations) + 1, "migrate probe", `
+		CREATE TABLE migrate_probe (n INT);
+		INSERT INTO migrate_probe VALUES (1);`}
+	prev := migrations
+	migrations = append(migrations[:len(migrations):len(migrations)], probe)
+	t.Cleanup(func() {
+		migrations = prev
+		DB.Exec(ctx, "DROP TABLE IF EXISTS migrate_probe")
+		DB.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", probe.Version)
+	})
+
+	for run := 1; run <= 2; run++ {
+		if err := Migrate(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	var recorded, rows int
+	if err := DB.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != len(migrations) {
+		t.Fatalf("%d migrations recorded, want each of the %d once", recorded, len(migrations))
+	}
+	if err := DB.QueryRow(ctx, "SELECT COUNT(*) FROM migrate_probe").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Fatalf("probe ran %d times, want once", rows)
+	}
+}
@@ -2,9 +2,15 @@ package database
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"crypto/tls"
+	"log/slog"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/config"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -12,22 +18,105 @@ import (
 // Global Redis Client
 var Rdb *redis.Client
 
-func ConnectRedis() {
+// keyPrefix namespaces every key (and pub/sub channel) this app uses, so a
+// test run can share a Redis server without clobbering real data
+var keyPrefix = strings.TrimSuffix(config.String("REDIS_KEY_PREFIX", ""), ":")
+
+// Key joins parts with ":" under REDIS_KEY_PREFIX, e.g. Key("product", "1", "stock")
+// is "product:1:stock", or "test:product:1:stock" with REDIS_KEY_PREFIX=test
+func Key(parts ...string) string {
+	if keyPrefix != "" {
+		parts = append([]string{keyPrefix}, parts...)
+	}
+	return strings.Join(parts, ":")
+}
+
+// redisOptions builds the client options from REDIS_* env vars. Managed
+// Redis (ElastiCache, Upstash, ...) usually needs REDIS_PASSWORD and
+// REDIS_TLS=true; the docker-compose Redis needs neither.
+func redisOptions() *redis.Options {
+	host := os.Getenv("REDIS_HOST")
+	opts := &redis.Options{
+		Addr:     net.JoinHostPort(host, os.Getenv("REDIS_PORT")),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       config.Int("REDIS_DB", 0),
+	}
+	if config.Bool("REDIS_TLS", false) {
+		opts.TLSConfig = &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return opts
+}
+
+// ConnectRedis creates the global client and waits for Redis to answer
+func ConnectRedis() error {
 	// 1. Configure the client
-	dsn := fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))
-	
-	Rdb = redis.NewClient(&redis.Options{
-		Addr: dsn, 
-		// No password set in docker-compose, so empty string
-		Password: "", 
-		DB:       0,  // Default DB
-	})
+	opts := redisOptions()
+	Rdb = redis.NewClient(opts)
+	if simRedisLatency > 0 {
+		Rdb.AddHook(redisLatencyHook{})
+		slog.Info("🐢 Simulating Redis latency per command", "latency", simRedisLatency)
+	}
+	slog.Info("🔌 Redis", "addr", opts.Addr, "db", opts.DB, "tls", opts.TLSConfig != nil)
 
-	// 2. Test Connection (Ping)
-	_, err := Rdb.Ping(context.Background()).Result()
+	// 2. Test Connection (Ping), retrying while Redis starts up
+	err := pingWithRetry("Redis", func(ctx context.Context) error {
+		return Rdb.Ping(ctx).Err()
+	})
 	if err != nil {
-		log.Fatalf("❌ Redis connection failed: %v", err)
+		return err
+	}
+
+	slog.Info("⚡ Connected to Redis successfully!")
+	return nil
+}
+
+// StockKey returns the Redis key holding the live stock counter for a product
+func StockKey(productID int) string {
+	return Key("product", strconv.Itoa(productID), "stock")
+}
+
+// StockKeyTTL is how long a seeded stock key lives (STOCK_KEY_TTL_SEC; 0, the
+// default, never expires). For short sales the key then disappears on its own
+// and GetStock / REDIS_AUTO_SEED-style reloads bring it back from PostgreSQL.
+var StockKeyTTL = time.Duration(config.Int("STOCK_KEY_TTL_SEC", 0)) * time.Second
+
+// GetStock reads a product's Redis stock. When the key has expired (only
+// possible with STOCK_KEY_TTL_SEC) it is reloaded from PostgreSQL with SETNX,
+// so of many concurrent readers only the first write lands and the rest read
+// it back. Returns redis.Nil for a missing key when no TTL is configured, and
+// pgx.ErrNoRows if the product doesn't exist.
+func GetStock(ctx context.Context, productID int) (int, error) {
+	key := StockKey(productID)
+	stock, err := Rdb.Get(ctx, key).Int()
+	if err != redis.Nil || StockKeyTTL == 0 {
+		return stock, err
+	}
+
+	var quantity int
+	if err := DB.QueryRow(ctx, "SELECT quantity FROM products WHERE id=$1", productID).Scan(&quantity); err != nil {
+		return 0, err
+	}
+	if err := Rdb.SetNX(ctx, key, max(quantity, 0), StockKeyTTL).Err(); err != nil {
+		return 0, err
+	}
+	return Rdb.Get(ctx, key).Int()
+}
+
+// CloseRedis closes the Redis client. Safe to call if never connected.
+func CloseRedis() {
+	if Rdb != nil {
+		if err := Rdb.Close(); err != nil {
+			slog.Warn("⚠️ Failed to close Redis", "error", err)
+			return
+		}
+		slog.Info("👋 Redis client closed")
 	}
+}
 
-	fmt.Println("⚡ Connected to Redis successfully!")
-}
\ No newline at end of file
+// UserPurchaseKey returns the Redis key counting a user's purchases of a product
+func UserPurchaseKey(userID, productID int) string {
+	return Key("user", strconv.Itoa(userID), "product", strconv.Itoa(productID), "count")
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestConnectRedisUnreachable(t *testing.T) {
+	t.Setenv("REDIS_HOST", "127.0.0.1")
+	t.Setenv("REDIS_PORT", "1")
+	t.Setenv("DB_CONNECT_RETRIES", "2")
+	t.Setenv("DB_CONNECT_BACKOFF_MS", "1")
+	prev := Rdb
+	t.Cleanup(func() {
+		CloseRedis()
+		Rdb = prev
+	})
+
+	err := ConnectRedis()
+	if err == nil || !strings.Contains(err.Error(), "Redis unreachable after 2 attempts") {
+		t.Fatalf("err = %v, want Redis unreachable after 2 attempts", err)
+	}
+}
+
+// withKeyPrefix sets REDIS_KEY_PREFIX's value for the test
+func withKeyPrefix(t *testing.T, prefix string) {
+	t.Helper()
+	prev := keyPrefix
+	keyPrefix = prefix
+	t.Cleanup(func() { keyPrefix = prev })
+}
+
+func TestKeyPrefix(t *testing.T) {
+	withKeyPrefix(t, "")
+	if got := StockKey(1); got != "product:1:stock" {
+		t.Fatalf("StockKey(1) = %q without a prefix", got)
+	}
+
+	withKeyPrefix(t, "test")
+	for got, want := range map[string]string{
+		StockKey(1):              "test:product:1:stock",
+		UserPurchaseKey(7, 1):    "test:user:7:product:1:count",
+		Key("queue", "1", "seq"): "test:queue:1:seq",
+		Key():                    "test",
+	} {
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestGetStockUsesPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	prev := Rdb
+	Rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		Rdb.Close()
+		Rdb = prev
+	})
+	withKeyPrefix(t, "test")
+	mr.Set("product:1:stock", "100") // someone else's live data
+	mr.Set("test:product:1:stock", "3")
+
+	if stock, err := GetStock(context.Background(), 1); err != nil || stock != 3 {
+		t.Fatalf("GetStock = %d, %v; want the prefixed key's 3", stock, err)
+	}
+	if _, err := GetStock(context.Background(), 2); err != redis.Nil {
+		t.Fatalf("err = %v for a product with no prefixed key, want redis.Nil", err)
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	t.Setenv("REDIS_HOST", "cache.example.com")
+	t.Setenv("REDIS_PORT", "6380")
+	t.Setenv("REDIS_PASSWORD", "s3cret")
+	t.Setenv("REDIS_DB", "2")
+	t.Setenv("REDIS_TLS", "true")
+
+	opts := redisOptions()
+	if opts.Addr != "cache.example.com:6380" || opts.Password != "s3cret" || opts.DB != 2 {
+		t.Fatalf("addr %q, password %q, db %d", opts.Addr, opts.Password, opts.DB)
+	}
+	if opts.TLSConfig == nil || opts.TLSConfig.ServerName != "cache.example.com" || opts.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("TLS config = %+v, want TLS 1.2+ for cache.example.com", opts.TLSConfig)
+	}
+}
+
+func TestRedisOptionsDefaults(t *testing.T) {
+	t.Setenv("REDIS_HOST", "localhost")
+	t.Setenv("REDIS_PORT", "6379")
+	t.Setenv("REDIS_PASSWORD", "")
+	t.Setenv("REDIS_DB", "")
+	t.Setenv("REDIS_TLS", "")
+
+	opts := redisOptions()
+	if opts.Password != "" || opts.DB != 0 || opts.TLSConfig != nil {
+		t.Fatalf("password %q, db %d, TLS %v; want none of them for a local Redis", opts.Password, opts.DB, opts.TLSConfig)
+	}
+}
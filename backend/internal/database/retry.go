@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"flash-sale-backend/internal/config"
+)
+
+// pingWithRetry calls ping up to DB_CONNECT_RETRIES times (default 5), doubling
+// the wait from DB_CONNECT_BACKOFF_MS (default 500) after each failure. This
+// lets the backend ride out docker-compose starting Postgres/Redis after it.
+func pingWithRetry(name string, ping func(ctx context.Context) error) error {
+	attempts := max(config.Int("DB_CONNECT_RETRIES", 5), 1)
+	backoff := time.Duration(config.Int("DB_CONNECT_BACKOFF_MS", 500)) * time.Millisecond
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if attempt < attempts {
+			slog.Warn("⏳ Not ready, retrying", "service", name, "attempt", attempt, "attempts", attempts, "backoff", backoff, "error", err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("%s unreachable after %d attempts: %w", name, attempts, err)
+}
@@ -2,52 +2,197 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"flash-sale-backend/internal/config"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// SeedProduct is one entry of the seed catalog (see SEED_FILE)
+type SeedProduct struct {
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+
+	// Optional sale window (RFC 3339); omit for always on
+	SaleStart *time.Time `json:"sale_start,omitempty"`
+	SaleEnd   *time.Time `json:"sale_end,omitempty"`
+
+	// Optional cap on units per user (0 = none); omit for MAX_PER_USER
+	MaxPerUser *int `json:"max_per_user,omitempty"`
+}
+
+// seedUserEmail identifies the seeded test user (log in as testuser)
+const seedUserEmail = "test@example.com"
+
+// Without SEED_FILE, SEED_PRODUCT_COUNT products are generated with
+// SEED_PRODUCT_STOCK each; the defaults give the classic 100 iPhones at $999
+var (
+	seedProductCount = config.Int("SEED_PRODUCT_COUNT", 1)
+	seedProductStock = config.Int("SEED_PRODUCT_STOCK", 100)
+)
+
+const (
+	defaultProductName  = "iPhone 15 Pro"
+	defaultProductPrice = 999.00
+)
+
+// generatedCatalog builds count identical products for benchmarking,
+// numbered when there is more than one
+func generatedCatalog(count, stock int) ([]SeedProduct, error) {
+	if count < 1 || stock < 0 {
+		return nil, fmt.Errorf("SEED_PRODUCT_COUNT must be at least 1 and SEED_PRODUCT_STOCK non-negative (got %d, %d)", count, stock)
+	}
+	if count == 1 {
+		return []SeedProduct{{Name: defaultProductName, Price: defaultProductPrice, Quantity: stock}}, nil
+	}
+
+	catalog := make([]SeedProduct, count)
+	for i := range catalog {
+		catalog[i] = SeedProduct{
+			Name:     fmt.Sprintf("%s #%d", defaultProductName, i+1),
+			Price:    defaultProductPrice,
+			Quantity: stock,
+		}
+	}
+	return catalog, nil
+}
+
+// loadCatalog reads the products to seed from the JSON array at SEED_FILE,
+// falling back to SEED_PRODUCT_COUNT generated products.
+func loadCatalog() ([]SeedProduct, error) {
+	path := os.Getenv("SEED_FILE")
+	if path == "" {
+		return generatedCatalog(seedProductCount, seedProductStock)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var catalog []SeedProduct
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for i, p := range catalog {
+		if p.Name == "" || p.Price < 0 || p.Quantity < 0 {
+			return nil, fmt.Errorf("%s: product #%d needs a name and non-negative price/quantity", path, i+1)
+		}
+		if p.SaleStart != nil && p.SaleEnd != nil && !p.SaleEnd.After(*p.SaleStart) {
+			return nil, fmt.Errorf("%s: product #%d sale_end must be after sale_start", path, i+1)
+		}
+		if p.MaxPerUser != nil && *p.MaxPerUser < 0 {
+			return nil, fmt.Errorf("%s: product #%d max_per_user can't be negative", path, i+1)
+		}
+	}
+	return catalog, nil
+}
+
+// seedTestUser makes sure the test user exists with a bcrypt hash of
+// SEED_USER_PASSWORD (default "password"). It runs on every start: a missing
+// user is created, and a row left over from older seeds with a plaintext
+// password_hash is re-hashed. A row that already holds a bcrypt hash is left
+// alone, so a changed SEED_USER_PASSWORD doesn't overwrite it.
+func seedTestUser() {
+	var existing string
+	err := DB.QueryRow(context.Background(),
+		"SELECT password_hash FROM users WHERE email = $1", seedUserEmail).Scan(&existing)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.Warn("⚠️ Failed to check test user", "error", err)
+		return
+	}
+	if err == nil {
+		if _, costErr := bcrypt.Cost([]byte(existing)); costErr == nil {
+			return
+		}
+	}
+
+	password := os.Getenv("SEED_USER_PASSWORD")
+	if password == "" {
+		password = "password"
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		_, err = CreateUser(context.Background(), "testuser", seedUserEmail, password)
+		if errors.Is(err, ErrEmailTaken) {
+			return // another instance seeded it first
+		}
+		if err != nil {
+			slog.Error("❌ Failed to seed user", "error", err)
+			return
+		}
+		slog.Info("👤 Seeded test user", "username", "testuser")
+		return
+	}
+
+	// Pre-bcrypt row: replace the plaintext hash
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("❌ Failed to hash seed password", "error", err)
+		return
+	}
+	_, err = DB.Exec(context.Background(),
+		"UPDATE users SET password_hash = $2 WHERE email = $1", seedUserEmail, string(hash))
+	if err != nil {
+		slog.Error("❌ Failed to re-hash test user", "error", err)
+		return
+	}
+	slog.Info("👤 Re-hashed test user's password", "username", "testuser")
+}
+
 func SeedDatabase() {
+	// The test user is checked on every start so old plaintext rows get hashed
+	seedTestUser()
+
 	// 1. Check if we already have a product (Idempotency)
 	// We don't want to add a new iPhone every time we restart the server!
 	var count int
 	err := DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM products").Scan(&count)
 	if err != nil {
-		log.Printf("⚠️ Failed to check product count: %v", err)
+		slog.Warn("⚠️ Failed to check product count", "error", err)
 		return
 	}
 
 	// 2. If data exists, skip seeding
 	if count > 0 {
-		fmt.Println("ℹ️ Database already seeded. Skipping...")
+		slog.Info("ℹ️ Database already seeded. Skipping...")
 		return
 	}
 
-	// 3. Insert a Test User
-	// We insert a user with ID 1 so we can use it for testing later
-	_, err = DB.Exec(context.Background(), `
-		INSERT INTO users (username, email, password_hash) 
-		VALUES ('testuser', 'test@example.com', 'hashed_secret_password');
-	`)
+	catalog, err := loadCatalog()
 	if err != nil {
-		log.Printf("❌ Failed to seed user: %v", err)
+		slog.Error("❌ Failed to load seed catalog", "error", err)
+		return
 	}
 
-	// 4. Insert the "Flash Sale" Product
-	// 100 iPhones available. Price $999.
-	_, err = DB.Exec(context.Background(), `
-		INSERT INTO products (name, price, quantity) 
-		VALUES ('iPhone 15 Pro', 999.00, 100);
-	`)
-	if err != nil {
-		log.Printf("❌ Failed to seed product: %v", err)
-	}
+	// 3. Insert the "Flash Sale" Products, mirroring each one's stock into Redis
+	for _, p := range catalog {
+		var id int
+		err = DB.QueryRow(context.Background(),
+			`INSERT INTO products (name, price, quantity, initial_quantity, sale_start, sale_end, max_per_user)
+			VALUES ($1, $2, $3, $3, $4, $5, $6) RETURNING id`,
+			p.Name, p.Price, p.Quantity, p.SaleStart, p.SaleEnd, p.MaxPerUser).Scan(&id)
+		if err != nil {
+			slog.Error("❌ Failed to seed product", "name", p.Name, "error", err)
+			continue
+		}
 
-	err = Rdb.Set(context.Background(), "product:1:stock", 100, 0).Err()
-	if err != nil {
-		log.Printf("❌ Failed to seed Redis: %v", err)
-	} else {
-		fmt.Println("⚡ Redis cache seeded with 100 stock!")
+		err = Rdb.Set(context.Background(), StockKey(id), p.Quantity, StockKeyTTL).Err()
+		if err != nil {
+			slog.Error("❌ Failed to seed Redis", "name", p.Name, "error", err)
+			continue
+		}
+		slog.Info("⚡ Seeded product", "product_id", id, "name", p.Name, "stock", p.Quantity)
 	}
 
-	fmt.Println("🌱 Database seeded successfully with 100 iPhones!")
+	slog.Info("🌱 Database seeded successfully!", "products", len(catalog))
 }
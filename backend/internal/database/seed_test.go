@@ -0,0 +1,167 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// seedProduct is a seeded product row
+type seedProduct struct {
+	id              int
+	name            string
+	price           float64
+	quantity        int
+	initialQuantity int
+}
+
+// seededProducts reads back every product, in id order
+func seededProducts(t *testing.T) []seedProduct {
+	t.Helper()
+	rows, err := database.DB.Query(context.Background(),
+		"SELECT id, name, price::float8, quantity, initial_quantity FROM products ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []seedProduct
+	for rows.Next() {
+		var p seedProduct
+		if err := rows.Scan(&p.id, &p.name, &p.price, &p.quantity, &p.initialQuantity); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSeedFromFile(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	catalog := `[
+		{"name": "Console", "price": 499.99, "quantity": 20},
+		{"name": "Headphones", "price": 79.5, "quantity": 0}
+	]`
+	if err := os.WriteFile(path, []byte(catalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SEED_FILE", path)
+
+	database.SeedDatabase()
+	want := []seedProduct{
+		{1, "Console", 499.99, 20, 20},
+		{2, "Headphones", 79.5, 0, 0},
+	}
+	got := seededProducts(t)
+	if len(got) != len(want) {
+		t.Fatalf("seeded %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("product %d = %+v, want %+v", i+1, got[i], want[i])
+		}
+		stock, err := mr.Get(database.StockKey(want[i].id))
+		if err != nil || stock != strconv.Itoa(want[i].quantity) {
+			t.Fatalf("Redis stock of %s = %q (%v), want %d", want[i].name, stock, err, want[i].quantity)
+		}
+	}
+
+	// Seeding again is a no-op
+	database.SeedDatabase()
+	if n := len(seededProducts(t)); n != 2 {
+		t.Fatalf("%d products after a second seed, want 2", n)
+	}
+}
+
+func TestSeedBadFileSeedsNothing(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "", "price": 1, "quantity": 1}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SEED_FILE", path)
+
+	database.SeedDatabase()
+	if got := seededProducts(t); len(got) != 0 {
+		t.Fatalf("seeded %+v from an invalid catalog, want nothing", got)
+	}
+}
+
+func TestSeedGeneratedProducts(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	t.Setenv("SEED_FILE", "")
+	database.SetSeedSize(t, 5, 20)
+
+	database.SeedDatabase()
+	database.SeedDatabase() // idempotent
+	got := seededProducts(t)
+	if len(got) != 5 {
+		t.Fatalf("seeded %+v, want 5 products", got)
+	}
+	for _, p := range got {
+		if p.quantity != 20 || p.initialQuantity != 20 {
+			t.Fatalf("product %+v, want 20 in stock", p)
+		}
+		if stock, err := mr.Get(database.StockKey(p.id)); err != nil || stock != "20" {
+			t.Fatalf("Redis stock of %s = %q (%v), want 20", p.name, stock, err)
+		}
+	}
+}
+
+// testUserHash reads the seeded test user's password_hash
+func testUserHash(t *testing.T) string {
+	t.Helper()
+	var hash string
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT password_hash FROM users WHERE username = 'testuser'").Scan(&hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestSeedUserPassword(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	t.Setenv("SEED_USER_PASSWORD", "hunter2")
+
+	database.SeedDatabase()
+	hash := testUserHash(t)
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("hunter2")); err != nil {
+		t.Fatalf("stored hash doesn't match SEED_USER_PASSWORD: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("password")) == nil {
+		t.Fatal("stored hash matches the default password")
+	}
+
+	// Seeding again keeps the hash
+	database.SeedDatabase()
+	if again := testUserHash(t); again != hash {
+		t.Fatal("a second seed replaced the password hash")
+	}
+
+	// A row from before hashing is upgraded in place
+	if _, err := database.DB.Exec(context.Background(),
+		"UPDATE users SET password_hash = 'hashed_secret_password' WHERE username = 'testuser'"); err != nil {
+		t.Fatal(err)
+	}
+	database.SeedDatabase()
+	if err := bcrypt.CompareHashAndPassword([]byte(testUserHash(t)), []byte("hunter2")); err != nil {
+		t.Fatalf("plaintext row wasn't re-hashed: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// withStockKeyTTL sets STOCK_KEY_TTL_SEC's value for the test
+func withStockKeyTTL(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	prev := database.StockKeyTTL
+	database.StockKeyTTL = ttl
+	t.Cleanup(func() { database.StockKeyTTL = prev })
+}
+
+func TestGetStockReloadsExpiredKey(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	withStockKeyTTL(t, 2*time.Second)
+	productID := testutil.Product(t, "Ephemeral", 10)
+	key := database.StockKey(productID)
+	mr.Set(key, "4") // Redis is ahead of PostgreSQL mid-sale
+	mr.SetTTL(key, database.StockKeyTTL)
+
+	ctx := context.Background()
+	if stock, err := database.GetStock(ctx, productID); err != nil || stock != 4 {
+		t.Fatalf("GetStock = %d, %v; want the live key's 4", stock, err)
+	}
+
+	// Once the key expires, the next read reloads it from PostgreSQL
+	if _, err := database.DB.Exec(ctx, "UPDATE products SET quantity = 7 WHERE id = $1", productID); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(3 * time.Second)
+	if mr.Exists(key) {
+		t.Fatal("key outlived its TTL")
+	}
+	if stock, err := database.GetStock(ctx, productID); err != nil || stock != 7 {
+		t.Fatalf("GetStock = %d, %v; want 7 reloaded from PostgreSQL", stock, err)
+	}
+	if got, _ := mr.Get(key); got != "7" || mr.TTL(key) != database.StockKeyTTL {
+		t.Fatalf("reloaded key = %s with TTL %s, want 7 with %s", got, mr.TTL(key), database.StockKeyTTL)
+	}
+
+	// An oversold product reloads as 0, never negative
+	if _, err := database.DB.Exec(ctx, "UPDATE products SET quantity = -3 WHERE id = $1", productID); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(3 * time.Second)
+	if stock, err := database.GetStock(ctx, productID); err != nil || stock != 0 {
+		t.Fatalf("GetStock = %d, %v; want 0", stock, err)
+	}
+}
+
+func TestGetStockWithoutTTL(t *testing.T) {
+	mr := testutil.Redis(t)
+	withStockKeyTTL(t, 0)
+	mr.Set(database.StockKey(1), "5")
+
+	// No DB needed: without a TTL a missing key is just missing
+	if stock, err := database.GetStock(context.Background(), 1); err != nil || stock != 5 {
+		t.Fatalf("GetStock = %d, %v; want 5", stock, err)
+	}
+	if _, err := database.GetStock(context.Background(), 2); err != redis.Nil {
+		t.Fatalf("err = %v, want redis.Nil", err)
+	}
+}
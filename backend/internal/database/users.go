@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrEmailTaken means a user with that email already exists
+var ErrEmailTaken = errors.New("email already registered")
+
+// uniqueViolation is the Postgres SQLSTATE for a UNIQUE constraint conflict
+const uniqueViolation = "23505"
+
+// CreateUser inserts a user with a bcrypt hash of password and returns its id.
+// The email column is UNIQUE; a conflict comes back as ErrEmailTaken rather
+// than a raw driver error.
+func CreateUser(ctx context.Context, username, email, password string) (int, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = DB.QueryRow(ctx,
+		"INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id",
+		username, email, string(hash)).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return 0, ErrEmailTaken
+	}
+	return id, err
+}
@@ -0,0 +1,204 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: proto/flashsale/v1/purchase.proto
+
+package flashsalepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// PurchaseRequest is one purchase; quantity defaults to 1.
+type PurchaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int32                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ProductId     int32                  `protobuf:"varint,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseRequest) Reset() {
+	*x = PurchaseRequest{}
+	mi := &file_proto_flashsale_v1_purchase_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseRequest) ProtoMessage() {}
+
+func (x *PurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flashsale_v1_purchase_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseRequest.ProtoReflect.Descriptor instead.
+func (*PurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_flashsale_v1_purchase_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PurchaseRequest) GetUserId() int32 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *PurchaseRequest) GetProductId() int32 {
+	if x != nil {
+		return x.ProductId
+	}
+	return 0
+}
+
+func (x *PurchaseRequest) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+// PurchaseResponse is a completed purchase.
+type PurchaseResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	OrderId int32                  `protobuf:"varint,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	// Stock left in PostgreSQL after this purchase.
+	Remaining     int32 `protobuf:"varint,2,opt,name=remaining,proto3" json:"remaining,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseResponse) Reset() {
+	*x = PurchaseResponse{}
+	mi := &file_proto_flashsale_v1_purchase_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseResponse) ProtoMessage() {}
+
+func (x *PurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flashsale_v1_purchase_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseResponse.ProtoReflect.Descriptor instead.
+func (*PurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_flashsale_v1_purchase_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PurchaseResponse) GetOrderId() int32 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *PurchaseResponse) GetRemaining() int32 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
+var File_proto_flashsale_v1_purchase_proto protoreflect.FileDescriptor
+
+const file_proto_flashsale_v1_purchase_proto_rawDesc = "" +
+	"\n" +
+	"!proto/flashsale/v1/purchase.proto\x12\fflashsale.v1\"e\n" +
+	"\x0fPurchaseRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x05R\x06userId\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x02 \x01(\x05R\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\x05R\bquantity\"K\n" +
+	"\x10PurchaseResponse\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\x05R\aorderId\x12\x1c\n" +
+	"\tremaining\x18\x02 \x01(\x05R\tremaining2\\\n" +
+	"\x0fPurchaseService\x12I\n" +
+	"\bPurchase\x12\x1d.flashsale.v1.PurchaseRequest\x1a\x1e.flashsale.v1.PurchaseResponseB.Z,flash-sale-backend/internal/grpc/flashsalepbb\x06proto3"
+
+var (
+	file_proto_flashsale_v1_purchase_proto_rawDescOnce sync.Once
+	file_proto_flashsale_v1_purchase_proto_rawDescData []byte
+)
+
+func file_proto_flashsale_v1_purchase_proto_rawDescGZIP() []byte {
+	file_proto_flashsale_v1_purchase_proto_rawDescOnce.Do(func() {
+		file_proto_flashsale_v1_purchase_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_flashsale_v1_purchase_proto_rawDesc), len(file_proto_flashsale_v1_purchase_proto_rawDesc)))
+	})
+	return file_proto_flashsale_v1_purchase_proto_rawDescData
+}
+
+var file_proto_flashsale_v1_purchase_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_flashsale_v1_purchase_proto_goTypes = []any{
+	(*PurchaseRequest)(nil),  // 0: flashsale.v1.PurchaseRequest
+	(*PurchaseResponse)(nil), // 1: flashsale.v1.PurchaseResponse
+}
+var file_proto_flashsale_v1_purchase_proto_depIdxs = []int32{
+	0, // 0: flashsale.v1.PurchaseService.Purchase:input_type -> flashsale.v1.PurchaseRequest
+	1, // 1: flashsale.v1.PurchaseService.Purchase:output_type -> flashsale.v1.PurchaseResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_flashsale_v1_purchase_proto_init() }
+func file_proto_flashsale_v1_purchase_proto_init() {
+	if File_proto_flashsale_v1_purchase_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_flashsale_v1_purchase_proto_rawDesc), len(file_proto_flashsale_v1_purchase_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_flashsale_v1_purchase_proto_goTypes,
+		DependencyIndexes: file_proto_flashsale_v1_purchase_proto_depIdxs,
+		MessageInfos:      file_proto_flashsale_v1_purchase_proto_msgTypes,
+	}.Build()
+	File_proto_flashsale_v1_purchase_proto = out.File
+	file_proto_flashsale_v1_purchase_proto_goTypes = nil
+	file_proto_flashsale_v1_purchase_proto_depIdxs = nil
+}
@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/grpc/flashsalepb"
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/service"
+
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ============================================
+// 📡 gRPC PURCHASE SERVICE
+// ============================================
+// flashsale.v1.PurchaseService (proto/flashsale/v1/purchase.proto) sells
+// through service.Purchase, the same Redis + PostgreSQL path as
+// POST /purchase/redis, and is counted in /stats under that mode. The HTTP
+// middleware (rate limits, waiting room, idempotency, circuit breaker) does
+// not apply here.
+
+// requestTimeout caps each RPC the way REQUEST_TIMEOUT_MS caps HTTP purchases
+var requestTimeout = time.Duration(config.Int("REQUEST_TIMEOUT_MS", 3000)) * time.Millisecond
+
+// maxQuantity matches the HTTP PurchaseRequest's binding
+const maxQuantity = 100
+
+type purchaseServer struct {
+	flashsalepb.UnimplementedPurchaseServiceServer
+}
+
+// Purchase validates the request like the HTTP binding does, then sells
+func (purchaseServer) Purchase(ctx context.Context, req *flashsalepb.PurchaseRequest) (*flashsalepb.PurchaseResponse, error) {
+	quantity := int(req.GetQuantity())
+	if quantity == 0 {
+		quantity = 1
+	}
+	if req.GetUserId() < 1 || req.GetProductId() < 1 || quantity < 1 || quantity > maxQuantity {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"user_id and product_id must be positive, quantity between 1 and %d", maxQuantity)
+	}
+	userID, productID := int(req.GetUserId()), int(req.GetProductId())
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	res, err := service.Purchase(ctx, userID, productID, quantity)
+	handlers.RecordPurchase(userID, productID, quantity, res, err, time.Since(start))
+	if err != nil {
+		return nil, purchaseStatus(ctx, err)
+	}
+	return &flashsalepb.PurchaseResponse{
+		OrderId:   int32(res.OrderID),
+		Remaining: int32(res.Remaining),
+	}, nil
+}
+
+// purchaseStatus maps a service.Purchase error to a gRPC status
+func purchaseStatus(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	var closed *service.SaleClosedError
+	var limitErr *service.UserLimitError
+	switch {
+	case database.IsStatementTimeout(err):
+		return status.Error(codes.DeadlineExceeded, "Database query timed out")
+	case errors.As(err, &closed):
+		return status.Error(codes.FailedPrecondition, closed.Error())
+	case errors.Is(err, service.ErrSoldOut):
+		return status.Error(codes.FailedPrecondition, "Out of stock!")
+	case errors.As(err, &limitErr):
+		return status.Errorf(codes.ResourceExhausted, "Purchase limit of %d per user reached", limitErr.Limit)
+	case errors.Is(err, service.ErrProductNotFound):
+		return status.Error(codes.NotFound, "Product not found")
+	}
+
+	slog.Error("❌ gRPC purchase failed", "error", err)
+	return status.Error(codes.Internal, "Purchase failed")
+}
+
+// NewServer returns a gRPC server with PurchaseService registered
+func NewServer() *grpcgo.Server {
+	srv := grpcgo.NewServer()
+	flashsalepb.RegisterPurchaseServiceServer(srv, purchaseServer{})
+	return srv
+}
+
+// Run serves gRPC on GRPC_PORT (default 9090, 0 disables) until ctx is
+// cancelled, then lets in-flight RPCs finish. Like the HTTP server it listens
+// on APP_HOST.
+func Run(ctx context.Context) {
+	port := config.Int("GRPC_PORT", 9090)
+	if port <= 0 {
+		slog.Info("ℹ️ gRPC server disabled")
+		return
+	}
+
+	addr := net.JoinHostPort(config.String("APP_HOST", ""), fmt.Sprint(port))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("❌ gRPC listen failed", "addr", addr, "error", err)
+		return
+	}
+
+	srv := NewServer()
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	slog.Info("📡 gRPC server running", "addr", addr)
+	if err := srv.Serve(lis); err != nil {
+		slog.Error("❌ gRPC server stopped", "error", err)
+	}
+}
@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/grpc/flashsalepb"
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves NewServer over an in-process bufconn listener and returns a
+// client connected to it
+func dial(t *testing.T) flashsalepb.PurchaseServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpcgo.NewClient("passthrough:///bufnet",
+		grpcgo.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpcgo.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return flashsalepb.NewPurchaseServiceClient(conn)
+}
+
+func TestPurchaseInvalidArgument(t *testing.T) {
+	client := dial(t)
+	for _, req := range []*flashsalepb.PurchaseRequest{
+		{UserId: 0, ProductId: 1},
+		{UserId: 1, ProductId: 0},
+		{UserId: 1, ProductId: 1, Quantity: -1},
+		{UserId: 1, ProductId: 1, Quantity: maxQuantity + 1},
+	} {
+		_, err := client.Purchase(t.Context(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: err = %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+func TestPurchaseStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{service.ErrSoldOut, codes.FailedPrecondition},
+		{&service.SaleClosedError{At: time.Now().Add(time.Hour)}, codes.FailedPrecondition},
+		{&service.UserLimitError{Limit: 2}, codes.ResourceExhausted},
+		{fmt.Errorf("reserve: %w", service.ErrProductNotFound), codes.NotFound},
+		{errors.New("connection reset"), codes.Internal},
+	} {
+		if got := status.Code(purchaseStatus(context.Background(), tc.err)); got != tc.want {
+			t.Errorf("%v: code = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if got := status.Code(purchaseStatus(ctx, errors.New("whatever"))); got != codes.DeadlineExceeded {
+		t.Errorf("expired context: code = %s, want DeadlineExceeded", got)
+	}
+}
+
+func TestPurchase(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	handlers.ResetStats()
+	t.Cleanup(handlers.ResetStats)
+	productID := testutil.Product(t, "Widget", 2)
+	client := dial(t)
+
+	res, err := client.Purchase(t.Context(), &flashsalepb.PurchaseRequest{UserId: 1, ProductId: int32(productID), Quantity: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetOrderId() == 0 || res.GetRemaining() != 0 {
+		t.Fatalf("response = %v, want an order and 0 left", res)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "0" {
+		t.Fatalf("Redis stock = %s, want 0", got)
+	}
+	if n := testutil.Orders(t, productID, service.OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d orders, want 1", n)
+	}
+
+	_, err = client.Purchase(t.Context(), &flashsalepb.PurchaseRequest{UserId: 2, ProductId: int32(productID)})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("sold out: err = %v, want FailedPrecondition", err)
+	}
+	_, err = client.Purchase(t.Context(), &flashsalepb.PurchaseRequest{UserId: 2, ProductId: int32(productID) + 1})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("unknown product: err = %v, want NotFound", err)
+	}
+
+	stats := handlers.GetStats()
+	if stats["success"] != int64(1) || stats["failed"] != int64(2) {
+		t.Fatalf("stats: %v successes, %v failures; want 1 and 2", stats["success"], stats["failed"])
+	}
+}
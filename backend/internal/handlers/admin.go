@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 🔐 ADMIN ENDPOINTS
+// ============================================
+
+// AdminTokenHeader carries the shared secret for /admin routes
+const AdminTokenHeader = "X-Admin-Token"
+
+// adminToken is the expected X-Admin-Token; admin routes are disabled when unset
+var adminToken = config.String("ADMIN_TOKEN", "")
+
+// RequireAdmin rejects requests whose X-Admin-Token doesn't match ADMIN_TOKEN
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			respondError(c, http.StatusForbidden, CodeForbidden, "Admin endpoints are disabled (ADMIN_TOKEN is not set)")
+			return
+		}
+		token := c.GetHeader(AdminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid "+AdminTokenHeader)
+			return
+		}
+		c.Next()
+	}
+}
+
+// CreateProductRequest is the body of POST /admin/products. Price and
+// quantity are required; the sale window and per-user cap are optional, as in
+// SEED_FILE.
+type CreateProductRequest struct {
+	Name       string     `json:"name" binding:"required,max=100"`
+	Price      *Money     `json:"price" binding:"required"`
+	Quantity   *int       `json:"quantity" binding:"required,min=0"`
+	SaleStart  *time.Time `json:"sale_start"`
+	SaleEnd    *time.Time `json:"sale_end"`
+	MaxPerUser *int       `json:"max_per_user" binding:"omitempty,min=0"`
+}
+
+// maxProductPrice is the largest price products.price (DECIMAL(10, 2)) holds
+var maxProductPrice = NewMoney("99999999.99")
+
+// CreateProduct adds a product at runtime and seeds its Redis stock key, so
+// it can be bought straight away. Redis is set before the insert commits and
+// cleared again if the commit fails, so neither store has it without the other.
+func CreateProduct(c *gin.Context) {
+	var req CreateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", "name is required")
+		return
+	}
+	if req.Price.IsNegative() || req.Price.GreaterThan(maxProductPrice.Decimal) {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", "price must be between 0 and "+maxProductPrice.String())
+		return
+	}
+	if req.SaleStart != nil && req.SaleEnd != nil && !req.SaleEnd.After(*req.SaleStart) {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", "sale_end must be after sale_start")
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var id int
+	err = tx.QueryRow(c,
+		`INSERT INTO products (name, price, quantity, initial_quantity, sale_start, sale_end, max_per_user)
+		VALUES ($1, $2, $3, $3, $4, $5, $6) RETURNING id`,
+		req.Name, *req.Price, *req.Quantity, req.SaleStart, req.SaleEnd, req.MaxPerUser).Scan(&id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to create product")
+		return
+	}
+
+	key := database.StockKey(id)
+	if err := database.Rdb.Set(c, key, *req.Quantity, database.StockKeyTTL).Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to seed Redis stock")
+		return
+	}
+	if err := tx.Commit(c); err != nil {
+		database.Rdb.Del(context.Background(), key)
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to commit transaction")
+		return
+	}
+	slog.Info("⚡ Product created", "product_id", id, "name", req.Name, "stock", *req.Quantity, "price", req.Price.String())
+
+	p := productDetail{
+		ProductDTO: ProductDTO{ID: id, Name: req.Name, Price: *req.Price, Quantity: *req.Quantity},
+		RedisStock: req.Quantity,
+		SaleStart:  req.SaleStart,
+		SaleEnd:    req.SaleEnd,
+		ServerTime: time.Now().UTC(),
+		MaxPerUser: service.MaxPerUser,
+	}
+	if req.MaxPerUser != nil {
+		p.MaxPerUser = *req.MaxPerUser
+	}
+	c.Header("Location", "/products/"+strconv.Itoa(id))
+	c.JSON(http.StatusCreated, p)
+}
+
+// SetUserLimit sets a product's cap on units per user with
+// {"max_per_user": n} (0 = no limit), or {"max_per_user": null} to fall back
+// to MAX_PER_USER. Units already bought still count against the new cap.
+func SetUserLimit(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MaxPerUser *int `json:"max_per_user" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+
+	tag, err := database.DB.Exec(c, "UPDATE products SET max_per_user=$1 WHERE id=$2", req.MaxPerUser, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to update limit")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+	service.ForgetProductRules(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":   id,
+		"max_per_user": req.MaxPerUser,
+		"effective":    service.UserLimit(c, id),
+	})
+}
+
+// adjustStockScript adds a delta to a stock key that exists. A missing (or
+// expired) key is set to the PostgreSQL stock instead, since INCRBY would
+// create it holding just the delta. Returns {stock, 1} after INCRBY and
+// {stock, 0} after SET.
+// KEYS[1] = stock key, ARGV[1] = delta, ARGV[2] = PostgreSQL stock,
+// ARGV[3] = TTL in ms (0 = none)
+var adjustStockScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 1 then
+		return {redis.call('INCRBY', KEYS[1], ARGV[1]), 1}
+	end
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	else
+		redis.call('SET', KEYS[1], ARGV[2])
+	end
+	return {tonumber(ARGV[2]), 0}
+`)
+
+// adjustRedisStock adds delta to a product's Redis stock, or loads stock (the
+// PostgreSQL value after the change) when the key is missing. incremented
+// says which happened, for undoing.
+func adjustRedisStock(ctx context.Context, productID, delta, stock int) (redisStock int, incremented bool, err error) {
+	res, err := adjustStockScript.Run(ctx, database.Rdb, []string{database.StockKey(productID)},
+		delta, stock, database.StockKeyTTL.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return int(res[0]), res[1] == 1, nil
+}
+
+// AdjustStock restocks a product by {"delta": n} or sets it with {"set": n}.
+// The row stays locked while Redis is updated, and Redis is put back if the
+// Postgres commit fails, so the two stores move together. Stock that goes up
+// wakes that many users from the product's waitlist; the stock event says
+// "restock" then and "adjust" otherwise.
+func AdjustStock(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Delta *int `json:"delta"`
+		Set   *int `json:"set"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Delta == nil) == (req.Set == nil) {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "Provide exactly one of delta or set")
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var current int
+	err = tx.QueryRow(c, "SELECT quantity FROM products WHERE id=$1 FOR UPDATE", id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to lock product row")
+		return
+	}
+
+	stock := current
+	if req.Delta != nil {
+		stock += *req.Delta
+	} else {
+		stock = *req.Set
+	}
+	if stock < 0 {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Stock can't go negative",
+			fmt.Sprintf("current %d, requested %d", current, stock))
+		return
+	}
+
+	if _, err := tx.Exec(c, "UPDATE products SET quantity=$1 WHERE id=$2", stock, id); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to update stock")
+		return
+	}
+
+	// A delta is applied to Redis as a delta so in-flight reservations survive
+	// (a missing key is loaded instead); a set overwrites it, remembering the
+	// old value in case we must undo.
+	key := database.StockKey(id)
+	var undo func()
+	var redisStock int
+	if req.Delta != nil {
+		var incremented bool
+		redisStock, incremented, err = adjustRedisStock(c, id, *req.Delta, stock)
+		undo = func() { database.Rdb.Del(context.Background(), key) }
+		if incremented {
+			undo = func() { database.Rdb.DecrBy(context.Background(), key, int64(*req.Delta)) }
+		}
+	} else {
+		var old string
+		redisStock = stock
+		old, err = database.Rdb.SetArgs(c, key, stock, redis.SetArgs{Get: true, TTL: database.StockKeyTTL}).Result()
+		if err == redis.Nil {
+			err = nil
+			undo = func() { database.Rdb.Del(context.Background(), key) }
+		} else {
+			undo = func() { database.Rdb.Set(context.Background(), key, old, database.StockKeyTTL) }
+		}
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to update Redis stock")
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		undo()
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to commit transaction")
+		return
+	}
+
+	reason := "adjust"
+	if stock > current {
+		reason = "restock"
+	}
+	publishStock(id, stock, reason)
+
+	// One waitlisted user per unit that came back
+	notified := notifyWaitlist(c, id, stock-max(current, 0), stock)
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":        id,
+		"previous":          current,
+		"quantity":          stock,
+		"redis_stock":       redisStock,
+		"waitlist_notified": notified,
+	})
+}
+
+// InspectRedis shows a product's raw Redis stock key for debugging drift
+// without redis-cli: whether it exists, its value, and its TTL. A missing key
+// is a 200 with exists=false and nulls, not a 404.
+func InspectRedis(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	key := database.StockKey(id)
+	pipe := database.Rdb.Pipeline()
+	get := pipe.Get(c, key)
+	pttl := pipe.PTTL(c, key)
+	if _, err := pipe.Exec(c); err != nil && err != redis.Nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to read Redis key")
+		return
+	}
+
+	resp := gin.H{
+		"product_id": id,
+		"key":        key,
+		"exists":     false,
+		"raw":        nil,
+		"stock":      nil, // null when missing or not an integer
+		"expires":    false,
+		"ttl_ms":     nil,
+	}
+
+	raw, err := get.Result()
+	if err == redis.Nil {
+		resp["message"] = "Stock key does not exist; run POST /sync-redis"
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	resp["exists"] = true
+	resp["raw"] = raw
+	if stock, err := get.Int(); err == nil {
+		resp["stock"] = stock
+	}
+	// PTTL is -1 for a key without expiry
+	if ttl := pttl.Val(); ttl >= 0 {
+		resp["expires"] = true
+		resp["ttl_ms"] = ttl.Milliseconds()
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminRouter serves the /admin routes behind RequireAdmin, with ADMIN_TOKEN
+// "secret"
+func adminRouter(t testing.TB) *gin.Engine {
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = "" })
+	r := gin.New()
+	admin := r.Group("/admin", RequireAdmin())
+	admin.POST("/products", CreateProduct)
+	admin.POST("/products/:id/stock", AdjustStock)
+	admin.POST("/products/:id/limit", SetUserLimit)
+	admin.GET("/redis/:id", InspectRedis)
+	return r
+}
+
+// stockEvents collects the stock_changed events published while the test runs
+func stockEvents(t testing.TB) <-chan StockEvent {
+	t.Helper()
+	sub := database.Rdb.Subscribe(t.Context(), stockChannel)
+	if _, err := sub.Receive(t.Context()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	t.Cleanup(func() { sub.Close() })
+
+	events := make(chan StockEvent, 16)
+	go func() {
+		for msg := range sub.Channel() {
+			var ev StockEvent
+			if json.Unmarshal([]byte(msg.Payload), &ev) == nil && ev.Type == "stock_changed" {
+				events <- ev
+			}
+		}
+	}()
+	return events
+}
+
+func nextStockEvent(t testing.TB, events <-chan StockEvent) StockEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stock_changed event")
+		return StockEvent{}
+	}
+}
+
+func TestAdjustStockRequiresAdmin(t *testing.T) {
+	r := adminRouter(t)
+	for _, header := range []string{"", "wrong"} {
+		rec := serve(r, http.MethodPost, "/admin/products/1/stock", `{"delta": 5}`, AdminTokenHeader, header)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("X-Admin-Token %q: status = %d, want 401", header, rec.Code)
+		}
+	}
+
+	adminToken = ""
+	rec := serve(r, http.MethodPost, "/admin/products/1/stock", `{"delta": 5}`, AdminTokenHeader, "")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("ADMIN_TOKEN unset: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestAdjustStock(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := adminRouter(t)
+	events := stockEvents(t)
+
+	adjust := func(productID int, body string) (int, map[string]any) {
+		rec := serve(r, http.MethodPost, fmt.Sprintf("/admin/products/%d/stock", productID), body, AdminTokenHeader, "secret")
+		var resp map[string]any
+		decode(t, rec, &resp)
+		return rec.Code, resp
+	}
+
+	t.Run("positive delta", func(t *testing.T) {
+		id := testutil.Product(t, "Delta", 10)
+		// A reservation in flight: Redis is already below PostgreSQL
+		mr.Set(database.StockKey(id), "7")
+
+		code, resp := adjust(id, `{"delta": 5}`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d: %v", code, resp)
+		}
+		if got := testutil.Quantity(t, id); got != 15 {
+			t.Fatalf("PostgreSQL quantity = %d, want 15", got)
+		}
+		if got, _ := mr.Get(database.StockKey(id)); got != "12" {
+			t.Fatalf("Redis stock = %s, want 12 (the in-flight reservation kept)", got)
+		}
+		if ev := nextStockEvent(t, events); ev.Reason != "restock" || ev.Stock != 15 {
+			t.Fatalf("event = %+v, want a restock to 15", ev)
+		}
+	})
+
+	t.Run("delta on a missing key", func(t *testing.T) {
+		id := testutil.Product(t, "Expired", 10)
+		mr.Del(database.StockKey(id))
+
+		if code, resp := adjust(id, `{"delta": 5}`); code != http.StatusOK {
+			t.Fatalf("status = %d: %v", code, resp)
+		}
+		if got, _ := mr.Get(database.StockKey(id)); got != "15" {
+			t.Fatalf("Redis stock = %s, want 15 (loaded from PostgreSQL, not just the delta)", got)
+		}
+		nextStockEvent(t, events)
+	})
+
+	t.Run("set to an exact value", func(t *testing.T) {
+		id := testutil.Product(t, "Set", 10)
+
+		code, resp := adjust(id, `{"set": 3}`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d: %v", code, resp)
+		}
+		if resp["previous"] != 10.0 || resp["quantity"] != 3.0 || resp["redis_stock"] != 3.0 {
+			t.Fatalf("response = %v, want previous 10, quantity and redis_stock 3", resp)
+		}
+		if got := testutil.Quantity(t, id); got != 3 {
+			t.Fatalf("PostgreSQL quantity = %d, want 3", got)
+		}
+		if got, _ := mr.Get(database.StockKey(id)); got != "3" {
+			t.Fatalf("Redis stock = %s, want 3", got)
+		}
+		if ev := nextStockEvent(t, events); ev.Reason != "adjust" {
+			t.Fatalf("lowering stock published reason %q, want adjust", ev.Reason)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		id := testutil.Product(t, "Rejected", 2)
+		for _, body := range []string{`{"delta": -3}`, `{"delta": 1, "set": 1}`, `{}`} {
+			if code, resp := adjust(id, body); code != http.StatusBadRequest {
+				t.Fatalf("%s: status = %d, want 400: %v", body, code, resp)
+			}
+		}
+		if code, _ := adjust(999999, `{"delta": 1}`); code != http.StatusNotFound {
+			t.Fatalf("unknown product: status = %d, want 404", code)
+		}
+		if got := testutil.Quantity(t, id); got != 2 {
+			t.Fatalf("PostgreSQL quantity = %d after rejected requests, want 2", got)
+		}
+	})
+}
+
+func TestAdjustRedisStock(t *testing.T) {
+	mr := testutil.Redis(t)
+	key := database.StockKey(42)
+
+	stock, incremented, err := adjustRedisStock(t.Context(), 42, 5, 20)
+	if err != nil || incremented || stock != 20 {
+		t.Fatalf("missing key: got (%d, %t, %v), want it loaded as 20", stock, incremented, err)
+	}
+
+	mr.Set(key, "8")
+	stock, incremented, err = adjustRedisStock(t.Context(), 42, 5, 20)
+	if err != nil || !incremented || stock != 13 {
+		t.Fatalf("existing key: got (%d, %t, %v), want 13 by INCRBY", stock, incremented, err)
+	}
+
+	mr.Del(key)
+	database.StockKeyTTL = time.Minute
+	t.Cleanup(func() { database.StockKeyTTL = 0 })
+	if _, _, err := adjustRedisStock(t.Context(), 42, 1, 9); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(key); ttl != time.Minute {
+		t.Fatalf("reloaded key TTL = %s, want STOCK_KEY_TTL_SEC", ttl)
+	}
+}
+
+// redisInspection is a GET /admin/redis/:id response
+type redisInspection struct {
+	Key     string  `json:"key"`
+	Exists  bool    `json:"exists"`
+	Raw     *string `json:"raw"`
+	Stock   *int    `json:"stock"`
+	Expires bool    `json:"expires"`
+	TTLMs   *int64  `json:"ttl_ms"`
+	Message string  `json:"message"`
+}
+
+func TestInspectRedis(t *testing.T) {
+	mr := testutil.Redis(t)
+	r := adminRouter(t)
+	inspect := func(id int) redisInspection {
+		t.Helper()
+		rec := serve(r, http.MethodGet, fmt.Sprintf("/admin/redis/%d", id), "", AdminTokenHeader, "secret")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("product %d: status = %d: %s; want 200", id, rec.Code, rec.Body)
+		}
+		var res redisInspection
+		decode(t, rec, &res)
+		return res
+	}
+
+	if rec := serve(r, http.MethodGet, "/admin/redis/1", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without the admin token: status = %d, want 401", rec.Code)
+	}
+
+	mr.Set(database.StockKey(1), "7")
+	res := inspect(1)
+	if !res.Exists || res.Key != database.StockKey(1) || res.Stock == nil || *res.Stock != 7 || res.Expires || res.TTLMs != nil {
+		t.Fatalf("plain key = %+v, want stock 7 without expiry", res)
+	}
+
+	mr.SetTTL(database.StockKey(1), time.Minute)
+	if res := inspect(1); !res.Expires || res.TTLMs == nil || *res.TTLMs <= 0 || *res.TTLMs > time.Minute.Milliseconds() {
+		t.Fatalf("expiring key = %+v, want a TTL up to 60000ms", res)
+	}
+
+	mr.Set(database.StockKey(2), "lots")
+	if res := inspect(2); !res.Exists || res.Raw == nil || *res.Raw != "lots" || res.Stock != nil {
+		t.Fatalf("non-integer key = %+v, want raw \"lots\" and stock null", res)
+	}
+
+	res = inspect(3)
+	if res.Exists || res.Raw != nil || res.Stock != nil || res.TTLMs != nil || res.Message == "" {
+		t.Fatalf("missing key = %+v, want exists false, nulls and a hint", res)
+	}
+}
+
+func TestSetUserLimitBadInput(t *testing.T) {
+	r := adminRouter(t)
+	for _, tt := range []struct{ path, body string }{
+		{"/admin/products/abc/limit", `{"max_per_user": 1}`},
+		{"/admin/products/1/limit", `{"max_per_user": -1}`},
+		{"/admin/products/1/limit", `{"max_per_user": "one"}`},
+	} {
+		rec := serve(r, http.MethodPost, tt.path, tt.body, AdminTokenHeader, "secret")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s %s: status = %d: %s; want 400 %s", tt.path, tt.body, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestPerProductUserLimit(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	r := adminRouter(t)
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	single := testutil.Product(t, "Limited Edition", 10)
+	triple := testutil.Product(t, "Bundle", 10)
+	unknown := triple + 1
+
+	setLimit := func(productID int, body string) *httptest.ResponseRecorder {
+		return serve(r, http.MethodPost, fmt.Sprintf("/admin/products/%d/limit", productID), body, AdminTokenHeader, "secret")
+	}
+	for productID, limit := range map[int]int{single: 1, triple: 3} {
+		rec := setLimit(productID, fmt.Sprintf(`{"max_per_user": %d}`, limit))
+		var resp struct {
+			Effective int `json:"effective"`
+		}
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || resp.Effective != limit {
+			t.Fatalf("product %d: status = %d: %s; want effective limit %d", productID, rec.Code, rec.Body, limit)
+		}
+	}
+	if rec := setLimit(unknown, `{"max_per_user": 1}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown product: status = %d, want 404", rec.Code)
+	}
+
+	// The same buyer hits each product's own cap
+	token := bearer(t, 1)
+	for _, tt := range []struct{ productID, limit int }{{single, 1}, {triple, 3}} {
+		body := fmt.Sprintf(`{"product_id": %d}`, tt.productID)
+		for i := range tt.limit {
+			if rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", token); rec.Code != http.StatusOK {
+				t.Fatalf("product %d purchase %d of %d: status = %d: %s", tt.productID, i+1, tt.limit, rec.Code, rec.Body)
+			}
+		}
+		rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", token)
+		if rec.Code != http.StatusTooManyRequests || errorOf(t, rec).Code != CodeUserLimitExceeded {
+			t.Fatalf("product %d over its limit of %d: status = %d: %s; want 429 %s", tt.productID, tt.limit, rec.Code, rec.Body, CodeUserLimitExceeded)
+		}
+	}
+
+	// null falls back to MAX_PER_USER
+	rec := setLimit(single, `{"max_per_user": null}`)
+	var resp struct {
+		Effective int `json:"effective"`
+	}
+	decode(t, rec, &resp)
+	if rec.Code != http.StatusOK || resp.Effective != service.MaxPerUser {
+		t.Fatalf("null limit: status = %d: %s; want effective MAX_PER_USER (%d)", rec.Code, rec.Body, service.MaxPerUser)
+	}
+}
+
+func TestCreateProductBadInput(t *testing.T) {
+	r := adminRouter(t)
+	for _, body := range []string{
+		`{}`,
+		`{"name": "Widget", "quantity": 5}`,
+		`{"name": "Widget", "price": "9.99"}`,
+		`{"name": "   ", "price": "9.99", "quantity": 5}`,
+		`{"name": "Widget", "price": "-1", "quantity": 5}`,
+		`{"name": "Widget", "price": "100000000", "quantity": 5}`,
+		`{"name": "Widget", "price": "9.99", "quantity": -1}`,
+		`{"name": "Widget", "price": "9.99", "quantity": 5, "max_per_user": -1}`,
+		`{"name": "Widget", "price": "9.99", "quantity": 5,
+			"sale_start": "2026-01-02T00:00:00Z", "sale_end": "2026-01-01T00:00:00Z"}`,
+	} {
+		rec := serve(r, http.MethodPost, "/admin/products", body, AdminTokenHeader, "secret")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", body, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestCreateProductThenBuy(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := adminRouter(t)
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+
+	rec := serve(r, http.MethodPost, "/admin/products", `{"name": " Launch Edition ", "price": "49.90", "quantity": 3}`,
+		AdminTokenHeader, "secret")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", rec.Code, rec.Body)
+	}
+	var p struct {
+		ID         int         `json:"id"`
+		Name       string      `json:"name"`
+		Price      json.Number `json:"price"`
+		Quantity   int         `json:"quantity"`
+		RedisStock *int        `json:"redis_stock"`
+	}
+	decode(t, rec, &p)
+	if p.ID == 0 || p.Name != "Launch Edition" || p.Price != "49.90" || p.Quantity != 3 {
+		t.Fatalf("created %+v, want Launch Edition at 49.90 with 3 in stock", p)
+	}
+	if loc := rec.Header().Get("Location"); loc != fmt.Sprintf("/products/%d", p.ID) {
+		t.Fatalf("Location = %q", loc)
+	}
+	if got, _ := mr.Get(database.StockKey(p.ID)); got != "3" {
+		t.Fatalf("Redis stock = %s, want 3 seeded", got)
+	}
+	service.ForgetProductRules(p.ID) // ids restart per test; drop rules cached under this one
+
+	rec = serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, p.ID), "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("purchase: status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := testutil.Quantity(t, p.ID); got != 2 {
+		t.Fatalf("quantity = %d, want 2", got)
+	}
+}
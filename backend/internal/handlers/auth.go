@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ============================================
+// 🔑 LOGIN + JWT
+// ============================================
+// POST /auth/login checks a seeded user's bcrypt password and returns a
+// signed token. Purchase and waitlist routes take the buyer from that token
+// only, so nobody can spend someone else's per-user limit by naming them in
+// the body. Load tools mint tokens for synthetic buyers with POST
+// /admin/tokens.
+
+const ctxUserID = "auth_user_id"
+
+var (
+	jwtTTL    = config.Duration("JWT_TTL", time.Hour)
+	jwtSecret = loadJWTSecret()
+)
+
+// loadJWTSecret reads JWT_SECRET, or makes a random one so tokens at least
+// can't be forged; they then stop working when the server restarts
+func loadJWTSecret() []byte {
+	if secret := config.String("JWT_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	slog.Warn("⚠️ JWT_SECRET not set, using a random secret; tokens won't survive a restart")
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// issueToken signs a token whose subject is the user id
+func issueToken(userID int) (string, time.Time, error) {
+	expires := time.Now().Add(jwtTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	})
+	signed, err := token.SignedString(jwtSecret)
+	return signed, expires, err
+}
+
+// parseToken validates a token and returns its user id
+func parseToken(raw string) (int, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(*jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, err
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return 0, errors.New("token subject is not a user id")
+	}
+	return userID, nil
+}
+
+// Login exchanges a username (or email) and password for a JWT
+func Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" || req.Password == "" {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "username and password are required")
+		return
+	}
+
+	var userID int
+	var hash string
+	err := database.DB.QueryRow(c,
+		"SELECT id, password_hash FROM users WHERE username=$1 OR email=$1 ORDER BY id LIMIT 1",
+		req.Username).Scan(&userID, &hash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to look up user")
+		return
+	}
+	// Same answer for unknown user and wrong password
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Invalid username or password")
+		return
+	}
+
+	token, expires, err := issueToken(userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeInternal, "Failed to sign token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expires.UTC(),
+		"user_id":    userID,
+	})
+}
+
+// RegisterRequest is the body of POST /auth/register. bcrypt only looks at
+// the first 72 bytes of a password, hence the cap.
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,max=50"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// Register creates a user who can then log in; an email that is already
+// registered gets 409 EMAIL_TAKEN
+func Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+
+	userID, err := database.CreateUser(c, req.Username, req.Email, req.Password)
+	if errors.Is(err, database.ErrEmailTaken) {
+		respondError(c, http.StatusConflict, CodeEmailTaken, "Email is already registered")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to create user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user_id":  userID,
+		"username": req.Username,
+		"email":    req.Email,
+	})
+}
+
+// Authenticate reads "Authorization: Bearer <token>" and stores the user id
+// for authUserID. A missing, malformed or expired token is rejected with 401.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Authorization: Bearer <token> is required")
+			return
+		}
+
+		raw, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Authorization must be a Bearer token")
+			return
+		}
+		userID, err := parseToken(raw)
+		if err != nil {
+			respondErrorDetail(c, http.StatusUnauthorized, CodeUnauthorized, "Invalid or expired token", err.Error())
+			return
+		}
+
+		c.Set(ctxUserID, userID)
+		c.Next()
+	}
+}
+
+// authUserID returns the user Authenticate took from the token, or 0 on a
+// route it doesn't guard
+func authUserID(c *gin.Context) int {
+	id, _ := c.Get(ctxUserID)
+	userID, _ := id.(int)
+	return userID
+}
+
+// MintTokensRequest is the body of POST /admin/tokens, at most 5000 users
+type MintTokensRequest struct {
+	UserIDs []int `json:"user_ids" binding:"required,min=1,max=5000,dive,min=1"`
+}
+
+// MintTokens is POST /admin/tokens: a token for each listed user id, without
+// a password, so the attack script and dashboard can buy as many synthetic
+// users. Admin only, like every route that can act as someone else.
+func MintTokens(c *gin.Context) {
+	var req MintTokensRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+
+	tokens := make([]gin.H, 0, len(req.UserIDs))
+	var expires time.Time
+	for _, userID := range req.UserIDs {
+		token, exp, err := issueToken(userID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, "Failed to sign token")
+			return
+		}
+		expires = exp
+		tokens = append(tokens, gin.H{"user_id": userID, "token": token})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":     tokens,
+		"token_type": "Bearer",
+		"expires_at": expires.UTC(),
+	})
+}
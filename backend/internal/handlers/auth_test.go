@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// whoAmI answers with the buyer bindPurchase settled on
+func whoAmI(c *gin.Context) {
+	var req PurchaseRequest
+	if err := bindPurchase(c, &req, &req.UserID); err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": req.UserID})
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), whoAmI)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "7",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header string
+	}{
+		{"missing token", ""},
+		{"not a bearer token", "Basic dXNlcjpwYXNz"},
+		{"garbage token", "Bearer not-a-jwt"},
+		{"expired token", "Bearer " + expired},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(r, http.MethodPost, "/purchase", `{"user_id": 7, "product_id": 1}`, "Authorization", tc.header)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401: %s", rec.Code, rec.Body)
+			}
+			if code := errorOf(t, rec).Code; code != CodeUnauthorized {
+				t.Fatalf("code = %s, want %s", code, CodeUnauthorized)
+			}
+		})
+	}
+}
+
+func TestAuthenticateIgnoresBodyUserID(t *testing.T) {
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), whoAmI)
+
+	rec := serve(r, http.MethodPost, "/purchase", `{"user_id": 99, "product_id": 1}`, "Authorization", bearer(t, 7))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		UserID int `json:"user_id"`
+	}
+	decode(t, rec, &body)
+	if body.UserID != 7 {
+		t.Fatalf("buyer = %d, want the token's user 7", body.UserID)
+	}
+}
+
+func TestPurchaseRouteRejectsMissingToken(t *testing.T) {
+	r := gin.New()
+	r.POST("/purchase/redis", Authenticate(), PurchaseRedisPostgres)
+
+	// No Redis or PostgreSQL is set up: reaching the handler would panic
+	rec := serve(r, http.MethodPost, "/purchase/redis", `{"user_id": 1, "product_id": 1}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMintTokens(t *testing.T) {
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = "" })
+	r := gin.New()
+	r.POST("/admin/tokens", RequireAdmin(), MintTokens)
+
+	if rec := serve(r, http.MethodPost, "/admin/tokens", `{"user_ids": [1]}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without X-Admin-Token: status = %d, want 401", rec.Code)
+	}
+
+	rec := serve(r, http.MethodPost, "/admin/tokens", `{"user_ids": [3, 5]}`, AdminTokenHeader, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Tokens []struct {
+			UserID int    `json:"user_id"`
+			Token  string `json:"token"`
+		} `json:"tokens"`
+	}
+	decode(t, rec, &body)
+	if len(body.Tokens) != 2 {
+		t.Fatalf("got %d tokens, want 2", len(body.Tokens))
+	}
+	for i, want := range []int{3, 5} {
+		got, err := parseToken(body.Tokens[i].Token)
+		if err != nil || got != want || body.Tokens[i].UserID != want {
+			t.Fatalf("token %d is for user %d (listed as %d, err %v), want %d", i, got, body.Tokens[i].UserID, err, want)
+		}
+	}
+
+	if rec := serve(r, http.MethodPost, "/admin/tokens", `{"user_ids": [0]}`, AdminTokenHeader, "secret"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("user id 0: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	testutil.Postgres(t)
+	userID, err := database.CreateUser(t.Context(), "alice", "alice@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/auth/login", Login)
+
+	t.Run("success", func(t *testing.T) {
+		rec := serve(r, http.MethodPost, "/auth/login", `{"username": "alice", "password": "correct horse"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Token  string `json:"token"`
+			UserID int    `json:"user_id"`
+		}
+		decode(t, rec, &body)
+		got, err := parseToken(body.Token)
+		if err != nil {
+			t.Fatalf("token does not verify: %v", err)
+		}
+		if got != userID || body.UserID != userID {
+			t.Fatalf("token for user %d (body says %d), want %d", got, body.UserID, userID)
+		}
+	})
+
+	t.Run("by email", func(t *testing.T) {
+		rec := serve(r, http.MethodPost, "/auth/login", `{"username": "alice@example.com", "password": "correct horse"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	for _, body := range []string{
+		`{"username": "alice", "password": "wrong password"}`,
+		`{"username": "nobody", "password": "correct horse"}`,
+	} {
+		t.Run("rejected "+strconv.Quote(body), func(t *testing.T) {
+			rec := serve(r, http.MethodPost, "/auth/login", body)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401: %s", rec.Code, rec.Body)
+			}
+			if code := errorOf(t, rec).Code; code != CodeUnauthorized {
+				t.Fatalf("code = %s, want %s", code, CodeUnauthorized)
+			}
+		})
+	}
+}
+
+func TestRegisterBadInput(t *testing.T) {
+	r := gin.New()
+	r.POST("/auth/register", Register)
+	for _, body := range []string{
+		`{"email": "bob@example.com", "password": "long enough"}`,
+		`{"username": "bob", "email": "not an email", "password": "long enough"}`,
+		`{"username": "bob", "email": "bob@example.com", "password": "short"}`,
+	} {
+		rec := serve(r, http.MethodPost, "/auth/register", body)
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", body, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	testutil.Postgres(t)
+	r := gin.New()
+	r.POST("/auth/register", Register)
+
+	rec := serve(r, http.MethodPost, "/auth/register",
+		`{"username": "bob", "email": "bob@example.com", "password": "long enough"}`)
+	var body struct {
+		UserID int `json:"user_id"`
+	}
+	decode(t, rec, &body)
+	if rec.Code != http.StatusCreated || body.UserID == 0 {
+		t.Fatalf("first registration: status = %d: %s; want 201 with a user_id", rec.Code, rec.Body)
+	}
+
+	rec = serve(r, http.MethodPost, "/auth/register",
+		`{"username": "robert", "email": "bob@example.com", "password": "another one"}`)
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Code != CodeEmailTaken {
+		t.Fatalf("second registration: status = %d: %s; want 409 %s", rec.Code, rec.Body, CodeEmailTaken)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"flash-sale-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 📦 REQUEST BODY GUARDS
+// ============================================
+// A purchase body is a few dozen bytes of JSON. Rejecting anything else up
+// front keeps a huge or mislabelled body from reaching the JSON decoder,
+// where it would cost memory and come back as a vague INVALID_INPUT.
+
+// maxBodyBytes caps the size of a purchase request body
+var maxBodyBytes = int64(config.Int("MAX_BODY_BYTES", 4096))
+
+// RequireJSON rejects POST, PUT and PATCH requests whose body isn't
+// Content-Type: application/json with 415. Requests without a body (the admin
+// actions like POST /reset) pass through.
+func RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		contentType := c.GetHeader("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			respondErrorDetail(c, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+				"Request body must be JSON", fmt.Sprintf("got Content-Type %q, want application/json", contentType))
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitBody rejects bodies larger than MAX_BODY_BYTES with 413. The body is
+// read here, through http.MaxBytesReader, so a client that lies about (or
+// omits) Content-Length is caught too; handlers then read the buffered copy.
+func LimitBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || maxBodyBytes <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxBodyBytes {
+			failBodyTooLarge(c)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			failBodyTooLarge(c)
+			return
+		}
+		if err != nil {
+			respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Failed to read request body", err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+func failBodyTooLarge(c *gin.Context) {
+	respondErrorDetail(c, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large",
+		fmt.Sprintf("limit is %d bytes", maxBodyBytes))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyRouter echoes the bytes a handler gets through the guards
+func bodyRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(RequireJSON())
+	r.POST("/purchase", LimitBody(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%s", body)
+	})
+	r.POST("/reset", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/products", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestRequireJSON(t *testing.T) {
+	r := bodyRouter()
+	for _, tc := range []struct {
+		name, method, path, body, contentType string
+		want                                  int
+	}{
+		{"json", http.MethodPost, "/purchase", `{"product_id": 1}`, "application/json", http.StatusOK},
+		{"json with charset", http.MethodPost, "/purchase", `{"product_id": 1}`, "application/json; charset=utf-8", http.StatusOK},
+		{"text/plain", http.MethodPost, "/purchase", `{"product_id": 1}`, "text/plain", http.StatusUnsupportedMediaType},
+		{"form", http.MethodPost, "/purchase", "product_id=1", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "/purchase", `{"product_id": 1}`, "", http.StatusUnsupportedMediaType},
+		{"no body", http.MethodPost, "/reset", "", "", http.StatusOK},
+		{"GET", http.MethodGet, "/products", "", "", http.StatusOK},
+	} {
+		rec := serve(r, tc.method, tc.path, tc.body, "Content-Type", tc.contentType)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d: %s; want %d", tc.name, rec.Code, rec.Body, tc.want)
+			continue
+		}
+		if tc.want == http.StatusUnsupportedMediaType && errorOf(t, rec).Code != CodeUnsupportedMediaType {
+			t.Errorf("%s: %s, want %s", tc.name, rec.Body, CodeUnsupportedMediaType)
+		}
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	prev := maxBodyBytes
+	t.Cleanup(func() { maxBodyBytes = prev })
+	maxBodyBytes = 64
+	r := bodyRouter()
+
+	small := `{"product_id": 1, "quantity": 2}`
+	if rec := serve(r, http.MethodPost, "/purchase", small); rec.Code != http.StatusOK || rec.Body.String() != small {
+		t.Fatalf("small body: status = %d: %s; want 200 with the body passed on", rec.Code, rec.Body)
+	}
+
+	huge := `{"product_id": 1, "note": "` + strings.Repeat("x", 100) + `"}`
+	rec := serve(r, http.MethodPost, "/purchase", huge)
+	if rec.Code != http.StatusRequestEntityTooLarge || errorOf(t, rec).Code != CodePayloadTooLarge {
+		t.Fatalf("oversized body: status = %d: %s; want 413 %s", rec.Code, rec.Body, CodePayloadTooLarge)
+	}
+
+	// Without a Content-Length the limit is enforced while reading
+	req := httptest.NewRequest(http.MethodPost, "/purchase", io.NopCloser(strings.NewReader(huge)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body of unknown length: status = %d: %s; want 413", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sony/gobreaker/v2"
+)
+
+// ============================================
+// 🔌 CIRCUIT BREAKER AROUND POSTGRES WRITES
+// ============================================
+// When Postgres is struggling, every purchase still opening a transaction
+// only piles on load. After DB_BREAKER_FAILURES consecutive outage-type
+// failures the breaker opens: purchases fail fast with 503 DB_UNAVAILABLE
+// (handing their Redis reservation back) for DB_BREAKER_COOLDOWN_MS, then a
+// single trial transaction decides whether to close it again.
+
+var (
+	dbBreakerFailures = config.Int("DB_BREAKER_FAILURES", 5) // 0 = disabled
+	dbBreakerCooldown = time.Duration(config.Int("DB_BREAKER_COOLDOWN_MS", 5000)) * time.Millisecond
+)
+
+var dbBreaker = newDBBreaker()
+
+// newDBBreaker builds the breaker from the DB_BREAKER_* settings
+func newDBBreaker() *gobreaker.TwoStepCircuitBreaker[struct{}] {
+	return gobreaker.NewTwoStepCircuitBreaker[struct{}](gobreaker.Settings{
+		Name:        "postgres",
+		MaxRequests: 1, // trial transactions while half-open
+		Timeout:     dbBreakerCooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return dbBreakerFailures > 0 && counts.ConsecutiveFailures >= uint32(dbBreakerFailures)
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			slog.Warn("🔌 Circuit breaker changed state", "breaker", name, "from", from.String(), "to", to.String())
+		},
+		IsSuccessful: func(err error) bool {
+			return !isDBOutage(err)
+		},
+	})
+}
+
+// isDBOutage reports whether err means Postgres itself is in trouble, as
+// opposed to a purchase failing on its own merits (a CHECK violation, a
+// client that went away). Only outages count toward opening the breaker.
+func isDBOutage(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || service.Refused(err) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 connection exception, 53 insufficient resources, 57 operator intervention
+		switch pgErr.Code[:2] {
+		case "08", "53", "57":
+			return true
+		}
+		return false
+	}
+	// Timeouts, refused connections, exhausted pool, ...
+	return true
+}
+
+// allowDB asks the pool high-water mark (see checkPoolSaturation) and the
+// breaker whether a purchase may open a transaction. When it may not, the
+// failure has already been reported and ok is false. Otherwise the caller
+// must pass the transaction's final error (nil on success) to done.
+func allowDB(ctx context.Context, c *gin.Context, mode string) (done func(error), ok bool) {
+	if !checkPoolSaturation(ctx, c, mode) {
+		return nil, false
+	}
+	done, err := dbBreaker.Allow()
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(dbBreakerCooldown.Seconds())+1))
+		failPurchaseDetail(ctx, c, mode, http.StatusServiceUnavailable, CodeDBUnavailable,
+			"Database is unavailable, try again shortly", fmt.Sprintf("circuit breaker %s", dbBreaker.State()))
+		return nil, false
+	}
+	return done, true
+}
+
+// breakerStatus describes the breaker for /health/ready
+func breakerStatus() gin.H {
+	counts := dbBreaker.Counts()
+	return gin.H{
+		"state":                dbBreaker.State().String(),
+		"consecutive_failures": counts.ConsecutiveFailures,
+		"failure_threshold":    dbBreakerFailures,
+		"cooldown_ms":          dbBreakerCooldown.Milliseconds(),
+	}
+}
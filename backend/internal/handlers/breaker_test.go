@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sony/gobreaker/v2"
+)
+
+// withBreaker swaps in a fresh breaker that opens after failures outages
+// and stays open for cooldown
+func withBreaker(t testing.TB, failures int, cooldown time.Duration) {
+	prevFailures, prevCooldown, prev := dbBreakerFailures, dbBreakerCooldown, dbBreaker
+	t.Cleanup(func() { dbBreakerFailures, dbBreakerCooldown, dbBreaker = prevFailures, prevCooldown, prev })
+	dbBreakerFailures, dbBreakerCooldown = failures, cooldown
+	dbBreaker = newDBBreaker()
+}
+
+// tryDB asks allowDB for a transaction, reporting err as its outcome when
+// allowed; the recorder holds the response when it was not
+func tryDB(err error) (*httptest.ResponseRecorder, bool) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/purchase", nil)
+	done, ok := allowDB(c.Request.Context(), c, ModePostgresLock)
+	if ok {
+		done(err)
+	}
+	return rec, ok
+}
+
+func TestIsDBOutage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"sold out", service.ErrSoldOut, false},
+		{"check violation", &pgconn.PgError{Code: "23514"}, false},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"dial", errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"), true},
+	} {
+		if got := isDBOutage(tc.err); got != tc.want {
+			t.Errorf("%s: isDBOutage = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDBBreakerOpensAndHalfOpens(t *testing.T) {
+	testutil.Redis(t)
+	resetStats(t)
+	withBreaker(t, 3, 100*time.Millisecond)
+	outage := &pgconn.PgError{Code: "08006", Message: "connection failure"}
+
+	// Failures that aren't outages don't count
+	for range 5 {
+		tryDB(service.ErrSoldOut)
+	}
+	if got := dbBreaker.State(); got != gobreaker.StateClosed {
+		t.Fatalf("state after refusals = %s, want closed", got)
+	}
+
+	for i := range 3 {
+		if _, ok := tryDB(outage); !ok {
+			t.Fatalf("transaction %d refused before the threshold", i+1)
+		}
+	}
+	if got := dbBreaker.State(); got != gobreaker.StateOpen {
+		t.Fatalf("state after 3 outages = %s, want open", got)
+	}
+
+	rec, ok := tryDB(nil)
+	if ok || rec.Code != http.StatusServiceUnavailable || errorOf(t, rec).Code != CodeDBUnavailable {
+		t.Fatalf("while open: status = %d: %s; want 503 %s", rec.Code, rec.Body, CodeDBUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After while open")
+	}
+
+	ready := serve(healthRouter(), http.MethodGet, "/health/ready", "")
+	var body struct {
+		Breaker struct {
+			State string `json:"state"`
+		} `json:"db_breaker"`
+	}
+	decode(t, ready, &body)
+	if ready.Code != http.StatusServiceUnavailable || body.Breaker.State != gobreaker.StateOpen.String() {
+		t.Fatalf("/health/ready: status = %d: %s; want 503 with the breaker open", ready.Code, ready.Body)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got := dbBreaker.State(); got != gobreaker.StateHalfOpen {
+		t.Fatalf("state after the cooldown = %s, want half-open", got)
+	}
+	if _, ok := tryDB(nil); !ok {
+		t.Fatal("trial transaction refused while half-open")
+	}
+	if got := dbBreaker.State(); got != gobreaker.StateClosed {
+		t.Fatalf("state after a good trial = %s, want closed", got)
+	}
+}
+
+func TestDBBreakerReturnsReservation(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	withBreaker(t, 1, time.Minute)
+	productID := testutil.Product(t, "Widget", 10)
+	tryDB(&pgconn.PgError{Code: "08006"})
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusServiceUnavailable || errorOf(t, rec).Code != CodeDBUnavailable {
+		t.Fatalf("status = %d: %s; want 503 %s", rec.Code, rec.Body, CodeDBUnavailable)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "10" {
+		t.Fatalf("Redis stock = %s, want 10: the reservation must be handed back", got)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10", got)
+	}
+}
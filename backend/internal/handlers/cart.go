@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🛒 CART: several products in one atomic purchase
+// ============================================
+// The handler validates and merges the cart; service.PurchaseService
+// reserves it in Redis (ReserveCart) and persists it (PersistCart).
+
+// Cart size limits
+const (
+	maxCartItems    = 50
+	maxItemQuantity = 100
+)
+
+type CartItem = service.CartItem
+
+type CartRequest struct {
+	UserID int        `json:"-"` // from the Bearer token
+	Items  []CartItem `json:"items" binding:"required"`
+}
+
+// mergeCartItems validates the cart and folds duplicate products together so
+// the Lua script checks each product's total quantity once
+func mergeCartItems(items []CartItem) ([]CartItem, error) {
+	if len(items) == 0 || len(items) > maxCartItems {
+		return nil, fmt.Errorf("cart must have between 1 and %d items", maxCartItems)
+	}
+
+	var merged []CartItem
+	index := map[int]int{}
+	for _, item := range items {
+		if item.ProductID <= 0 || item.Quantity <= 0 {
+			return nil, fmt.Errorf("product_id and quantity must be positive")
+		}
+		if i, ok := index[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+		} else {
+			index[item.ProductID] = len(merged)
+			merged = append(merged, item)
+		}
+	}
+	for _, item := range merged {
+		if item.Quantity > maxItemQuantity {
+			return nil, fmt.Errorf("product %d: at most %d units per cart", item.ProductID, maxItemQuantity)
+		}
+	}
+	return merged, nil
+}
+
+// PurchaseCart buys every item in the cart or none of them: one Lua script
+// reserves all stock in Redis, then one Postgres transaction persists it.
+func PurchaseCart(c *gin.Context) {
+	start := time.Now()
+	countRequest(ModeCart)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModeCart, start)
+	defer tr.end()
+
+	var req CartRequest
+	if err := bindPurchase(c, &req, &req.UserID); err != nil {
+		failPurchaseDetail(ctx, c, ModeCart, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+	items, err := mergeCartItems(req.Items)
+	if err != nil {
+		failPurchaseDetail(ctx, c, ModeCart, http.StatusBadRequest, CodeInvalidInput, "Invalid cart", err.Error())
+		return
+	}
+
+	for _, item := range items {
+		if !checkSaleWindow(ctx, c, ModeCart, item.ProductID) {
+			return
+		}
+	}
+
+	// ⚡ STEP 1: Reserve every item in Redis, all or nothing
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	cart, err := svc.ReserveCart(ctx, req.UserID, items)
+	if err != nil {
+		var itemErr *service.CartItemError
+		var limitErr *service.UserLimitError
+		productID := 0
+		if errors.As(err, &itemErr) {
+			productID = itemErr.ProductID
+		}
+		detail := fmt.Sprintf("product_id %d", productID)
+		switch {
+		case errors.Is(err, service.ErrSoldOut):
+			failPurchaseDetail(ctx, c, ModeCart, http.StatusBadRequest, CodeOutOfStock, "Out of stock!", detail)
+		case errors.As(err, &limitErr):
+			failPurchaseDetail(ctx, c, ModeCart, http.StatusTooManyRequests, CodeUserLimitExceeded,
+				fmt.Sprintf("Purchase limit of %d per user reached", limitErr.Limit), detail)
+		default:
+			failServiceError(ctx, c, ModeCart, productID, err)
+		}
+		return
+	}
+
+	// 🛡️ STEP 2: Persist every item in one PostgreSQL transaction
+	dbDone, ok := allowDB(ctx, c, ModeCart)
+	if !ok {
+		cart.Release()
+		return
+	}
+	res, err := svc.PersistCart(ctx, cart)
+	dbDone(err)
+	if err != nil {
+		failServiceError(ctx, c, ModeCart, 0, err)
+		return
+	}
+
+	recordSuccess(ModeCart, res.LowestRemaining(), time.Since(start))
+	for i, item := range items {
+		publishOrder(ModeCart, res.OrderIDs[i], req.UserID, item.ProductID, item.Quantity, res.Remaining[i])
+		publishStock(item.ProductID, res.Remaining[i], "purchase")
+	}
+
+	c.JSON(http.StatusOK, tr.attach(gin.H{
+		"message":    "Purchase successful!",
+		"mode":       ModeCart,
+		"order_ids":  res.OrderIDs,
+		"items":      items,
+		"latency_ms": time.Since(start).Milliseconds(),
+	}))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cart builds a cart from product id, quantity pairs
+func cart(pairs ...int) []CartItem {
+	var items []CartItem
+	for i := 0; i+1 < len(pairs); i += 2 {
+		items = append(items, CartItem{ProductID: pairs[i], Quantity: pairs[i+1]})
+	}
+	return items
+}
+
+func TestMergeCartItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []CartItem
+		want    []CartItem
+		wantErr bool
+	}{
+		{"empty", nil, nil, true},
+		{"one", cart(1, 2), cart(1, 2), false},
+		{"duplicates fold in first-seen order", cart(2, 1, 1, 1, 2, 3), cart(2, 4, 1, 1), false},
+		{"zero quantity", cart(1, 0), nil, true},
+		{"bad product", cart(0, 1), nil, true},
+		{"merged over the per-item cap", cart(1, maxItemQuantity, 1, 1), nil, true},
+		{"too many items", make([]CartItem, maxCartItems+1), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeCartItems(tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPurchaseCartAllOrNothing(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	plenty := testutil.Product(t, "Plenty", 10)
+	scarce := testutil.Product(t, "Scarce", 1)
+
+	r := gin.New()
+	r.POST("/purchase/cart", Authenticate(), PurchaseCart)
+	body := fmt.Sprintf(`{"items": [{"product_id": %d, "quantity": 2}, {"product_id": %d, "quantity": 2}]}`, plenty, scarce)
+	rec := serve(r, http.MethodPost, "/purchase/cart", body, "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeOutOfStock {
+		t.Fatalf("status = %d, want 400 %s: %s", rec.Code, CodeOutOfStock, rec.Body)
+	}
+	if got, _ := mr.Get(database.StockKey(plenty)); got != "10" {
+		t.Fatalf("first item's Redis stock = %s, want 10", got)
+	}
+	if got := testutil.Quantity(t, plenty); got != 10 {
+		t.Fatalf("first item's PostgreSQL quantity = %d, want 10", got)
+	}
+
+	body = fmt.Sprintf(`{"items": [{"product_id": %d, "quantity": 2}, {"product_id": %d, "quantity": 1}]}`, plenty, scarce)
+	rec = serve(r, http.MethodPost, "/purchase/cart", body, "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := testutil.Quantity(t, plenty); got != 8 {
+		t.Fatalf("first item's PostgreSQL quantity = %d, want 8", got)
+	}
+	if got := testutil.Quantity(t, scarce); got != 0 {
+		t.Fatalf("second item's PostgreSQL quantity = %d, want 0", got)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestTimeout caps how long a purchase may spend on Redis/Postgres calls
+var requestTimeout = time.Duration(config.Int("REQUEST_TIMEOUT_MS", 3000)) * time.Millisecond
+
+// requestContext derives a deadline-bound context from the client's request,
+// so a disconnect or a slow Postgres stops the purchase instead of piling up.
+func requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), requestTimeout)
+}
+
+// failPurchase counts a failed purchase and reports it. If the request context
+// has expired, the failure is reported as a 504 whichever step noticed it.
+func failPurchase(ctx context.Context, c *gin.Context, mode string, status int, code, msg string) {
+	failPurchaseDetail(ctx, c, mode, status, code, msg, "")
+}
+
+// failPurchaseDetail is failPurchase with extra context for the client
+func failPurchaseDetail(ctx context.Context, c *gin.Context, mode string, status int, code, msg, detail string) {
+	countFailure(mode)
+	if ctx.Err() != nil {
+		respondError(c, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+		return
+	}
+	respondErrorDetail(c, status, code, msg, detail)
+}
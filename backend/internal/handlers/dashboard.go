@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// statsFocusKey stores the product /stats reports on when no ?product_id= is given
+var statsFocusKey = database.Key("stats", "focus")
+
+// statsProductID resolves the product for /stats: the query param, then the
+// focus saved in Redis, then product 1.
+func statsProductID(c *gin.Context) (int, error) {
+	if raw := c.Query("product_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return 0, fmt.Errorf("invalid product_id %q", raw)
+		}
+		return id, nil
+	}
+
+	if id, err := database.Rdb.Get(c, statsFocusKey).Int(); err == nil && id > 0 {
+		return id, nil
+	}
+	return 1, nil
+}
+
+// ShowStats returns the live counters plus DB/Redis stock for one product
+func ShowStats(c *gin.Context) {
+	// Which product to report on: ?product_id= wins, then the focused product
+	productID, err := statsProductID(c)
+	if err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid product_id", err.Error())
+		return
+	}
+
+	// Get current stock from both DB and Redis
+	var dbStock int
+	database.DB.QueryRow(c, "SELECT quantity FROM products WHERE id=$1", productID).Scan(&dbStock)
+
+	redisStock, _ := database.Rdb.Get(c, database.StockKey(productID)).Int()
+
+	// Get order count
+	var orderCount int
+	database.DB.QueryRow(c, "SELECT COUNT(*) FROM orders").Scan(&orderCount)
+
+	stats := GetStats()
+	stats["db_stock"] = dbStock
+	stats["redis_stock"] = redisStock
+	stats["order_count"] = orderCount
+	stats["product_id"] = productID
+
+	respondJSONWithETag(c, http.StatusOK, stats)
+}
+
+// CompareStats returns every mode side by side, fastest first, with a "safe"
+// flag for modes that never oversold: the dashboard's leaderboard
+func CompareStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"since": statsSince().UTC(),
+		"modes": compareModes(),
+	})
+}
+
+// SetStatsFocus switches the product /stats reports on for every dashboard at once
+func SetStatsFocus(c *gin.Context) {
+	var req struct {
+		ProductID int `json:"product_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ProductID <= 0 {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input")
+		return
+	}
+
+	var exists bool
+	err := database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM products WHERE id=$1)", req.ProductID).Scan(&exists)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to look up product")
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+
+	if err := database.Rdb.Set(c, statsFocusKey, req.ProductID, 0).Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to save focus")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "✅ Stats focus updated", "product_id": req.ProductID})
+}
+
+// ResetStatsOnly zeroes the counters and latency samples between benchmark
+// runs, leaving products, orders and Redis as they are
+func ResetStatsOnly(c *gin.Context) {
+	saveStatRun(c)
+	ResetStats()
+	c.JSON(http.StatusOK, gin.H{"message": "✅ Stats reset, stock and orders untouched"})
+}
+
+// resetStock is the stock /reset restores for products seeded before
+// initial_quantity was recorded
+var resetStock = config.Int("RESET_STOCK", 100)
+
+// productScope reads the optional ?product_id= that limits /reset and
+// /sync-redis to one product; 0 means every product
+func productScope(c *gin.Context) (int, bool) {
+	return queryInt(c, "product_id", 0, 1, math.MaxInt32)
+}
+
+// ResetAll restocks every product (or just ?product_id=) to its seeded
+// quantity, clears their orders and purchase limits, and resets stats. The
+// response lists each step; 207 means Postgres was reset but Redis wasn't
+// fully.
+func ResetAll(c *gin.Context) {
+	productID, ok := productScope(c)
+	if !ok {
+		return
+	}
+
+	// Reset Postgres: stock and orders change together
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	rows, err := tx.Query(c, `
+		UPDATE products SET quantity = COALESCE(initial_quantity, $1)
+		WHERE $2 = 0 OR id = $2
+		RETURNING id, quantity`, resetStock, productID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to reset DB")
+		return
+	}
+	stock, err := pgx.CollectRows(rows, scanProductStock)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to reset DB")
+		return
+	}
+	if productID != 0 && len(stock) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+
+	if _, err := tx.Exec(c, "DELETE FROM orders WHERE $1 = 0 OR product_id = $1", productID); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to clear orders")
+		return
+	}
+	if err := tx.Commit(c); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to commit transaction")
+		return
+	}
+
+	// Postgres is reset. Every Redis step is still attempted even if an
+	// earlier one failed, and each reports how it went, so a Redis blip
+	// leaves a clear "run /sync-redis" instead of a silent half reset.
+	steps := gin.H{"postgres": resetStepStatus(nil)}
+	healthy := true
+	step := func(name string, err error) {
+		steps[name] = resetStepStatus(err)
+		if err != nil {
+			healthy = false
+			slog.Warn("⚠️ Reset step failed", "step", name, "error", err)
+		}
+	}
+
+	// Reset Redis - explicitly set each key (fixes any negative values)
+	step("redis_stock", setRedisStock(c, stock))
+
+	// Clear per-user purchase counters so limits start fresh
+	pattern := database.Key("user", "*", "product", "*", "count")
+	if productID != 0 {
+		pattern = database.Key("user", "*", "product", strconv.Itoa(productID), "count")
+	}
+	step("purchase_limits", deleteKeys(c, pattern))
+
+	// Fair mode's line and rank counters start over too
+	fairPattern := database.Key("fair", "*")
+	if productID != 0 {
+		fairPattern = database.Key("fair", strconv.Itoa(productID), "*")
+	}
+	step("fair_queue", deleteKeys(c, fairPattern))
+
+	// Nobody waits for stock that's back
+	waitlistPattern := database.Key("product", "*", "waitlist")
+	if productID != 0 {
+		waitlistPattern = waitlistKey(productID)
+	}
+	step("waitlist", deleteKeys(c, waitlistPattern))
+
+	// Reset Stats (saving them first with PERSIST_STATS)
+	saveStatRun(c)
+	ResetStats()
+	steps["stats"] = resetStepStatus(nil)
+
+	for _, p := range stock {
+		publishStock(p.ProductID, p.Stock, "reset")
+	}
+
+	if !healthy {
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"message":  "⚠️ PostgreSQL reset, but some Redis steps failed; run POST /sync-redis once Redis is back",
+			"products": stock,
+			"steps":    steps,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("✅ %d product(s) restocked, orders cleared, stats reset!", len(stock)),
+		"products": stock,
+		"steps":    steps,
+	})
+}
+
+// resetStepStatus is one entry of /reset's "steps"
+func resetStepStatus(err error) gin.H {
+	if err != nil {
+		return gin.H{"ok": false, "error": err.Error()}
+	}
+	return gin.H{"ok": true}
+}
+
+// deleteKeys removes every key matching pattern, returning the first error
+func deleteKeys(ctx context.Context, pattern string) error {
+	iter := database.Rdb.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := database.Rdb.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// productStock is one product's quantity as reported by /reset and /sync-redis
+type productStock struct {
+	ProductID int `json:"product_id"`
+	Stock     int `json:"stock"`
+}
+
+func scanProductStock(row pgx.CollectableRow) (productStock, error) {
+	var p productStock
+	err := row.Scan(&p.ProductID, &p.Stock)
+	return p, err
+}
+
+// setRedisStock writes every product's stock key in one round trip
+func setRedisStock(ctx context.Context, stock []productStock) error {
+	pipe := database.Rdb.Pipeline()
+	for _, p := range stock {
+		pipe.Set(ctx, database.StockKey(p.ProductID), p.Stock, database.StockKeyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SyncRedis copies the Postgres quantity of every product (or just
+// ?product_id=) into Redis, useful if Redis gets out of sync
+func SyncRedis(c *gin.Context) {
+	productID, ok := productScope(c)
+	if !ok {
+		return
+	}
+
+	// Ensure stock is never negative
+	rows, err := database.DB.Query(c,
+		"SELECT id, GREATEST(quantity, 0) FROM products WHERE $1 = 0 OR id = $1 ORDER BY id", productID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to read DB stock")
+		return
+	}
+	stock, err := pgx.CollectRows(rows, scanProductStock)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to read DB stock")
+		return
+	}
+	if productID != 0 && len(stock) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+
+	if err := setRedisStock(c, stock); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to sync Redis")
+		return
+	}
+
+	for _, p := range stock {
+		publishStock(p.ProductID, p.Stock, "sync")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "✅ Redis synced with PostgreSQL", "products": stock})
+}
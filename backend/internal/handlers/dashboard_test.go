@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardRouter serves the demo control routes like main.go
+func dashboardRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/stats", ShowStats)
+	r.POST("/stats/focus", SetStatsFocus)
+	r.POST("/stats/reset", ResetStatsOnly)
+	r.POST("/reset", ResetAll)
+	r.POST("/sync-redis", SyncRedis)
+	return r
+}
+
+func TestResetBadProductID(t *testing.T) {
+	r := dashboardRouter()
+	for _, path := range []string{"/reset?product_id=abc", "/sync-redis?product_id=0"} {
+		rec := serve(r, http.MethodPost, path, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", path, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestSyncRedisAllProducts(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	ids := []int{
+		testutil.Product(t, "Console", 10),
+		testutil.Product(t, "Headphones", 20),
+		testutil.Product(t, "Keyboard", 30),
+	}
+	mr.Set(database.StockKey(ids[0]), "-4") // a naive oversell
+	mr.Del(database.StockKey(ids[1]))
+	mr.Set(database.StockKey(ids[2]), "99")
+
+	// Scoped to one product, the others stay as they are
+	r := dashboardRouter()
+	if rec := serve(r, http.MethodPost, fmt.Sprintf("/sync-redis?product_id=%d", ids[2]), ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got, _ := mr.Get(database.StockKey(ids[2])); got != "30" {
+		t.Fatalf("synced stock = %s, want 30", got)
+	}
+	if got, _ := mr.Get(database.StockKey(ids[0])); got != "-4" {
+		t.Fatalf("stock outside ?product_id= = %s, want it left at -4", got)
+	}
+
+	if rec := serve(r, http.MethodPost, "/sync-redis", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	for i, want := range []string{"10", "20", "30"} {
+		if got, _ := mr.Get(database.StockKey(ids[i])); got != want {
+			t.Errorf("product %d stock = %q, want %s", ids[i], got, want)
+		}
+	}
+
+	rec := serve(r, http.MethodPost, "/sync-redis?product_id=99", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown product: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestResetAllProducts(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	ids := []int{
+		testutil.Product(t, "Console", 10),
+		testutil.Product(t, "Headphones", 20),
+		testutil.Product(t, "Keyboard", 30),
+	}
+	for _, id := range ids {
+		if _, err := database.DB.Exec(t.Context(), "UPDATE products SET quantity = 1 WHERE id = $1", id); err != nil {
+			t.Fatal(err)
+		}
+		mr.Set(database.StockKey(id), "1")
+	}
+
+	if rec := serve(dashboardRouter(), http.MethodPost, "/reset", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	for i, want := range []int{10, 20, 30} {
+		var quantity int
+		if err := database.DB.QueryRow(t.Context(), "SELECT quantity FROM products WHERE id = $1", ids[i]).Scan(&quantity); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := mr.Get(database.StockKey(ids[i])); quantity != want || got != fmt.Sprint(want) {
+			t.Errorf("product %d: quantity %d, Redis %s; want both restocked to %d", ids[i], quantity, got, want)
+		}
+	}
+}
+
+func TestResetStatsOnlyKeepsStock(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+	mr.Set(database.StockKey(productID), "4")
+	countRequest(ModePostgresLock)
+	recordSuccess(ModePostgresLock, 4, 3*time.Millisecond)
+
+	r := dashboardRouter()
+	if rec := serve(r, http.MethodPost, "/stats/reset", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := readModeCounters(ModePostgresLock); got != (modeCounters{}) {
+		t.Fatalf("postgres_lock counters = %+v after a stats reset, want zero", got)
+	}
+	var stats struct {
+		TotalRequests int64 `json:"total_requests"`
+		Success       int64 `json:"success"`
+	}
+	decode(t, serve(r, http.MethodGet, "/stats", ""), &stats)
+	if stats.TotalRequests != 0 || stats.Success != 0 {
+		t.Fatalf("/stats = %+v, want zeroed counters", stats)
+	}
+
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10 untouched", got)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "4" {
+		t.Fatalf("Redis stock = %s, want 4 untouched", got)
+	}
+}
+
+func TestResetRedisDown(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+	insertOrder(t, 1, productID, 1, OrderStatusSuccess)
+	if _, err := database.DB.Exec(t.Context(), "UPDATE products SET quantity = 3 WHERE id = $1", productID); err != nil {
+		t.Fatal(err)
+	}
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	rec := serve(dashboardRouter(), http.MethodPost, "/reset", "")
+	var body struct {
+		Steps map[string]struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		} `json:"steps"`
+	}
+	decode(t, rec, &body)
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d: %s; want 207", rec.Code, rec.Body)
+	}
+	for _, name := range []string{"postgres", "stats"} {
+		if !body.Steps[name].OK {
+			t.Errorf("step %s = %+v, want ok", name, body.Steps[name])
+		}
+	}
+	// Every Redis step was still tried, and each says why it failed
+	for _, name := range []string{"redis_stock", "purchase_limits", "fair_queue", "waitlist"} {
+		if s, ok := body.Steps[name]; !ok || s.OK || s.Error == "" {
+			t.Errorf("step %s = %+v, want a failure with its error", name, s)
+		}
+	}
+
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want Postgres restocked to 10", got)
+	}
+	var orders int
+	if err := database.DB.QueryRow(t.Context(), "SELECT COUNT(*) FROM orders").Scan(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if orders != 0 {
+		t.Fatalf("%d orders left, want them cleared", orders)
+	}
+}
+
+func TestSetStatsFocusBadBody(t *testing.T) {
+	r := dashboardRouter()
+	for _, body := range []string{"", "not json", `{}`, `{"product_id": 0}`, `{"product_id": -2}`, `{"product_id": "1"}`} {
+		rec := serve(r, http.MethodPost, "/stats/focus", body)
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%q: status = %d: %s; want 400 %s", body, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestSetStatsFocus(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	r := dashboardRouter()
+	testutil.Product(t, "First", 10)
+	focused := testutil.Product(t, "Focused", 7)
+
+	statsFor := func(query string) (productID, dbStock int) {
+		t.Helper()
+		rec := serve(r, http.MethodGet, "/stats"+query, "")
+		var body struct {
+			ProductID int `json:"product_id"`
+			DBStock   int `json:"db_stock"`
+		}
+		decode(t, rec, &body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/stats%s: status = %d: %s", query, rec.Code, rec.Body)
+		}
+		return body.ProductID, body.DBStock
+	}
+	if id, _ := statsFor(""); id != 1 {
+		t.Fatalf("no focus set: product_id = %d, want 1", id)
+	}
+
+	rec := serve(r, http.MethodPost, "/stats/focus", fmt.Sprintf(`{"product_id": %d}`, focused+1))
+	if rec.Code != http.StatusNotFound || errorOf(t, rec).Code != CodeNotFound {
+		t.Fatalf("unknown product: status = %d: %s; want 404 %s", rec.Code, rec.Body, CodeNotFound)
+	}
+	if id, _ := statsFor(""); id != 1 {
+		t.Fatalf("a refused focus changed /stats to product %d", id)
+	}
+
+	rec = serve(r, http.MethodPost, "/stats/focus", fmt.Sprintf(`{"product_id": %d}`, focused))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if id, stock := statsFor(""); id != focused || stock != 7 {
+		t.Fatalf("/stats = product %d with %d in stock, want the focused product %d with 7", id, stock, focused)
+	}
+	// ?product_id= still wins over the focus
+	if id, _ := statsFor("?product_id=1"); id != 1 {
+		t.Fatalf("/stats?product_id=1 reported product %d", id)
+	}
+}
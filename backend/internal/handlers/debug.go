@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🧪 DEBUG: how wide is Naive mode's race window?
+// ============================================
+
+// raceRead is what one simulated naive buyer saw
+type raceRead struct {
+	Quantity int  `json:"quantity_read"`
+	Proceeds bool `json:"would_proceed"`
+}
+
+// DebugRace replays Naive mode's read -> sleep -> write window with two
+// goroutines, without writing anything, and estimates how often real traffic
+// collides inside that window.
+//
+// The estimate treats naive arrivals as a Poisson process at the rate seen
+// since stats were last reset: P(another request lands in the window) is
+// 1 - e^(-rate * window).
+func DebugRace(c *gin.Context) {
+	productID, ok := queryInt(c, "product_id", 1, 1, math.MaxInt32)
+	if !ok {
+		return
+	}
+	delay, ok := naiveDelayFor(c)
+	if !ok {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "delay_ms must be an integer")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, delay+requestTimeout)
+	defer cancel()
+
+	// Two buyers read at the same moment, then both wait out the delay
+	reads := make([]raceRead, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range reads {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var quantity int
+			errs[i] = database.DB.QueryRow(ctx,
+				"SELECT quantity FROM products WHERE id=$1", productID).Scan(&quantity)
+			reads[i] = raceRead{Quantity: quantity, Proceeds: quantity > 0}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to read stock")
+			return
+		}
+	}
+
+	// Both proceeding on the same reading means both would decrement it
+	bothProceed := reads[0].Proceeds && reads[1].Proceeds
+	oversell := bothProceed && reads[0].Quantity < 2
+
+	elapsed := time.Since(statsSince()).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(atomic.LoadInt64(&modes[ModeNaive].requests)) / elapsed
+	}
+	probability := 1 - math.Exp(-rate*delay.Seconds())
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":            productID,
+		"delay_ms":              delay.Milliseconds(),
+		"default_delay_ms":      naiveDelay.Milliseconds(),
+		"readers":               reads,
+		"both_proceed":          bothProceed,
+		"would_oversell":        oversell,
+		"naive_requests_per_s":  rate,
+		"collision_probability": probability,
+	})
+}
+
+// ============================================
+// 🧪 DEBUG: PostgreSQL pool saturation
+// ============================================
+
+// PoolStats reports the pgxpool counters, to see whether purchases are
+// queueing for a connection during an attack: acquired at max_conns and a
+// growing empty_acquire_count mean the pool, not Postgres, is the bottleneck
+func PoolStats(c *gin.Context) {
+	s := database.DB.Stat()
+
+	avgAcquire := float64(0)
+	if n := s.AcquireCount(); n > 0 {
+		avgAcquire = float64(s.AcquireDuration().Microseconds()) / 1000 / float64(n)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"acquired_conns":             s.AcquiredConns(),
+		"idle_conns":                 s.IdleConns(),
+		"constructing_conns":         s.ConstructingConns(),
+		"total_conns":                s.TotalConns(),
+		"max_conns":                  s.MaxConns(),
+		"acquire_count":              s.AcquireCount(),
+		"empty_acquire_count":        s.EmptyAcquireCount(),
+		"canceled_acquire_count":     s.CanceledAcquireCount(),
+		"acquire_duration_ms":        s.AcquireDuration().Milliseconds(),
+		"avg_acquire_ms":             avgAcquire,
+		"new_conns_count":            s.NewConnsCount(),
+		"max_lifetime_destroy_count": s.MaxLifetimeDestroyCount(),
+		"max_idle_destroy_count":     s.MaxIdleDestroyCount(),
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// raceReport is a GET /debug/race response
+type raceReport struct {
+	DelayMs              int64      `json:"delay_ms"`
+	DefaultDelayMs       int64      `json:"default_delay_ms"`
+	Readers              []raceRead `json:"readers"`
+	BothProceed          bool       `json:"both_proceed"`
+	WouldOversell        bool       `json:"would_oversell"`
+	CollisionProbability float64    `json:"collision_probability"`
+}
+
+func TestDebugRaceBadInput(t *testing.T) {
+	r := gin.New()
+	r.GET("/debug/race", DebugRace)
+	for _, query := range []string{"product_id=0", "product_id=x", "delay_ms=soon"} {
+		rec := serve(r, http.MethodGet, "/debug/race?"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestDebugRace(t *testing.T) {
+	testutil.Postgres(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Last one", 1)
+	r := gin.New()
+	r.GET("/debug/race", DebugRace)
+
+	race := func(query string) raceReport {
+		t.Helper()
+		rec := serve(r, http.MethodGet, fmt.Sprintf("/debug/race?product_id=%d%s", productID, query), "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var report raceReport
+		decode(t, rec, &report)
+		return report
+	}
+
+	report := race("")
+	if report.DelayMs != naiveDelay.Milliseconds() || report.DefaultDelayMs != naiveDelay.Milliseconds() {
+		t.Fatalf("delay %dms (default %dms), want the configured %s", report.DelayMs, report.DefaultDelayMs, naiveDelay)
+	}
+	// With one unit left, both readers see it and both would sell it
+	if len(report.Readers) != 2 || !report.BothProceed || !report.WouldOversell {
+		t.Fatalf("report = %+v, want both readers proceeding into an oversell", report)
+	}
+	if report.CollisionProbability != 0 {
+		t.Fatalf("collision probability = %v with no naive traffic, want 0", report.CollisionProbability)
+	}
+
+	if report := race("&delay_ms=20"); report.DelayMs != 20 || report.DefaultDelayMs != naiveDelay.Milliseconds() {
+		t.Fatalf("?delay_ms=20 reported %dms (default %dms)", report.DelayMs, report.DefaultDelayMs)
+	}
+	if got := testutil.Quantity(t, productID); got != 1 {
+		t.Fatalf("quantity = %d; /debug/race must not write", got)
+	}
+}
+
+// poolRouter serves /debug/pool behind RequireAdmin like main.go
+func poolRouter(t testing.TB) *gin.Engine {
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = "" })
+	r := gin.New()
+	r.GET("/debug/pool", RequireAdmin(), PoolStats)
+	return r
+}
+
+func TestPoolStatsRequiresAdmin(t *testing.T) {
+	rec := serve(poolRouter(t), http.MethodGet, "/debug/pool", "", AdminTokenHeader, "wrong")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	testutil.Postgres(t)
+	conn, err := database.DB.Acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	rec := serve(poolRouter(t), http.MethodGet, "/debug/pool", "", AdminTokenHeader, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var stats map[string]any
+	decode(t, rec, &stats)
+	for _, field := range []string{
+		"acquired_conns", "idle_conns", "constructing_conns", "total_conns", "max_conns",
+		"acquire_count", "empty_acquire_count", "canceled_acquire_count",
+		"acquire_duration_ms", "avg_acquire_ms", "new_conns_count",
+		"max_lifetime_destroy_count", "max_idle_destroy_count",
+	} {
+		if _, ok := stats[field].(float64); !ok {
+			t.Errorf("%s = %v, want a number", field, stats[field])
+		}
+	}
+	if acquired, _ := stats["acquired_conns"].(float64); acquired < 1 {
+		t.Errorf("acquired_conns = %v with a connection held, want at least 1", acquired)
+	}
+	total, _ := stats["total_conns"].(float64)
+	if maxConns, _ := stats["max_conns"].(float64); total > maxConns {
+		t.Errorf("total_conns = %v above max_conns %v", total, maxConns)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// ============================================
+// 📦 RESPONSE TYPES
+// ============================================
+// Rows are scanned into these instead of map[string]interface{} so every
+// field has one JSON type whatever the driver hands back: prices are exact
+// Money, timestamps are RFC 3339.
+
+// Money is an exact amount with at most two decimals, on top of
+// shopspring/decimal. It scans from a NUMERIC column without going through
+// float64 and is written to JSON as a number with two decimals (999.00), so
+// 0.1 + 0.2 never turns into 0.30000000000000004.
+type Money struct {
+	decimal.Decimal
+}
+
+// NewMoney parses an amount such as "999.00"; it panics on anything else,
+// so it is for constants
+func NewMoney(s string) Money {
+	return Money{decimal.RequireFromString(s)}
+}
+
+// Scan implements sql.Scanner, rounding anything finer than a cent half away
+// from zero
+func (m *Money) Scan(src any) error {
+	if src == nil {
+		return errors.New("money: NULL")
+	}
+	var d decimal.Decimal
+	if err := d.Scan(src); err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	m.Decimal = d.Round(2)
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer so Money is written back exactly
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: m.Coefficient(), Exp: m.Exponent(), Valid: true}, nil
+}
+
+func (m Money) String() string {
+	return m.StringFixed(2)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a number or a numeric string with at most two decimals
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return fmt.Errorf("money: %q is not a number", s)
+	}
+	if !d.Equal(d.Round(2)) {
+		return fmt.Errorf("money: %q has more than two decimals", s)
+	}
+	m.Decimal = d
+	return nil
+}
+
+// ProductDTO is a product as the catalog endpoints return it
+type ProductDTO struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Quantity int    `json:"quantity"`
+}
+
+// OrderDTO is an order as /orders and /orders/export return it
+type OrderDTO struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id"` // orders.user_id is nullable (no foreign key to users)
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// orderColumns are the orders columns scanOrder reads, in order
+const orderColumns = "id, user_id, product_id, quantity, status, created_at"
+
+func scanOrder(row pgx.Row, o *OrderDTO) error {
+	return row.Scan(&o.ID, &o.UserID, &o.ProductID, &o.Quantity, &o.Status, &o.CreatedAt)
+}
+
+// productColumns are the products columns a ProductDTO is scanned from
+const productColumns = "id, name, price, quantity"
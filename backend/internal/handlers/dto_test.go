@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`999`, `999.00`},
+		{`999.5`, `999.50`},
+		{`"12.34"`, `12.34`},
+		{`0`, `0.00`},
+		{`-1.05`, `-1.05`},
+		{`1.500`, `1.50`},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.in), &m); err != nil {
+			t.Fatalf("unmarshal %s: %v", tt.in, err)
+		}
+		out, err := json.Marshal(m)
+		if err != nil || string(out) != tt.want {
+			t.Fatalf("marshal %s = %s (%v), want %s", tt.in, out, err, tt.want)
+		}
+		var back Money
+		if err := json.Unmarshal(out, &back); err != nil || !back.Equal(m.Decimal) {
+			t.Fatalf("%s didn't round-trip: got %s (%v)", out, back, err)
+		}
+	}
+
+	for _, bad := range []string{`12.345`, `"abc"`, `true`, `""`} {
+		var m Money
+		if err := json.Unmarshal([]byte(bad), &m); err == nil {
+			t.Errorf("unmarshal %s: got %s, want an error", bad, m)
+		}
+	}
+}
+
+func TestMoneyIsExact(t *testing.T) {
+	sum := Money{NewMoney("0.1").Add(NewMoney("0.2").Decimal)}
+	if sum.String() != "0.30" {
+		t.Fatalf("0.1 + 0.2 = %s, want 0.30", sum)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want string
+	}{
+		{"999.00", "999.00"},
+		{"12.345", "12.35"}, // half away from zero
+		{"-12.345", "-12.35"},
+		{"0.004", "0.00"},
+		{int64(5), "5.00"},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil {
+			t.Fatalf("scan %v: %v", tt.src, err)
+		}
+		if m.String() != tt.want {
+			t.Fatalf("scan %v = %s, want %s", tt.src, m, tt.want)
+		}
+	}
+	var m Money
+	if err := m.Scan(nil); err == nil {
+		t.Fatal("scan NULL: want an error")
+	}
+}
+
+func TestMoneyNumericValue(t *testing.T) {
+	n, err := NewMoney("1234.50").NumericValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Valid || n.Int.Int64() != 123450 || n.Exp != -2 {
+		t.Fatalf("NumericValue = %v e%d, want 123450e-2", n.Int, n.Exp)
+	}
+}
+
+func TestOrderDTOJSON(t *testing.T) {
+	userID := 7
+	created := time.Date(2026, 3, 1, 12, 30, 45, 0, time.FixedZone("IST", 5*3600+1800))
+	out, err := json.Marshal(OrderDTO{ID: 1, UserID: &userID, ProductID: 2, Quantity: 1, Status: OrderStatusSuccess, CreatedAt: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["created_at"] != "2026-03-01T12:30:45+05:30" {
+		t.Fatalf("created_at = %v, want RFC 3339", got["created_at"])
+	}
+	if _, err := time.Parse(time.RFC3339, got["created_at"].(string)); err != nil {
+		t.Fatalf("created_at doesn't parse as RFC 3339: %v", err)
+	}
+	if got["user_id"] != float64(7) {
+		t.Fatalf("user_id = %v, want 7", got["user_id"])
+	}
+
+	out, _ = json.Marshal(OrderDTO{ID: 1, ProductID: 2, Quantity: 1, Status: OrderStatusSuccess, CreatedAt: created})
+	if !strings.Contains(string(out), `"user_id":null`) {
+		t.Fatalf("order without a user: %s, want user_id null", out)
+	}
+	if rec := (OrderDTO{ID: 1, ProductID: 2, CreatedAt: created}).csvRecord(); rec[1] != "" {
+		t.Fatalf("CSV user_id = %q, want empty", rec[1])
+	}
+}
+
+func TestListOrdersCreatedAt(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Widget", 10)
+	insertOrder(t, 1, productID, 1, OrderStatusSuccess)
+
+	r := gin.New()
+	r.GET("/orders", ListOrders)
+	rec := serve(r, http.MethodGet, "/orders", "")
+	var body struct {
+		Orders []struct {
+			UserID    *int   `json:"user_id"`
+			CreatedAt string `json:"created_at"`
+		} `json:"orders"`
+	}
+	decode(t, rec, &body)
+	if len(body.Orders) != 1 {
+		t.Fatalf("%d orders, want 1", len(body.Orders))
+	}
+	if _, err := time.Parse(time.RFC3339, body.Orders[0].CreatedAt); err != nil {
+		t.Fatalf("created_at %q is not RFC 3339: %v", body.Orders[0].CreatedAt, err)
+	}
+	if body.Orders[0].UserID == nil || *body.Orders[0].UserID != 1 {
+		t.Fatalf("user_id = %v, want 1", body.Orders[0].UserID)
+	}
+}
+
+func TestOrderCreatedAtNonUTCSession(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	// A session whose TimeZone is far from UTC writes the order with the
+	// column default, then reads it back
+	conn, err := database.DB.Acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(t.Context(), "SET TimeZone = 'Asia/Kolkata'"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Exec(context.Background(), "RESET TimeZone") })
+
+	var id int
+	err = conn.QueryRow(t.Context(),
+		"INSERT INTO orders (user_id, product_id, quantity, status) VALUES (1, $1, 1, $2) RETURNING id",
+		productID, OrderStatusSuccess).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o OrderDTO
+	if err := scanOrder(conn.QueryRow(t.Context(), "SELECT "+orderColumns+" FROM orders WHERE id=$1", id), &o); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(o.CreatedAt); d < -time.Minute || d > time.Minute {
+		t.Fatalf("created_at = %s, %s from now; want the instant the order was written", o.CreatedAt, d)
+	}
+
+	out, _ := json.Marshal(o)
+	var got struct {
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil || !got.CreatedAt.Equal(o.CreatedAt) {
+		t.Fatalf("created_at JSON %s doesn't round-trip as RFC 3339: %v", out, err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import "github.com/gin-gonic/gin"
+
+// Machine-readable error codes returned to clients
+const (
+	CodeInvalidInput    = "INVALID_INPUT"
+	CodeOutOfStock      = "OUT_OF_STOCK"
+	CodeNotFound        = "NOT_FOUND"
+	CodeDBError         = "DB_ERROR"
+	CodeDBUnavailable   = "DB_UNAVAILABLE"
+	CodeRedisError      = "REDIS_ERROR"
+	CodeRedisNotSeeded  = "REDIS_NOT_SEEDED"
+	CodeTransactionFail = "TRANSACTION_FAILED"
+	CodeTimeout         = "TIMEOUT"
+	CodeLockTimeout     = "LOCK_TIMEOUT"
+	CodeLockContended   = "LOCK_CONTENDED"
+	CodeInternal        = "INTERNAL_ERROR"
+
+	CodeConstraintViolation = "CONSTRAINT_VIOLATION"
+
+	CodeInvalidTransition = "INVALID_TRANSITION"
+
+	CodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	CodeUserLimitExceeded     = "USER_LIMIT_EXCEEDED"
+	CodePaymentFailed         = "PAYMENT_FAILED"
+	CodeSaleNotStarted        = "SALE_NOT_STARTED"
+	CodeSaleEnded             = "SALE_ENDED"
+
+	CodeQueueTokenRequired = "QUEUE_TOKEN_REQUIRED"
+	CodeInvalidQueueToken  = "INVALID_QUEUE_TOKEN"
+	CodeQueueNotAdmitted   = "QUEUE_NOT_ADMITTED"
+
+	CodeRateLimited = "RATE_LIMITED"
+
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+
+	CodeOverloaded    = "OVERLOADED"
+	CodePoolSaturated = "POOL_SATURATED"
+
+	CodeDBTimeout = "DB_TIMEOUT"
+
+	CodeSerializationFailure = "SERIALIZATION_FAILURE"
+
+	CodeInStock = "IN_STOCK"
+
+	CodeProductNotFound = "PRODUCT_NOT_FOUND"
+
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeForbidden    = "FORBIDDEN"
+	CodeEmailTaken   = "EMAIL_TAKEN"
+)
+
+// APIError is the body of every error response, wrapped as {"error": {...}}
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// respondError aborts the request with a structured error body
+func respondError(c *gin.Context, status int, code, msg string) {
+	respondErrorDetail(c, status, code, msg, "")
+}
+
+// respondErrorDetail is respondError with extra context for debugging
+func respondErrorDetail(c *gin.Context, status int, code, msg, detail string) {
+	c.Set(ctxErrorCode, code)
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": APIError{Code: code, Message: msg, Detail: detail},
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondErrorShape(t *testing.T) {
+	r := gin.New()
+	r.GET("/plain", func(c *gin.Context) { respondError(c, http.StatusNotFound, CodeNotFound, "Product not found") })
+	r.GET("/detail", func(c *gin.Context) {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", "quantity must be at least 1")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/plain", http.StatusNotFound, `{"error":{"code":"NOT_FOUND","message":"Product not found"}}`},
+		{"/detail", http.StatusBadRequest, `{"error":{"code":"INVALID_INPUT","message":"Invalid input","detail":"quantity must be at least 1"}}`},
+	}
+	for _, tt := range tests {
+		rec := serve(r, http.MethodGet, tt.path, "")
+		if rec.Code != tt.status || rec.Body.String() != tt.want {
+			t.Errorf("%s: %d %s, want %d %s", tt.path, rec.Code, rec.Body, tt.status, tt.want)
+		}
+	}
+}
+
+func TestPurchaseBadInput(t *testing.T) {
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseNaive)
+
+	tests := []struct {
+		name, body, detail string
+	}{
+		{"missing product", `{}`, "product_id is required"},
+		{"negative quantity", `{"product_id": 1, "quantity": -1}`, "quantity must be at least 1"},
+		{"malformed", `{"product_id": `, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		rec := serve(r, http.MethodPost, "/purchase", tt.body, "Authorization", bearer(t, 1))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400: %s", tt.name, rec.Code, rec.Body)
+		}
+		got := errorOf(t, rec)
+		if got.Code != CodeInvalidInput || got.Message == "" || !strings.Contains(got.Detail, tt.detail) {
+			t.Errorf("%s: error = %+v, want %s mentioning %q", tt.name, got, CodeInvalidInput, tt.detail)
+		}
+	}
+}
+
+func TestPurchaseOutOfStock(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Gone", 0)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchasePostgresLock)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID), "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+
+	// Exactly {"error": {"code", "message"}}, nothing else
+	var body map[string]map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body) != 1 {
+		t.Fatalf("body = %s, want only an error object", rec.Body)
+	}
+	if body["error"]["code"] != CodeOutOfStock || body["error"]["message"] == "" {
+		t.Fatalf("error = %v, want %s with a message", body["error"], CodeOutOfStock)
+	}
+}
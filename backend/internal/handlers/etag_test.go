@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`W/"xyz"`, false},
+		{`"xyz", W/"abc"`, true},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRespondJSONWithETag(t *testing.T) {
+	body := gin.H{"n": 1}
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { respondJSONWithETag(c, http.StatusOK, body) })
+
+	rec := serve(r, http.MethodGet, "/", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.String() != `{"n":1}` {
+		t.Fatalf("status = %d, ETag %q: %s; want 200 with an ETag", rec.Code, etag, rec.Body)
+	}
+
+	rec = serve(r, http.MethodGet, "/", "", "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("unchanged: status = %d: %s; want an empty 304", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Fatalf("304 ETag = %q, want %q", got, etag)
+	}
+
+	body["n"] = 2
+	rec = serve(r, http.MethodGet, "/", "", "If-None-Match", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("changed: status = %d, ETag %q; want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	r := gin.New()
+	r.GET("/products", ListProducts)
+	r.GET("/stats", ShowStats)
+	r.POST("/purchase", Authenticate(), PurchasePostgresLock)
+	body := fmt.Sprintf(`{"product_id": %d, "quantity": 1}`, productID)
+
+	for userID, path := range []string{"/products", fmt.Sprintf("/stats?product_id=%d", productID)} {
+		rec := serve(r, http.MethodGet, path, "")
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: status = %d, ETag %q; want 200 with an ETag", path, rec.Code, etag)
+		}
+
+		rec = serve(r, http.MethodGet, path, "", "If-None-Match", etag)
+		if rec.Code != http.StatusNotModified {
+			t.Fatalf("%s unchanged: status = %d: %s; want 304", path, rec.Code, rec.Body)
+		}
+
+		rec = serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, userID+1))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("purchase: status = %d: %s", rec.Code, rec.Body)
+		}
+		rec = serve(r, http.MethodGet, path, "", "If-None-Match", etag)
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Fatalf("%s after a purchase: status = %d, ETag %q; want 200 with a new ETag", path, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+}
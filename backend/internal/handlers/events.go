@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// ============================================
+// 🔔 LIVE EVENTS (WebSocket + SSE)
+// ============================================
+// Purchase handlers publish an OrderEvent after each successful insert, and
+// every stock change (and waitlist turn) goes out on a Redis channel so all
+// instances hear it (see RunStockSubscriber). The hub fans both out to connected /ws/orders
+// and /stats/stream clients.
+
+// OrderEvent is the JSON message sent to WebSocket clients for each new order
+type OrderEvent struct {
+	Type      string    `json:"type"`
+	OrderID   int       `json:"order_id"`
+	Mode      string    `json:"mode"`
+	UserID    int       `json:"user_id"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Remaining int       `json:"remaining"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	hubSendBuffer  = 16               // messages queued per client before it counts as slow
+	wsWriteTimeout = 10 * time.Second // max time for one write to a client
+	wsPingEvery    = 30 * time.Second // keeps idle connections (and proxies) alive
+)
+
+// StockEvent is published whenever a product's stock changes
+type StockEvent struct {
+	Type      string `json:"type"`
+	ProductID int    `json:"product_id"`
+	Stock     int    `json:"stock"`
+	Reason    string `json:"reason"` // purchase, cancel, restock, adjust, reset, sync
+}
+
+// stockChannel is the Redis pub/sub channel stock changes are published on.
+// Channels ignore REDIS_DB, so the default carries the key prefix instead.
+var stockChannel = config.String("STOCK_CHANNEL", database.Key("stock", "updates"))
+
+// hubClient is one live subscriber; the hub writes to send, the handler drains it
+type hubClient struct {
+	send chan []byte
+}
+
+// eventHub owns the client set; only run() touches it, everything else talks
+// to it over the channels
+type eventHub struct {
+	register   chan *hubClient
+	unregister chan *hubClient
+	broadcast  chan []byte
+	done       chan struct{}
+	clients    map[*hubClient]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		register:   make(chan *hubClient),
+		unregister: make(chan *hubClient),
+		broadcast:  make(chan []byte, 256),
+		done:       make(chan struct{}),
+		clients:    map[*hubClient]bool{},
+	}
+}
+
+var liveHub = newEventHub()
+
+// RunEventHub delivers live events to connected clients until ctx is cancelled
+func RunEventHub(ctx context.Context) {
+	liveHub.run(ctx)
+}
+
+func (h *eventHub) run(ctx context.Context) {
+	defer close(h.done)
+	for {
+		select {
+		case <-ctx.Done():
+			for client := range h.clients {
+				h.drop(client)
+			}
+			return
+		case client := <-h.register:
+			h.clients[client] = true
+		case client := <-h.unregister:
+			if h.clients[client] {
+				h.drop(client)
+			}
+		case msg := <-h.broadcast:
+			for client := range h.clients {
+				select {
+				case client.send <- msg:
+				default:
+					// Too slow to keep up: drop it rather than stall everyone
+					h.drop(client)
+				}
+			}
+		}
+	}
+}
+
+// drop forgets a client; closing send makes its writePump hang up
+func (h *eventHub) drop(client *hubClient) {
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// subscribe registers a new client, or returns nil once the hub has stopped
+func (h *eventHub) subscribe() *hubClient {
+	client := &hubClient{send: make(chan []byte, hubSendBuffer)}
+	select {
+	case h.register <- client:
+		return client
+	case <-h.done:
+		return nil
+	}
+}
+
+// unsubscribe removes a client; safe to call after the hub has dropped it
+func (h *eventHub) unsubscribe(client *hubClient) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// publish queues a message for every client without ever blocking a purchase
+func (h *eventHub) publish(msg []byte) {
+	select {
+	case h.broadcast <- msg:
+	default:
+		slog.Warn("⚠️ Event hub backlog full, dropping event")
+	}
+}
+
+// publishOrder announces a successful purchase to /ws/orders clients
+func publishOrder(mode string, orderID, userID, productID, quantity, remaining int) {
+	msg, err := json.Marshal(OrderEvent{
+		Type:      "order_created",
+		OrderID:   orderID,
+		Mode:      mode,
+		UserID:    userID,
+		ProductID: productID,
+		Quantity:  quantity,
+		Remaining: remaining,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+	liveHub.publish(msg)
+}
+
+// publishStock announces a product's new stock on the Redis channel, so every
+// instance's subscriber (including this one's) forwards it to its clients,
+// and hands it to the low-stock watcher
+func publishStock(productID, stock int, reason string) {
+	watchLowStock(productID, stock)
+	announceStock(productID, stock, reason)
+}
+
+// publishReservedStock is publishStock for a purchase gated by a Redis
+// reservation. The event carries the Postgres stock like every other, but
+// the watcher gets the Redis counter the reserve script left: with
+// ORDER_BATCH or reservations in flight the two differ, and Redis is the one
+// buyers are refused on.
+func publishReservedStock(productID, stock int, reserved int64) {
+	watchLowStock(productID, int(reserved))
+	announceStock(productID, stock, "purchase")
+}
+
+// announceStock publishes a stock_changed event without the watcher
+func announceStock(productID, stock int, reason string) {
+	msg, err := json.Marshal(StockEvent{Type: "stock_changed", ProductID: productID, Stock: stock, Reason: reason})
+	if err != nil {
+		return
+	}
+	if err := database.Rdb.Publish(context.Background(), stockChannel, msg).Err(); err != nil {
+		slog.Warn("⚠️ Failed to publish stock update", "product_id", productID, "error", err)
+	}
+}
+
+// RunStockSubscriber relays stock updates from Redis to the local hub until ctx is cancelled
+func RunStockSubscriber(ctx context.Context) {
+	sub := database.Rdb.Subscribe(ctx, stockChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			liveHub.publish([]byte(msg.Payload))
+		}
+	}
+}
+
+// The feed is read-only and carries no secrets, so any dashboard origin may connect
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// OrderFeed upgrades to a WebSocket and streams an OrderEvent for every new
+// order, plus a StockEvent for every stock change
+func OrderFeed(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade already wrote the error response
+	}
+
+	hub := liveHub
+	client := hub.subscribe()
+	if client == nil {
+		conn.Close()
+		return
+	}
+
+	go writePump(conn, client)
+	readPump(conn)
+	hub.unsubscribe(client)
+}
+
+// readPump discards client messages; it returns once the connection is gone
+func readPump(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump sends queued events and pings until the hub closes send or a write fails
+func writePump(conn *websocket.Conn, client *hubClient) {
+	ping := time.NewTicker(wsPingEvery)
+	defer func() {
+		ping.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// dialOrderFeed connects a WebSocket client to /ws/orders on srv and waits
+// until the hub has registered it
+func dialOrderFeed(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// The hub registers the client just after the upgrade, so keep announcing
+	// a marker until the first one arrives
+	done := make(chan struct{})
+	go func() {
+		for {
+			liveHub.publish([]byte(`{"type":"hello"}`))
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	defer close(done)
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != `{"type":"hello"}` {
+		t.Fatalf("first message = %s (%v), want the marker", msg, err)
+	}
+	return conn
+}
+
+// nextOrder reads messages until an order_created event
+func nextOrder(t *testing.T, conn *websocket.Conn) OrderEvent {
+	t.Helper()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("no order event: %v", err)
+		}
+		var event OrderEvent
+		if json.Unmarshal(msg, &event) == nil && event.Type == "order_created" {
+			return event
+		}
+	}
+}
+
+func TestOrderFeed(t *testing.T) {
+	startHub(t)
+	r := gin.New()
+	r.GET("/ws/orders", OrderFeed)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	conn := dialOrderFeed(t, srv)
+
+	publishOrder(ModeFair, 42, 7, 3, 2, 18)
+	event := nextOrder(t, conn)
+	if event.OrderID != 42 || event.Mode != ModeFair || event.UserID != 7 || event.ProductID != 3 ||
+		event.Quantity != 2 || event.Remaining != 18 || event.CreatedAt.IsZero() {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+func TestOrderFeedPurchase(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	startHub(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	r := gin.New()
+	r.GET("/ws/orders", OrderFeed)
+	r.POST("/purchase/postgres", PurchasePostgresLock)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	conn := dialOrderFeed(t, srv)
+
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	if rec := serve(r, http.MethodPost, "/purchase/postgres", body, "Authorization", bearer(t, 5)); rec.Code != http.StatusOK {
+		t.Fatalf("purchase: status = %d: %s", rec.Code, rec.Body)
+	}
+	event := nextOrder(t, conn)
+	if event.Mode != ModePostgresLock || event.UserID != 5 || event.ProductID != productID || event.Remaining != 9 {
+		t.Fatalf("event = %+v, want user 5's postgres_lock order leaving 9", event)
+	}
+}
+
+func TestHubDropsSlowClient(t *testing.T) {
+	startHub(t)
+	slow := liveHub.subscribe()
+
+	// Nobody drains slow, so the message past its buffer gets it dropped
+	for range hubSendBuffer + 1 {
+		liveHub.publish([]byte(`{}`))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(slow.send) < hubSendBuffer {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d messages delivered", len(slow.send), hubSendBuffer)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Broadcasts go out in order, so once a later client sees a marker the
+	// message that overflowed slow has been handled too
+	probe := liveHub.subscribe()
+	defer liveHub.unsubscribe(probe)
+	liveHub.publish([]byte(`{"type":"marker"}`))
+	for msg := range probe.send {
+		if string(msg) == `{"type":"marker"}` {
+			break
+		}
+	}
+
+	received := 0
+	for range slow.send {
+		received++
+	}
+	if received != hubSendBuffer {
+		t.Fatalf("got %d messages before the drop, want %d", received, hubSendBuffer)
+	}
+	liveHub.unsubscribe(slow) // already gone; must not block or panic
+}
+
+func TestStockEventsReachEverySubscriber(t *testing.T) {
+	testutil.Redis(t)
+
+	// Two instances, each with its own subscription
+	var subs []*redis.PubSub
+	for range 2 {
+		sub := database.Rdb.Subscribe(t.Context(), stockChannel)
+		defer sub.Close()
+		if _, err := sub.Receive(t.Context()); err != nil { // the subscribe confirmation
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	publishStock(3, 7, "purchase")
+	for i, sub := range subs {
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		msg, err := sub.ReceiveMessage(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("subscriber %d: %v", i, err)
+		}
+		var event StockEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event != (StockEvent{Type: "stock_changed", ProductID: 3, Stock: 7, Reason: "purchase"}) {
+			t.Fatalf("subscriber %d got %+v", i, event)
+		}
+	}
+}
+
+func TestStockSubscriberFeedsHub(t *testing.T) {
+	mr := testutil.Redis(t)
+	startHub(t)
+	client := liveHub.subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		RunStockSubscriber(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	for deadline := time.Now().Add(5 * time.Second); mr.PubSubNumSub(stockChannel)[stockChannel] == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	publishStock(4, 0, "reset")
+	select {
+	case msg := <-client.send:
+		if !strings.Contains(string(msg), `"product_id":4`) || !strings.Contains(string(msg), `"reason":"reset"`) {
+			t.Fatalf("hub got %s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stock event never reached the hub")
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportBatch is how many orders each c.Stream step writes before flushing
+const exportBatch = 500
+
+var exportCSVHeader = []string{"id", "user_id", "product_id", "quantity", "status", "created_at"}
+
+func (o OrderDTO) csvRecord() []string {
+	userID := ""
+	if o.UserID != nil {
+		userID = strconv.Itoa(*o.UserID)
+	}
+	return []string{
+		strconv.Itoa(o.ID),
+		userID,
+		strconv.Itoa(o.ProductID),
+		strconv.Itoa(o.Quantity),
+		o.Status,
+		o.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ExportOrders downloads every order (or those matching /orders' filters) as
+// ?format=csv (default) or json. Rows are streamed straight from the cursor
+// to the client, so a big sale's orders never sit in memory all at once.
+func ExportOrders(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Unknown format", "use csv or json")
+		return
+	}
+	where, args, ok := orderFilters(c)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.Query(c,
+		"SELECT "+orderColumns+" FROM orders"+where+" ORDER BY id", args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load orders")
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("orders-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Each format opens, writes one order, hands buffered output to the
+	// connection, and closes the document
+	var begin func() error
+	var write func(OrderDTO) error
+	flush := func() {}
+	var end func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		begin = func() error { return w.Write(exportCSVHeader) }
+		write = func(o OrderDTO) error { return w.Write(o.csvRecord()) }
+		flush = w.Flush
+		end = func() error { w.Flush(); return w.Error() }
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(c.Writer)
+		first := true
+		begin = func() error { _, err := io.WriteString(c.Writer, "["); return err }
+		write = func(o OrderDTO) error {
+			if !first {
+				if _, err := io.WriteString(c.Writer, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return enc.Encode(o)
+		}
+		end = func() error { _, err := io.WriteString(c.Writer, "]\n"); return err }
+	}
+
+	// Headers are sent with the first byte, so from here on a failure can
+	// only cut the download short and be logged
+	if err := begin(); err != nil {
+		slog.Warn("⚠️ Order export aborted", "error", err)
+		return
+	}
+	var streamErr error
+	c.Stream(func(io.Writer) bool {
+		defer flush() // c.Stream flushes the connection right after
+		for i := 0; i < exportBatch; i++ {
+			if !rows.Next() {
+				return false
+			}
+			var o OrderDTO
+			if streamErr = scanOrder(rows, &o); streamErr != nil {
+				return false
+			}
+			if streamErr = write(o); streamErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if streamErr == nil {
+		streamErr = rows.Err()
+	}
+	if streamErr != nil {
+		slog.Warn("⚠️ Order export aborted", "error", streamErr)
+		return
+	}
+	if err := end(); err != nil {
+		slog.Warn("⚠️ Order export aborted", "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func exportRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/orders/export", ExportOrders)
+	return r
+}
+
+func TestOrderCSVRecord(t *testing.T) {
+	userID := 7
+	created := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	o := OrderDTO{ID: 1, UserID: &userID, ProductID: 2, Quantity: 3, Status: OrderStatusSuccess, CreatedAt: created}
+	want := []string{"1", "7", "2", "3", "success", "2026-03-01T12:30:00Z"}
+	if got := o.csvRecord(); !slices.Equal(got, want) {
+		t.Fatalf("record = %q, want %q", got, want)
+	}
+	o.UserID = nil
+	if got := o.csvRecord(); got[1] != "" {
+		t.Fatalf("user_id of a deleted user = %q, want empty", got[1])
+	}
+}
+
+func TestExportOrdersBadFormat(t *testing.T) {
+	rec := serve(exportRouter(), http.MethodGet, "/orders/export?format=xlsx", "")
+	if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+		t.Fatalf("status = %d: %s; want 400 %s", rec.Code, rec.Body, CodeInvalidInput)
+	}
+}
+
+func TestExportOrders(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+	// More than one streamed batch
+	const orders = exportBatch + 20
+	if _, err := database.DB.Exec(t.Context(), `
+		INSERT INTO orders (user_id, product_id, quantity, status)
+		SELECT n, $1, 1, CASE WHEN n % 10 = 0 THEN 'cancelled' ELSE 'success' END
+		FROM generate_series(1, $2) n`, productID, orders); err != nil {
+		t.Fatal(err)
+	}
+	r := exportRouter()
+
+	rec := serve(r, http.MethodGet, "/orders/export?format=csv", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("status = %d, Content-Disposition %q; want 200 as an attachment",
+			rec.Code, rec.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("not CSV: %v", err)
+	}
+	if len(records) != orders+1 || !slices.Equal(records[0], exportCSVHeader) {
+		t.Fatalf("%d records starting %q, want the header and %d orders", len(records), records[0], orders)
+	}
+	for i, record := range records[1:] {
+		if record[0] != fmt.Sprint(i+1) || record[2] != fmt.Sprint(productID) {
+			t.Fatalf("record %d = %q, want order %d of product %d", i+1, record, i+1, productID)
+		}
+	}
+
+	rec = serve(r, http.MethodGet, "/orders/export?format=json&status=cancelled", "")
+	var exported []OrderDTO
+	decode(t, rec, &exported)
+	if len(exported) != orders/10 {
+		t.Fatalf("%d cancelled orders exported as JSON, want %d", len(exported), orders/10)
+	}
+	for _, o := range exported {
+		if o.Status != OrderStatusCancelled {
+			t.Fatalf("exported %+v with ?status=cancelled", o)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🎫 FAIR MODE: first come, first served
+// ============================================
+// The other modes sell to whichever request happens to reach Redis or the
+// row lock first. Here every request is added to a per-product sorted set
+// scored by its arrival time, waits FAIR_WINDOW_MS, and then arrivals are
+// settled strictly by score: the earliest ones get the stock, the rest are
+// sold out. The window lets a request that arrived first but reached Redis
+// late (slow network, another instance) still take its place in line.
+// Joining the line counts the unit against the buyer's per-user limit; it is
+// handed back if they don't get one. The line lives in
+// service.PurchaseService.ReserveFair; the sale is persisted like Mode 3's.
+
+// PurchaseFair buys one unit in strict arrival order and reports the buyer's
+// rank among everyone who got one
+func PurchaseFair(c *gin.Context) {
+	start := time.Now()
+	countRequest(ModeFair)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModeFair, start)
+	defer tr.end()
+
+	var req PurchaseRequest
+	if !bindPurchaseRequest(ctx, c, ModeFair, &req) {
+		return
+	}
+	tagPurchase(c, ModeFair, req)
+	if req.Quantity != 1 {
+		failPurchase(ctx, c, ModeFair, http.StatusBadRequest, CodeInvalidInput, "Fair mode sells one unit per request")
+		return
+	}
+
+	if ctx.Err() != nil {
+		failPurchase(ctx, c, ModeFair, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+		return
+	}
+
+	if !checkSaleWindow(ctx, c, ModeFair, req.ProductID) {
+		return
+	}
+
+	// 📥 STEP 1: Take a place in line, wait for earlier arrivals, settle
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	reservation, err := svc.ReserveFair(ctx, req.UserID, req.ProductID, start)
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		failPurchase(ctx, c, ModeFair, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+		return
+	case errors.Is(err, service.ErrPlaceLost):
+		failPurchase(ctx, c, ModeFair, http.StatusConflict, CodeTransactionFail, "Place in line was lost, try again")
+		return
+	case errors.Is(err, service.ErrNotSeeded), errors.Is(err, service.ErrProductNotFound):
+		failNotSeeded(ctx, c, ModeFair, req.ProductID, err)
+		return
+	default:
+		failServiceError(ctx, c, ModeFair, req.ProductID, err)
+		return
+	}
+
+	// 🛡️ STEP 2: Persist like Mode 3; the rank is not handed back on
+	// failure, the unit and the allowance are
+	dbDone, ok := allowDB(ctx, c, ModeFair)
+	if !ok {
+		reservation.Release()
+		return
+	}
+	res, err := svc.Persist(ctx, reservation.Reservation, true)
+	dbDone(err)
+	if err != nil {
+		failServiceError(ctx, c, ModeFair, req.ProductID, err)
+		return
+	}
+
+	recordSuccess(ModeFair, res.Remaining, time.Since(start))
+	publishOrder(ModeFair, res.OrderID, req.UserID, req.ProductID, 1, res.Remaining)
+	publishStock(req.ProductID, res.Remaining, "purchase")
+
+	c.JSON(http.StatusOK, tr.attach(gin.H{
+		"message":    "Purchase successful!",
+		"mode":       ModeFair,
+		"order_id":   res.OrderID,
+		"rank":       reservation.Rank,
+		"arrived_at": start.UTC(),
+		"latency_ms": time.Since(start).Milliseconds(),
+	}))
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPurchaseFairUserLimit(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Fair", 10)
+	if _, err := database.DB.Exec(context.Background(), "UPDATE products SET max_per_user=1 WHERE id=$1", productID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/purchase/fair", Authenticate(), PurchaseFair)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	if rec := serve(r, http.MethodPost, "/purchase/fair", body, "Authorization", bearer(t, 1)); rec.Code != http.StatusOK {
+		t.Fatalf("first purchase: status = %d: %s", rec.Code, rec.Body)
+	}
+	rec := serve(r, http.MethodPost, "/purchase/fair", body, "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusTooManyRequests || errorOf(t, rec).Code != CodeUserLimitExceeded {
+		t.Fatalf("second purchase: status = %d, want 429 %s: %s", rec.Code, CodeUserLimitExceeded, rec.Body)
+	}
+
+	if got, _ := mr.Get(database.StockKey(productID)); got != "9" {
+		t.Fatalf("Redis stock = %s, want 9", got)
+	}
+	if n := testutil.Orders(t, productID, OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d successful orders, want 1", n)
+	}
+}
+
+func TestPurchaseFairUnknownProduct(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Fair", 10) + 1
+	service.ForgetProductRules(productID) // ids restart per test; drop rules cached under this one
+
+	r := gin.New()
+	r.POST("/purchase/fair", Authenticate(), PurchaseFair)
+	rec := serve(r, http.MethodPost, "/purchase/fair", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusNotFound || errorOf(t, rec).Code != CodeProductNotFound {
+		t.Fatalf("status = %d: %s; want 404 %s", rec.Code, rec.Body, CodeProductNotFound)
+	}
+}
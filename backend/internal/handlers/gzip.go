@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"flash-sale-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🗜️ RESPONSE COMPRESSION
+// ============================================
+// Big JSON and CSV answers (/orders, /products, exports) are gzipped for
+// clients that send Accept-Encoding: gzip, when ENABLE_GZIP is on (it is off
+// by default; a proxy in front usually does this). The first GZIP_MIN_BYTES
+// of a body are held back: a response that ends (or flushes) before reaching
+// that size, like a purchase result or an SSE event, goes out uncompressed.
+//
+// gin-contrib/gzip compresses every response whatever its size or type, so
+// it can't leave small purchase answers and event streams alone; hence the
+// writer below.
+
+var (
+	// gzipEnabled turns compression on (ENABLE_GZIP)
+	gzipEnabled = config.Bool("ENABLE_GZIP", false)
+
+	// gzipMinBytes is the smallest body worth compressing (GZIP_MIN_BYTES)
+	gzipMinBytes = config.Int("GZIP_MIN_BYTES", 1024)
+)
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// Gzip compresses responses when ENABLE_GZIP is on and the client accepts
+// gzip. WebSocket upgrades pass through untouched.
+func Gzip() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !gzipEnabled || c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(v, 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// compressible reports whether a Content-Type is text that gzip shrinks
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/problem+json", "application/javascript", "application/xml":
+		return true
+	}
+	return false
+}
+
+// gzipWriter buffers the start of the body until it knows whether to
+// compress, then either gzips or writes through for the rest of the response
+type gzipWriter struct {
+	gin.ResponseWriter
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		return w.write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= gzipMinBytes {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow waits for the decision: Content-Encoding can't be added once
+// the headers are out
+func (w *gzipWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Written counts buffered bytes, so Recovery doesn't append an error body to
+// a response that has already started
+func (w *gzipWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush ends buffering: a streaming handler wants its bytes on the wire now
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide picks gzip or plain from what's buffered and the response headers,
+// then sends the headers and the buffer
+func (w *gzipWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	if len(w.buf) >= gzipMinBytes && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		w.Status() != http.StatusNoContent && w.Status() != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+// finish sends whatever is still buffered and closes the gzip stream. With
+// nothing buffered there's nothing to do: Gin writes the status itself.
+func (w *gzipWriter) finish() {
+	if !w.decided && len(w.buf) > 0 {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enableGzip turns ENABLE_GZIP on with the given GZIP_MIN_BYTES for the test
+func enableGzip(t *testing.T, minBytes int) {
+	oldEnabled, oldMin := gzipEnabled, gzipMinBytes
+	gzipEnabled, gzipMinBytes = true, minBytes
+	t.Cleanup(func() { gzipEnabled, gzipMinBytes = oldEnabled, oldMin })
+}
+
+// gunzip decompresses a recorded body
+func gunzip(t *testing.T, rec *httptest.ResponseRecorder) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	return body
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"br, deflate", false},
+		{"gzip;q=oops", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json; charset=utf-8", true},
+		{"text/csv", true},
+		{"text/event-stream", false},
+		{"image/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := compressible(tt.contentType); got != tt.want {
+			t.Errorf("compressible(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+// gzipRouter serves GET /big (a JSON body over the threshold), /small and
+// whatever extra routes the test adds, behind Recovery and Gzip like main.go
+func gzipRouter(routes func(r *gin.Engine)) *gin.Engine {
+	r := gin.New()
+	r.Use(Recovery(), Gzip())
+	r.GET("/big", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"items": strings.Split(strings.Repeat("item,", 500), ",")})
+	})
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	if routes != nil {
+		routes(r)
+	}
+	return r
+}
+
+func TestGzip(t *testing.T) {
+	enableGzip(t, 1024)
+	r := gzipRouter(nil)
+
+	rec := serve(r, http.MethodGet, "/big", "", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers = %v, want gzip with Vary", rec.Header())
+	}
+	var body struct{ Items []string }
+	if err := json.Unmarshal(gunzip(t, rec), &body); err != nil || len(body.Items) != 501 {
+		t.Fatalf("decompressed body: %d items, err %v", len(body.Items), err)
+	}
+
+	rec = serve(r, http.MethodGet, "/small", "", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != `{"ok":true}` {
+		t.Fatalf("small body: Content-Encoding %q, body %s; want it as is", rec.Header().Get("Content-Encoding"), rec.Body)
+	}
+
+	rec = serve(r, http.MethodGet, "/big", "")
+	if rec.Header().Get("Content-Encoding") != "" || !json.Valid(rec.Body.Bytes()) {
+		t.Fatal("compressed for a client that doesn't accept gzip")
+	}
+}
+
+func TestGzipDisabledByDefault(t *testing.T) {
+	if gzipEnabled {
+		t.Skip("ENABLE_GZIP is set in the environment")
+	}
+	rec := serve(gzipRouter(nil), http.MethodGet, "/big", "", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("Vary") != "" {
+		t.Fatalf("headers = %v, want no compression with ENABLE_GZIP off", rec.Header())
+	}
+}
+
+func TestGzipFlushSendsEventsAsIs(t *testing.T) {
+	enableGzip(t, 1024)
+	r := gzipRouter(func(r *gin.Engine) {
+		r.GET("/events", func(c *gin.Context) {
+			c.Header("Content-Type", "text/event-stream")
+			c.Status(http.StatusOK)
+			c.Writer.WriteString("data: one\n\n")
+			c.Writer.Flush()
+			c.Writer.WriteString("data: two\n\n")
+			c.Writer.Flush()
+		})
+	})
+
+	rec := serve(r, http.MethodGet, "/events", "", "Accept-Encoding", "gzip")
+	if !rec.Flushed {
+		t.Fatal("Flush didn't reach the connection")
+	}
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: one\n\ndata: two\n\n" {
+		t.Fatalf("Content-Encoding %q, body %q; want the events as is", rec.Header().Get("Content-Encoding"), rec.Body)
+	}
+}
+
+func TestGzipFlushAfterThreshold(t *testing.T) {
+	enableGzip(t, 16)
+	r := gzipRouter(func(r *gin.Engine) {
+		r.GET("/stream", func(c *gin.Context) {
+			c.Header("Content-Type", "text/csv")
+			c.Writer.WriteString(strings.Repeat("a,b,c\n", 10))
+			c.Writer.Flush()
+			c.Writer.WriteString("d,e,f\n")
+		})
+	})
+
+	rec := serve(r, http.MethodGet, "/stream", "", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("headers = %v, want gzip", rec.Header())
+	}
+	if got := string(gunzip(t, rec)); got != strings.Repeat("a,b,c\n", 10)+"d,e,f\n" {
+		t.Fatalf("body = %q", got)
+	}
+}
+
+func TestGzipRecovery(t *testing.T) {
+	enableGzip(t, 16)
+	r := gzipRouter(func(r *gin.Engine) {
+		r.GET("/panic", func(c *gin.Context) { panic("boom") })
+		r.GET("/panic-late", func(c *gin.Context) {
+			c.Header("Content-Type", "text/csv")
+			c.Writer.WriteString(strings.Repeat("a,b,c\n", 10))
+			panic("boom")
+		})
+	})
+
+	// Nothing written yet: Recovery's error goes out, uncompressed (small)
+	rec := serve(r, http.MethodGet, "/panic", "", "Accept-Encoding", "gzip")
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeInternal {
+		t.Fatalf("status = %d, body %s; want a 500 INTERNAL_ERROR", rec.Code, rec.Body)
+	}
+
+	// Already compressing: the stream is closed cleanly and nothing is
+	// appended to it
+	rec = serve(r, http.MethodGet, "/panic-late", "", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("headers = %v, want gzip", rec.Header())
+	}
+	if got := string(gunzip(t, rec)); got != strings.Repeat("a,b,c\n", 10) {
+		t.Fatalf("body = %q, want only what the handler wrote", got)
+	}
+}
+
+func TestListOrdersGzip(t *testing.T) {
+	testutil.Postgres(t)
+	enableGzip(t, 1024)
+	productID := testutil.Product(t, "Popular", 100)
+	for userID := 1; userID <= 50; userID++ {
+		insertOrder(t, userID, productID, 1, OrderStatusSuccess)
+	}
+
+	r := gzipRouter(func(r *gin.Engine) { r.GET("/orders", ListOrders) })
+	rec := serve(r, http.MethodGet, "/orders", "", "Accept-Encoding", "gzip")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+	}
+	body := gunzip(t, rec)
+	if !json.Valid(body) {
+		t.Fatalf("decompressed body is not JSON: %s", body)
+	}
+}
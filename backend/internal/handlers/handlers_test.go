@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// serve sends one request to h; headers are name, value pairs
+func serve(h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// bearer is an Authorization header value for userID
+func bearer(t testing.TB, userID int) string {
+	t.Helper()
+	token, _, err := issueToken(userID)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// decode unmarshals a JSON response body into v
+func decode(t testing.TB, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, rec.Body)
+	}
+}
+
+// errorOf decodes an {"error": {...}} response
+func errorOf(t testing.TB, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	decode(t, rec, &body)
+	return body.Error
+}
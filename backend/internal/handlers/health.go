@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker/v2"
+)
+
+var errNotConnected = errors.New("not connected")
+
+// healthCheckTimeout bounds each dependency ping so a hung backend fails fast
+const healthCheckTimeout = 2 * time.Second
+
+// dependencyStatus pings Postgres and Redis, returning per-dependency status
+// and whether all of them are reachable
+func dependencyStatus(ctx context.Context) (gin.H, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	status := gin.H{}
+	healthy := true
+
+	check := func(name string, ping func(context.Context) error) {
+		if err := ping(ctx); err != nil {
+			status[name] = gin.H{"status": "down", "error": err.Error()}
+			healthy = false
+			return
+		}
+		status[name] = gin.H{"status": "up"}
+	}
+
+	check("postgres", func(ctx context.Context) error {
+		if database.DB == nil {
+			return errNotConnected
+		}
+		return database.DB.Ping(ctx)
+	})
+	check("redis", func(ctx context.Context) error {
+		if database.Rdb == nil {
+			return errNotConnected
+		}
+		return database.Rdb.Ping(ctx).Err()
+	})
+
+	return status, healthy
+}
+
+// Health reports whether the service can actually serve purchases, returning
+// 503 with per-dependency status when Postgres or Redis is unreachable
+func Health(c *gin.Context) {
+	deps, healthy := dependencyStatus(c)
+	if !healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":       "degraded",
+			"dependencies": deps,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "up",
+		"message":      "✅ System is running smoothly",
+		"dependencies": deps,
+	})
+}
+
+// Live reports that the process is up, without touching dependencies
+func Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "up"})
+}
+
+// Ready reports whether Postgres and Redis are reachable and the Postgres
+// circuit breaker is not open (503 if any of them fails)
+func Ready(c *gin.Context) {
+	deps, healthy := dependencyStatus(c)
+	breaker := breakerStatus()
+
+	status := http.StatusOK
+	if !healthy || breaker["state"] == gobreaker.StateOpen.String() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"ready":        status == http.StatusOK,
+		"dependencies": deps,
+		"db_breaker":   breaker,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthResponse is the body of /health and /health/ready
+type healthResponse struct {
+	Status       string `json:"status"`
+	Ready        bool   `json:"ready"`
+	Dependencies map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"dependencies"`
+}
+
+func healthRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/health", Health)
+	r.GET("/health/live", Live)
+	r.GET("/health/ready", Ready)
+	return r
+}
+
+func TestLiveIgnoresDependencies(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	if rec := serve(healthRouter(), http.MethodGet, "/health/live", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 while Redis is down", rec.Code)
+	}
+}
+
+func TestReadyRedisDown(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	for _, path := range []string{"/health/ready", "/health"} {
+		rec := serve(healthRouter(), http.MethodGet, path, "")
+		var body healthResponse
+		decode(t, rec, &body)
+		if rec.Code != http.StatusServiceUnavailable || body.Ready {
+			t.Fatalf("%s: status = %d: %s; want 503", path, rec.Code, rec.Body)
+		}
+		if redis := body.Dependencies["redis"]; redis.Status != "down" || redis.Error == "" {
+			t.Fatalf("%s: redis = %+v, want down with the error", path, redis)
+		}
+	}
+}
+
+func TestReadyAllUp(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+
+	rec := serve(healthRouter(), http.MethodGet, "/health/ready", "")
+	var body healthResponse
+	decode(t, rec, &body)
+	if rec.Code != http.StatusOK || !body.Ready {
+		t.Fatalf("status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+	for _, dep := range []string{"postgres", "redis"} {
+		if body.Dependencies[dep].Status != "up" {
+			t.Fatalf("%s = %+v, want up", dep, body.Dependencies[dep])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================
+// 📈 STATS HISTORY
+// ============================================
+// With PERSIST_STATS=true, every reset first saves the counters of each mode
+// that saw traffic to stat_runs, so benchmark runs can be compared over time.
+
+var persistStats = config.Bool("PERSIST_STATS", false)
+
+// StatRun is one mode's counters at the moment stats were reset
+type StatRun struct {
+	ID         int       `json:"id"`
+	Mode       string    `json:"mode"`
+	Requests   int64     `json:"requests"`
+	Success    int64     `json:"success"`
+	Failed     int64     `json:"failed"`
+	Oversells  int64     `json:"oversells"`
+	P50Ms      float64   `json:"p50_latency_ms"`
+	P95Ms      float64   `json:"p95_latency_ms"`
+	P99Ms      float64   `json:"p99_latency_ms"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// saveStatRun writes the current counters to stat_runs, one row per mode that
+// handled at least one request. Errors are logged: losing history must never
+// block a reset.
+func saveStatRun(ctx context.Context) {
+	if !persistStats {
+		return
+	}
+
+	now := time.Now().UTC()
+	batch := &pgx.Batch{}
+	for _, name := range modeNames() {
+		m := modes[name]
+		requests := atomic.LoadInt64(&m.requests)
+		if requests == 0 {
+			continue
+		}
+		summary := latencySummary(m.window.snapshot())
+		batch.Queue(`
+			INSERT INTO stat_runs (mode, requests, success, failed, oversells,
+				p50_latency_ms, p95_latency_ms, p99_latency_ms, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			name, requests, atomic.LoadInt64(&m.success), atomic.LoadInt64(&m.failed), atomic.LoadInt64(&m.oversells),
+			summary["p50_latency_ms"], summary["p95_latency_ms"], summary["p99_latency_ms"], now)
+	}
+	if batch.Len() == 0 {
+		return
+	}
+
+	if err := database.DB.SendBatch(ctx, batch).Close(); err != nil {
+		slog.Warn("⚠️ Failed to save stats run", "error", err)
+	}
+}
+
+// StatsHistory returns saved runs oldest first; ?mode= filters, ?limit= caps
+// the count to the most recent runs (default 100, max 1000)
+func StatsHistory(c *gin.Context) {
+	limit, ok := queryInt(c, "limit", 100, 1, 1000)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.Query(c, `
+		SELECT id, mode, requests, success, failed, oversells,
+			p50_latency_ms, p95_latency_ms, p99_latency_ms, recorded_at
+		FROM (
+			SELECT * FROM stat_runs
+			WHERE $1 = '' OR mode = $1
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT $2
+		) recent
+		ORDER BY recorded_at, id`, c.Query("mode"), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load stats history")
+		return
+	}
+	runs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StatRun, error) {
+		var r StatRun
+		err := row.Scan(&r.ID, &r.Mode, &r.Requests, &r.Success, &r.Failed, &r.Oversells,
+			&r.P50Ms, &r.P95Ms, &r.P99Ms, &r.RecordedAt)
+		return r, err
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load stats history")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "persist_stats": persistStats})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// historyRouter serves the stats reset and history routes like main.go
+func historyRouter() *gin.Engine {
+	r := gin.New()
+	r.POST("/stats/reset", ResetStatsOnly)
+	r.GET("/stats/history", StatsHistory)
+	return r
+}
+
+// statsHistory GETs /stats/history?query and decodes a 200 response
+func statsHistory(t *testing.T, r *gin.Engine, query string) []StatRun {
+	t.Helper()
+	rec := serve(r, http.MethodGet, "/stats/history?"+query, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /stats/history?%s: status = %d: %s", query, rec.Code, rec.Body)
+	}
+	var body struct {
+		Runs []StatRun `json:"runs"`
+	}
+	decode(t, rec, &body)
+	return body.Runs
+}
+
+func TestStatsHistoryBadLimit(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=1001", "limit=all"} {
+		rec := serve(historyRouter(), http.MethodGet, "/stats/history?"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	testutil.Postgres(t)
+	resetStats(t)
+	r := historyRouter()
+	prev := persistStats
+	t.Cleanup(func() { persistStats = prev })
+
+	// Without PERSIST_STATS a reset keeps nothing
+	countRequest(ModeNaive)
+	serve(r, http.MethodPost, "/stats/reset", "")
+	if runs := statsHistory(t, r, ""); len(runs) != 0 {
+		t.Fatalf("history = %+v with PERSIST_STATS off, want none", runs)
+	}
+
+	persistStats = true
+	for range 3 {
+		countRequest(ModePostgresLock)
+		recordSuccess(ModePostgresLock, 5, 2*time.Millisecond)
+	}
+	serve(r, http.MethodPost, "/stats/reset", "")
+	countRequest(ModePostgresLock)
+	countFailure(ModePostgresLock)
+	serve(r, http.MethodPost, "/stats/reset", "")
+
+	runs := statsHistory(t, r, "mode="+ModePostgresLock)
+	if len(runs) != 2 {
+		t.Fatalf("history = %+v, want two runs", runs)
+	}
+	first, second := runs[0], runs[1]
+	if first.Requests != 3 || first.Success != 3 || first.P50Ms != 2 {
+		t.Fatalf("first run = %+v, want 3 successes at 2ms", first)
+	}
+	if second.Requests != 1 || second.Failed != 1 || second.RecordedAt.Before(first.RecordedAt) {
+		t.Fatalf("second run = %+v, want 1 failure recorded after the first", second)
+	}
+
+	if runs := statsHistory(t, r, "limit=1"); len(runs) != 1 || runs[0].ID != second.ID {
+		t.Fatalf("limit=1 = %+v, want only the latest run", runs)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyTTL is how long a processed Idempotency-Key is remembered
+var idempotencyTTL = time.Duration(config.Int("IDEMPOTENCY_TTL_SEC", 86400)) * time.Second
+
+// idempotencyPending marks a key whose first request is still being processed
+const idempotencyPending = "pending"
+
+// storedResponse is what we keep in Redis for a completed idempotent request
+type storedResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// bodyRecorder captures the response body so it can be replayed later
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// idempotencyKey scopes a client's Idempotency-Key to the authenticated user
+// and the route, so one buyer's key can't replay another's response and the
+// same key sent to /purchase/cart and /purchase/redis are separate requests
+func idempotencyKey(c *gin.Context, key string) string {
+	return database.Key("idem", strconv.Itoa(authUserID(c)), c.Request.Method, c.Request.URL.Path, key)
+}
+
+// Idempotency makes purchases safe to retry. The first request carrying an
+// Idempotency-Key claims it with SET NX, so two identical keys arriving at the
+// same time can't both buy. Repeats get the original response replayed
+// without touching stock again. Mount it after Authenticate: keys are per
+// user.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		redisKey := idempotencyKey(c, key)
+
+		claimed, err := database.Rdb.SetNX(c, redisKey, idempotencyPending, idempotencyTTL).Result()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to check idempotency key")
+			return
+		}
+
+		if !claimed {
+			replayIdempotent(c, redisKey)
+			return
+		}
+
+		rec := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		// Settle the key even if the client went away or the handler panicked
+		// (Recovery sits above this middleware, so a panic would skip code
+		// after c.Next and leave the key pending until idempotencyTTL)
+		ctx := context.WithoutCancel(c)
+		completed := false
+		defer func() {
+			if !completed {
+				database.Rdb.Del(ctx, redisKey)
+			}
+		}()
+		c.Next()
+		completed = true
+
+		// Server-side failures release the key so the client can retry for real
+		if rec.Status() >= http.StatusInternalServerError {
+			database.Rdb.Del(ctx, redisKey)
+			return
+		}
+
+		stored, _ := json.Marshal(storedResponse{Status: rec.Status(), Body: rec.body.Bytes()})
+		database.Rdb.Set(ctx, redisKey, stored, idempotencyTTL)
+	}
+}
+
+// replayIdempotent answers a repeated key with the stored response
+func replayIdempotent(c *gin.Context, redisKey string) {
+	val, err := database.Rdb.Get(c, redisKey).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to read idempotency key")
+		return
+	}
+
+	if val == idempotencyPending {
+		respondError(c, http.StatusConflict, CodeIdempotencyInProgress, "A request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	var stored storedResponse
+	if err := json.Unmarshal([]byte(val), &stored); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Corrupt idempotency record")
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.Status, "application/json; charset=utf-8", stored.Body)
+	c.Abort()
+}
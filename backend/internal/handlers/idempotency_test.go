@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRouter puts a counting purchase stub behind Authenticate and
+// Idempotency at /purchase/a and /purchase/b, under Recovery like main.go.
+// The stub answers 500 or panics when the body asks for it.
+func idempotentRouter(orders *atomic.Int64) *gin.Engine {
+	buy := func(c *gin.Context) {
+		var req struct {
+			Fail  bool `json:"fail"`
+			Panic bool `json:"panic"`
+		}
+		c.ShouldBindJSON(&req)
+		if req.Panic {
+			panic("boom")
+		}
+		if req.Fail {
+			respondError(c, http.StatusInternalServerError, CodeDBError, "boom")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"order_id": orders.Add(1), "user_id": authUserID(c)})
+	}
+	r := gin.New()
+	r.Use(Recovery())
+	purchase := r.Group("/purchase", Authenticate(), Idempotency())
+	purchase.POST("/a", buy)
+	purchase.POST("/b", buy)
+	return r
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	testutil.Redis(t)
+	var orders atomic.Int64
+	r := idempotentRouter(&orders)
+	alice, bob := bearer(t, 1), bearer(t, 2)
+
+	first := serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", alice, "Idempotency-Key", "k1")
+	again := serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", alice, "Idempotency-Key", "k1")
+	if first.Code != http.StatusOK || again.Code != http.StatusOK {
+		t.Fatalf("statuses %d, %d: %s", first.Code, again.Code, again.Body)
+	}
+	if again.Header().Get("Idempotent-Replayed") != "true" || again.Body.String() != first.Body.String() {
+		t.Fatalf("repeat was not a replay: %q vs %q", again.Body, first.Body)
+	}
+	if n := orders.Load(); n != 1 {
+		t.Fatalf("%d orders after a replayed key, want 1", n)
+	}
+
+	// Same key, another buyer or another route: a new request each
+	for _, rec := range []*httptest.ResponseRecorder{
+		serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", bob, "Idempotency-Key", "k1"),
+		serve(r, http.MethodPost, "/purchase/b", `{}`, "Authorization", alice, "Idempotency-Key", "k1"),
+	} {
+		if rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("replayed across users or routes: %s", rec.Body)
+		}
+	}
+	if n := orders.Load(); n != 3 {
+		t.Fatalf("%d orders, want 3", n)
+	}
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	testutil.Redis(t)
+	var orders atomic.Int64
+	r := idempotentRouter(&orders)
+	token := bearer(t, 1)
+
+	const n = 20
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", token, "Idempotency-Key", "same").Code
+		}()
+	}
+	wg.Wait()
+
+	if got := orders.Load(); got != 1 {
+		t.Fatalf("%d orders for one key fired %d times at once, want 1", got, n)
+	}
+	for _, status := range statuses {
+		if status != http.StatusOK && status != http.StatusConflict {
+			t.Fatalf("status %d, want 200 (first or replay) or 409 (in progress)", status)
+		}
+	}
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	testutil.Redis(t)
+	var orders atomic.Int64
+	r := idempotentRouter(&orders)
+	token := bearer(t, 1)
+
+	if rec := serve(r, http.MethodPost, "/purchase/a", `{"fail": true}`, "Authorization", token, "Idempotency-Key", "k"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	rec := serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", token, "Idempotency-Key", "k")
+	if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after a 500 = %d (replayed %q), want a fresh 200", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	testutil.Redis(t)
+	resetStats(t)
+	var orders atomic.Int64
+	r := idempotentRouter(&orders)
+	token := bearer(t, 1)
+
+	if rec := serve(r, http.MethodPost, "/purchase/a", `{"panic": true}`, "Authorization", token, "Idempotency-Key", "k"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 from Recovery", rec.Code)
+	}
+	rec := serve(r, http.MethodPost, "/purchase/a", `{}`, "Authorization", token, "Idempotency-Key", "k")
+	if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after a panic = %d: %s; want a fresh 200, not the key stuck pending", rec.Code, rec.Body)
+	}
+	if n := orders.Load(); n != 1 {
+		t.Fatalf("%d orders, want 1", n)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnDisconnect(t *testing.T) {
+	testutil.Redis(t)
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), Idempotency(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	// The client is gone by the time the handler finishes
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/purchase", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", bearer(t, 1))
+	req.Header.Set("Idempotency-Key", "k")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := serve(r, http.MethodPost, "/purchase", `{}`, "Authorization", bearer(t, 1), "Idempotency-Key", "k")
+	if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry = %d (replayed %q): %s; want the stored 200", rec.Code, rec.Header().Get("Idempotent-Replayed"), rec.Body)
+	}
+}
+
+func TestIdempotencyCreatesOneOrder(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Idempotent", 10)
+	r := gin.New()
+	r.POST("/purchase/redis", Authenticate(), Idempotency(), PurchaseRedisPostgres)
+	token := bearer(t, 1)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(r, http.MethodPost, "/purchase/redis", fmt.Sprintf(`{"product_id": %d}`, productID),
+				"Authorization", token, "Idempotency-Key", "retry-me")
+		}()
+	}
+	wg.Wait()
+
+	if n := testutil.Orders(t, productID, OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d orders for one Idempotency-Key, want 1", n)
+	}
+	if q := testutil.Quantity(t, productID); q != 9 {
+		t.Fatalf("quantity = %d, want 9", q)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"flash-sale-backend/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys stored on the gin context for the request logger
+const (
+	ctxRequestID = "request_id"
+	ctxErrorCode = "error_code"
+	ctxPurchase  = "purchase"
+)
+
+// RequestIDHeader carries the correlation id in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// purchaseTag is what a purchase handler records about itself for the log line
+type purchaseTag struct {
+	mode      string
+	userID    int
+	productID int
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// RequestID reuses the caller's X-Request-ID or generates one, and echoes it
+// back so a client can quote it when reporting a problem
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newUUID()
+		}
+		c.Set(ctxRequestID, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestIDFrom returns the current request's id, if RequestID ran
+func requestIDFrom(c *gin.Context) string {
+	return c.GetString(ctxRequestID)
+}
+
+// tagPurchase marks the request as a purchase attempt so it is logged (and
+// its server span labelled) with its mode, user and product
+func tagPurchase(c *gin.Context, mode string, req PurchaseRequest) {
+	c.Set(ctxPurchase, purchaseTag{mode: mode, userID: req.UserID, productID: req.ProductID})
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(tracing.PurchaseAttributes(mode, req.ProductID)...)
+}
+
+// RequestLogger writes one structured log line per request, replacing Gin's
+// default logger. Purchase attempts also carry mode, user, product and outcome.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		attrs := []any{
+			slog.String("request_id", requestIDFrom(c)),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+
+		msg := "request"
+		if v, ok := c.Get(ctxPurchase); ok {
+			tag := v.(purchaseTag)
+			outcome := "success"
+			if code := c.GetString(ctxErrorCode); code != "" {
+				outcome = code
+			}
+			msg = "purchase"
+			attrs = append(attrs,
+				slog.String("mode", tag.mode),
+				slog.Int("user_id", tag.userID),
+				slog.Int("product_id", tag.productID),
+				slog.String("outcome", outcome),
+			)
+		} else if code := c.GetString(ctxErrorCode); code != "" {
+			attrs = append(attrs, slog.String("error_code", code))
+		}
+
+		slog.Info(msg, attrs...)
+	}
+}
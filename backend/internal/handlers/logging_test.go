@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// requestIDRouter answers GET /id with the id RequestID stored on the context
+func requestIDRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/id", func(c *gin.Context) { c.String(http.StatusOK, requestIDFrom(c)) })
+	return r
+}
+
+func TestRequestIDEchoesCaller(t *testing.T) {
+	rec := serve(requestIDRouter(), http.MethodGet, "/id", "", RequestIDHeader, "trace-abc-123")
+	if got := rec.Header().Get(RequestIDHeader); got != "trace-abc-123" {
+		t.Fatalf("%s = %q, want the caller's id", RequestIDHeader, got)
+	}
+	if rec.Body.String() != "trace-abc-123" {
+		t.Fatalf("handler saw %q, want the caller's id", rec.Body)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+	}{
+		{"missing", nil},
+		{"too long", []string{RequestIDHeader, strings.Repeat("x", 129)}},
+	}
+	for _, tt := range tests {
+		rec := serve(requestIDRouter(), http.MethodGet, "/id", "", tt.headers...)
+		id := rec.Header().Get(RequestIDHeader)
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("%s: %s = %q, want a v4 UUID", tt.name, RequestIDHeader, id)
+		}
+		if rec.Body.String() != id {
+			t.Fatalf("%s: handler saw %q, header says %q", tt.name, rec.Body, id)
+		}
+	}
+
+	a := serve(requestIDRouter(), http.MethodGet, "/id", "").Header().Get(RequestIDHeader)
+	b := serve(requestIDRouter(), http.MethodGet, "/id", "").Header().Get(RequestIDHeader)
+	if a == b {
+		t.Fatalf("two requests got the same id %q", a)
+	}
+}
+
+func TestRequestLoggerIncludesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+
+	r := gin.New()
+	r.Use(RequestID(), RequestLogger())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serve(r, http.MethodGet, "/ping", "", RequestIDHeader, "req-1")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line %q is not one JSON object: %v", buf.String(), err)
+	}
+	if line["request_id"] != "req-1" || line["path"] != "/ping" || line["status"] != float64(http.StatusNoContent) {
+		t.Fatalf("log line = %v, want request_id, path and status", line)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+)
+
+// ============================================
+// 🔔 LOW-STOCK WEBHOOK
+// ============================================
+// With LOW_STOCK_WEBHOOK_URL set, every stock change a purchase (or restock,
+// cancel, reset) publishes is also checked against LOW_STOCK_THRESHOLD. The
+// first time a product's stock is at or below it, {"product_id", "remaining"}
+// is POSTed to the webhook. A Redis flag per product debounces the alert
+// across purchases and instances; it is cleared once stock climbs back above
+// the threshold, arming the next crossing.
+//
+// Purchases through a single Redis reservation (redis_postgres, payment, the
+// gRPC server) are checked on the Redis counter the reserve script left (see
+// publishReservedStock). The rest, fair and cart mode included, are checked on
+// the Postgres stock they publish.
+
+var (
+	lowStockWebhookURL = config.String("LOW_STOCK_WEBHOOK_URL", "") // unset disables the watcher
+	lowStockThreshold  = config.Int("LOW_STOCK_THRESHOLD", 10)
+	lowStockChecks     = make(chan lowStockCheck, 1024)
+	lowStockClient     = &http.Client{Timeout: 5 * time.Second}
+)
+
+type lowStockCheck struct {
+	productID int
+	stock     int
+}
+
+// LowStockAlert is the webhook body
+type LowStockAlert struct {
+	ProductID int       `json:"product_id"`
+	Remaining int       `json:"remaining"`
+	Threshold int       `json:"threshold"`
+	At        time.Time `json:"at"`
+}
+
+// lowStockAlertedKey marks a product whose crossing has already been alerted
+func lowStockAlertedKey(productID int) string {
+	return database.Key("product", strconv.Itoa(productID), "low_stock_alerted")
+}
+
+// watchLowStock hands a stock change to the watcher without ever blocking a
+// purchase; a full queue drops the check (the next change re-checks)
+func watchLowStock(productID, stock int) {
+	if lowStockWebhookURL == "" {
+		return
+	}
+	select {
+	case lowStockChecks <- lowStockCheck{productID, stock}:
+	default:
+	}
+}
+
+// RunLowStockWatcher checks queued stock changes until ctx is cancelled
+func RunLowStockWatcher(ctx context.Context) {
+	if lowStockWebhookURL == "" {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case check := <-lowStockChecks:
+			checkLowStock(ctx, check)
+		}
+	}
+}
+
+// checkLowStock alerts on a crossing, or re-arms the alert above the threshold
+func checkLowStock(ctx context.Context, check lowStockCheck) {
+	key := lowStockAlertedKey(check.productID)
+	if check.stock > lowStockThreshold {
+		if err := database.Rdb.Del(ctx, key).Err(); err != nil {
+			slog.Warn("⚠️ Failed to re-arm low-stock alert", "product_id", check.productID, "error", err)
+		}
+		return
+	}
+
+	first, err := database.Rdb.SetNX(ctx, key, check.stock, 0).Result()
+	if err != nil {
+		slog.Warn("⚠️ Failed to check low-stock alert flag", "product_id", check.productID, "error", err)
+		return
+	}
+	if !first {
+		return // already alerted for this crossing
+	}
+
+	if err := sendLowStockAlert(ctx, check); err != nil {
+		// Let the next stock change try again rather than lose the alert
+		slog.Warn("⚠️ Low-stock webhook failed", "product_id", check.productID, "error", err)
+		database.Rdb.Del(context.Background(), key)
+		return
+	}
+	slog.Info("🔔 Low-stock alert sent", "product_id", check.productID, "remaining", check.stock)
+}
+
+func sendLowStockAlert(ctx context.Context, check lowStockCheck) error {
+	body, err := json.Marshal(LowStockAlert{
+		ProductID: check.productID,
+		Remaining: check.stock,
+		Threshold: lowStockThreshold,
+		At:        time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lowStockWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := lowStockClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
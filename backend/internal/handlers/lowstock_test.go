@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lowStockWebhook is a webhook receiver that records the alerts it gets and
+// answers with status
+type lowStockWebhook struct {
+	mu     sync.Mutex
+	alerts []LowStockAlert
+	status int
+	got    chan struct{}
+}
+
+func (w *lowStockWebhook) received() []LowStockAlert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]LowStockAlert(nil), w.alerts...)
+}
+
+// withLowStockWebhook points LOW_STOCK_WEBHOOK_URL at a test server with
+// LOW_STOCK_THRESHOLD threshold
+func withLowStockWebhook(t *testing.T, threshold int) *lowStockWebhook {
+	w := &lowStockWebhook{status: http.StatusNoContent, got: make(chan struct{}, 16)}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var alert LowStockAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		w.mu.Lock()
+		w.alerts = append(w.alerts, alert)
+		status := w.status
+		w.mu.Unlock()
+		rw.WriteHeader(status)
+		w.got <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+
+	prevURL, prevThreshold := lowStockWebhookURL, lowStockThreshold
+	t.Cleanup(func() { lowStockWebhookURL, lowStockThreshold = prevURL, prevThreshold })
+	lowStockWebhookURL, lowStockThreshold = srv.URL, threshold
+	return w
+}
+
+func TestLowStockAlertOncePerCrossing(t *testing.T) {
+	testutil.Redis(t)
+	w := withLowStockWebhook(t, 3)
+	check := func(stock int) { checkLowStock(t.Context(), lowStockCheck{productID: 7, stock: stock}) }
+
+	for stock := 6; stock >= 0; stock-- {
+		check(stock)
+	}
+	alerts := w.received()
+	if len(alerts) != 1 || alerts[0].ProductID != 7 || alerts[0].Remaining != 3 || alerts[0].Threshold != 3 {
+		t.Fatalf("alerts = %+v, want one for product 7 at 3 remaining", alerts)
+	}
+
+	// A restock above the threshold arms the next crossing
+	check(20)
+	check(2)
+	check(1)
+	if alerts := w.received(); len(alerts) != 2 || alerts[1].Remaining != 2 {
+		t.Fatalf("alerts = %+v, want a second one at 2 remaining", alerts)
+	}
+}
+
+func TestLowStockWebhookFailureRetries(t *testing.T) {
+	testutil.Redis(t)
+	w := withLowStockWebhook(t, 3)
+	w.status = http.StatusInternalServerError
+
+	checkLowStock(t.Context(), lowStockCheck{productID: 7, stock: 3})
+	w.mu.Lock()
+	w.status = http.StatusOK
+	w.mu.Unlock()
+	checkLowStock(t.Context(), lowStockCheck{productID: 7, stock: 2})
+	checkLowStock(t.Context(), lowStockCheck{productID: 7, stock: 1})
+
+	if alerts := w.received(); len(alerts) != 2 || alerts[1].Remaining != 2 {
+		t.Fatalf("alerts = %+v, want the failed one retried once at 2 remaining", alerts)
+	}
+}
+
+func TestLowStockWatcher(t *testing.T) {
+	testutil.Redis(t)
+	w := withLowStockWebhook(t, 1)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		RunLowStockWatcher(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	for stock := 3; stock >= 0; stock-- {
+		watchLowStock(9, stock)
+	}
+	select {
+	case <-w.got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook call")
+	}
+	// Give the watcher time to (not) send a second one
+	time.Sleep(100 * time.Millisecond)
+	if alerts := w.received(); len(alerts) != 1 || alerts[0].ProductID != 9 || alerts[0].Remaining != 1 {
+		t.Fatalf("alerts = %+v, want one for product 9 at 1 remaining", alerts)
+	}
+}
+
+// drainLowStockChecks empties the watcher queue left by earlier tests
+func drainLowStockChecks() {
+	for len(lowStockChecks) > 0 {
+		<-lowStockChecks
+	}
+}
+
+// nextLowStockCheck takes the next queued watcher input, failing if there is none
+func nextLowStockCheck(t *testing.T) lowStockCheck {
+	t.Helper()
+	select {
+	case check := <-lowStockChecks:
+		return check
+	default:
+		t.Fatal("nothing was handed to the low-stock watcher")
+		return lowStockCheck{}
+	}
+}
+
+func TestPublishReservedStock(t *testing.T) {
+	testutil.Redis(t)
+	withLowStockWebhook(t, 5)
+	drainLowStockChecks()
+	events := stockEvents(t)
+
+	// Postgres says 12, but only 3 are left to reserve in Redis
+	publishReservedStock(7, 12, 3)
+	if check := nextLowStockCheck(t); check != (lowStockCheck{7, 3}) {
+		t.Fatalf("watcher got %+v, want product 7 at the Redis count 3", check)
+	}
+	if ev := nextStockEvent(t, events); ev.ProductID != 7 || ev.Stock != 12 || ev.Reason != "purchase" {
+		t.Fatalf("event = %+v, want product 7 at the Postgres stock 12", ev)
+	}
+}
+
+func TestLowStockWatchesRedisCount(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	withLowStockWebhook(t, 5)
+	drainLowStockChecks()
+	productID := testutil.Product(t, "Widget", 10)
+	// Reservations still in flight: Redis is well below Postgres
+	mr.Set(database.StockKey(productID), "4")
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID), "Authorization", bearer(t, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if check := nextLowStockCheck(t); check != (lowStockCheck{productID, 3}) {
+		t.Fatalf("watcher got %+v, want the Redis count 3, not the Postgres 9", check)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics exposes the purchase counters in the Prometheus text exposition format
+func Metrics(c *gin.Context) {
+	var b strings.Builder
+	names := modeNames()
+
+	counter := func(name, help string, value func(*modeStats) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, mode := range names {
+			fmt.Fprintf(&b, "%s{mode=%q} %d\n", name, mode, value(modes[mode]))
+		}
+	}
+
+	counter("flashsale_requests_total", "Purchase attempts.",
+		func(m *modeStats) int64 { return atomic.LoadInt64(&m.requests) })
+	counter("flashsale_success_total", "Completed purchases.",
+		func(m *modeStats) int64 { return atomic.LoadInt64(&m.success) })
+	counter("flashsale_failures_total", "Purchases that did not complete, including out of stock.",
+		func(m *modeStats) int64 { return atomic.LoadInt64(&m.failed) })
+	counter("flashsale_oversells_total", "Completed purchases that left DB quantity below zero.",
+		func(m *modeStats) int64 { return atomic.LoadInt64(&m.oversells) })
+
+	fmt.Fprintf(&b, "# HELP flashsale_redis_fallbacks_total Redis-mode purchases served by the row lock because Redis was down.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_redis_fallbacks_total counter\nflashsale_redis_fallbacks_total %d\n",
+		atomic.LoadInt64(&FallbackCount))
+
+	fmt.Fprintf(&b, "# HELP flashsale_lock_contended_total NOWAIT purchases turned away because the row was already locked.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_lock_contended_total counter\nflashsale_lock_contended_total %d\n",
+		atomic.LoadInt64(&LockContendedCount))
+
+	fmt.Fprintf(&b, "# HELP flashsale_overloaded_total Purchases turned away with 503 OVERLOADED by MAX_CONCURRENT_PURCHASES.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_overloaded_total counter\nflashsale_overloaded_total %d\n",
+		atomic.LoadInt64(&OverloadedCount))
+
+	fmt.Fprintf(&b, "# HELP flashsale_pool_saturated_total Purchases turned away with 503 POOL_SATURATED by DB_POOL_HIGH_WATER_PCT.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_pool_saturated_total counter\nflashsale_pool_saturated_total %d\n",
+		atomic.LoadInt64(&PoolSaturatedCount))
+
+	fmt.Fprintf(&b, "# HELP flashsale_serialization_retries_total SERIALIZABLE purchases retried after a serialization failure.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_serialization_retries_total counter\nflashsale_serialization_retries_total %d\n",
+		atomic.LoadInt64(&SerializationRetryCount))
+
+	fmt.Fprintf(&b, "# HELP flashsale_in_flight_requests Purchase requests being served right now.\n")
+	fmt.Fprintf(&b, "# TYPE flashsale_in_flight_requests gauge\nflashsale_in_flight_requests %d\n",
+		atomic.LoadInt64(&InFlightCount))
+
+	const hist = "flashsale_purchase_latency_seconds"
+	fmt.Fprintf(&b, "# HELP %s Latency of completed purchases.\n# TYPE %s histogram\n", hist, hist)
+	for _, mode := range names {
+		m := modes[mode]
+		var cumulative int64
+		for i, le := range latencyBucketsMs {
+			cumulative += atomic.LoadInt64(&m.buckets[i])
+			fmt.Fprintf(&b, "%s_bucket{mode=%q,le=%q} %d\n", hist, mode,
+				strconv.FormatFloat(le/1000, 'f', -1, 64), cumulative)
+		}
+		cumulative += atomic.LoadInt64(&m.buckets[len(latencyBucketsMs)])
+		fmt.Fprintf(&b, "%s_bucket{mode=%q,le=\"+Inf\"} %d\n", hist, mode, cumulative)
+		fmt.Fprintf(&b, "%s_sum{mode=%q} %g\n", hist, mode, float64(atomic.LoadInt64(&m.latencySumUs))/1e6)
+		fmt.Fprintf(&b, "%s_count{mode=%q} %d\n", hist, mode, cumulative)
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
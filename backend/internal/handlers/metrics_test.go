@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetrics(t *testing.T) {
+	resetStats(t)
+	for range 3 {
+		countRequest(ModeRedisPostgres)
+	}
+	recordSuccess(ModeRedisPostgres, 5, 3*time.Millisecond)    // le 0.005
+	recordSuccess(ModeRedisPostgres, 4, 40*time.Millisecond)   // le 0.05
+	recordSuccess(ModeRedisPostgres, 3, 9000*time.Millisecond) // +Inf only
+	countRequest(ModeNaive)
+	countFailure(ModeNaive)
+
+	r := gin.New()
+	r.GET("/metrics", Metrics)
+	rec := serve(r, http.MethodGet, "/metrics", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("status %d, Content-Type %q; want 200 in the Prometheus text format", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE flashsale_requests_total counter",
+		`flashsale_requests_total{mode="redis_postgres"} 3`,
+		`flashsale_requests_total{mode="naive"} 1`,
+		`flashsale_success_total{mode="redis_postgres"} 3`,
+		`flashsale_failures_total{mode="naive"} 1`,
+		`flashsale_oversells_total{mode="redis_postgres"} 0`,
+		"# TYPE flashsale_purchase_latency_seconds histogram",
+		`flashsale_purchase_latency_seconds_bucket{mode="redis_postgres",le="0.001"} 0`,
+		`flashsale_purchase_latency_seconds_bucket{mode="redis_postgres",le="0.005"} 1`,
+		`flashsale_purchase_latency_seconds_bucket{mode="redis_postgres",le="0.05"} 2`,
+		`flashsale_purchase_latency_seconds_bucket{mode="redis_postgres",le="5"} 2`,
+		`flashsale_purchase_latency_seconds_bucket{mode="redis_postgres",le="+Inf"} 3`,
+		`flashsale_purchase_latency_seconds_sum{mode="redis_postgres"} 9.043`,
+		`flashsale_purchase_latency_seconds_count{mode="redis_postgres"} 3`,
+		"# TYPE flashsale_in_flight_requests gauge",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+
+	// Every sample line is "name{labels} value" or "name value"
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) != 2 || !strings.HasPrefix(fields[0], "flashsale_") {
+			t.Errorf("malformed sample line %q", line)
+		}
+	}
+}
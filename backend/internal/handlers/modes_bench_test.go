@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/testutil"
+)
+
+// modeReport is one mode's line in the BenchmarkModes JSON report
+type modeReport struct {
+	Mode          string  `json:"mode"`
+	Sales         int     `json:"sales"`
+	Requests      int     `json:"requests"`
+	Successes     int     `json:"successes"`
+	ThroughputRPS float64 `json:"throughput_rps"`
+	P95LatencyMs  float64 `json:"p95_latency_ms"`
+	Oversells     int     `json:"oversells"`
+}
+
+// BenchmarkModes runs the same sale (100 units, 500 concurrent buyers)
+// against every mode and writes throughput, p95 latency and oversells per
+// mode to the JSON file named by BENCH_MODES_REPORT; without it (or
+// TEST_DATABASE_URL) the benchmark is skipped:
+//
+//	BENCH_MODES_REPORT=modes.json TEST_DATABASE_URL=... go test ./internal/handlers -run '^$' -bench BenchmarkModes
+func BenchmarkModes(b *testing.B) {
+	path := os.Getenv("BENCH_MODES_REPORT")
+	if path == "" {
+		b.Skip("BENCH_MODES_REPORT is not set")
+	}
+	testutil.Postgres(b)
+	testutil.Redis(b)
+
+	const stock, buyers = 100, 500
+	var reports []modeReport
+	for _, m := range saleModes {
+		var (
+			report    = modeReport{Mode: m.name}
+			elapsed   time.Duration
+			latencies []int64
+		)
+		b.Run(m.name, func(b *testing.B) {
+			// b.Run may call this more than once; the report keeps the last run
+			report = modeReport{Mode: m.name}
+			elapsed, latencies = 0, nil
+			for b.Loop() {
+				res := runSale(b, m, stock, buyers)
+				report.Sales++
+				report.Requests += buyers
+				report.Successes += res.successes
+				report.Oversells += max(res.successes-stock, -res.remaining, 0)
+				elapsed += res.elapsed
+				for _, d := range res.latencies {
+					latencies = append(latencies, d.Microseconds())
+				}
+			}
+			report.ThroughputRPS = float64(report.Requests) / elapsed.Seconds()
+			slices.Sort(latencies)
+			report.P95LatencyMs = percentile(latencies, 95)
+			b.ReportMetric(report.ThroughputRPS, "req/s")
+			b.ReportMetric(report.P95LatencyMs, "p95-ms")
+			b.ReportMetric(float64(report.Oversells), "oversells")
+		})
+		reports = append(reports, report)
+	}
+
+	out, err := json.MarshalIndent(map[string]any{
+		"stock":  stock,
+		"buyers": buyers,
+		"modes":  reports,
+	}, "", "  ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o644); err != nil {
+		b.Fatalf("write report: %v", err)
+	}
+
+	for i, m := range saleModes {
+		if m.safe && reports[i].Oversells != 0 {
+			b.Errorf("%s oversold %d time(s); it must never oversell", m.name, reports[i].Oversells)
+		}
+	}
+}
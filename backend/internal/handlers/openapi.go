@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 📜 OPENAPI DOCUMENT
+// ============================================
+// GET /openapi.json describes the purchase, product, order, stats and reset
+// endpoints; purchases need the bearerAuth scheme. Request bodies and the error body are generated from the Go
+// structs (json tags, binding rules), and the /purchase/<mode> paths from
+// purchaseQueryModes, so those can't drift from the code. Responses built
+// with gin.H are described by hand below.
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// OpenAPI serves the OpenAPI 3 document, built once on first request
+func OpenAPI(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		doc, err := json.Marshal(openAPIDocument())
+		if err != nil {
+			panic(err) // only plain maps and slices go in
+		}
+		openAPIJSON = doc
+	})
+	c.Data(http.StatusOK, "application/json", openAPIJSON)
+}
+
+// openAPIDocument assembles the spec
+func openAPIDocument() gin.H {
+	purchaseResponses := gin.H{
+		"200": jsonResponse("Order created", ref("PurchaseResponse")),
+		"400": errorResponse("Invalid input or out of stock"),
+		"401": errorResponse("Missing or invalid Bearer token"),
+		"404": errorResponse("Product not found"),
+		"410": errorResponse("Sale ended"),
+		"425": errorResponse("Sale not started"),
+		"429": errorResponse("Per-user limit or rate limit reached"),
+		"500": errorResponse("Redis or PostgreSQL failed"),
+		"503": errorResponse("Database unavailable or overloaded"),
+		"504": errorResponse("Request timed out"),
+	}
+	bearerAuth := []gin.H{{"bearerAuth": []string{}}}
+	purchaseOp := func(summary string) gin.H {
+		return gin.H{"post": gin.H{
+			"summary":     summary,
+			"tags":        []string{"purchase"},
+			"security":    bearerAuth,
+			"requestBody": jsonBody(ref("PurchaseRequest")),
+			"responses":   purchaseResponses,
+		}}
+	}
+
+	paths := gin.H{
+		"/purchase": gin.H{"post": gin.H{
+			"summary":     "Buy through ?mode= (default redis)",
+			"tags":        []string{"purchase"},
+			"security":    bearerAuth,
+			"parameters":  []gin.H{queryParam("mode", gin.H{"type": "string", "enum": purchaseModeNames(), "default": "redis"})},
+			"requestBody": jsonBody(ref("PurchaseRequest")),
+			"responses":   purchaseResponses,
+		}},
+		"/purchase/cart": gin.H{"post": gin.H{
+			"summary":     "Buy several products, all or nothing",
+			"tags":        []string{"purchase"},
+			"security":    bearerAuth,
+			"requestBody": jsonBody(ref("CartRequest")),
+			"responses": gin.H{
+				"200":     jsonResponse("Orders created", ref("CartResponse")),
+				"401":     errorResponse("Missing or invalid Bearer token"),
+				"default": errorResponse("Purchase refused or failed"),
+			},
+		}},
+		"/products": gin.H{"get": gin.H{
+			"summary":   "Every product with PostgreSQL and Redis stock",
+			"tags":      []string{"products"},
+			"responses": gin.H{"200": jsonResponse("Products", arrayOf(ref("ProductSummary")))},
+		}},
+		"/products/{id}": gin.H{"get": gin.H{
+			"summary":    "One product with its sale window",
+			"tags":       []string{"products"},
+			"parameters": []gin.H{pathID()},
+			"responses": gin.H{
+				"200": jsonResponse("Product", ref("Product")),
+				"404": errorResponse("Product not found"),
+			},
+		}},
+		"/products/{id}/stock": gin.H{"get": gin.H{
+			"summary":    "Current stock, Redis first",
+			"tags":       []string{"products"},
+			"parameters": []gin.H{pathID()},
+			"responses": gin.H{
+				"200": jsonResponse("Stock", objectOf(gin.H{
+					"product_id": integer(), "stock": integer(), "source": gin.H{"type": "string", "enum": []string{"redis", "postgres"}},
+				})),
+				"404": errorResponse("Product not found"),
+			},
+		}},
+		"/orders": gin.H{"get": gin.H{
+			"summary": "Orders newest first",
+			"tags":    []string{"orders"},
+			"parameters": []gin.H{
+				queryParam("limit", gin.H{"type": "integer", "minimum": 1, "maximum": maxOrdersLimit, "default": defaultOrdersLimit}),
+				queryParam("offset", gin.H{"type": "integer", "minimum": 0, "default": 0}),
+				queryParam("user_id", gin.H{"type": "integer", "minimum": 1}),
+				queryParam("product_id", gin.H{"type": "integer", "minimum": 1}),
+				queryParam("status", gin.H{"type": "string", "enum": orderStatusNames()}),
+			},
+			"responses": gin.H{
+				"200": jsonResponse("A page of orders", objectOf(gin.H{
+					"orders": arrayOf(ref("Order")), "total_orders": integer(), "total_count": integer(),
+					"limit": integer(), "offset": integer(),
+				})),
+				"400": errorResponse("Invalid filter or page"),
+			},
+		}},
+		"/stats": gin.H{"get": gin.H{
+			"summary":   "Counters and latency percentiles, overall and per mode",
+			"tags":      []string{"stats"},
+			"responses": gin.H{"200": jsonResponse("Stats", ref("Stats"))},
+		}},
+		"/reset": gin.H{"post": gin.H{
+			"summary":    "Restock, clear orders and purchase limits, reset stats",
+			"tags":       []string{"admin"},
+			"parameters": []gin.H{queryParam("product_id", gin.H{"type": "integer", "minimum": 1})},
+			"responses": gin.H{
+				"200": jsonResponse("Everything reset", ref("ResetResponse")),
+				"207": jsonResponse("PostgreSQL reset, some Redis steps failed", ref("ResetResponse")),
+				"404": errorResponse("Product not found"),
+				"500": errorResponse("PostgreSQL reset failed"),
+			},
+		}},
+	}
+	for name, route := range purchaseQueryModes {
+		paths["/purchase/"+name] = purchaseOp("Buy in mode " + route.mode)
+	}
+
+	stepStatus := objectOf(gin.H{"ok": gin.H{"type": "boolean"}, "error": gin.H{"type": "string"}})
+	schemas := gin.H{
+		"PurchaseRequest": schemaOf(reflect.TypeOf(PurchaseRequest{})),
+		"CartRequest":     schemaOf(reflect.TypeOf(CartRequest{})),
+		"Error":           objectOf(gin.H{"error": schemaOf(reflect.TypeOf(APIError{}))}),
+		"PurchaseResponse": objectOf(gin.H{
+			"message":    gin.H{"type": "string"},
+			"mode":       gin.H{"type": "string"},
+			"order_id":   integer(),
+			"rank":       gin.H{"type": "integer", "description": "fair mode only"},
+			"fallback":   gin.H{"type": "boolean", "description": "redis mode served by the row-lock fallback"},
+			"retries":    gin.H{"type": "integer", "description": "serializable mode: serialization failures retried"},
+			"latency_ms": integer(),
+		}),
+		"CartResponse": objectOf(gin.H{
+			"message":    gin.H{"type": "string"},
+			"mode":       gin.H{"type": "string"},
+			"order_ids":  arrayOf(integer()),
+			"items":      arrayOf(schemaOf(reflect.TypeOf(CartItem{}))),
+			"latency_ms": integer(),
+		}),
+		"ProductSummary": objectOf(gin.H{
+			"id":          integer(),
+			"name":        gin.H{"type": "string"},
+			"price":       gin.H{"type": "number"},
+			"quantity":    integer(),
+			"db_quantity": integer(),
+			"redis_stock": gin.H{"type": "integer", "nullable": true},
+			"consistent":  gin.H{"type": "boolean"},
+		}),
+		"Product": objectOf(gin.H{
+			"id":           integer(),
+			"name":         gin.H{"type": "string"},
+			"price":        gin.H{"type": "number"},
+			"quantity":     integer(),
+			"redis_stock":  gin.H{"type": "integer", "nullable": true},
+			"sale_start":   gin.H{"type": "string", "format": "date-time", "nullable": true},
+			"sale_end":     gin.H{"type": "string", "format": "date-time", "nullable": true},
+			"server_time":  gin.H{"type": "string", "format": "date-time"},
+			"max_per_user": gin.H{"type": "integer", "description": "units one user may buy (0 = no limit)"},
+		}),
+		"Order": objectOf(gin.H{
+			"id":         integer(),
+			"user_id":    gin.H{"type": "integer", "nullable": true},
+			"product_id": integer(),
+			"quantity":   integer(),
+			"status":     gin.H{"type": "string", "enum": orderStatusNames()},
+			"created_at": gin.H{"type": "string", "format": "date-time"},
+		}),
+		"Stats": objectOf(gin.H{
+			"total_requests":        integer(),
+			"success":               integer(),
+			"failed":                integer(),
+			"oversells":             integer(),
+			"fallback_count":        integer(),
+			"lock_contended":        integer(),
+			"overloaded":            integer(),
+			"pool_saturated":        integer(),
+			"serialization_retries": integer(),
+			"in_flight":             integer(),
+			"max_in_flight":         integer(),
+			"avg_latency_ms":        gin.H{"type": "number"},
+			"p50_latency_ms":        gin.H{"type": "number"},
+			"p95_latency_ms":        gin.H{"type": "number"},
+			"p99_latency_ms":        gin.H{"type": "number"},
+			"by_mode":               gin.H{"type": "object", "additionalProperties": objectOf(gin.H{"requests": integer(), "success": integer(), "failed": integer(), "oversells": integer()})},
+			"latency_by_mode":       gin.H{"type": "object", "additionalProperties": gin.H{"type": "object"}},
+		}),
+		"ResetResponse": objectOf(gin.H{
+			"message":  gin.H{"type": "string"},
+			"products": arrayOf(schemaOf(reflect.TypeOf(productStock{}))),
+			"steps":    gin.H{"type": "object", "additionalProperties": stepStatus},
+		}),
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "Flash Sale API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": schemas,
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// schemaOf describes a struct from its json tags and binding rules
+// ("required", "min=", "max=")
+func schemaOf(t reflect.Type) gin.H {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		props := gin.H{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			prop := schemaOf(f.Type)
+			for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+				key, value, _ := strings.Cut(rule, "=")
+				n, err := strconv.Atoi(value)
+				switch {
+				case key == "required":
+					required = append(required, name)
+				case key == "min" && err == nil:
+					prop["minimum"] = n
+				case key == "max" && err == nil:
+					prop["maximum"] = n
+				}
+			}
+			props[name] = prop
+		}
+		schema := gin.H{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Slice, reflect.Array:
+		return arrayOf(schemaOf(t.Elem()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return integer()
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	}
+	return gin.H{}
+}
+
+// purchaseModeNames lists the ?mode= values POST /purchase accepts
+func purchaseModeNames() []string {
+	names := make([]string, 0, len(purchaseQueryModes))
+	for name := range purchaseQueryModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// orderStatusNames lists the statuses /orders filters by
+func orderStatusNames() []string {
+	names := make([]string, 0, len(validOrderStatuses))
+	for status := range validOrderStatuses {
+		names = append(names, status)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ref(name string) gin.H {
+	return gin.H{"$ref": "#/components/schemas/" + name}
+}
+
+func integer() gin.H {
+	return gin.H{"type": "integer"}
+}
+
+func arrayOf(items gin.H) gin.H {
+	return gin.H{"type": "array", "items": items}
+}
+
+func objectOf(props gin.H) gin.H {
+	return gin.H{"type": "object", "properties": props}
+}
+
+func jsonBody(schema gin.H) gin.H {
+	return gin.H{"required": true, "content": gin.H{"application/json": gin.H{"schema": schema}}}
+}
+
+func jsonResponse(description string, schema gin.H) gin.H {
+	return gin.H{"description": description, "content": gin.H{"application/json": gin.H{"schema": schema}}}
+}
+
+func errorResponse(description string) gin.H {
+	return jsonResponse(description, ref("Error"))
+}
+
+func queryParam(name string, schema gin.H) gin.H {
+	return gin.H{"name": name, "in": "query", "schema": schema}
+}
+
+func pathID() gin.H {
+	return gin.H{"name": "id", "in": "path", "required": true, "schema": gin.H{"type": "integer", "minimum": 1}}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refs collects every "$ref" in a decoded JSON document
+func refs(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if s, ok := child.(string); ok && k == "$ref" {
+				out = append(out, s)
+				continue
+			}
+			out = append(out, refs(child)...)
+		}
+	case []any:
+		for _, child := range v {
+			out = append(out, refs(child)...)
+		}
+	}
+	return out
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := gin.New()
+	r.GET("/openapi.json", OpenAPI)
+	rec := serve(r, http.MethodGet, "/openapi.json", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("status = %d, Content-Type %q; want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	decode(t, rec, &doc)
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+
+	for _, path := range []string{"/purchase", "/purchase/redis", "/products", "/orders", "/stats", "/reset"} {
+		if doc.Paths[path] == nil {
+			t.Errorf("no %s path", path)
+		}
+	}
+	// Every ?mode= has its own path
+	for name := range purchaseQueryModes {
+		if doc.Paths["/purchase/"+name]["post"] == nil {
+			t.Errorf("no POST /purchase/%s", name)
+		}
+	}
+
+	var full any
+	decode(t, rec, &full)
+	for _, ref := range refs(full) {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if !ok || doc.Components.Schemas[name] == nil {
+			t.Errorf("$ref %q points nowhere", ref)
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	got := schemaOf(reflect.TypeOf(PurchaseRequest{}))
+	props := got["properties"].(gin.H)
+	if _, ok := props["UserID"]; ok {
+		t.Fatalf("properties = %v, want json:\"-\" fields left out", props)
+	}
+	if !slices.Equal(got["required"].([]string), []string{"product_id"}) {
+		t.Fatalf("required = %v, want [product_id]", got["required"])
+	}
+	quantity := props["quantity"].(gin.H)
+	if quantity["type"] != "integer" || quantity["minimum"] != 1 || quantity["maximum"] != 100 {
+		t.Fatalf("quantity = %v, want an integer from 1 to 100 like its binding", quantity)
+	}
+	if productID := props["product_id"].(gin.H); productID["minimum"] != 1 || productID["maximum"] != nil {
+		t.Fatalf("product_id = %v, want minimum 1 and no maximum", productID)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================
+// 📦 BATCHED ORDER WRITES
+// ============================================
+// With ORDER_BATCH=true, Redis mode still takes the stock in Postgres inside
+// the request, but hands the order row to a background writer that COPYs
+// rows in bulk every ORDER_BATCH_SIZE rows or ORDER_BATCH_INTERVAL_MS,
+// whichever comes first. Responses then carry no order_id.
+
+var (
+	orderBatching     = config.Bool("ORDER_BATCH", false)
+	orderBatchSize    = max(config.Int("ORDER_BATCH_SIZE", 500), 1)
+	orderBatchEvery   = time.Duration(max(config.Int("ORDER_BATCH_INTERVAL_MS", 50), 1)) * time.Millisecond
+	orderQueue        = make(chan pendingOrder, 4*orderBatchSize)
+	orderQueueMu      sync.RWMutex // write-locked once to stop new sends before the final drain
+	orderQueueStopped bool
+)
+
+// pendingOrder is an order row waiting for the batch writer
+type pendingOrder struct {
+	UserID    int
+	ProductID int
+	Quantity  int
+	Status    string
+	CreatedAt time.Time
+}
+
+// insertOrderNow writes one order row directly, for when the queue can't take it
+func insertOrderNow(o pendingOrder) {
+	_, err := database.DB.Exec(context.Background(),
+		"INSERT INTO orders (user_id, product_id, quantity, status, created_at) VALUES ($1, $2, $3, $4, $5)",
+		o.UserID, o.ProductID, o.Quantity, o.Status, o.CreatedAt)
+	if err != nil {
+		slog.Error("❌ Lost order", "user_id", o.UserID, "product_id", o.ProductID, "error", err)
+	}
+}
+
+// queueOrder hands an order to the batch writer. If the queue is full or the
+// writer has stopped, the row is written synchronously instead: slower, but
+// never dropped.
+func queueOrder(o pendingOrder) {
+	orderQueueMu.RLock()
+	if !orderQueueStopped {
+		select {
+		case orderQueue <- o:
+			orderQueueMu.RUnlock()
+			return
+		default:
+		}
+	}
+	orderQueueMu.RUnlock()
+	insertOrderNow(o)
+}
+
+// RunOrderWriter flushes queued orders until ctx is cancelled, then writes
+// whatever is still queued and returns. Call it before closing the DB pool.
+func RunOrderWriter(ctx context.Context) {
+	ticker := time.NewTicker(orderBatchEvery)
+	defer ticker.Stop()
+
+	batch := make([]pendingOrder, 0, orderBatchSize)
+	for {
+		select {
+		case o := <-orderQueue:
+			batch = append(batch, o)
+			if len(batch) >= orderBatchSize {
+				batch = flushOrders(batch)
+			}
+		case <-ticker.C:
+			batch = flushOrders(batch)
+		case <-ctx.Done():
+			// Stop new sends (they fall back to direct inserts), then drain
+			orderQueueMu.Lock()
+			orderQueueStopped = true
+			orderQueueMu.Unlock()
+			for {
+				select {
+				case o := <-orderQueue:
+					batch = append(batch, o)
+				default:
+					flushOrders(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flushOrders COPYs the batch into orders and returns it emptied for reuse.
+// If the COPY fails the rows are retried one by one so a single bad row
+// can't take the others down with it.
+func flushOrders(batch []pendingOrder) []pendingOrder {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	_, err := database.DB.CopyFrom(context.Background(),
+		pgx.Identifier{"orders"},
+		[]string{"user_id", "product_id", "quantity", "status", "created_at"},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			o := batch[i]
+			return []any{o.UserID, o.ProductID, o.Quantity, o.Status, o.CreatedAt}, nil
+		}))
+	if err != nil {
+		slog.Warn("⚠️ Batch insert failed, retrying individually", "orders", len(batch), "error", err)
+		for _, o := range batch {
+			insertOrderNow(o)
+		}
+	}
+	return batch[:0]
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+)
+
+// countOrders counts every order row
+func countOrders(t *testing.T) int {
+	t.Helper()
+	var n int
+	if err := database.DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM orders").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOrderBatching(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+
+	prevBatching, prevEvery := orderBatching, orderBatchEvery
+	orderBatching, orderBatchEvery = true, 20*time.Millisecond
+	orderQueueStopped = false
+	t.Cleanup(func() {
+		orderBatching, orderBatchEvery = prevBatching, prevEvery
+		orderQueueStopped = false
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		RunOrderWriter(ctx)
+		close(stopped)
+	}()
+	stop := func() {
+		cancel()
+		<-stopped
+	}
+	t.Cleanup(stop)
+
+	const stock, buyers = 300, 400
+	res := runSale(t, saleMode{ModeRedisPostgres, PurchaseRedisPostgres, true}, stock, buyers)
+	if res.successes != stock || res.remaining != 0 {
+		t.Fatalf("%d sales, %d left; want %d and 0", res.successes, res.remaining, stock)
+	}
+
+	// The stock was taken synchronously; the rows follow within a few flushes
+	deadline := time.Now().Add(5 * time.Second)
+	for countOrders(t) < stock && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := countOrders(t); n != stock {
+		t.Fatalf("%d orders written by the batch writer, want %d", n, stock)
+	}
+
+	// Once stopped, orders bypass the queue and are written directly
+	stop()
+	queueOrder(pendingOrder{UserID: 1, ProductID: 1, Quantity: 1, Status: OrderStatusSuccess, CreatedAt: time.Now()})
+	if n := countOrders(t); n != stock+1 {
+		t.Fatalf("%d orders after a send to the stopped writer, want %d", n, stock+1)
+	}
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Order statuses
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusSuccess   = service.OrderStatusSuccess
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+
+	OrderStatusFailed        = "failed"
+	OrderStatusPaymentFailed = service.OrderStatusPaymentFailed
+)
+
+// orderTransitions lists the statuses each status may move to.
+// "success" (what the purchase handlers insert) behaves like "confirmed".
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusSuccess:   {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusCancelled},
+	OrderStatusDelivered: {},
+	OrderStatusCancelled: {},
+
+	// Recorded after the purchase was rolled back; no stock is held
+	OrderStatusFailed:        {},
+	OrderStatusPaymentFailed: {},
+}
+
+// validOrderStatuses lists the statuses /orders can filter on
+var validOrderStatuses = func() map[string]bool {
+	valid := map[string]bool{}
+	for status := range orderTransitions {
+		valid[status] = true
+	}
+	return valid
+}()
+
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderFilters builds a parameterized WHERE clause from the optional
+// ?user_id=, ?product_id= and ?status= params, ANDed together.
+// Values only ever travel as $n args, never inside the SQL string.
+func orderFilters(c *gin.Context) (string, []interface{}, bool) {
+	var conds []string
+	var args []interface{}
+	add := func(column string, value interface{}) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	for _, name := range []string{"user_id", "product_id"} {
+		if c.Query(name) == "" {
+			continue
+		}
+		id, ok := queryInt(c, name, 0, 1, math.MaxInt32)
+		if !ok {
+			return "", nil, false
+		}
+		add(name, id)
+	}
+
+	if status := c.Query("status"); status != "" {
+		if !validOrderStatuses[status] {
+			respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Unknown status", status)
+			return "", nil, false
+		}
+		add("status", status)
+	}
+
+	if len(conds) == 0 {
+		return "", nil, true
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, true
+}
+
+// Page size limits for /orders
+const (
+	defaultOrdersLimit = 50
+	maxOrdersLimit     = 500
+)
+
+// ListOrders returns orders newest first, paginated with ?limit= and ?offset=
+// and optionally filtered by user, product and status
+func ListOrders(c *gin.Context) {
+	limit, ok := queryInt(c, "limit", defaultOrdersLimit, 1, maxOrdersLimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+
+	where, args, ok := orderFilters(c)
+	if !ok {
+		return
+	}
+
+	var totalCount int
+	if err := database.DB.QueryRow(c, "SELECT COUNT(*) FROM orders"+where, args...).Scan(&totalCount); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to count orders")
+		return
+	}
+
+	args = append(args, limit, offset)
+	rows, err := database.DB.Query(c, fmt.Sprintf(
+		"SELECT "+orderColumns+" FROM orders%s ORDER BY id DESC LIMIT $%d OFFSET $%d",
+		where, len(args)-1, len(args)), args...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load orders")
+		return
+	}
+	defer rows.Close()
+
+	var orders []OrderDTO
+	for rows.Next() {
+		var o OrderDTO
+		if err := scanOrder(rows, &o); err != nil {
+			slog.Warn("⚠️ Failed to scan order row", "error", err)
+			respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load orders")
+			return
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Warn("⚠️ Failed to read order rows", "error", err)
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total_orders": len(orders),
+		"total_count":  totalCount,
+		"limit":        limit,
+		"offset":       offset,
+		"orders":       orders,
+	})
+}
+
+// Window limits for /orders/summary's per-minute series
+const (
+	defaultSummaryMinutes = 15
+	maxSummaryMinutes     = 24 * 60
+)
+
+// orderCount is one group in /orders/summary
+type orderCount struct {
+	Status    string     `json:"status,omitempty"`
+	ProductID int        `json:"product_id,omitempty"`
+	Minute    *time.Time `json:"minute,omitempty"`
+	Orders    int        `json:"orders"`
+	Units     int        `json:"units"`
+}
+
+// OrdersSummary aggregates orders in SQL for the dashboard: counts by status,
+// by product, and per minute over the last ?minutes= (default 15). Minutes
+// without orders are left out of the series.
+func OrdersSummary(c *gin.Context) {
+	minutes, ok := queryInt(c, "minutes", defaultSummaryMinutes, 1, maxSummaryMinutes)
+	if !ok {
+		return
+	}
+
+	byStatus, err := queryOrderCounts(c, func(row pgx.CollectableRow) (orderCount, error) {
+		var oc orderCount
+		err := row.Scan(&oc.Status, &oc.Orders, &oc.Units)
+		return oc, err
+	}, `SELECT status, COUNT(*), COALESCE(SUM(quantity), 0) FROM orders GROUP BY status ORDER BY status`)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to summarize orders")
+		return
+	}
+
+	byProduct, err := queryOrderCounts(c, func(row pgx.CollectableRow) (orderCount, error) {
+		var oc orderCount
+		err := row.Scan(&oc.ProductID, &oc.Orders, &oc.Units)
+		return oc, err
+	}, `SELECT product_id, COUNT(*), COALESCE(SUM(quantity), 0) FROM orders GROUP BY product_id ORDER BY product_id`)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to summarize orders")
+		return
+	}
+
+	// Minutes are truncated in the session's time zone; the instants are exact
+	perMinute, err := queryOrderCounts(c, func(row pgx.CollectableRow) (orderCount, error) {
+		var oc orderCount
+		err := row.Scan(&oc.Minute, &oc.Orders, &oc.Units)
+		return oc, err
+	}, `SELECT date_trunc('minute', created_at) AS minute, COUNT(*), COALESCE(SUM(quantity), 0)
+		FROM orders
+		WHERE created_at >= date_trunc('minute', NOW()) - make_interval(mins => $1 - 1)
+		GROUP BY minute ORDER BY minute`, minutes)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to summarize orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"by_status":  byStatus,
+		"by_product": byProduct,
+		"per_minute": perMinute,
+		"minutes":    minutes,
+	})
+}
+
+// queryOrderCounts runs one GROUP BY for OrdersSummary; never returns nil so
+// empty groups encode as []
+func queryOrderCounts(ctx context.Context, scan pgx.RowToFunc[orderCount], sql string, args ...any) ([]orderCount, error) {
+	rows, err := database.DB.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := pgx.CollectRows(rows, scan)
+	if counts == nil {
+		counts = []orderCount{}
+	}
+	return counts, err
+}
+
+// releaseAllowanceScript takes a cancelled order's units off the buyer's
+// per-user counter, never below 0: orders from the Postgres-only modes were
+// never counted, so there may be less (or nothing) to take back.
+// KEYS[1] = user counter, ARGV[1] = units. Returns the counter afterwards.
+var releaseAllowanceScript = redis.NewScript(`
+	local bought = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if bought <= 0 then
+		return 0
+	end
+	return redis.call('DECRBY', KEYS[1], math.min(bought, tonumber(ARGV[1])))
+`)
+
+// UpdateOrderStatus moves an order along its lifecycle. Cancelling puts the
+// unit back on sale and hands the buyer's allowance back: Postgres is
+// restocked in the same transaction as the status change, and Redis only
+// after that commits. A Redis step that fails then is dead-lettered
+// (service.RecordCompensationFailure) for the reconcile job or an operator.
+// Mounted behind RequireAdmin: shipping and cancelling are the shop's calls,
+// not the buyer's.
+func UpdateOrderStatus(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validOrderStatuses[req.Status] {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "Invalid or unknown status")
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Lock the order row so two concurrent cancels can't both restock
+	var current string
+	var userID *int
+	var productID, quantity int
+	err = tx.QueryRow(c, "SELECT status, user_id, product_id, quantity FROM orders WHERE id=$1 FOR UPDATE", id).
+		Scan(&current, &userID, &productID, &quantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load order")
+		return
+	}
+
+	if !canTransition(current, req.Status) {
+		respondErrorDetail(c, http.StatusConflict, CodeInvalidTransition, "Illegal status transition",
+			fmt.Sprintf("%s -> %s", current, req.Status))
+		return
+	}
+
+	if _, err := tx.Exec(c, "UPDATE orders SET status=$1 WHERE id=$2", req.Status, id); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to update order")
+		return
+	}
+
+	restock := req.Status == OrderStatusCancelled
+	var stock int
+	if restock {
+		err := tx.QueryRow(c, "UPDATE products SET quantity = quantity + $1 WHERE id=$2 RETURNING quantity", quantity, productID).Scan(&stock)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to restock product")
+			return
+		}
+	}
+
+	if err := tx.Commit(c); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeTransactionFail, "Failed to commit transaction")
+		return
+	}
+
+	if restock {
+		releaseCancelledOrder(id, userID, productID, quantity, stock)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":   id,
+		"from":       current,
+		"status":     req.Status,
+		"restocked":  restock,
+		"product_id": productID,
+	})
+}
+
+// releaseCancelledOrder puts a cancelled order's units back in Redis, stock
+// (already restocked to dbStock in Postgres) and the buyer's counter
+func releaseCancelledOrder(orderID int, userID *int, productID, quantity, dbStock int) {
+	ctx := context.Background()
+	buyer := 0 // compensation_failures.user_id is NOT NULL
+	if userID != nil {
+		buyer = *userID
+	}
+
+	stock, _, err := adjustRedisStock(ctx, productID, quantity, dbStock)
+	if err != nil {
+		slog.Warn("⚠️ Order cancelled but Redis restock failed", "order_id", orderID, "product_id", productID, "error", err)
+		service.RecordCompensationFailure(productID, buyer, database.StockKey(productID), int64(quantity), err)
+	} else {
+		publishStock(productID, stock, "cancel")
+	}
+
+	if userID == nil {
+		return
+	}
+	userKey := database.UserPurchaseKey(*userID, productID)
+	if err := releaseAllowanceScript.Run(ctx, database.Rdb, []string{userKey}, quantity).Err(); err != nil {
+		service.RecordCompensationFailure(productID, buyer, userKey, -int64(quantity), err)
+	}
+}
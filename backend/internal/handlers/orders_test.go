@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// insertOrder writes an order row straight to PostgreSQL
+func insertOrder(t testing.TB, userID, productID, quantity int, status string) int {
+	t.Helper()
+	id, err := service.InsertOrder(t.Context(), database.DB, userID, productID, quantity, status)
+	if err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	return id
+}
+
+func TestCanTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		{OrderStatusPending, OrderStatusConfirmed, true},
+		{OrderStatusSuccess, OrderStatusShipped, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusConfirmed, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusShipped, OrderStatusCancelled, true},
+		{OrderStatusDelivered, OrderStatusCancelled, false},
+		{OrderStatusPaymentFailed, OrderStatusConfirmed, false},
+		{OrderStatusDelivered, OrderStatusPending, false},
+		{OrderStatusCancelled, OrderStatusConfirmed, false},
+		{OrderStatusSuccess, OrderStatusSuccess, false},
+	} {
+		if got := canTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("canTransition(%s, %s) = %t, want %t", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+// orderStatusRouter serves POST /orders/:id/status as main does, with
+// ADMIN_TOKEN "secret"
+func orderStatusRouter(t testing.TB) *gin.Engine {
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = "" })
+	r := gin.New()
+	r.POST("/orders/:id/status", RequireAdmin(), UpdateOrderStatus)
+	return r
+}
+
+func TestUpdateOrderStatusRequiresAdmin(t *testing.T) {
+	r := orderStatusRouter(t)
+	rec := serve(r, http.MethodPost, "/orders/1/status", `{"status": "cancelled"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := orderStatusRouter(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	setStatus := func(orderID int, status string) (int, APIError) {
+		rec := serve(r, http.MethodPost, fmt.Sprintf("/orders/%d/status", orderID),
+			fmt.Sprintf(`{"status": %q}`, status), AdminTokenHeader, "secret")
+		if rec.Code == http.StatusOK {
+			return rec.Code, APIError{}
+		}
+		return rec.Code, errorOf(t, rec)
+	}
+
+	t.Run("valid transition", func(t *testing.T) {
+		orderID := insertOrder(t, 1, productID, 1, OrderStatusSuccess)
+		if code, apiErr := setStatus(orderID, OrderStatusShipped); code != http.StatusOK {
+			t.Fatalf("success -> shipped: status = %d (%s)", code, apiErr.Code)
+		}
+		if code, apiErr := setStatus(orderID, OrderStatusDelivered); code != http.StatusOK {
+			t.Fatalf("shipped -> delivered: status = %d (%s)", code, apiErr.Code)
+		}
+		if n := testutil.Orders(t, productID, OrderStatusDelivered); n != 1 {
+			t.Fatalf("%d delivered orders, want 1", n)
+		}
+	})
+
+	t.Run("illegal transition", func(t *testing.T) {
+		orderID := insertOrder(t, 2, productID, 1, OrderStatusShipped)
+		code, apiErr := setStatus(orderID, OrderStatusPending)
+		if code != http.StatusConflict || apiErr.Code != CodeInvalidTransition {
+			t.Fatalf("shipped -> pending: status = %d (%s), want 409 %s", code, apiErr.Code, CodeInvalidTransition)
+		}
+		if n := testutil.Orders(t, productID, OrderStatusShipped); n != 1 {
+			t.Fatal("the refused transition changed the order")
+		}
+	})
+
+	t.Run("cancel restocks", func(t *testing.T) {
+		orderID := insertOrder(t, 3, productID, 4, OrderStatusSuccess)
+		before := testutil.Quantity(t, productID)
+		if code, apiErr := setStatus(orderID, OrderStatusCancelled); code != http.StatusOK {
+			t.Fatalf("success -> cancelled: status = %d (%s)", code, apiErr.Code)
+		}
+		if got := testutil.Quantity(t, productID); got != before+4 {
+			t.Fatalf("PostgreSQL quantity = %d, want %d", got, before+4)
+		}
+		if got, _ := mr.Get(database.StockKey(productID)); got != "14" {
+			t.Fatalf("Redis stock = %s, want 14", got)
+		}
+
+		// A second cancel is illegal and must not restock again
+		if code, _ := setStatus(orderID, OrderStatusCancelled); code != http.StatusConflict {
+			t.Fatalf("cancelling twice: status = %d, want 409", code)
+		}
+		if got := testutil.Quantity(t, productID); got != before+4 {
+			t.Fatalf("PostgreSQL quantity = %d after a second cancel, want %d", got, before+4)
+		}
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		if code, _ := setStatus(999999, OrderStatusShipped); code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", code)
+		}
+	})
+}
+
+// cancelOrder cancels an order through orderStatusRouter, failing on anything but 200
+func cancelOrder(t *testing.T, r *gin.Engine, orderID int) {
+	t.Helper()
+	rec := serve(r, http.MethodPost, fmt.Sprintf("/orders/%d/status", orderID),
+		`{"status": "cancelled"}`, AdminTokenHeader, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel order %d: status = %d: %s", orderID, rec.Code, rec.Body)
+	}
+}
+
+func TestCancelReleasesAllowance(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := orderStatusRouter(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	counted := database.UserPurchaseKey(5, productID)
+	mr.Set(counted, "3")
+	cancelOrder(t, r, insertOrder(t, 5, productID, 2, OrderStatusSuccess))
+	if got, _ := mr.Get(counted); got != "1" {
+		t.Fatalf("user counter = %s, want 1 after cancelling 2 of 3 units", got)
+	}
+
+	// An order the counter never saw (Postgres-only modes) can't push it below 0
+	cancelOrder(t, r, insertOrder(t, 5, productID, 4, OrderStatusSuccess))
+	if got, _ := mr.Get(counted); got != "0" {
+		t.Fatalf("user counter = %s, want 0", got)
+	}
+	uncounted := database.UserPurchaseKey(6, productID)
+	cancelOrder(t, r, insertOrder(t, 6, productID, 1, OrderStatusSuccess))
+	if mr.Exists(uncounted) {
+		t.Fatal("cancelling created a counter for a buyer who had none")
+	}
+}
+
+func TestCancelDeadLettersRedisFailure(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := orderStatusRouter(t)
+	productID := testutil.Product(t, "Widget", 10)
+	orderID := insertOrder(t, 5, productID, 2, OrderStatusSuccess)
+
+	mr.SetError("ERR redis is down")
+	cancelOrder(t, r, orderID)
+	mr.SetError("")
+
+	if got := testutil.Quantity(t, productID); got != 12 {
+		t.Fatalf("PostgreSQL quantity = %d, want 12", got)
+	}
+	rows, err := database.DB.Query(t.Context(),
+		"SELECT redis_key, delta FROM compensation_failures WHERE product_id=$1 AND user_id=5 ORDER BY id", productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type deadLetter struct {
+		Key   string
+		Delta int64
+	}
+	got, err := pgx.CollectRows(rows, pgx.RowToStructByPos[deadLetter])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []deadLetter{
+		{database.StockKey(productID), 2},
+		{database.UserPurchaseKey(5, productID), -2},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("dead letters = %+v, want %+v", got, want)
+	}
+}
+
+// orderPage is a GET /orders response
+type orderPage struct {
+	TotalOrders int        `json:"total_orders"`
+	TotalCount  int        `json:"total_count"`
+	Limit       int        `json:"limit"`
+	Offset      int        `json:"offset"`
+	Orders      []OrderDTO `json:"orders"`
+}
+
+// listOrders GETs /orders?query and decodes a 200 response
+func listOrders(t *testing.T, query string) orderPage {
+	t.Helper()
+	r := gin.New()
+	r.GET("/orders", ListOrders)
+	rec := serve(r, http.MethodGet, "/orders?"+query, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /orders?%s: status = %d: %s", query, rec.Code, rec.Body)
+	}
+	var page orderPage
+	decode(t, rec, &page)
+	return page
+}
+
+func TestListOrdersBadPaging(t *testing.T) {
+	r := gin.New()
+	r.GET("/orders", ListOrders)
+	for _, query := range []string{"limit=0", "limit=501", "limit=ten", "offset=-1", "offset=x"} {
+		rec := serve(r, http.MethodGet, "/orders?"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestListOrdersPagination(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Widget", 200)
+	for userID := 1; userID <= 120; userID++ {
+		insertOrder(t, userID, productID, 1, OrderStatusSuccess)
+	}
+
+	page := listOrders(t, "")
+	if page.Limit != defaultOrdersLimit || page.Offset != 0 || page.TotalCount != 120 || len(page.Orders) != defaultOrdersLimit {
+		t.Fatalf("default page: limit %d, offset %d, total %d, %d orders", page.Limit, page.Offset, page.TotalCount, len(page.Orders))
+	}
+
+	// Newest first, so page 2 of 50 holds orders 70 down to 21
+	page = listOrders(t, "limit=50&offset=50")
+	if page.TotalCount != 120 || page.TotalOrders != 50 || page.Limit != 50 || page.Offset != 50 {
+		t.Fatalf("page 2: %+v", page)
+	}
+	for i, o := range page.Orders {
+		if want := 70 - i; o.ID != want {
+			t.Fatalf("page 2 order %d has id %d, want %d", i, o.ID, want)
+		}
+	}
+
+	page = listOrders(t, "limit=50&offset=100")
+	if len(page.Orders) != 20 || page.Orders[19].ID != 1 {
+		t.Fatalf("last page: %d orders, want 20 ending at id 1", len(page.Orders))
+	}
+	if page = listOrders(t, "offset=500"); len(page.Orders) != 0 || page.TotalCount != 120 {
+		t.Fatalf("past the end: %d orders (total %d), want none of 120", len(page.Orders), page.TotalCount)
+	}
+}
+
+func TestOrderFilters(t *testing.T) {
+	tests := []struct {
+		query string
+		where string
+		args  []interface{}
+	}{
+		{"", "", nil},
+		{"user_id=7", " WHERE user_id = $1", []interface{}{7}},
+		{"product_id=3", " WHERE product_id = $1", []interface{}{3}},
+		{"status=cancelled", " WHERE status = $1", []interface{}{"cancelled"}},
+		{"status=cancelled&product_id=3&user_id=7", " WHERE user_id = $1 AND product_id = $2 AND status = $3", []interface{}{7, 3, "cancelled"}},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/orders?"+tt.query, nil)
+		where, args, ok := orderFilters(c)
+		if !ok || where != tt.where || !slices.Equal(args, tt.args) {
+			t.Errorf("%q: %q %v (ok %t), want %q %v", tt.query, where, args, ok, tt.where, tt.args)
+		}
+	}
+}
+
+func TestListOrdersScanError(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+	insertOrder(t, 1, productID, 1, OrderStatusSuccess)
+	// product_id is nullable in the schema but not in the DTO
+	if _, err := database.DB.Exec(t.Context(),
+		"INSERT INTO orders (user_id, product_id, quantity, status) VALUES (2, NULL, 1, 'success')"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/orders", ListOrders)
+	rec := serve(r, http.MethodGet, "/orders", "")
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeDBError {
+		t.Fatalf("status = %d: %s; want 500 %s, not an order for product 0", rec.Code, rec.Body, CodeDBError)
+	}
+}
+
+func TestListOrdersBadFilters(t *testing.T) {
+	r := gin.New()
+	r.GET("/orders", ListOrders)
+	for _, query := range []string{"status=lost", "status=success';DROP TABLE orders;--", "user_id=abc", "product_id=0"} {
+		rec := serve(r, http.MethodGet, "/orders?"+url.PathEscape(query), "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestListOrdersFiltered(t *testing.T) {
+	testutil.Postgres(t)
+	a := testutil.Product(t, "A", 100)
+	b := testutil.Product(t, "B", 100)
+	insertOrder(t, 1, a, 1, OrderStatusSuccess)   // 1
+	insertOrder(t, 1, b, 1, OrderStatusCancelled) // 2
+	insertOrder(t, 2, a, 1, OrderStatusCancelled) // 3
+	insertOrder(t, 2, b, 1, OrderStatusSuccess)   // 4
+	insertOrder(t, 1, a, 1, OrderStatusCancelled) // 5
+
+	tests := []struct {
+		query string
+		want  []int // order ids, newest first
+	}{
+		{fmt.Sprintf("user_id=%d", 1), []int{5, 2, 1}},
+		{fmt.Sprintf("product_id=%d", b), []int{4, 2}},
+		{"status=cancelled", []int{5, 3, 2}},
+		{fmt.Sprintf("user_id=1&product_id=%d", a), []int{5, 1}},
+		{fmt.Sprintf("user_id=1&product_id=%d&status=cancelled", a), []int{5}},
+		{"user_id=2&status=shipped", nil},
+	}
+	for _, tt := range tests {
+		page := listOrders(t, tt.query)
+		var got []int
+		for _, o := range page.Orders {
+			got = append(got, o.ID)
+		}
+		if !slices.Equal(got, tt.want) || page.TotalCount != len(tt.want) {
+			t.Errorf("%s: orders %v (total %d), want %v", tt.query, got, page.TotalCount, tt.want)
+		}
+	}
+}
+
+func TestPurchaseReturnsOrderID(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+
+	for i, m := range saleModes {
+		t.Run(m.name, func(t *testing.T) {
+			userID := i + 1
+			productID := testutil.Product(t, "Widget "+m.name, 10)
+			r := gin.New()
+			r.POST("/purchase", Authenticate(), m.handler)
+			rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID),
+				"Authorization", bearer(t, userID))
+			var res struct {
+				OrderID int `json:"order_id"`
+			}
+			decode(t, rec, &res)
+			if rec.Code != http.StatusOK || res.OrderID == 0 {
+				t.Fatalf("status = %d: %s; want 200 with an order_id", rec.Code, rec.Body)
+			}
+
+			page := listOrders(t, fmt.Sprintf("user_id=%d", userID))
+			if len(page.Orders) != 1 {
+				t.Fatalf("user %d has %d orders, want 1", userID, len(page.Orders))
+			}
+			order := page.Orders[0]
+			if order.ID != res.OrderID || order.ProductID != productID || order.UserID == nil || *order.UserID != userID {
+				t.Fatalf("order = %+v, want id %d for user %d and product %d", order, res.OrderID, userID, productID)
+			}
+		})
+	}
+}
+
+func TestOrdersSummaryBadMinutes(t *testing.T) {
+	r := gin.New()
+	r.GET("/orders/summary", OrdersSummary)
+	for _, query := range []string{"minutes=0", "minutes=1441", "minutes=soon"} {
+		rec := serve(r, http.MethodGet, "/orders/summary?"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestOrdersSummary(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	widget := testutil.Product(t, "Widget", 10)
+	gadget := testutil.Product(t, "Gadget", 10)
+	insertOrder(t, 1, widget, 2, OrderStatusSuccess)
+	insertOrder(t, 2, widget, 1, OrderStatusSuccess)
+	insertOrder(t, 3, widget, 1, OrderStatusCancelled)
+	insertOrder(t, 1, gadget, 3, OrderStatusSuccess)
+	old := insertOrder(t, 2, gadget, 1, OrderStatusPending)
+	if _, err := database.DB.Exec(t.Context(),
+		"UPDATE orders SET created_at = NOW() - interval '2 hours' WHERE id = $1", old); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/orders/summary", OrdersSummary)
+	rec := serve(r, http.MethodGet, "/orders/summary?minutes=60", "")
+	var summary struct {
+		ByStatus  []orderCount `json:"by_status"`
+		ByProduct []orderCount `json:"by_product"`
+		PerMinute []orderCount `json:"per_minute"`
+		Minutes   int          `json:"minutes"`
+	}
+	decode(t, rec, &summary)
+	if rec.Code != http.StatusOK || summary.Minutes != 60 {
+		t.Fatalf("status = %d: %s; want 200 over 60 minutes", rec.Code, rec.Body)
+	}
+
+	// Sorted by status, then by product id
+	wantStatus := []orderCount{
+		{Status: OrderStatusCancelled, Orders: 1, Units: 1},
+		{Status: OrderStatusPending, Orders: 1, Units: 1},
+		{Status: OrderStatusSuccess, Orders: 3, Units: 6},
+	}
+	if !slices.Equal(summary.ByStatus, wantStatus) {
+		t.Fatalf("by_status = %+v, want %+v", summary.ByStatus, wantStatus)
+	}
+	wantProduct := []orderCount{
+		{ProductID: widget, Orders: 3, Units: 4},
+		{ProductID: gadget, Orders: 2, Units: 4},
+	}
+	if !slices.Equal(summary.ByProduct, wantProduct) {
+		t.Fatalf("by_product = %+v, want %+v", summary.ByProduct, wantProduct)
+	}
+
+	// The backdated order is outside the window; the rest may straddle a minute
+	orders := 0
+	for _, m := range summary.PerMinute {
+		if m.Minute == nil {
+			t.Fatalf("per_minute entry %+v has no minute", m)
+		}
+		orders += m.Orders
+	}
+	if orders != 4 || len(summary.PerMinute) > 2 {
+		t.Fatalf("per_minute = %+v, want the 4 recent orders in one or two minutes", summary.PerMinute)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🚦 BACKPRESSURE ON THE POSTGRES STEP
+// ============================================
+// With MAX_CONCURRENT_PURCHASES > 0, at most that many Redis-mode purchases
+// run their Postgres transaction at once. The rest wait for a slot until
+// their request deadline and then get 503 OVERLOADED, instead of all piling
+// onto the pool and timing out together.
+//
+// DB_POOL_HIGH_WATER_PCT > 0 sheds load earlier still: once that share of
+// the pool's connections is checked out, purchases that would open a
+// transaction get 503 POOL_SATURATED at once rather than queueing on
+// connection acquisition.
+
+// purchaseSlots is the semaphore; nil (the default, 0) means no limit
+var purchaseSlots = newPurchaseSlots(config.Int("MAX_CONCURRENT_PURCHASES", 0))
+
+func newPurchaseSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// poolHighWater is the percentage of DB_MAX_CONNS in use at which purchases
+// are shed (0 = never)
+var poolHighWater = min(max(config.Int("DB_POOL_HIGH_WATER_PCT", 0), 0), 100)
+
+// checkPoolSaturation turns the purchase away when the pool is at its high
+// water mark, reporting the failure and returning false
+func checkPoolSaturation(ctx context.Context, c *gin.Context, mode string) bool {
+	if poolHighWater == 0 {
+		return true
+	}
+	s := database.DB.Stat()
+	if int64(s.AcquiredConns())*100 < int64(s.MaxConns())*int64(poolHighWater) {
+		return true
+	}
+	countPoolSaturated()
+	c.Header("Retry-After", "1")
+	failPurchaseDetail(ctx, c, mode, http.StatusServiceUnavailable, CodePoolSaturated, "Database pool is saturated, try again",
+		fmt.Sprintf("%d of %d connections in use (DB_POOL_HIGH_WATER_PCT=%d)", s.AcquiredConns(), s.MaxConns(), poolHighWater))
+	return false
+}
+
+// acquirePurchaseSlot waits for a Postgres slot. When none frees up before
+// ctx ends, the failure has already been reported and ok is false; otherwise
+// the caller must call release (typically deferred).
+func acquirePurchaseSlot(ctx context.Context, c *gin.Context, mode string) (release func(), ok bool) {
+	if purchaseSlots == nil {
+		return func() {}, true
+	}
+	select {
+	case purchaseSlots <- struct{}{}:
+		return func() { <-purchaseSlots }, true
+	case <-ctx.Done():
+		countOverloaded()
+		countFailure(mode)
+		c.Header("Retry-After", "1")
+		respondErrorDetail(c, http.StatusServiceUnavailable, CodeOverloaded, "Too many purchases in progress, try again",
+			"MAX_CONCURRENT_PURCHASES="+strconv.Itoa(cap(purchaseSlots)))
+		return nil, false
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPurchaseSlots(t *testing.T) {
+	resetStats(t)
+	prevSlots, prevTimeout := purchaseSlots, requestTimeout
+	t.Cleanup(func() { purchaseSlots, requestTimeout = prevSlots, prevTimeout })
+	purchaseSlots, requestTimeout = newPurchaseSlots(2), 100*time.Millisecond
+
+	// Holds its slot until unblock is closed, like a slow transaction
+	acquired := make(chan struct{})
+	unblock := make(chan struct{})
+	r := gin.New()
+	r.POST("/purchase", func(c *gin.Context) {
+		ctx, cancel := requestContext(c)
+		defer cancel()
+		release, ok := acquirePurchaseSlot(ctx, c, ModeRedisPostgres)
+		if !ok {
+			return
+		}
+		defer release()
+		acquired <- struct{}{}
+		<-unblock
+		c.Status(http.StatusOK)
+	})
+
+	const held, excess = 2, 3
+	var wg sync.WaitGroup
+	for range held {
+		wg.Go(func() { serve(r, http.MethodPost, "/purchase", "") })
+	}
+	for range held {
+		<-acquired
+	}
+
+	recs := make([]*httptest.ResponseRecorder, excess)
+	var excessWG sync.WaitGroup
+	for i := range recs {
+		excessWG.Go(func() { recs[i] = serve(r, http.MethodPost, "/purchase", "") })
+	}
+	excessWG.Wait()
+	for i, rec := range recs {
+		if rec.Code != http.StatusServiceUnavailable || errorOf(t, rec).Code != CodeOverloaded {
+			t.Fatalf("excess request %d: status = %d: %s; want 503 %s", i+1, rec.Code, rec.Body, CodeOverloaded)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("excess request %d has no Retry-After", i+1)
+		}
+	}
+	if OverloadedCount != excess || readModeCounters(ModeRedisPostgres).Failed != excess {
+		t.Fatalf("overloaded = %d, failures = %d; want %d each",
+			OverloadedCount, readModeCounters(ModeRedisPostgres).Failed, excess)
+	}
+
+	// Slots free up again once the held purchases finish
+	close(unblock)
+	wg.Wait()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(r, http.MethodPost, "/purchase", "") }()
+	<-acquired
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Fatalf("after release: status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+}
+
+func TestPoolSaturationDisabled(t *testing.T) {
+	prev := poolHighWater
+	t.Cleanup(func() { poolHighWater = prev })
+	poolHighWater = 0
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/purchase", nil)
+	// With no high-water mark the pool isn't even consulted
+	if !checkPoolSaturation(c.Request.Context(), c, ModePostgresLock) {
+		t.Fatalf("DB_POOL_HIGH_WATER_PCT=0 shed a purchase: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPoolSaturation(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	prev := poolHighWater
+	t.Cleanup(func() { poolHighWater = prev })
+	poolHighWater = 10
+	productID := testutil.Product(t, "Widget", 10)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchasePostgresLock)
+	r.POST("/purchase/naive", Authenticate(), PurchaseNaive)
+	body := fmt.Sprintf(`{"product_id": %d, "quantity": 1}`, productID)
+
+	// Hold open transactions until 10% of the pool is in use
+	maxConns := int(database.DB.Stat().MaxConns())
+	held := make([]pgx.Tx, 0, (maxConns*poolHighWater+99)/100)
+	release := func() {
+		for _, tx := range held {
+			tx.Rollback(context.Background())
+		}
+		held = held[:0]
+	}
+	t.Cleanup(release)
+	for range cap(held) {
+		tx, err := database.DB.Begin(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, tx)
+	}
+
+	for userID, path := range []string{"/purchase", "/purchase", "/purchase/naive"} {
+		rec := serve(r, http.MethodPost, path, body, "Authorization", bearer(t, userID+1))
+		if rec.Code != http.StatusServiceUnavailable || errorOf(t, rec).Code != CodePoolSaturated {
+			t.Fatalf("%s with %d of %d connections held: status = %d: %s; want 503 %s", path, len(held), maxConns, rec.Code, rec.Body, CodePoolSaturated)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatal("503 without Retry-After")
+		}
+	}
+	if n := atomic.LoadInt64(&PoolSaturatedCount); n != 3 {
+		t.Fatalf("pool_saturated = %d, want 3", n)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10: a shed purchase must not sell", got)
+	}
+
+	release()
+	if rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, 4)); rec.Code != http.StatusOK {
+		t.Fatalf("pool drained: status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+}
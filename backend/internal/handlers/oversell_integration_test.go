@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// saleMode is one purchase endpoint the oversell harness drives
+type saleMode struct {
+	name    string
+	handler gin.HandlerFunc
+	safe    bool // must never sell more than the stock
+}
+
+var saleModes = []saleMode{
+	{ModeNaive, PurchaseNaive, false},
+	{ModePostgresLock, PurchasePostgresLock, true},
+	{ModePostgresNoWait, PurchasePostgresLockNoWait, true},
+	{ModeSerializable, PurchaseSerializable, true},
+	{ModeRedisPostgres, PurchaseRedisPostgres, true},
+	{ModeFair, PurchaseFair, true},
+}
+
+// saleResult is what one burst of purchases against a fresh product did
+type saleResult struct {
+	successes int
+	remaining int             // PostgreSQL quantity afterwards
+	latencies []time.Duration // of the successful purchases
+	elapsed   time.Duration
+}
+
+// runSale seeds a product with stock units and has buyers distinct users buy
+// one unit each, all at once, through the mode's handler
+func runSale(t testing.TB, m saleMode, stock, buyers int) saleResult {
+	t.Helper()
+	productID := testutil.Product(t, "Oversell "+m.name, stock)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), m.handler)
+	body := fmt.Sprintf(`{"product_id": %d, "quantity": 1}`, productID)
+	tokens := make([]string, buyers)
+	for i := range tokens {
+		tokens[i] = bearer(t, i+1)
+	}
+
+	var (
+		mu     sync.Mutex
+		res    saleResult
+		wg     sync.WaitGroup
+		starts = make(chan struct{})
+	)
+	for _, token := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-starts
+			begin := time.Now()
+			rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", token)
+			if rec.Code != http.StatusOK {
+				return
+			}
+			mu.Lock()
+			res.successes++
+			res.latencies = append(res.latencies, time.Since(begin))
+			mu.Unlock()
+		}()
+	}
+	begin := time.Now()
+	close(starts)
+	wg.Wait()
+	res.elapsed = time.Since(begin)
+	res.remaining = testutil.Quantity(t, productID)
+	return res
+}
+
+func TestOversell(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fires thousands of purchases; skipped with -short")
+	}
+	testutil.Postgres(t)
+	testutil.Redis(t)
+
+	const stock, buyers = 100, 500
+	for _, m := range saleModes {
+		t.Run(m.name, func(t *testing.T) {
+			res := runSale(t, m, stock, buyers)
+			t.Logf("%d of %d purchases succeeded, %d left", res.successes, buyers, res.remaining)
+			if !m.safe {
+				// Naive mode may oversell; that is what it demonstrates
+				return
+			}
+			if res.successes > stock {
+				t.Fatalf("%d purchases succeeded with %d in stock", res.successes, stock)
+			}
+			if res.remaining < 0 {
+				t.Fatalf("quantity went negative: %d", res.remaining)
+			}
+			if res.remaining != stock-res.successes {
+				t.Fatalf("quantity = %d after %d sales of %d, want %d", res.remaining, res.successes, stock, stock-res.successes)
+			}
+		})
+	}
+}
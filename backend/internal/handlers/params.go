@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idParam parses a positive integer path param, responding 400 when it isn't one
+func idParam(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid "+name, "must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// queryInt parses an optional integer query param within [min, max], falling
+// back to def when absent and responding 400 when invalid
+func queryInt(c *gin.Context, name string, def, min, max int) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min || n > max {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid "+name,
+			fmt.Sprintf("must be an integer between %d and %d", min, max))
+		return 0, false
+	}
+	return n, true
+}
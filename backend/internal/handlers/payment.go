@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 💳 PURCHASE WITH PAYMENT (compensating transactions)
+// ============================================
+// Same reservation as Mode 3, but a simulated payment sits between reserving
+// stock in Redis and taking it in Postgres (service.PurchaseService.Charge).
+// When payment fails, the Redis reservation is released and a
+// 'payment_failed' order is recorded so the attempt is visible in /orders;
+// Postgres stock is never touched.
+
+var (
+	paymentFailRate = min(max(config.Int("PAYMENT_FAIL_RATE", 10), 0), 100) // percent
+	paymentLatency  = time.Duration(config.Int("PAYMENT_LATENCY_MS", 20)) * time.Millisecond
+)
+
+// simulatePayment stands in for a payment provider: it takes PAYMENT_LATENCY_MS
+// and declines PAYMENT_FAIL_RATE percent of charges
+func simulatePayment(ctx context.Context) error {
+	select {
+	case <-time.After(paymentLatency):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if rand.IntN(100) < paymentFailRate {
+		return service.ErrPaymentDeclined
+	}
+	return nil
+}
+
+func PurchaseWithPayment(c *gin.Context) {
+	start := time.Now()
+	countRequest(ModePayment)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModePayment, start)
+	defer tr.end()
+
+	var req PurchaseRequest
+	if !bindPurchaseRequest(ctx, c, ModePayment, &req) {
+		return
+	}
+	tagPurchase(c, ModePayment, req)
+
+	if ctx.Err() != nil {
+		failPurchase(ctx, c, ModePayment, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+		return
+	}
+
+	if !checkSaleWindow(ctx, c, ModePayment, req.ProductID) {
+		return
+	}
+
+	// ⚡ STEP 1: Reserve in Redis
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	reservation, err := svc.Reserve(ctx, req.UserID, req.ProductID, req.Quantity)
+	if err != nil {
+		failServiceError(ctx, c, ModePayment, req.ProductID, err)
+		return
+	}
+
+	// 💳 STEP 2: Charge while only the Redis reservation is held, so a slow
+	// provider never keeps a Postgres row locked. A failure hands it back.
+	if err := svc.Charge(ctx, reservation, simulatePayment); err != nil {
+		if errors.Is(err, service.ErrPaymentDeclined) {
+			failPurchase(ctx, c, ModePayment, http.StatusPaymentRequired, CodePaymentFailed, "Payment declined, stock released")
+			return
+		}
+		failPurchase(ctx, c, ModePayment, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+		return
+	}
+
+	// 🛡️ STEP 3: Take the stock and record the paid order in one short
+	// transaction. If it fails the reservation is released; a real provider
+	// would be asked to refund here.
+	dbDone, ok := allowDB(ctx, c, ModePayment)
+	if !ok {
+		reservation.Release()
+		return
+	}
+	res, err := svc.Persist(ctx, reservation, true)
+	dbDone(err)
+	if err != nil {
+		failServiceError(ctx, c, ModePayment, req.ProductID, err)
+		return
+	}
+	remaining, orderID := res.Remaining, res.OrderID
+
+	recordSuccess(ModePayment, remaining, time.Since(start))
+	publishOrder(ModePayment, orderID, req.UserID, req.ProductID, req.Quantity, remaining)
+	publishReservedStock(req.ProductID, remaining, reservation.Stock)
+
+	c.JSON(http.StatusOK, tr.attach(gin.H{
+		"message":    "Purchase successful!",
+		"mode":       ModePayment,
+		"order_id":   orderID,
+		"latency_ms": time.Since(start).Milliseconds(),
+	}))
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPaymentFailRate sets PAYMENT_FAIL_RATE and drops PAYMENT_LATENCY_MS to
+// nothing for the test
+func setPaymentFailRate(t testing.TB, percent int) {
+	oldRate, oldLatency := paymentFailRate, paymentLatency
+	paymentFailRate, paymentLatency = percent, 0
+	t.Cleanup(func() { paymentFailRate, paymentLatency = oldRate, oldLatency })
+}
+
+func TestSimulatePayment(t *testing.T) {
+	setPaymentFailRate(t, 100)
+	if err := simulatePayment(t.Context()); !errors.Is(err, service.ErrPaymentDeclined) {
+		t.Fatalf("PAYMENT_FAIL_RATE=100: err = %v, want a decline", err)
+	}
+
+	setPaymentFailRate(t, 0)
+	for range 100 {
+		if err := simulatePayment(t.Context()); err != nil {
+			t.Fatalf("PAYMENT_FAIL_RATE=0: err = %v", err)
+		}
+	}
+
+	paymentLatency = 1 << 40
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := simulatePayment(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled context: err = %v", err)
+	}
+}
+
+func TestPaymentDeclineRestoresStock(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	setPaymentFailRate(t, 100)
+	productID := testutil.Product(t, "Declined", 10)
+
+	r := gin.New()
+	r.POST("/purchase/payment", Authenticate(), PurchaseWithPayment)
+	for userID := 1; userID <= 5; userID++ {
+		rec := serve(r, http.MethodPost, "/purchase/payment", fmt.Sprintf(`{"product_id": %d, "quantity": 2}`, productID),
+			"Authorization", bearer(t, userID))
+		if rec.Code != http.StatusPaymentRequired || errorOf(t, rec).Code != CodePaymentFailed {
+			t.Fatalf("user %d: status = %d, want 402 %s: %s", userID, rec.Code, CodePaymentFailed, rec.Body)
+		}
+		if got, _ := mr.Get(database.UserPurchaseKey(userID, productID)); got != "0" {
+			t.Fatalf("user %d's purchase counter = %q after a decline, want 0", userID, got)
+		}
+	}
+
+	if got, _ := mr.Get(database.StockKey(productID)); got != "10" {
+		t.Fatalf("Redis stock = %s, want all 10 back", got)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("PostgreSQL quantity = %d, want 10", got)
+	}
+	if n := testutil.Orders(t, productID, OrderStatusPaymentFailed); n != 5 {
+		t.Fatalf("%d payment_failed orders, want 5", n)
+	}
+	if n := testutil.Orders(t, productID, OrderStatusSuccess); n != 0 {
+		t.Fatalf("%d successful orders, want 0", n)
+	}
+}
+
+func TestPaymentSuccess(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	setPaymentFailRate(t, 0)
+	productID := testutil.Product(t, "Paid", 10)
+
+	r := gin.New()
+	r.POST("/purchase/payment", Authenticate(), PurchaseWithPayment)
+	rec := serve(r, http.MethodPost, "/purchase/payment", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "9" {
+		t.Fatalf("Redis stock = %s, want 9", got)
+	}
+	if got := testutil.Quantity(t, productID); got != 9 {
+		t.Fatalf("PostgreSQL quantity = %d, want 9", got)
+	}
+	if n := testutil.Orders(t, productID, OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d successful orders, want 1", n)
+	}
+}
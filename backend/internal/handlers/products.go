@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// productListing is one row of /products: the product plus its drift check
+type productListing struct {
+	ProductDTO
+	DBQuantity int  `json:"db_quantity"`
+	RedisStock *int `json:"redis_stock"` // nil when the key is missing or Redis failed
+	Consistent bool `json:"consistent"`
+}
+
+// ListProducts returns every product with its DB quantity and live Redis
+// stock, flagging products whose two counts disagree so drift shows up at a
+// glance without waiting for the reconciler. Sent with an ETag so pollers get
+// 304 while nothing changed.
+func ListProducts(c *gin.Context) {
+	rows, err := database.DB.Query(c, "SELECT "+productColumns+" FROM products ORDER BY id")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load products")
+		return
+	}
+	defer rows.Close()
+
+	var products []productListing
+	var stockKeys []string
+	for rows.Next() {
+		var p productListing
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Quantity); err != nil {
+			// Better no list than one with zeroed fields passed off as real stock
+			slog.Warn("⚠️ Failed to scan product row", "error", err)
+			respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load products")
+			return
+		}
+		p.DBQuantity = p.Quantity
+		products = append(products, p)
+		stockKeys = append(stockKeys, database.StockKey(p.ID))
+	}
+	if err := rows.Err(); err != nil {
+		slog.Warn("⚠️ Failed to read product rows", "error", err)
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load products")
+		return
+	}
+
+	// Live Redis stock for every product in one round-trip.
+	// A missing key (or a Redis error) is reported as null and inconsistent.
+	if len(stockKeys) > 0 {
+		values, err := database.Rdb.MGet(c, stockKeys...).Result()
+		for i := range products {
+			if err != nil {
+				continue
+			}
+			if s, ok := values[i].(string); ok {
+				if stock, convErr := strconv.Atoi(s); convErr == nil {
+					products[i].RedisStock = &stock
+					products[i].Consistent = stock == products[i].DBQuantity
+				}
+			}
+		}
+	}
+
+	respondJSONWithETag(c, http.StatusOK, products)
+}
+
+// Limits for /products/search
+const (
+	maxSearchQueryLen  = 100
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// likeEscaper makes a search term match literally inside ILIKE '%...%'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchProducts finds products whose name contains ?q= (case-insensitive),
+// alphabetically, at most ?limit= of them
+func SearchProducts(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLen {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid q",
+			fmt.Sprintf("must be between 1 and %d characters", maxSearchQueryLen))
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.Query(c,
+		"SELECT "+productColumns+" FROM products WHERE name ILIKE '%' || $1 || '%' ORDER BY name, id LIMIT $2",
+		likeEscaper.Replace(q), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to search products")
+		return
+	}
+	products, err := pgx.CollectRows(rows, pgx.RowToStructByPos[ProductDTO])
+	if err != nil {
+		slog.Warn("⚠️ Failed to read product search rows", "error", err)
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to search products")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":    q,
+		"count":    len(products),
+		"limit":    limit,
+		"products": products,
+	})
+}
+
+// productDetail is GET /products/:id
+type productDetail struct {
+	ProductDTO
+	RedisStock *int       `json:"redis_stock"` // nil when the key is missing or Redis is unreachable
+	SaleStart  *time.Time `json:"sale_start"`
+	SaleEnd    *time.Time `json:"sale_end"`
+	ServerTime time.Time  `json:"server_time"`
+	MaxPerUser int        `json:"max_per_user"`
+}
+
+// GetProduct returns one product's full detail, with live Redis stock for comparison
+func GetProduct(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var p productDetail
+	var maxPerUser *int
+	err := database.DB.QueryRow(c,
+		"SELECT "+productColumns+", sale_start, sale_end, max_per_user FROM products WHERE id=$1", id).
+		Scan(&p.ID, &p.Name, &p.Price, &p.Quantity, &p.SaleStart, &p.SaleEnd, &maxPerUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load product")
+		return
+	}
+
+	// The cap that applies: the product's own, else MAX_PER_USER (0 = none)
+	p.MaxPerUser = service.MaxPerUser
+	if maxPerUser != nil {
+		p.MaxPerUser = *maxPerUser
+	}
+
+	if stock, err := database.Rdb.Get(c, database.StockKey(id)).Int(); err == nil {
+		p.RedisStock = &stock
+	}
+	p.ServerTime = time.Now().UTC()
+
+	c.JSON(http.StatusOK, p)
+}
+
+// GetProductStock is a cheap stock read for dashboards to poll instead of
+// /stats: Redis first (reloaded if STOCK_KEY_TTL_SEC expired it), PostgreSQL
+// when the key is missing or Redis is down.
+// Cached for a second so a busy dashboard doesn't hit Redis per render.
+func GetProductStock(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	stock, err := database.GetStock(c, id)
+	source := "redis"
+	if err != nil {
+		source = "postgres"
+		err = database.DB.QueryRow(c, "SELECT quantity FROM products WHERE id=$1", id).Scan(&stock)
+		if errors.Is(err, pgx.ErrNoRows) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load stock")
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "public, max-age=1")
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"stock":      stock,
+		"source":     source,
+	})
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productsRouter serves the /products routes like main.go
+func productsRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/products", ListProducts)
+	r.GET("/products/search", SearchProducts)
+	r.GET("/products/:id", GetProduct)
+	r.GET("/products/:id/stock", GetProductStock)
+	return r
+}
+
+func TestGetProductBadID(t *testing.T) {
+	r := productsRouter()
+	for _, id := range []string{"abc", "0", "-3", "1.5", "99999999999999999999"} {
+		rec := serve(r, http.MethodGet, "/products/"+id, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("id %q: status = %d: %s; want 400 %s", id, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+	mr.Set(database.StockKey(productID), "7") // drifted from the DB's 10
+
+	r := productsRouter()
+	rec := serve(r, http.MethodGet, fmt.Sprintf("/products/%d", productID), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var p struct {
+		ID         int         `json:"id"`
+		Name       string      `json:"name"`
+		Price      json.Number `json:"price"`
+		Quantity   int         `json:"quantity"`
+		RedisStock *int        `json:"redis_stock"`
+	}
+	decode(t, rec, &p)
+	if p.ID != productID || p.Name != "Widget" || p.Price != "10.00" || p.Quantity != 10 {
+		t.Fatalf("product = %+v, want Widget at 10.00 with 10 in stock", p)
+	}
+	if p.RedisStock == nil || *p.RedisStock != 7 {
+		t.Fatalf("redis_stock = %v, want 7", p.RedisStock)
+	}
+
+	rec = serve(r, http.MethodGet, fmt.Sprintf("/products/%d", productID+1), "")
+	if rec.Code != http.StatusNotFound || errorOf(t, rec).Code != CodeNotFound {
+		t.Fatalf("unknown product: status = %d: %s; want 404", rec.Code, rec.Body)
+	}
+}
+
+func TestListProductsIncludesPrice(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	testutil.Product(t, "Widget", 10)
+
+	rec := serve(productsRouter(), http.MethodGet, "/products", "")
+	var products []struct {
+		Name  string      `json:"name"`
+		Price json.Number `json:"price"`
+	}
+	decode(t, rec, &products)
+	if len(products) != 1 || products[0].Price != "10.00" {
+		t.Fatalf("products = %+v, want Widget priced 10.00", products)
+	}
+}
+
+func TestListProductsConsistency(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	inSync := testutil.Product(t, "In sync", 10)
+	drifted := testutil.Product(t, "Drifted", 10)
+	unseeded := testutil.Product(t, "Unseeded", 10)
+	mr.Set(database.StockKey(drifted), "8")
+	mr.Del(database.StockKey(unseeded))
+
+	rec := serve(productsRouter(), http.MethodGet, "/products", "")
+	var products []productListing
+	decode(t, rec, &products)
+	if rec.Code != http.StatusOK || len(products) != 3 {
+		t.Fatalf("status = %d: %s; want 200 with 3 products", rec.Code, rec.Body)
+	}
+
+	byID := map[int]productListing{}
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	for id, want := range map[int]struct {
+		redisStock string // "null" when the key is missing
+		consistent bool
+	}{
+		inSync:   {"10", true},
+		drifted:  {"8", false},
+		unseeded: {"null", false},
+	} {
+		p := byID[id]
+		redisStock := "null"
+		if p.RedisStock != nil {
+			redisStock = fmt.Sprint(*p.RedisStock)
+		}
+		if p.DBQuantity != 10 || redisStock != want.redisStock || p.Consistent != want.consistent {
+			t.Errorf("product %d: db_quantity %d, redis_stock %s, consistent %t; want 10, %s, %t",
+				id, p.DBQuantity, redisStock, p.Consistent, want.redisStock, want.consistent)
+		}
+	}
+}
+
+func TestListProductsScanError(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	testutil.Product(t, "Widget", 10)
+
+	// A NULL name can't scan into the DTO's string
+	if _, err := database.DB.Exec(t.Context(), "ALTER TABLE products ALTER COLUMN name DROP NOT NULL"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.DB.Exec(ctx, "DELETE FROM products WHERE name IS NULL")
+		database.DB.Exec(ctx, "ALTER TABLE products ALTER COLUMN name SET NOT NULL")
+	})
+	if _, err := database.DB.Exec(t.Context(),
+		"INSERT INTO products (name, price, quantity) VALUES (NULL, 5, 3)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(productsRouter(), http.MethodGet, "/products", "")
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeDBError {
+		t.Fatalf("status = %d: %s; want 500 %s, not a product with an empty name", rec.Code, rec.Body, CodeDBError)
+	}
+}
+
+// productStockResponse is a GET /products/:id/stock response
+type productStockResponse struct {
+	ProductID int    `json:"product_id"`
+	Stock     int    `json:"stock"`
+	Source    string `json:"source"`
+}
+
+func TestGetProductStockFromRedis(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.Set(database.StockKey(3), "42")
+
+	rec := serve(productsRouter(), http.MethodGet, "/products/3/stock", "")
+	var body productStockResponse
+	decode(t, rec, &body)
+	if rec.Code != http.StatusOK || body != (productStockResponse{3, 42, "redis"}) {
+		t.Fatalf("status = %d: %s; want 42 from redis", rec.Code, rec.Body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=1" {
+		t.Fatalf("Cache-Control = %q, want a one-second cache", cc)
+	}
+}
+
+func TestGetProductStockFallback(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+	mr.Del(database.StockKey(productID))
+
+	r := productsRouter()
+	rec := serve(r, http.MethodGet, fmt.Sprintf("/products/%d/stock", productID), "")
+	var body productStockResponse
+	decode(t, rec, &body)
+	if rec.Code != http.StatusOK || body != (productStockResponse{productID, 10, "postgres"}) {
+		t.Fatalf("status = %d: %s; want 10 from postgres", rec.Code, rec.Body)
+	}
+
+	rec = serve(r, http.MethodGet, fmt.Sprintf("/products/%d/stock", productID+1), "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown product: status = %d, want 404", rec.Code)
+	}
+}
+
+// searchResponse is GET /products/search
+type searchResponse struct {
+	Query    string       `json:"query"`
+	Count    int          `json:"count"`
+	Limit    int          `json:"limit"`
+	Products []ProductDTO `json:"products"`
+}
+
+func TestSearchProductsBadInput(t *testing.T) {
+	r := productsRouter()
+	for _, query := range []string{
+		"",
+		"?q=",
+		"?q=%20%20",
+		"?q=" + strings.Repeat("a", maxSearchQueryLen+1),
+		"?q=widget&limit=0",
+		"?q=widget&limit=" + fmt.Sprint(maxSearchLimit+1),
+	} {
+		rec := serve(r, http.MethodGet, "/products/search"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%q: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	red := testutil.Product(t, "Red Widget", 5)
+	blue := testutil.Product(t, "blue widget", 7)
+	gadget := testutil.Product(t, "Gadget", 3)
+	sale := testutil.Product(t, "50% Off Mug", 2)
+
+	r := productsRouter()
+	search := func(query string) searchResponse {
+		t.Helper()
+		rec := serve(r, http.MethodGet, "/products/search?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d: %s", query, rec.Code, rec.Body)
+		}
+		var body searchResponse
+		decode(t, rec, &body)
+		if body.Count != len(body.Products) {
+			t.Fatalf("%q: count = %d for %d products", query, body.Count, len(body.Products))
+		}
+		return body
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"q=WIDGET", []int{red, blue}},
+		{"q=dget", []int{red, blue, gadget}},
+		{"q=%25", []int{sale}}, // % matches literally, not everything
+		{"q=_", nil},
+		{"q=nothing", nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, p := range search(tt.query).Products {
+			got = append(got, p.ID)
+		}
+		slices.Sort(got)
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: products = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	body := search("q=widget&limit=1")
+	if body.Limit != 1 || len(body.Products) != 1 {
+		t.Fatalf("limit=1: got %d products with limit %d", len(body.Products), body.Limit)
+	}
+	if p := body.Products[0]; p.ID != red && p.ID != blue {
+		t.Fatalf("limit=1: product %+v is not a widget", p)
+	}
+}
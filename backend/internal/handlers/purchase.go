@@ -2,280 +2,560 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"sync/atomic"
+	"strconv"
 	"time"
 
+	"flash-sale-backend/internal/config"
 	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// PurchaseRequest is the body of every single-product purchase. Quantity is
+// optional and defaults to 1. UserID comes from the Bearer token.
 type PurchaseRequest struct {
-	UserID    int `json:"user_id"`
-	ProductID int `json:"product_id"`
+	UserID    int `json:"-"`
+	ProductID int `json:"product_id" binding:"required,min=1"`
+	Quantity  int `json:"quantity" binding:"omitempty,min=1,max=100"`
 }
 
-// Stats tracking for dashboard
-var (
-	TotalRequests  int64
-	SuccessCount   int64
-	FailCount      int64
-	OversellCount  int64
-	TotalLatencyMs int64
+// bindPurchaseRequest binds and validates a PurchaseRequest, responding with
+// the failing fields on error
+func bindPurchaseRequest(ctx context.Context, c *gin.Context, mode string, req *PurchaseRequest) bool {
+	if err := bindPurchase(c, req, &req.UserID); err != nil {
+		failPurchaseDetail(ctx, c, mode, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return false
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	return true
+}
+
+// stockConstraint is the CHECK added by ENFORCE_STOCK_CONSTRAINT
+const (
+	stockConstraint = "products_quantity_check"
+	checkViolation  = "23514" // Postgres SQLSTATE check_violation
 )
 
-func ResetStats() {
-	atomic.StoreInt64(&TotalRequests, 0)
-	atomic.StoreInt64(&SuccessCount, 0)
-	atomic.StoreInt64(&FailCount, 0)
-	atomic.StoreInt64(&OversellCount, 0)
-	atomic.StoreInt64(&TotalLatencyMs, 0)
+// isStockConstraintViolation reports whether err is Postgres refusing to let
+// a product's quantity go below zero
+func isStockConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == checkViolation && pgErr.ConstraintName == stockConstraint
 }
 
-func GetStats() map[string]interface{} {
-	total := atomic.LoadInt64(&TotalRequests)
-	success := atomic.LoadInt64(&SuccessCount)
-	fail := atomic.LoadInt64(&FailCount)
-	oversell := atomic.LoadInt64(&OversellCount)
-	latency := atomic.LoadInt64(&TotalLatencyMs)
-
-	avgLatency := float64(0)
-	if total > 0 {
-		avgLatency = float64(latency) / float64(total)
+// failStockUpdate responds to a failed stock decrement, telling an oversell
+// caught by the CHECK constraint apart from other DB errors
+func failStockUpdate(ctx context.Context, c *gin.Context, mode string, err error) {
+	if database.IsStatementTimeout(err) {
+		failDBTimeout(ctx, c, mode)
+		return
 	}
-
-	return map[string]interface{}{
-		"total_requests": total,
-		"success":        success,
-		"failed":         fail,
-		"oversells":      oversell,
-		"avg_latency_ms": avgLatency,
+	if isStockConstraintViolation(err) {
+		failPurchaseDetail(ctx, c, mode, http.StatusConflict, CodeConstraintViolation,
+			"Oversell blocked by the database", stockConstraint+" rejected a negative quantity")
+		return
 	}
+	failPurchase(ctx, c, mode, http.StatusInternalServerError, CodeDBError, "Failed to update stock")
 }
 
 // ============================================
 // MODE 1: NAIVE (No Protection - Shows Race Condition)
 // ============================================
+
+// maxNaiveDelay caps the artificial race window so a typo can't hang requests
+const maxNaiveDelay = 1000 * time.Millisecond
+
+// naiveDelay is the default race window, tunable with NAIVE_DELAY_MS
+var naiveDelay = clampNaiveDelay(time.Duration(config.Int("NAIVE_DELAY_MS", 5)) * time.Millisecond)
+
+func clampNaiveDelay(d time.Duration) time.Duration {
+	return min(max(d, 0), maxNaiveDelay)
+}
+
+// naiveDelayFor returns the ?delay_ms= override for live demos, or the default
+func naiveDelayFor(c *gin.Context) (time.Duration, bool) {
+	if c.Query("delay_ms") == "" {
+		return naiveDelay, true
+	}
+	ms, err := strconv.Atoi(c.Query("delay_ms"))
+	if err != nil {
+		return 0, false
+	}
+	return clampNaiveDelay(time.Duration(ms) * time.Millisecond), true
+}
+
 func PurchaseNaive(c *gin.Context) {
 	start := time.Now()
-	atomic.AddInt64(&TotalRequests, 1)
+	countRequest(ModeNaive)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModeNaive, start)
+	defer tr.end()
 
 	var req PurchaseRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !bindPurchaseRequest(ctx, c, ModeNaive, &req) {
 		return
 	}
+	tagPurchase(c, ModeNaive, req)
 
-	// DANGER: No locking! Just read and write - WILL cause overselling
-	var quantity int
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT quantity FROM products WHERE id=$1", req.ProductID).Scan(&quantity)
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+	delay, ok := naiveDelayFor(c)
+	if !ok {
+		failPurchase(ctx, c, ModeNaive, http.StatusBadRequest, CodeInvalidInput, "delay_ms must be an integer")
 		return
 	}
 
-	if quantity <= 0 {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Out of stock!"})
+	if ctx.Err() != nil {
+		// Client already gone or deadline passed: don't touch the DB at all
+		failPurchase(ctx, c, ModeNaive, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
 		return
 	}
 
-	// 🚨 INTENTIONAL DELAY: Widen the race condition window for demo purposes
-	// In real apps, this delay exists due to network latency, processing, etc.
-	time.Sleep(5 * time.Millisecond)
-
-	// DANGER: Race condition window - another request could read same quantity!
-	_, err = database.DB.Exec(context.Background(),
-		"UPDATE products SET quantity = quantity - 1 WHERE id=$1", req.ProductID)
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update failed"})
+	if !checkSaleWindow(ctx, c, ModeNaive, req.ProductID) {
 		return
 	}
 
-	_, err = database.DB.Exec(context.Background(),
-		"INSERT INTO orders (user_id, product_id, status) VALUES ($1, $2, 'success')",
-		req.UserID, req.ProductID)
+	// Naive holds its connection across the read→sleep window, so it is the
+	// mode that saturates the pool first
+	dbDone, ok := allowDB(ctx, c, ModeNaive)
+	if !ok {
+		return
+	}
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	res, err := svc.Naive(ctx, req.UserID, req.ProductID, req.Quantity, delay)
+	dbDone(err)
 	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order failed"})
+		failServiceError(ctx, c, ModeNaive, req.ProductID, err)
 		return
 	}
+	remaining, orderID := res.Remaining, res.OrderID
 
-	atomic.AddInt64(&SuccessCount, 1)
-	atomic.AddInt64(&TotalLatencyMs, time.Since(start).Milliseconds())
+	recordSuccess(ModeNaive, remaining, time.Since(start))
+	publishOrder(ModeNaive, orderID, req.UserID, req.ProductID, req.Quantity, remaining)
+	publishStock(req.ProductID, remaining, "purchase")
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, tr.attach(gin.H{
 		"message":    "Purchase successful!",
-		"mode":       "naive",
+		"mode":       ModeNaive,
+		"order_id":   orderID,
 		"latency_ms": time.Since(start).Milliseconds(),
-	})
+	}))
 }
 
 // ============================================
 // MODE 2: PostgreSQL Pessimistic Locking (Safe but Slower)
 // ============================================
 func PurchasePostgresLock(c *gin.Context) {
+	purchaseRowLockMode(c, ModePostgresLock)
+}
+
+// PurchasePostgresLockNoWait is Mode 2 with FOR UPDATE NOWAIT: a buyer who
+// finds the row locked is turned away at once with LOCK_CONTENDED instead of
+// queueing behind the holder. Lower, flatter latency; no fairness.
+func PurchasePostgresLockNoWait(c *gin.Context) {
+	purchaseRowLockMode(c, ModePostgresNoWait)
+}
+
+// purchaseRowLockMode is the whole request for Mode 2 and its NOWAIT variant
+func purchaseRowLockMode(c *gin.Context, mode string) {
 	start := time.Now()
-	atomic.AddInt64(&TotalRequests, 1)
+	countRequest(mode)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, mode, start)
+	defer tr.end()
 
 	var req PurchaseRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !bindPurchaseRequest(ctx, c, mode, &req) {
 		return
 	}
+	tagPurchase(c, mode, req)
 
-	tx, err := database.DB.Begin(context.Background())
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+	if ctx.Err() != nil {
+		// Client already gone or deadline passed: don't touch the DB at all
+		failPurchase(ctx, c, mode, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
 		return
 	}
-	defer tx.Rollback(context.Background())
 
-	// SAFE: SELECT FOR UPDATE locks the row!
-	var quantity int
-	err = tx.QueryRow(context.Background(),
-		"SELECT quantity FROM products WHERE id=$1 FOR UPDATE", req.ProductID).Scan(&quantity)
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lock failed"})
+	if !checkSaleWindow(ctx, c, mode, req.ProductID) {
 		return
 	}
 
-	if quantity <= 0 {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Out of stock!"})
+	remaining, orderID, ok := purchaseWithRowLock(ctx, c, mode, req, tr)
+	if !ok {
 		return
 	}
 
-	_, err = tx.Exec(context.Background(),
-		"UPDATE products SET quantity = quantity - 1 WHERE id=$1", req.ProductID)
+	recordSuccess(mode, remaining, time.Since(start))
+	publishOrder(mode, orderID, req.UserID, req.ProductID, req.Quantity, remaining)
+	publishStock(req.ProductID, remaining, "purchase")
+
+	c.JSON(http.StatusOK, tr.attach(gin.H{
+		"message":    "Purchase successful!",
+		"mode":       mode,
+		"order_id":   orderID,
+		"latency_ms": time.Since(start).Milliseconds(),
+	}))
+}
+
+// purchaseWithRowLock buys req.Quantity units under SELECT ... FOR UPDATE in
+// its own transaction, responding on failure. Used by Mode 2 (FOR UPDATE
+// NOWAIT for ModePostgresNoWait) and by Mode 3's REDIS_FALLBACK path.
+func purchaseWithRowLock(ctx context.Context, c *gin.Context, mode string, req PurchaseRequest, tr *purchaseTrace) (remaining, orderID int, ok bool) {
+	dbDone, ok := allowDB(ctx, c, mode)
+	if !ok {
+		return 0, 0, false
+	}
+
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	lock := svc.PostgresLock
+	if mode == ModePostgresNoWait {
+		lock = svc.PostgresNoWait
+	}
+	res, err := lock(ctx, req.UserID, req.ProductID, req.Quantity)
+	dbDone(err)
 	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update failed"})
+		failServiceError(ctx, c, mode, req.ProductID, err)
+		return 0, 0, false
+	}
+	return res.Remaining, res.OrderID, true
+}
+
+// ============================================
+// SERIALIZABLE: Optimistic MVCC (Safe, Retries Instead of Waiting)
+// ============================================
+
+// PurchaseSerializable reads and decrements the stock in a SERIALIZABLE
+// transaction with no row lock. Postgres aborts a buyer whose snapshot went
+// stale (40001); it is retried up to SERIALIZABLE_MAX_RETRIES times, each
+// retry counted as serialization_retries in /stats.
+func PurchaseSerializable(c *gin.Context) {
+	start := time.Now()
+	countRequest(ModeSerializable)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModeSerializable, start)
+	defer tr.end()
+
+	var req PurchaseRequest
+	if !bindPurchaseRequest(ctx, c, ModeSerializable, &req) {
 		return
 	}
+	tagPurchase(c, ModeSerializable, req)
 
-	_, err = tx.Exec(context.Background(),
-		"INSERT INTO orders (user_id, product_id, status) VALUES ($1, $2, 'success')",
-		req.UserID, req.ProductID)
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order failed"})
+	if ctx.Err() != nil {
+		failPurchase(ctx, c, ModeSerializable, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
 		return
 	}
 
-	err = tx.Commit(context.Background())
+	if !checkSaleWindow(ctx, c, ModeSerializable, req.ProductID) {
+		return
+	}
+
+	dbDone, ok := allowDB(ctx, c, ModeSerializable)
+	if !ok {
+		return
+	}
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	res, err := svc.Serializable(ctx, req.UserID, req.ProductID, req.Quantity)
+	dbDone(err)
+	countSerializationRetries(res.Retries)
 	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Commit failed"})
+		failServiceError(ctx, c, ModeSerializable, req.ProductID, err)
 		return
 	}
 
-	atomic.AddInt64(&SuccessCount, 1)
-	atomic.AddInt64(&TotalLatencyMs, time.Since(start).Milliseconds())
+	recordSuccess(ModeSerializable, res.Remaining, time.Since(start))
+	publishOrder(ModeSerializable, res.OrderID, req.UserID, req.ProductID, req.Quantity, res.Remaining)
+	publishStock(req.ProductID, res.Remaining, "purchase")
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, tr.attach(gin.H{
 		"message":    "Purchase successful!",
-		"mode":       "postgres_lock",
+		"mode":       ModeSerializable,
+		"order_id":   res.OrderID,
+		"retries":    res.Retries,
 		"latency_ms": time.Since(start).Milliseconds(),
-	})
+	}))
 }
 
 // ============================================
 // MODE 3: Redis + PostgreSQL (FASTEST - Production Ready)
 // ============================================
+
+// redisFallback lets Mode 3 fall back to Mode 2's row lock when Redis errors
+var redisFallback = config.Bool("REDIS_FALLBACK", false)
+
+// dryRun makes Mode 3 stop after the Redis reservation (also ?persist=false)
+var dryRun = config.Bool("DRY_RUN", false)
+
+// failNotSeeded responds for a missing stock key that could not be auto-seeded
+func failNotSeeded(ctx context.Context, c *gin.Context, mode string, productID int, err error) {
+	if errors.Is(err, service.ErrProductNotFound) {
+		failPurchaseDetail(ctx, c, mode, http.StatusNotFound, CodeProductNotFound, "Product not found",
+			fmt.Sprintf("product_id %d", productID))
+		return
+	}
+	failPurchaseDetail(ctx, c, mode, http.StatusInternalServerError, CodeRedisNotSeeded,
+		"Stock is not loaded into Redis", fmt.Sprintf("product_id %d; run POST /sync-redis", productID))
+}
+
+// isRedisFailure reports whether a Reserve error is Redis failing, as
+// opposed to the purchase being refused or the stock key missing
+func isRedisFailure(err error) bool {
+	return !service.Refused(err) && !errors.Is(err, service.ErrNotSeeded)
+}
+
+// stepFailures is how each failed Postgres step of a purchase is reported
+// (update_stock goes through failStockUpdate)
+var stepFailures = map[string]struct{ code, msg string }{
+	service.StepReadStock:      {CodeDBError, "Failed to read stock"},
+	service.StepBegin:          {CodeTransactionFail, "Failed to start transaction"},
+	service.StepSetLockTimeout: {CodeDBError, "Failed to set lock timeout"},
+	service.StepLock:           {CodeDBError, "Failed to lock product row"},
+	service.StepInsertOrder:    {CodeDBError, "Failed to create order"},
+	service.StepCommit:         {CodeTransactionFail, "Failed to commit transaction"},
+}
+
+// failDBTimeout responds to a statement Postgres cancelled after
+// DB_STATEMENT_TIMEOUT_MS
+func failDBTimeout(ctx context.Context, c *gin.Context, mode string) {
+	failPurchaseDetail(ctx, c, mode, http.StatusGatewayTimeout, CodeDBTimeout,
+		"Database query timed out", fmt.Sprintf("statement_timeout %s", database.StatementTimeout))
+}
+
+// failServiceError responds to a failed service.PurchaseService call. Errors
+// that are neither refusals nor Postgres steps come from Redis.
+func failServiceError(ctx context.Context, c *gin.Context, mode string, productID int, err error) {
+	var stepErr *service.StepError
+	var limitErr *service.UserLimitError
+	switch {
+	case errors.Is(err, service.ErrSoldOut):
+		failPurchase(ctx, c, mode, http.StatusBadRequest, CodeOutOfStock, "Out of stock!")
+	case errors.As(err, &limitErr):
+		failPurchase(ctx, c, mode, http.StatusTooManyRequests, CodeUserLimitExceeded,
+			fmt.Sprintf("Purchase limit of %d per user reached", limitErr.Limit))
+	case errors.Is(err, service.ErrProductNotFound), errors.Is(err, service.ErrNotSeeded):
+		failNotSeeded(ctx, c, mode, productID, err)
+	case errors.Is(err, service.ErrLockContended):
+		countLockContended()
+		failPurchase(ctx, c, mode, http.StatusConflict, CodeLockContended, "Product is busy, try again")
+	case errors.Is(err, service.ErrSerializationConflict):
+		failPurchaseDetail(ctx, c, mode, http.StatusConflict, CodeSerializationFailure,
+			"Product is busy, try again", fmt.Sprintf("serialization failed %d times in a row", service.SerializableRetries+1))
+	case errors.Is(err, service.ErrLockTimeout):
+		failPurchaseDetail(ctx, c, mode, http.StatusServiceUnavailable, CodeLockTimeout,
+			"Product is busy, try again", fmt.Sprintf("row lock not granted within %s", service.LockTimeout))
+	case database.IsStatementTimeout(err):
+		failDBTimeout(ctx, c, mode)
+	case errors.As(err, &stepErr) && stepErr.Step == service.StepUpdateStock:
+		failStockUpdate(ctx, c, mode, stepErr.Err)
+	case errors.As(err, &stepErr):
+		f := stepFailures[stepErr.Step]
+		failPurchase(ctx, c, mode, http.StatusInternalServerError, f.code, f.msg)
+	default:
+		failPurchase(ctx, c, mode, http.StatusInternalServerError, CodeRedisError, "Failed to reserve stock in Redis")
+	}
+}
+
+// serviceTrace feeds the service's step timings into a purchaseTrace
+type serviceTrace struct {
+	tr           *purchaseTrace
+	txStart      time.Time
+	insertBefore time.Duration
+}
+
+func (s *serviceTrace) Redis(from time.Time)       { s.tr.add(&s.tr.redis, from) }
+func (s *serviceTrace) Query(from time.Time)       { s.tr.add(&s.tr.dbTx, from) }
+func (s *serviceTrace) InsertOrder(from time.Time) { s.tr.add(&s.tr.orderInsert, from) }
+func (s *serviceTrace) Wait(from time.Time)        { s.tr.add(&s.tr.sleep, from) }
+func (s *serviceTrace) Payment(from time.Time)     { s.tr.add(&s.tr.payment, from) }
+
+func (s *serviceTrace) BeginTx(from time.Time) {
+	s.txStart, s.insertBefore = from, s.tr.orderInsert
+	s.tr.beginTx(from)
+}
+
+func (s *serviceTrace) EndTx() {
+	s.tr.dbTx += time.Since(s.txStart) - (s.tr.orderInsert - s.insertBefore)
+	s.tr.endTx()
+}
+
 func PurchaseRedisPostgres(c *gin.Context) {
 	start := time.Now()
-	atomic.AddInt64(&TotalRequests, 1)
+	countRequest(ModeRedisPostgres)
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	tr := newPurchaseTrace(c, ModeRedisPostgres, start)
+	defer tr.end()
 
 	var req PurchaseRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !bindPurchaseRequest(ctx, c, ModeRedisPostgres, &req) {
 		return
 	}
+	tagPurchase(c, ModeRedisPostgres, req)
 
-	// ⚡ STEP 1: Redis Gatekeeper (Microseconds!)
-	// Use Lua script to atomically check and decrement - prevents negative stock
-	luaScript := `
-		local stock = redis.call('GET', KEYS[1])
-		if stock == false then
-			return -1
-		end
-		stock = tonumber(stock)
-		if stock <= 0 then
-			return -1
-		end
-		return redis.call('DECR', KEYS[1])
-	`
-	stock, err := database.Rdb.Eval(context.Background(), luaScript, []string{"product:1:stock"}).Int64()
-	if err != nil {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error"})
+	if ctx.Err() != nil {
+		// Client already gone or deadline passed: don't touch the DB at all
+		failPurchase(ctx, c, ModeRedisPostgres, http.StatusGatewayTimeout, CodeTimeout, "Request timed out")
 		return
 	}
 
-	if stock < 0 {
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Out of stock!"})
+	if !checkSaleWindow(ctx, c, ModeRedisPostgres, req.ProductID) {
 		return
 	}
 
-	// 🛡️ STEP 2: Persist to PostgreSQL
-	tx, err := database.DB.Begin(context.Background())
+	// ⚡ STEP 1: Redis Gatekeeper (Microseconds!)
+	// One Lua script checks stock AND the user's limit, then reserves both,
+	// so nothing can slip in between the checks and the decrement.
+	svc := service.PurchaseService{Observer: &serviceTrace{tr: tr}}
+	reservation, err := svc.Reserve(ctx, req.UserID, req.ProductID, req.Quantity)
+	if err != nil && redisFallback && isRedisFailure(err) && ctx.Err() == nil {
+		// Redis is down but Postgres can still sell safely under a row lock.
+		// Nothing was reserved in Redis we know of, so there's nothing to
+		// release; the reconciler fixes the key once Redis is back.
+		slog.Warn("⚠️ Redis unavailable, falling back to row lock", "product_id", req.ProductID, "error", err)
+		countFallback()
+		remaining, orderID, ok := purchaseWithRowLock(ctx, c, ModeRedisPostgres, req, tr)
+		if !ok {
+			return
+		}
+		recordSuccess(ModeRedisPostgres, remaining, time.Since(start))
+		publishOrder(ModeRedisPostgres, orderID, req.UserID, req.ProductID, req.Quantity, remaining)
+		publishStock(req.ProductID, remaining, "purchase")
+
+		c.JSON(http.StatusOK, tr.attach(gin.H{
+			"message":    "Purchase successful!",
+			"mode":       ModeRedisPostgres,
+			"fallback":   true,
+			"order_id":   orderID,
+			"latency_ms": time.Since(start).Milliseconds(),
+		}))
+		return
+	}
 	if err != nil {
-		database.Rdb.Incr(context.Background(), "product:1:stock") // Compensate
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+		failServiceError(ctx, c, ModeRedisPostgres, req.ProductID, err)
 		return
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(),
-		"UPDATE products SET quantity = quantity - 1 WHERE id=$1", req.ProductID)
-	if err != nil {
-		database.Rdb.Incr(context.Background(), "product:1:stock")
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update failed"})
+	// 🧪 Dry run: measure the Redis gatekeeper alone. The reservation stays
+	// in Redis only, so run POST /sync-redis (or /reset) afterwards.
+	if dryRun || c.Query("persist") == "false" {
+		recordSuccess(ModeRedisPostgres, int(reservation.Stock), time.Since(start))
+		c.JSON(http.StatusOK, tr.attach(gin.H{
+			"message":     "Reserved in Redis (dry run, not persisted)",
+			"mode":        ModeRedisPostgres,
+			"persisted":   false,
+			"redis_stock": reservation.Stock,
+			"latency_ms":  time.Since(start).Milliseconds(),
+		}))
 		return
 	}
 
-	_, err = tx.Exec(context.Background(),
-		"INSERT INTO orders (user_id, product_id, status) VALUES ($1, $2, 'success')",
-		req.UserID, req.ProductID)
-	if err != nil {
-		database.Rdb.Incr(context.Background(), "product:1:stock")
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order failed"})
+	// 🛡️ STEP 2: Persist to PostgreSQL, once a MAX_CONCURRENT_PURCHASES slot
+	// is free and unless the breaker says it's down. With ORDER_BATCH the row
+	// is written after commit by the batch writer.
+	releaseSlot, ok := acquirePurchaseSlot(ctx, c, ModeRedisPostgres)
+	if !ok {
+		reservation.Release()
 		return
 	}
+	defer releaseSlot()
 
-	err = tx.Commit(context.Background())
+	dbDone, ok := allowDB(ctx, c, ModeRedisPostgres)
+	if !ok {
+		reservation.Release()
+		return
+	}
+	res, err := svc.Persist(ctx, reservation, !orderBatching)
+	dbDone(err)
 	if err != nil {
-		database.Rdb.Incr(context.Background(), "product:1:stock")
-		atomic.AddInt64(&FailCount, 1)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Commit failed"})
+		failServiceError(ctx, c, ModeRedisPostgres, req.ProductID, err)
 		return
 	}
+	remaining, orderID := res.Remaining, res.OrderID
+
+	if orderBatching {
+		queueOrder(pendingOrder{
+			UserID:    req.UserID,
+			ProductID: req.ProductID,
+			Quantity:  req.Quantity,
+			Status:    OrderStatusSuccess,
+			CreatedAt: time.Now(),
+		})
+	}
 
-	atomic.AddInt64(&SuccessCount, 1)
-	atomic.AddInt64(&TotalLatencyMs, time.Since(start).Milliseconds())
+	recordSuccess(ModeRedisPostgres, remaining, time.Since(start))
+	publishOrder(ModeRedisPostgres, orderID, req.UserID, req.ProductID, req.Quantity, remaining)
+	publishReservedStock(req.ProductID, remaining, reservation.Stock)
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"message":    "Purchase successful!",
-		"mode":       "redis_postgres",
+		"mode":       ModeRedisPostgres,
+		"order_id":   orderID,
 		"latency_ms": time.Since(start).Milliseconds(),
-	})
+	}
+	if orderBatching {
+		resp["order_id"] = nil // assigned when the batch is written
+		resp["order_queued"] = true
+	}
+	c.JSON(http.StatusOK, tr.attach(resp))
+}
+
+// RecordPurchase books a service.Purchase made outside Gin (the gRPC server)
+// into /stats and the live order and stock feeds, under Mode 3
+func RecordPurchase(userID, productID, quantity int, res service.Result, err error, d time.Duration) {
+	countRequest(ModeRedisPostgres)
+	if err != nil {
+		countFailure(ModeRedisPostgres)
+		return
+	}
+	recordSuccess(ModeRedisPostgres, res.Remaining, d)
+	publishOrder(ModeRedisPostgres, res.OrderID, userID, productID, quantity, res.Remaining)
+	publishReservedStock(productID, res.Remaining, res.Reserved)
 }
 
-// Keep the original for backwards compatibility
+// purchaseModeRoute is one choice of POST /purchase?mode=
+type purchaseModeRoute struct {
+	mode    string // what /stats counts it under
+	handler gin.HandlerFunc
+}
+
+// purchaseQueryModes maps ?mode= to the handler behind the matching
+// /purchase/<mode> route; the cart takes a different body, so it isn't here
+var purchaseQueryModes = map[string]purchaseModeRoute{
+	"naive":           {ModeNaive, PurchaseNaive},
+	"postgres":        {ModePostgresLock, PurchasePostgresLock},
+	"postgres-nowait": {ModePostgresNoWait, PurchasePostgresLockNoWait},
+	"redis":           {ModeRedisPostgres, PurchaseRedisPostgres},
+	"payment":         {ModePayment, PurchaseWithPayment},
+	"fair":            {ModeFair, PurchaseFair},
+	"serializable":    {ModeSerializable, PurchaseSerializable},
+}
+
+// PurchaseProduct is POST /purchase: Redis + PostgreSQL by default, or the
+// mode named by ?mode= so comparison tooling can sweep modes on one URL
 func PurchaseProduct(c *gin.Context) {
-	PurchaseRedisPostgres(c)
+	name := c.DefaultQuery("mode", "redis")
+	route, ok := purchaseQueryModes[name]
+	if !ok {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Unknown purchase mode",
+			fmt.Sprintf("mode %q; use naive, postgres, postgres-nowait, redis, payment, fair or serializable", name))
+		return
+	}
+	route.handler(c)
 }
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// resetStats clears the global counters now and when the test ends
+func resetStats(t *testing.T) {
+	ResetStats()
+	t.Cleanup(ResetStats)
+}
+
+func TestRecordSuccessCountsOversells(t *testing.T) {
+	resetStats(t)
+	recordSuccess(ModeNaive, 0, time.Millisecond)
+	recordSuccess(ModeNaive, -1, time.Millisecond)
+	recordSuccess(ModeNaive, -2, time.Millisecond)
+	recordSuccess(ModePostgresLock, 3, time.Millisecond)
+
+	if got := readModeCounters(ModeNaive); got.Success != 3 || got.Oversells != 2 {
+		t.Fatalf("naive = %+v, want 3 successes, 2 oversells", got)
+	}
+	if got := readModeCounters(ModePostgresLock).Oversells; got != 0 {
+		t.Fatalf("postgres_lock oversells = %d, want 0", got)
+	}
+	if got := GetStats()["oversells"]; got != int64(2) {
+		t.Fatalf("total oversells = %v, want 2", got)
+	}
+}
+
+func TestNaiveOversellsAreCounted(t *testing.T) {
+	testutil.Postgres(t)
+	resetStats(t)
+	old := naiveDelay
+	naiveDelay = 50 * time.Millisecond // every buyer reads the stock before anyone writes
+	t.Cleanup(func() { naiveDelay = old })
+
+	const stock, buyers = 5, 40
+	res := runSale(t, saleMode{ModeNaive, PurchaseNaive, false}, stock, buyers)
+	if res.remaining >= 0 {
+		t.Fatalf("%d sales of %d left %d; the race didn't oversell", res.successes, stock, res.remaining)
+	}
+	// Each sale past zero saw a negative RETURNING quantity
+	if got := readModeCounters(ModeNaive).Oversells; got != int64(-res.remaining) {
+		t.Fatalf("oversells = %d, want %d (quantity ended at %d)", got, -res.remaining, res.remaining)
+	}
+}
+
+func TestPurchaseCancelledContext(t *testing.T) {
+	// Any DB or Redis call would panic on the nil clients
+	oldDB, oldRdb := database.DB, database.Rdb
+	database.DB, database.Rdb = nil, nil
+	t.Cleanup(func() { database.DB, database.Rdb = oldDB, oldRdb })
+	resetStats(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, m := range []saleMode{
+		{ModeNaive, PurchaseNaive, false},
+		{ModePostgresLock, PurchasePostgresLock, true},
+		{ModePostgresNoWait, PurchasePostgresLockNoWait, true},
+		{ModeSerializable, PurchaseSerializable, true},
+		{ModeRedisPostgres, PurchaseRedisPostgres, true},
+		{ModePayment, PurchaseWithPayment, true},
+		{ModeFair, PurchaseFair, true},
+	} {
+		r := gin.New()
+		r.POST("/purchase", Authenticate(), m.handler)
+		req := httptest.NewRequest(http.MethodPost, "/purchase", strings.NewReader(`{"product_id": 1}`)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", bearer(t, 1))
+		rec := httptest.NewRecorder()
+
+		start := time.Now()
+		r.ServeHTTP(rec, req)
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%s: took %s with a cancelled context", m.name, elapsed)
+		}
+		if rec.Code != http.StatusGatewayTimeout || errorOf(t, rec).Code != CodeTimeout {
+			t.Errorf("%s: status = %d, body %s; want 504 %s", m.name, rec.Code, rec.Body, CodeTimeout)
+		}
+		if got := readModeCounters(m.name).Failed; got != 1 {
+			t.Errorf("%s: %d failures counted, want 1", m.name, got)
+		}
+	}
+}
+
+func TestPurchaseUserLimit(t *testing.T) {
+	if service.MaxPerUser <= 0 {
+		t.Skip("MAX_PER_USER=0 turns the limit off")
+	}
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Limited", 10)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	buy := func(userID int) *httptest.ResponseRecorder {
+		return serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, userID))
+	}
+
+	for i := range service.MaxPerUser {
+		if rec := buy(1); rec.Code != http.StatusOK {
+			t.Fatalf("purchase %d of %d: status = %d: %s", i+1, service.MaxPerUser, rec.Code, rec.Body)
+		}
+	}
+	rec := buy(1)
+	if rec.Code != http.StatusTooManyRequests || errorOf(t, rec).Code != CodeUserLimitExceeded {
+		t.Fatalf("over the limit: status = %d, body %s; want 429 %s", rec.Code, rec.Body, CodeUserLimitExceeded)
+	}
+	if rec := buy(2); rec.Code != http.StatusOK {
+		t.Fatalf("another user: status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := testutil.Quantity(t, productID); got != 10-service.MaxPerUser-1 {
+		t.Fatalf("quantity = %d, want %d", got, 10-service.MaxPerUser-1)
+	}
+}
+
+func TestNaiveDelayFor(t *testing.T) {
+	tests := []struct {
+		query string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", naiveDelay, true},
+		{"delay_ms=0", 0, true},
+		{"delay_ms=250", 250 * time.Millisecond, true},
+		{"delay_ms=999999", maxNaiveDelay, true},
+		{"delay_ms=-5", 0, true},
+		{"delay_ms=fast", 0, false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/purchase/naive?"+tt.query, nil)
+		got, ok := naiveDelayFor(c)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: %s, %t; want %s, %t", tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPurchaseNaiveDelay(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Slow", 10)
+
+	r := gin.New()
+	r.POST("/purchase/naive", Authenticate(), PurchaseNaive)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	start := time.Now()
+	rec := serve(r, http.MethodPost, "/purchase/naive?delay_ms=150", body, "Authorization", bearer(t, 1))
+	if elapsed := time.Since(start); rec.Code != http.StatusOK || elapsed < 150*time.Millisecond {
+		t.Fatalf("status %d after %s, want 200 after at least 150ms: %s", rec.Code, elapsed, rec.Body)
+	}
+
+	rec = serve(r, http.MethodPost, "/purchase/naive?delay_ms=soon", body, "Authorization", bearer(t, 2))
+	if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+		t.Fatalf("bad delay_ms: status = %d: %s; want 400", rec.Code, rec.Body)
+	}
+}
+
+func TestPurchaseNotSeeded(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Unseeded", 10)
+	mr.Del(database.StockKey(productID)) // e.g. Redis restarted and nobody ran /sync-redis
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeRedisNotSeeded {
+		t.Fatalf("status = %d: %s; want 500 %s, not out of stock", rec.Code, rec.Body, CodeRedisNotSeeded)
+	}
+	if mr.Exists(database.StockKey(productID)) {
+		t.Fatal("the stock key was seeded without REDIS_AUTO_SEED")
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10 untouched", got)
+	}
+}
+
+func TestPurchaseUnknownProduct(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10) + 1
+	service.ForgetProductRules(productID)     // ids restart per test; drop rules cached under this one
+	mr.Set(database.StockKey(productID), "5") // left over from a deleted product
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusNotFound || errorOf(t, rec).Code != CodeProductNotFound {
+		t.Fatalf("status = %d: %s; want 404 %s", rec.Code, rec.Body, CodeProductNotFound)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "5" {
+		t.Fatalf("stale stock key = %s, want 5 untouched", got)
+	}
+	if mr.Exists(database.UserPurchaseKey(1, productID)) {
+		t.Fatal("a user counter was written for a product that doesn't exist")
+	}
+}
+
+func TestPurchaseRedisFallback(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	prev := redisFallback
+	t.Cleanup(func() { redisFallback = prev })
+
+	redisFallback = false
+	if rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, 1)); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("without REDIS_FALLBACK: status = %d: %s; want 500", rec.Code, rec.Body)
+	}
+
+	// The stock change still reaches the low-stock watcher (this test has
+	// none running, so the check waits in its queue)
+	withLowStockWebhook(t, 0)
+	for len(lowStockChecks) > 0 {
+		<-lowStockChecks
+	}
+
+	redisFallback = true
+	rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, 2))
+	var res struct {
+		Fallback bool `json:"fallback"`
+	}
+	decode(t, rec, &res)
+	if rec.Code != http.StatusOK || !res.Fallback {
+		t.Fatalf("with REDIS_FALLBACK: status = %d: %s; want 200 via the row lock", rec.Code, rec.Body)
+	}
+	if FallbackCount != 1 {
+		t.Fatalf("fallback_count = %d, want 1", FallbackCount)
+	}
+	// Sold once, from Postgres only
+	if got := testutil.Quantity(t, productID); got != 9 {
+		t.Fatalf("quantity = %d, want 9", got)
+	}
+	select {
+	case check := <-lowStockChecks:
+		if check != (lowStockCheck{productID, 9}) {
+			t.Fatalf("stock change = %+v, want product %d at 9", check, productID)
+		}
+	default:
+		t.Fatal("the fallback purchase published no stock change")
+	}
+	mr.SetError("")
+	if got, _ := mr.Get(database.StockKey(productID)); got != "10" {
+		t.Fatalf("Redis stock = %s, want 10 left for the reconciler", got)
+	}
+}
+
+func TestNaiveHitsStockConstraint(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	t.Setenv("ENFORCE_STOCK_CONSTRAINT", "true")
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		database.DB.Exec(context.Background(), "ALTER TABLE products DROP CONSTRAINT IF EXISTS "+stockConstraint)
+	})
+
+	const stock, buyers = 5, 40
+	productID := testutil.Product(t, "Constrained", stock)
+	r := gin.New()
+	r.POST("/purchase/naive", Authenticate(), PurchaseNaive)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	// Every buyer reads the stock inside the 50ms window before anyone writes
+	codes := make([]string, buyers)
+	var wg sync.WaitGroup
+	for i := range buyers {
+		token := bearer(t, i+1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serve(r, http.MethodPost, "/purchase/naive?delay_ms=50", body, "Authorization", token)
+			if rec.Code == http.StatusOK {
+				codes[i] = "OK"
+				return
+			}
+			var res struct {
+				Error APIError `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &res) // errorOf can't Fatal off the test goroutine
+			codes[i] = res.Error.Code
+		}()
+	}
+	wg.Wait()
+
+	tally := map[string]int{}
+	for _, code := range codes {
+		tally[code]++
+	}
+	if tally["OK"] != stock || tally[CodeConstraintViolation] == 0 {
+		t.Fatalf("outcomes = %v, want %d sales and the rest stopped by %s", tally, stock, CodeConstraintViolation)
+	}
+	if got := testutil.Quantity(t, productID); got != 0 {
+		t.Fatalf("quantity = %d, want 0: the constraint must stop it going negative", got)
+	}
+	if got := readModeCounters(ModeNaive).Oversells; got != 0 {
+		t.Fatalf("oversells = %d, want 0", got)
+	}
+}
+
+func TestPurchaseDryRun(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase?persist=false", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	var res struct {
+		Persisted  *bool `json:"persisted"`
+		RedisStock int   `json:"redis_stock"`
+	}
+	decode(t, rec, &res)
+	if rec.Code != http.StatusOK || res.Persisted == nil || *res.Persisted || res.RedisStock != 9 {
+		t.Fatalf("status = %d: %s; want 200, persisted false, redis_stock 9", rec.Code, rec.Body)
+	}
+
+	if got, _ := mr.Get(database.StockKey(productID)); got != "9" {
+		t.Fatalf("Redis stock = %s, want 9", got)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10: a dry run must not touch PostgreSQL", got)
+	}
+	if n := testutil.Orders(t, productID, OrderStatusSuccess); n != 0 {
+		t.Fatalf("%d orders written by a dry run, want 0", n)
+	}
+	if got := readModeCounters(ModeRedisPostgres).Success; got != 1 {
+		t.Fatalf("successes = %d, want the dry run counted", got)
+	}
+}
+
+func TestPurchaseProductUnknownMode(t *testing.T) {
+	r := gin.New()
+	r.POST("/purchase", PurchaseProduct)
+	for _, mode := range []string{"atomic", "optimistic", "REDIS", ""} {
+		rec := serve(r, http.MethodPost, "/purchase?mode="+mode, `{"product_id": 1}`)
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("mode %q: status = %d: %s; want 400 %s", mode, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestPurchaseProductModes(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	setPaymentFailRate(t, 0)
+	productID := testutil.Product(t, "Widget", 100)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseProduct)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	queries := map[string]string{"": ModeRedisPostgres} // no ?mode= is Redis + PostgreSQL
+	for name, route := range purchaseQueryModes {
+		queries["?mode="+name] = route.mode
+	}
+
+	userID := 0
+	for query, mode := range queries {
+		userID++
+		before := readModeCounters(mode).Success
+		rec := serve(r, http.MethodPost, "/purchase"+query, body, "Authorization", bearer(t, userID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d: %s; want 200", query, rec.Code, rec.Body)
+		}
+		if got := readModeCounters(mode).Success; got != before+1 {
+			t.Fatalf("%q: %s successes = %d, want %d", query, mode, got, before+1)
+		}
+	}
+	if got := testutil.Quantity(t, productID); got != 100-len(queries) {
+		t.Fatalf("quantity = %d, want %d", got, 100-len(queries))
+	}
+}
+
+func TestFailStockUpdateStatementTimeout(t *testing.T) {
+	resetStats(t)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/purchase/postgres", nil)
+
+	err := &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}
+	failStockUpdate(c.Request.Context(), c, ModePostgresLock, err)
+	if rec.Code != http.StatusGatewayTimeout || errorOf(t, rec).Code != CodeDBTimeout {
+		t.Fatalf("status = %d: %s; want 504 %s", rec.Code, rec.Body, CodeDBTimeout)
+	}
+	if stats := readModeCounters(ModePostgresLock); stats.Failed != 1 || stats.Oversells != 0 {
+		t.Fatalf("stats = %+v, want the timeout counted as one failure", stats)
+	}
+}
+
+func TestPurchaseSerializableRetries(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+
+	const stock, buyers = 20, 50
+	res := runSale(t, saleMode{ModeSerializable, PurchaseSerializable, true}, stock, buyers)
+	if res.successes > stock || res.remaining != stock-res.successes {
+		t.Fatalf("%d sales of %d left quantity %d, want no oversell", res.successes, stock, res.remaining)
+	}
+	if res.successes == 0 {
+		t.Fatal("no purchase succeeded")
+	}
+	if n := atomic.LoadInt64(&SerializationRetryCount); n == 0 {
+		t.Fatalf("%d buyers on one row never retried a serialization failure", buyers)
+	}
+}
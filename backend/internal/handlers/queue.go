@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 🎟️ VIRTUAL WAITING ROOM
+// ============================================
+// Each visitor joins with POST /queue/join and gets a position. A background
+// admitter moves the "admitted" cursor forward at a fixed rate; once the
+// cursor reaches a position, that token may purchase.
+
+var (
+	queuePositionKey = database.Key("queue", "position")
+	queueAdmittedKey = database.Key("queue", "admitted")
+)
+
+var (
+	queueRequired   = config.Bool("QUEUE_REQUIRED", false)
+	queueAdmitRate  = config.Int("QUEUE_ADMIT_PER_SEC", 50)
+	queueTokenTTL   = time.Duration(config.Int("QUEUE_TOKEN_TTL_SEC", 3600)) * time.Second
+	queueAdmitEvery = time.Second
+)
+
+func queueTokenKey(token string) string {
+	return database.Key("queue", "token", token)
+}
+
+// advanceCursorScript moves the admitted cursor forward by ARGV[1], but never
+// past the last position handed out, so an idle queue can't bank admissions.
+var advanceCursorScript = redis.NewScript(`
+	local last = tonumber(redis.call('GET', KEYS[1]) or '0')
+	local cursor = tonumber(redis.call('GET', KEYS[2]) or '0')
+	local next = math.min(cursor + tonumber(ARGV[1]), last)
+	if next > cursor then
+		redis.call('SET', KEYS[2], next)
+	end
+	return next
+`)
+
+// RunQueueAdmitter advances the admitted cursor until ctx is cancelled
+func RunQueueAdmitter(ctx context.Context) {
+	ticker := time.NewTicker(queueAdmitEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := advanceCursorScript.Run(ctx, database.Rdb,
+				[]string{queuePositionKey, queueAdmittedKey}, queueAdmitRate).Err()
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("⚠️ Queue admitter failed", "error", err)
+			}
+		}
+	}
+}
+
+// JoinQueue hands out the next queue position and a token to check it with
+func JoinQueue(c *gin.Context) {
+	position, err := database.Rdb.Incr(c, queuePositionKey).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to join queue")
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeInternal, "Failed to issue token")
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := database.Rdb.Set(c, queueTokenKey(token), position, queueTokenTTL).Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to save token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":    token,
+		"position": position,
+	})
+}
+
+// queueStatus looks up a token's position and whether it has been admitted
+func queueStatus(ctx context.Context, token string) (position, cursor int64, err error) {
+	position, err = database.Rdb.Get(ctx, queueTokenKey(token)).Int64()
+	if err != nil {
+		return 0, 0, err
+	}
+	cursor, err = database.Rdb.Get(ctx, queueAdmittedKey).Int64()
+	if err == redis.Nil {
+		return position, 0, nil
+	}
+	return position, cursor, err
+}
+
+// QueueStatus reports whether a token may purchase yet
+func QueueStatus(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "token is required")
+		return
+	}
+
+	position, cursor, err := queueStatus(c, token)
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, CodeInvalidQueueToken, "Unknown or expired queue token")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to read queue status")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"position": position,
+		"admitted": position <= cursor,
+		"ahead":    max(position-cursor-1, 0),
+	})
+}
+
+// RequireQueueToken gates purchases behind an admitted X-Queue-Token. When
+// QUEUE_REQUIRED is off, requests without the header pass straight through.
+func RequireQueueToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Queue-Token")
+		if token == "" {
+			if queueRequired {
+				respondError(c, http.StatusBadRequest, CodeQueueTokenRequired, "X-Queue-Token header is required")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		position, cursor, err := queueStatus(c, token)
+		if err == redis.Nil {
+			respondError(c, http.StatusForbidden, CodeInvalidQueueToken, "Unknown or expired queue token")
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to read queue status")
+			return
+		}
+		if position > cursor {
+			respondErrorDetail(c, http.StatusTooEarly, CodeQueueNotAdmitted, "Not admitted yet, keep waiting",
+				fmt.Sprintf("position %d, admitted up to %d", position, cursor))
+			return
+		}
+
+		c.Next()
+	}
+}
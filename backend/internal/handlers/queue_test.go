@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueRouter serves the queue endpoints and a POST /purchase gated by
+// RequireQueueToken that just answers 200
+func queueRouter() *gin.Engine {
+	r := gin.New()
+	r.POST("/queue/join", JoinQueue)
+	r.GET("/queue/status", QueueStatus)
+	r.POST("/purchase", RequireQueueToken(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+// joinQueue joins and returns the token and position
+func joinQueue(t *testing.T, r http.Handler) (string, int64) {
+	t.Helper()
+	rec := serve(r, http.MethodPost, "/queue/join", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("join: status = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Token    string `json:"token"`
+		Position int64  `json:"position"`
+	}
+	decode(t, rec, &body)
+	return body.Token, body.Position
+}
+
+// admit advances the admitted cursor by n, as one admitter tick would
+func admit(t *testing.T, n int) int64 {
+	t.Helper()
+	cursor, err := advanceCursorScript.Run(context.Background(), database.Rdb,
+		[]string{queuePositionKey, queueAdmittedKey}, n).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+func TestQueueJoin(t *testing.T) {
+	testutil.Redis(t)
+	r := queueRouter()
+
+	token1, pos1 := joinQueue(t, r)
+	token2, pos2 := joinQueue(t, r)
+	if pos1 != 1 || pos2 != 2 {
+		t.Fatalf("positions = %d, %d; want 1, 2", pos1, pos2)
+	}
+	if token1 == token2 || len(token1) != 32 {
+		t.Fatalf("tokens %q and %q, want two distinct 32-char hex tokens", token1, token2)
+	}
+
+	rec := serve(r, http.MethodGet, "/queue/status?token="+token2, "")
+	var status struct {
+		Position int64 `json:"position"`
+		Admitted bool  `json:"admitted"`
+		Ahead    int64 `json:"ahead"`
+	}
+	decode(t, rec, &status)
+	if status.Position != 2 || status.Admitted || status.Ahead != 1 {
+		t.Fatalf("status = %+v, want position 2, not admitted, 1 ahead", status)
+	}
+
+	if rec := serve(r, http.MethodGet, "/queue/status?token=nope", ""); rec.Code != http.StatusNotFound || errorOf(t, rec).Code != CodeInvalidQueueToken {
+		t.Fatalf("unknown token: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(r, http.MethodGet, "/queue/status", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("no token: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestQueueAdmission(t *testing.T) {
+	testutil.Redis(t)
+	r := queueRouter()
+	token1, _ := joinQueue(t, r)
+	token2, _ := joinQueue(t, r)
+	purchase := func(token string) *http.Response {
+		return serve(r, http.MethodPost, "/purchase", "", "X-Queue-Token", token).Result()
+	}
+
+	rec := serve(r, http.MethodPost, "/purchase", "", "X-Queue-Token", token1)
+	if rec.Code != http.StatusTooEarly || errorOf(t, rec).Code != CodeQueueNotAdmitted {
+		t.Fatalf("before admission: status = %d: %s; want 425 %s", rec.Code, rec.Body, CodeQueueNotAdmitted)
+	}
+
+	if cursor := admit(t, 1); cursor != 1 {
+		t.Fatalf("cursor = %d, want 1", cursor)
+	}
+	if got := purchase(token1).StatusCode; got != http.StatusOK {
+		t.Fatalf("first in line after one admission: status = %d, want 200", got)
+	}
+	if got := purchase(token2).StatusCode; got != http.StatusTooEarly {
+		t.Fatalf("second in line after one admission: status = %d, want 425", got)
+	}
+
+	// The cursor stops at the last position handed out
+	if cursor := admit(t, 100); cursor != 2 {
+		t.Fatalf("cursor = %d, want it capped at 2", cursor)
+	}
+	if got := purchase(token2).StatusCode; got != http.StatusOK {
+		t.Fatalf("second in line after admission: status = %d, want 200", got)
+	}
+	token3, _ := joinQueue(t, r)
+	if got := purchase(token3).StatusCode; got != http.StatusTooEarly {
+		t.Fatalf("joined after an idle stretch: status = %d, want 425 (no banked admissions)", got)
+	}
+
+	if rec := serve(r, http.MethodPost, "/purchase", "", "X-Queue-Token", "nope"); rec.Code != http.StatusForbidden {
+		t.Fatalf("unknown token: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestRequireQueueTokenHeader(t *testing.T) {
+	testutil.Redis(t)
+	r := queueRouter()
+
+	if rec := serve(r, http.MethodPost, "/purchase", ""); rec.Code != http.StatusOK {
+		t.Fatalf("QUEUE_REQUIRED off, no header: status = %d, want 200", rec.Code)
+	}
+
+	old := queueRequired
+	queueRequired = true
+	t.Cleanup(func() { queueRequired = old })
+	rec := serve(r, http.MethodPost, "/purchase", "")
+	if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeQueueTokenRequired {
+		t.Fatalf("QUEUE_REQUIRED on, no header: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRunQueueAdmitter(t *testing.T) {
+	mr := testutil.Redis(t)
+	oldEvery, oldRate := queueAdmitEvery, queueAdmitRate
+	queueAdmitEvery, queueAdmitRate = 5*time.Millisecond, 1
+	t.Cleanup(func() { queueAdmitEvery, queueAdmitRate = oldEvery, oldRate })
+	mr.Set(queuePositionKey, "3")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunQueueAdmitter(ctx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if got, _ := mr.Get(queueAdmittedKey); got == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			got, _ := mr.Get(queueAdmittedKey)
+			t.Fatalf("cursor = %q after 2s, want 3", got)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("admitter didn't stop when its context was cancelled")
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 🚦 PER-IP RATE LIMIT (token bucket in Redis)
+// ============================================
+// The bucket lives in Redis so every API instance shares the same limit.
+
+var (
+	rateLimitRPS   = config.Int("RATE_LIMIT_RPS", 0) // 0 = disabled
+	rateLimitBurst = config.Int("RATE_LIMIT_BURST", 20)
+)
+
+func rateLimitKey(ip string) string {
+	return database.Key("ratelimit", "ip", ip)
+}
+
+// takeTokenScript refills the bucket for the time elapsed since the last call,
+// then takes one token. Returns {1, 0} if allowed, or {0, ms until a token is
+// available}. Uses Redis TIME so instances with skewed clocks agree.
+// KEYS[1] = bucket hash, ARGV[1] = tokens per second, ARGV[2] = burst
+var takeTokenScript = redis.NewScript(`
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local t = redis.call('TIME')
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	local tokens = tonumber(bucket[1]) or burst
+	local ts = tonumber(bucket[2]) or now
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+
+	local allowed = 0
+	local wait = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	else
+		wait = math.ceil((1 - tokens) * 1000 / rate)
+	end
+
+	redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+	redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+	return {allowed, wait}
+`)
+
+// RateLimit limits each client IP to RATE_LIMIT_RPS requests per second with
+// bursts of RATE_LIMIT_BURST. If Redis is unavailable the request is let
+// through: the limiter protects the sale, it shouldn't take it down.
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rateLimitRPS <= 0 {
+			c.Next()
+			return
+		}
+
+		res, err := takeTokenScript.Run(c, database.Rdb,
+			[]string{rateLimitKey(c.ClientIP())}, rateLimitRPS, max(rateLimitBurst, 1)).Int64Slice()
+		if err != nil || len(res) != 2 {
+			slog.Warn("⚠️ Rate limiter unavailable, allowing request", "client_ip", c.ClientIP(), "error", err)
+			c.Next()
+			return
+		}
+
+		if res[0] == 0 {
+			wait := time.Duration(res[1]) * time.Millisecond
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondErrorDetail(c, http.StatusTooManyRequests, CodeRateLimited, "Too many requests",
+				fmt.Sprintf("limit is %d/s per IP, retry in %s", rateLimitRPS, wait))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ============================================
+// 🌍 GLOBAL SALE RATE LIMIT
+// ============================================
+// One bucket shared by every buyer caps purchases per second for the whole
+// sale, protecting fulfillment downstream. It runs as middleware before the
+// purchase handlers, so a throttled request never touches stock or the
+// per-mode counters. POST /admin/rate changes it without a restart (per
+// instance: call every instance when running several).
+
+var globalRateKey = database.Key("ratelimit", "global")
+
+var globalRPS, globalBurst atomic.Int64
+
+func init() {
+	globalRPS.Store(int64(config.Int("GLOBAL_SALE_RPS", 0))) // 0 = disabled
+	globalBurst.Store(int64(config.Int("GLOBAL_SALE_BURST", 0)))
+}
+
+// globalRate returns the current rate and burst; burst defaults to one
+// second's worth of tokens
+func globalRate() (rps, burst int64) {
+	rps, burst = globalRPS.Load(), globalBurst.Load()
+	if burst <= 0 {
+		burst = max(rps, 1)
+	}
+	return rps, burst
+}
+
+// GlobalRateLimit lets at most GLOBAL_SALE_RPS purchases per second through
+// across all clients. Like RateLimit it fails open if Redis is unavailable.
+func GlobalRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rps, burst := globalRate()
+		if rps <= 0 {
+			c.Next()
+			return
+		}
+
+		res, err := takeTokenScript.Run(c, database.Rdb, []string{globalRateKey}, rps, burst).Int64Slice()
+		if err != nil || len(res) != 2 {
+			slog.Warn("⚠️ Global rate limiter unavailable, allowing request", "error", err)
+			c.Next()
+			return
+		}
+
+		if res[0] == 0 {
+			wait := time.Duration(res[1]) * time.Millisecond
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondErrorDetail(c, http.StatusTooManyRequests, CodeRateLimited, "The sale is busy, try again shortly",
+				fmt.Sprintf("sale limit is %d purchases/s, retry in %s", rps, wait))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetGlobalRate reports the current global sale limit
+func GetGlobalRate(c *gin.Context) {
+	rps, burst := globalRate()
+	c.JSON(http.StatusOK, gin.H{"rps": rps, "burst": burst, "enabled": rps > 0})
+}
+
+// SetGlobalRate changes the global sale limit on the fly: {"rps": 100} or
+// {"rps": 100, "burst": 200}; rps 0 turns it off
+func SetGlobalRate(c *gin.Context) {
+	var req struct {
+		RPS   *int64 `json:"rps"`
+		Burst int64  `json:"burst"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RPS == nil || *req.RPS < 0 || req.Burst < 0 {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "rps (>= 0) is required; burst must not be negative")
+		return
+	}
+
+	globalRPS.Store(*req.RPS)
+	globalBurst.Store(req.Burst)
+	// Start the new limit from a full bucket rather than the old one's state
+	database.Rdb.Del(c, globalRateKey)
+
+	slog.Info("🌍 Global sale limit set", "rps", *req.RPS, "burst", req.Burst)
+	GetGlobalRate(c)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// globalRateRouter serves POST /admin/rate and a purchase stub behind
+// GlobalRateLimit that counts the requests it lets through
+func globalRateRouter(t *testing.T, served *atomic.Int64) *gin.Engine {
+	t.Helper()
+	prevRPS, prevBurst := globalRPS.Load(), globalBurst.Load()
+	t.Cleanup(func() {
+		globalRPS.Store(prevRPS)
+		globalBurst.Store(prevBurst)
+	})
+	r := gin.New()
+	r.POST("/admin/rate", SetGlobalRate)
+	r.POST("/purchase", GlobalRateLimit(), func(c *gin.Context) {
+		served.Add(1)
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	testutil.Redis(t)
+	var served atomic.Int64
+	r := globalRateRouter(t, &served)
+
+	if rec := serve(r, http.MethodPost, "/admin/rate", `{"rps": 1, "burst": 3}`); rec.Code != http.StatusOK {
+		t.Fatalf("set rate: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	const buyers = 10
+	var wg sync.WaitGroup
+	var throttled atomic.Int64
+	for range buyers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serve(r, http.MethodPost, "/purchase", "")
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "" {
+				throttled.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if served.Load() != 3 || throttled.Load() != buyers-3 {
+		t.Fatalf("%d served, %d throttled; want the burst of 3 through and %d throttled", served.Load(), throttled.Load(), buyers-3)
+	}
+
+	// rps 0 turns the limit off
+	serve(r, http.MethodPost, "/admin/rate", `{"rps": 0}`)
+	for range 5 {
+		if rec := serve(r, http.MethodPost, "/purchase", ""); rec.Code != http.StatusOK {
+			t.Fatalf("with the limit off: status = %d", rec.Code)
+		}
+	}
+}
+
+func TestSetGlobalRateBadInput(t *testing.T) {
+	var served atomic.Int64
+	r := globalRateRouter(t, &served)
+	for _, body := range []string{`{}`, `{"rps": -1}`, `{"rps": 5, "burst": -1}`, `nope`} {
+		rec := serve(r, http.MethodPost, "/admin/rate", body)
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", body, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"flash-sale-backend/internal/reconcile"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReconcileStatus reports the last Redis/Postgres reconciliation pass
+func ReconcileStatus(c *gin.Context) {
+	result := reconcile.LastResult()
+	if result == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "No reconciliation has run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// purchaseRouteModes maps purchase routes to their mode, for panics that
+// happen before the handler tagged the request
+var purchaseRouteModes = map[string]string{
+	"/purchase":                 ModeRedisPostgres,
+	"/purchase/naive":           ModeNaive,
+	"/purchase/postgres":        ModePostgresLock,
+	"/purchase/postgres-nowait": ModePostgresNoWait,
+	"/purchase/redis":           ModeRedisPostgres,
+	"/purchase/cart":            ModeCart,
+	"/purchase/payment":         ModePayment,
+	"/purchase/fair":            ModeFair,
+	"/purchase/serializable":    ModeSerializable,
+}
+
+// Recovery replaces gin.Recovery: a panicking purchase is counted as a
+// failure (otherwise TotalRequests runs ahead of success + failed), the stack
+// is logged with the request id, and the client gets a normal INTERNAL_ERROR.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec) // net/http's "stop quietly" signal
+			}
+
+			mode := purchaseRouteModes[c.FullPath()]
+			if route, ok := purchaseQueryModes[c.Query("mode")]; ok && c.FullPath() == "/purchase" {
+				mode = route.mode
+			}
+			if tag, ok := c.Get(ctxPurchase); ok {
+				mode = tag.(purchaseTag).mode
+			}
+			if mode != "" {
+				countFailure(mode)
+			}
+
+			slog.Error("💥 Panic recovered",
+				"request_id", requestIDFrom(c),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"panic", fmt.Sprint(rec),
+				"stack", string(debug.Stack()))
+
+			if c.Writer.Written() {
+				c.Abort() // too late for a clean body
+				return
+			}
+			respondError(c, http.StatusInternalServerError, CodeInternal, "Internal server error")
+		}()
+		c.Next()
+	}
+}
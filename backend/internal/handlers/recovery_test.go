@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicRouter serves a purchase route and a plain route that both panic
+func panicRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(RequestID(), Recovery())
+	r.POST("/purchase/naive", func(c *gin.Context) {
+		countRequest(ModeNaive)
+		panic("boom")
+	})
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+	return r
+}
+
+func TestRecoveryCountsFailure(t *testing.T) {
+	resetStats(t)
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+
+	rec := serve(panicRouter(), http.MethodPost, "/purchase/naive", `{}`, RequestIDHeader, "req-9")
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeInternal {
+		t.Fatalf("status = %d: %s; want 500 %s", rec.Code, rec.Body, CodeInternal)
+	}
+	if got := readModeCounters(ModeNaive); got.Requests != 1 || got.Failed != 1 {
+		t.Fatalf("naive = %+v, want the request counted as failed", got)
+	}
+	if FailCount != 1 {
+		t.Fatalf("FailCount = %d, want 1", FailCount)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log %q is not one JSON line: %v", buf.String(), err)
+	}
+	if line["request_id"] != "req-9" || line["panic"] != "boom" || !strings.Contains(line["stack"].(string), "recovery_test.go") {
+		t.Fatalf("log line = %v, want request_id, panic and stack", line)
+	}
+}
+
+func TestRecoveryOtherRoutes(t *testing.T) {
+	resetStats(t)
+	rec := serve(panicRouter(), http.MethodGet, "/boom", "")
+	if rec.Code != http.StatusInternalServerError || errorOf(t, rec).Code != CodeInternal {
+		t.Fatalf("status = %d: %s; want 500 %s", rec.Code, rec.Body, CodeInternal)
+	}
+	if FailCount != 0 {
+		t.Fatalf("FailCount = %d; a non-purchase panic isn't a failed purchase", FailCount)
+	}
+}
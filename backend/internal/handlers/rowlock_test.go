@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// holdRowLock takes the product row lock in a transaction of its own, as a
+// slow buyer would; release (or the end of the test) rolls it back
+func holdRowLock(t *testing.T, productID int) (release func()) {
+	t.Helper()
+	tx, err := database.DB.Begin(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(t.Context(), "SELECT quantity FROM products WHERE id = $1 FOR UPDATE", productID); err != nil {
+		tx.Rollback(context.Background())
+		t.Fatal(err)
+	}
+	release = func() { tx.Rollback(context.Background()) }
+	t.Cleanup(release)
+	return release
+}
+
+func TestPurchaseLockTimeout(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	prev := service.LockTimeout
+	t.Cleanup(func() { service.LockTimeout = prev })
+	service.LockTimeout = 200 * time.Millisecond
+
+	productID := testutil.Product(t, "Widget", 10)
+	release := holdRowLock(t, productID)
+
+	r := gin.New()
+	r.POST("/purchase/postgres", Authenticate(), PurchasePostgresLock)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	start := time.Now()
+	rec := serve(r, http.MethodPost, "/purchase/postgres", body, "Authorization", bearer(t, 1))
+	elapsed := time.Since(start)
+	if rec.Code != http.StatusServiceUnavailable || errorOf(t, rec).Code != CodeLockTimeout {
+		t.Fatalf("status = %d: %s; want 503 %s", rec.Code, rec.Body, CodeLockTimeout)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("gave up after %s, want about the 200ms lock timeout", elapsed)
+	}
+	stats := readModeCounters(ModePostgresLock)
+	if stats.Failed != 1 || stats.Oversells != 0 {
+		t.Fatalf("stats = %+v, want 1 failure and no oversell", stats)
+	}
+
+	// Once the lock is free the same purchase goes through
+	release()
+	if rec := serve(r, http.MethodPost, "/purchase/postgres", body, "Authorization", bearer(t, 1)); rec.Code != http.StatusOK {
+		t.Fatalf("after release: status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+	if got := testutil.Quantity(t, productID); got != 9 {
+		t.Fatalf("quantity = %d, want 9", got)
+	}
+}
+
+func TestPurchaseNoWait(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Widget", 10)
+	release := holdRowLock(t, productID)
+
+	r := gin.New()
+	r.POST("/purchase/postgres-nowait", Authenticate(), PurchasePostgresLockNoWait)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	start := time.Now()
+	rec := serve(r, http.MethodPost, "/purchase/postgres-nowait", body, "Authorization", bearer(t, 1))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("took %s with the row locked, want an immediate answer", elapsed)
+	}
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Code != CodeLockContended {
+		t.Fatalf("status = %d: %s; want 409 %s", rec.Code, rec.Body, CodeLockContended)
+	}
+	if LockContendedCount != 1 {
+		t.Fatalf("lock_contended = %d, want 1", LockContendedCount)
+	}
+	if got := readModeCounters(ModePostgresNoWait).Failed; got != 1 {
+		t.Fatalf("failures = %d, want 1", got)
+	}
+
+	release()
+	if rec := serve(r, http.MethodPost, "/purchase/postgres-nowait", body, "Authorization", bearer(t, 1)); rec.Code != http.StatusOK {
+		t.Fatalf("after release: status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// checkSaleWindow fails the purchase with 425 SALE_NOT_STARTED or 410
+// SALE_ENDED outside the product's window (see service.CheckSaleWindow).
+// Unknown products pass, so each mode reports them the way it always has.
+func checkSaleWindow(ctx context.Context, c *gin.Context, mode string, productID int) bool {
+	err := service.CheckSaleWindow(ctx, productID)
+	var closed *service.SaleClosedError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &closed) && closed.Ended:
+		failPurchaseDetail(ctx, c, mode, http.StatusGone, CodeSaleEnded, "Sale has ended",
+			"ended at "+closed.At.UTC().Format(time.RFC3339))
+	case errors.As(err, &closed):
+		failPurchaseDetail(ctx, c, mode, http.StatusTooEarly, CodeSaleNotStarted, "Sale has not started yet",
+			"starts at "+closed.At.UTC().Format(time.RFC3339))
+	default:
+		failPurchase(ctx, c, mode, http.StatusInternalServerError, CodeDBError, "Failed to load sale window")
+	}
+	return false
+}
+
+// SaleCountdown gives the dashboard an authoritative clock for a product's
+// sale: server time, the window, and seconds until it opens and closes
+// (null when that side is unbounded; negative once passed).
+func SaleCountdown(c *gin.Context) {
+	productID, ok := queryInt(c, "product_id", 0, 1, math.MaxInt32)
+	if !ok {
+		return
+	}
+	if productID == 0 {
+		respondError(c, http.StatusBadRequest, CodeInvalidInput, "product_id is required")
+		return
+	}
+
+	var start, end *time.Time
+	err := database.DB.QueryRow(c,
+		"SELECT sale_start, sale_end FROM products WHERE id=$1", productID).Scan(&start, &end)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load sale window")
+		return
+	}
+
+	now := time.Now().UTC()
+	secondsUntil := func(t *time.Time) *float64 {
+		if t == nil {
+			return nil
+		}
+		s := t.Sub(now).Seconds()
+		return &s
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":          productID,
+		"server_time":         now,
+		"sale_start":          start,
+		"sale_end":            end,
+		"seconds_until_start": secondsUntil(start),
+		"seconds_until_end":   secondsUntil(end),
+	})
+}
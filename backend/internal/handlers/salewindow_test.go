@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setSaleWindow sets a product's sale_start and sale_end (nil for no bound)
+func setSaleWindow(t *testing.T, productID int, start, end *time.Time) {
+	t.Helper()
+	_, err := database.DB.Exec(t.Context(),
+		"UPDATE products SET sale_start=$2, sale_end=$3 WHERE id=$1", productID, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.ForgetProductRules(productID)
+}
+
+func TestSaleWindow(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Timed", 10)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	r.POST("/purchase/postgres", Authenticate(), PurchasePostgresLock)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	buyer := 0 // a new buyer each time, clear of any per-user limit
+	hour := time.Hour
+	past, future := time.Now().Add(-hour), time.Now().Add(hour)
+	for _, tc := range []struct {
+		name       string
+		start, end *time.Time
+		status     int
+		code       string
+	}{
+		{"before", &future, nil, http.StatusTooEarly, CodeSaleNotStarted},
+		{"after", nil, &past, http.StatusGone, CodeSaleEnded},
+		{"during", &past, &future, http.StatusOK, ""},
+		{"always on", nil, nil, http.StatusOK, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setSaleWindow(t, productID, tc.start, tc.end)
+			for _, path := range []string{"/purchase", "/purchase/postgres"} {
+				buyer++
+				rec := serve(r, http.MethodPost, path, body, "Authorization", bearer(t, buyer))
+				if rec.Code != tc.status || (tc.code != "" && errorOf(t, rec).Code != tc.code) {
+					t.Fatalf("%s: status = %d: %s; want %d %s", path, rec.Code, rec.Body, tc.status, tc.code)
+				}
+			}
+		})
+	}
+	// Only the two windows that were open sold anything
+	if got := testutil.Quantity(t, productID); got != 6 {
+		t.Fatalf("quantity = %d, want 6", got)
+	}
+}
+
+func TestGetProductSaleWindow(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Timed", 10)
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	setSaleWindow(t, productID, &start, nil)
+
+	before := time.Now()
+	rec := serve(productsRouter(), http.MethodGet, fmt.Sprintf("/products/%d", productID), "")
+	var p struct {
+		SaleStart  *time.Time `json:"sale_start"`
+		SaleEnd    *time.Time `json:"sale_end"`
+		ServerTime time.Time  `json:"server_time"`
+	}
+	decode(t, rec, &p)
+	if p.SaleStart == nil || !p.SaleStart.Equal(start) || p.SaleEnd != nil {
+		t.Fatalf("window = %v to %v, want %s to unbounded", p.SaleStart, p.SaleEnd, start)
+	}
+	if p.ServerTime.Before(before.Add(-time.Second)) || p.ServerTime.After(time.Now().Add(time.Second)) {
+		t.Fatalf("server_time = %s, want about now", p.ServerTime)
+	}
+}
+
+func TestSaleCountdown(t *testing.T) {
+	testutil.Postgres(t)
+	productID := testutil.Product(t, "Timed", 10)
+	start := time.Now().Add(10 * time.Minute)
+	setSaleWindow(t, productID, &start, nil)
+
+	r := gin.New()
+	r.GET("/sale/countdown", SaleCountdown)
+	rec := serve(r, http.MethodGet, fmt.Sprintf("/sale/countdown?product_id=%d", productID), "")
+	var body struct {
+		ServerTime        time.Time `json:"server_time"`
+		SecondsUntilStart *float64  `json:"seconds_until_start"`
+		SecondsUntilEnd   *float64  `json:"seconds_until_end"`
+	}
+	decode(t, rec, &body)
+	if rec.Code != http.StatusOK || body.ServerTime.IsZero() {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if s := body.SecondsUntilStart; s == nil || *s <= 590 || *s > 600 {
+		t.Fatalf("seconds_until_start = %v, want about 600", s)
+	}
+	if body.SecondsUntilEnd != nil {
+		t.Fatalf("seconds_until_end = %v for an open-ended sale, want null", *body.SecondsUntilEnd)
+	}
+
+	if rec := serve(r, http.MethodGet, "/sale/countdown?product_id=999", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown product: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSaleCountdownBadInput(t *testing.T) {
+	r := gin.New()
+	r.GET("/sale/countdown", SaleCountdown)
+	for _, query := range []string{"", "product_id=0", "product_id=x"} {
+		rec := serve(r, http.MethodGet, "/sale/countdown?"+query, "")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%q: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 📜 LUA SCRIPT CACHE
+// ============================================
+// Every Lua script is a redis.Script: Run calls EVALSHA with the script's
+// SHA1 and only sends the full text (EVAL, which caches it again) when Redis
+// answers NOSCRIPT, e.g. after a restart or SCRIPT FLUSH. Loading them at
+// startup means the hot path never ships the script body at all.
+
+// luaScripts lists every script the handlers run
+var luaScripts = map[string]*redis.Script{
+	"reserve_stock":  service.ReserveStockScript,
+	"reserve_cart":   service.ReserveCartScript,
+	"join_fair":      service.JoinFairScript,
+	"settle_fair":    service.SettleFairScript,
+	"leave_fair":     service.LeaveFairScript,
+	"take_token":     takeTokenScript,
+	"advance_cursor": advanceCursorScript,
+	"adjust_stock":   adjustStockScript,
+}
+
+// LoadScripts registers every Lua script with Redis (SCRIPT LOAD). A failure
+// is only logged: Run falls back to EVAL and the script gets cached then.
+func LoadScripts(ctx context.Context) {
+	for name, script := range luaScripts {
+		if err := script.Load(ctx, database.Rdb).Err(); err != nil {
+			slog.Warn("⚠️ Failed to preload Lua script, it will be sent on first use", "script", name, "error", err)
+			continue
+		}
+		slog.Debug("📜 Lua script loaded", "script", name, "sha", script.Hash())
+	}
+}
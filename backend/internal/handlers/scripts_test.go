@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadScripts(t *testing.T) {
+	testutil.Redis(t)
+	LoadScripts(t.Context())
+
+	for name, script := range luaScripts {
+		exists, err := database.Rdb.ScriptExists(t.Context(), script.Hash()).Result()
+		if err != nil || !exists[0] {
+			t.Fatalf("%s: loaded = %v, %v; want it cached", name, exists, err)
+		}
+	}
+}
+
+func TestScriptSurvivesFlush(t *testing.T) {
+	mr := testutil.Redis(t)
+	LoadScripts(t.Context())
+	mr.Set(database.StockKey(1), "20")
+
+	for i := range 10 {
+		if i == 5 {
+			if err := database.Rdb.ScriptFlush(t.Context()).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		keys := []string{database.StockKey(1), database.UserPurchaseKey(i+1, 1)}
+		stock, err := service.ReserveStockScript.Run(t.Context(), database.Rdb, keys, 0, 1).Int64()
+		if err != nil || stock != int64(19-i) {
+			t.Fatalf("reservation %d: stock = %d, %v; want %d", i+1, stock, err, 19-i)
+		}
+	}
+	// Run cached it again on the NOSCRIPT
+	exists, err := database.Rdb.ScriptExists(t.Context(), service.ReserveStockScript.Hash()).Result()
+	if err != nil || !exists[0] {
+		t.Fatalf("after the flush: loaded = %v, %v; want it cached again", exists, err)
+	}
+}
+
+func TestPurchaseAcrossScriptFlush(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	resetStats(t)
+	LoadScripts(t.Context())
+	const stock, buyers = 10, 15
+	productID := testutil.Product(t, "Widget", stock)
+
+	r := gin.New()
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+	sold := 0
+	for i := range buyers {
+		if i%4 == 2 {
+			// As after a Redis restart: every cached script is gone
+			if err := database.Rdb.ScriptFlush(t.Context()).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, i+1))
+		switch {
+		case rec.Code == http.StatusOK:
+			sold++
+		case i < stock:
+			t.Fatalf("purchase %d: status = %d: %s; want 200", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	if sold != stock {
+		t.Fatalf("%d sold, want %d", sold, stock)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "0" {
+		t.Fatalf("Redis stock = %s, want 0", got)
+	}
+	if got := testutil.Quantity(t, productID); got != 0 {
+		t.Fatalf("quantity = %d, want 0", got)
+	}
+	if got := readModeCounters(ModeRedisPostgres).Oversells; got != 0 {
+		t.Fatalf("oversells = %d, want 0", got)
+	}
+}
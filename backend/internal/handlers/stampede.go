@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 🐘 DEMO: STAMPEDE
+// ============================================
+// POST /demo/stampede fires a burst of purchases from inside the server, so a
+// demo doesn't need a load generator. Each purchase goes straight to the
+// mode's handler through an in-process router and a recorded response: each
+// buyer gets a minted token and goes through Authenticate, the rest of the
+// /purchase middleware (rate limits, waiting room, idempotency) is skipped,
+// the handler and its stats are not.
+
+const (
+	maxStampedeCount       = 5000
+	maxStampedeConcurrency = 200
+)
+
+// stampedeUsers hands out buyer ids well clear of real users, fresh for every
+// stampede so per-user limits don't turn the second run into a wall of 409s
+var stampedeUsers int64 = 900_000_000
+
+// modeCounters is one mode's counters at a point in time
+type modeCounters struct {
+	Requests  int64 `json:"requests"`
+	Success   int64 `json:"success"`
+	Failed    int64 `json:"failed"`
+	Oversells int64 `json:"oversells"`
+}
+
+func readModeCounters(mode string) modeCounters {
+	m := modes[mode]
+	return modeCounters{
+		Requests:  atomic.LoadInt64(&m.requests),
+		Success:   atomic.LoadInt64(&m.success),
+		Failed:    atomic.LoadInt64(&m.failed),
+		Oversells: atomic.LoadInt64(&m.oversells),
+	}
+}
+
+func (a modeCounters) minus(b modeCounters) modeCounters {
+	return modeCounters{
+		Requests:  a.Requests - b.Requests,
+		Success:   a.Success - b.Success,
+		Failed:    a.Failed - b.Failed,
+		Oversells: a.Oversells - b.Oversells,
+	}
+}
+
+// Stampede is POST /demo/stampede?count=&concurrency=&mode=&product_id=. It
+// runs count one-unit purchases of the product, concurrency at a time, and
+// returns how the mode's /stats counters moved, with a tally of status codes.
+// Other traffic on the same mode meanwhile lands in the delta too.
+func Stampede(c *gin.Context) {
+	count, ok := queryInt(c, "count", 100, 1, maxStampedeCount)
+	if !ok {
+		return
+	}
+	concurrency, ok := queryInt(c, "concurrency", 20, 1, maxStampedeConcurrency)
+	if !ok {
+		return
+	}
+	productID, ok := queryInt(c, "product_id", 1, 1, math.MaxInt32)
+	if !ok {
+		return
+	}
+	name := c.DefaultQuery("mode", "redis")
+	route, ok := purchaseQueryModes[name]
+	if !ok {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Unknown purchase mode",
+			fmt.Sprintf("mode %q; use naive, postgres, postgres-nowait, redis, payment, fair or serializable", name))
+		return
+	}
+
+	firstUser := atomic.AddInt64(&stampedeUsers, int64(count)) - int64(count)
+	jobs := make(chan int, count)
+	for i := range count {
+		jobs <- int(firstUser) + i
+	}
+	close(jobs)
+
+	before := readModeCounters(route.mode)
+	start := time.Now()
+
+	var (
+		mu       sync.Mutex
+		statuses = map[string]int{}
+		wg       sync.WaitGroup
+	)
+	for range min(concurrency, count) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range jobs {
+				if c.Request.Context().Err() != nil {
+					return // the caller gave up; stop launching
+				}
+				status := stampedePurchase(c, name, userID, productID)
+				mu.Lock()
+				statuses[strconv.Itoa(status)]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	sent := 0
+	for _, n := range statuses {
+		sent += n
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mode":             name,
+		"product_id":       productID,
+		"count":            count,
+		"concurrency":      concurrency,
+		"sent":             sent,
+		"duration_ms":      elapsed.Milliseconds(),
+		"requests_per_sec": math.Round(float64(sent)/elapsed.Seconds()*10) / 10,
+		"statuses":         statuses,
+		"delta":            readModeCounters(route.mode).minus(before),
+	})
+}
+
+// stampedeRouter serves each purchase mode at /purchase/<mode> behind
+// Recovery and Authenticate, so a panicking handler is counted and answered
+// like on the real router instead of taking the server down
+var stampedeRouter = sync.OnceValue(func() *gin.Engine {
+	r := gin.New()
+	r.Use(Recovery(), Authenticate())
+	for name, route := range purchaseQueryModes {
+		r.POST("/purchase/"+name, route.handler)
+	}
+	return r
+})
+
+// stampedePurchase runs one purchase in-process as userID and returns the
+// status it answered with
+func stampedePurchase(c *gin.Context, mode string, userID, productID int) int {
+	token, _, err := issueToken(userID)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	body, _ := json.Marshal(PurchaseRequest{ProductID: productID, Quantity: 1})
+	req := httptest.NewRequestWithContext(c.Request.Context(), http.MethodPost, "/purchase/"+mode, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	stampedeRouter().ServeHTTP(rec, req)
+	return rec.Code
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stampedeResponse is a POST /demo/stampede response
+type stampedeResponse struct {
+	Mode     string         `json:"mode"`
+	Sent     int            `json:"sent"`
+	Statuses map[string]int `json:"statuses"`
+	Delta    modeCounters   `json:"delta"`
+}
+
+// demoRouter serves /demo/stampede behind RequireAdmin like main.go
+func demoRouter(t testing.TB) *gin.Engine {
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = "" })
+	r := gin.New()
+	r.POST("/demo/stampede", RequireAdmin(), Stampede)
+	return r
+}
+
+func TestStampedeBadInput(t *testing.T) {
+	r := demoRouter(t)
+	if rec := serve(r, http.MethodPost, "/demo/stampede", "", AdminTokenHeader, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status = %d, want 401", rec.Code)
+	}
+	for _, query := range []string{
+		"count=0",
+		fmt.Sprintf("count=%d", maxStampedeCount+1),
+		fmt.Sprintf("concurrency=%d", maxStampedeConcurrency+1),
+		"product_id=0",
+		"mode=bogus",
+	} {
+		rec := serve(r, http.MethodPost, "/demo/stampede?"+query, "", AdminTokenHeader, "secret")
+		if rec.Code != http.StatusBadRequest || errorOf(t, rec).Code != CodeInvalidInput {
+			t.Errorf("%s: status = %d: %s; want 400 %s", query, rec.Code, rec.Body, CodeInvalidInput)
+		}
+	}
+}
+
+func TestStampede(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Stampede", 5)
+
+	before := readModeCounters(ModePostgresLock)
+	path := fmt.Sprintf("/demo/stampede?mode=postgres&count=8&concurrency=4&product_id=%d", productID)
+	rec := serve(demoRouter(t), http.MethodPost, path, "", AdminTokenHeader, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp stampedeResponse
+	decode(t, rec, &resp)
+
+	if resp.Sent != 8 || resp.Statuses["200"] != 5 {
+		t.Fatalf("sent %d with statuses %v, want 8 sent and 5 successes", resp.Sent, resp.Statuses)
+	}
+	if resp.Delta != (modeCounters{Requests: 8, Success: 5, Failed: 3}) {
+		t.Fatalf("delta = %+v, want 8 requests: 5 successes, 3 failures", resp.Delta)
+	}
+	if got := readModeCounters(ModePostgresLock).Success; got != before.Success+5 {
+		t.Fatalf("/stats successes = %d, want %d", got, before.Success+5)
+	}
+	if got := testutil.Quantity(t, productID); got != 0 {
+		t.Fatalf("quantity = %d, want 0", got)
+	}
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Purchase modes, also used as the "mode" field in purchase responses
+const (
+	ModeNaive          = "naive"
+	ModePostgresLock   = "postgres_lock"
+	ModePostgresNoWait = "postgres_nowait"
+	ModeRedisPostgres  = "redis_postgres"
+	ModeCart           = "cart"
+	ModePayment        = "payment"
+	ModeFair           = "fair"
+	ModeSerializable   = "serializable"
+)
+
+// Stats tracking for dashboard
+var (
+	TotalRequests  int64
+	SuccessCount   int64
+	FailCount      int64
+	OversellCount  int64
+	TotalLatencyMs int64
+
+	// Mode 3 purchases served by the row lock because Redis was down
+	FallbackCount int64
+
+	// NOWAIT purchases turned away because the row was already locked
+	LockContendedCount int64
+
+	// Purchases that gave up waiting for a MAX_CONCURRENT_PURCHASES slot
+	OverloadedCount int64
+
+	// Purchases shed because the pool passed DB_POOL_HIGH_WATER_PCT
+	PoolSaturatedCount int64
+
+	// SERIALIZABLE transactions retried after a serialization failure
+	SerializationRetryCount int64
+
+	// Purchase requests being served right now, and the most seen at once
+	// since the last reset (see InFlight)
+	InFlightCount    int64
+	MaxInFlightCount int64
+)
+
+// statsSinceNs is when the counters were last reset (unix nanoseconds)
+var statsSinceNs = time.Now().UnixNano()
+
+// statsSince returns when the counters were last reset
+func statsSince() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&statsSinceNs))
+}
+
+// latencyWindowSize is how many recent samples each mode keeps for percentiles
+const latencyWindowSize = 10000
+
+// latencyWindow is a fixed-size ring buffer of recent latencies (in microseconds).
+// Once full, the oldest sample is overwritten, so percentiles reflect recent traffic.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []int64
+	next    int
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]int64, 0, size)}
+}
+
+func (w *latencyWindow) record(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, d.Microseconds())
+		return
+	}
+	w.samples[w.next] = d.Microseconds()
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// snapshot returns a copy of the current samples so they can be sorted safely
+func (w *latencyWindow) snapshot() []int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := make([]int64, len(w.samples))
+	copy(out, w.samples)
+	return out
+}
+
+func (w *latencyWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = w.samples[:0]
+	w.next = 0
+}
+
+// latencyBucketsMs are the upper bounds of the /metrics latency histogram
+var latencyBucketsMs = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// modeStats holds the counters and latency samples for one purchase mode
+type modeStats struct {
+	requests  int64
+	success   int64
+	failed    int64
+	oversells int64
+
+	// Histogram of successful purchase latencies; the last slot is +Inf
+	buckets      []int64
+	latencySumUs int64
+
+	window *latencyWindow
+}
+
+func newModeStats() *modeStats {
+	return &modeStats{
+		buckets: make([]int64, len(latencyBucketsMs)+1),
+		window:  newLatencyWindow(latencyWindowSize),
+	}
+}
+
+func (m *modeStats) reset() {
+	atomic.StoreInt64(&m.requests, 0)
+	atomic.StoreInt64(&m.success, 0)
+	atomic.StoreInt64(&m.failed, 0)
+	atomic.StoreInt64(&m.oversells, 0)
+	atomic.StoreInt64(&m.latencySumUs, 0)
+	for i := range m.buckets {
+		atomic.StoreInt64(&m.buckets[i], 0)
+	}
+	m.window.reset()
+}
+
+// One set of stats per purchase mode
+var modes = map[string]*modeStats{
+	ModeNaive:          newModeStats(),
+	ModePostgresLock:   newModeStats(),
+	ModePostgresNoWait: newModeStats(),
+	ModeRedisPostgres:  newModeStats(),
+	ModeCart:           newModeStats(),
+	ModePayment:        newModeStats(),
+	ModeFair:           newModeStats(),
+	ModeSerializable:   newModeStats(),
+}
+
+// modeNames returns the modes in a stable order for output
+func modeNames() []string {
+	names := make([]string, 0, len(modes))
+	for name := range modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countRequest records that a purchase attempt started
+func countRequest(mode string) {
+	atomic.AddInt64(&TotalRequests, 1)
+	if m, ok := modes[mode]; ok {
+		atomic.AddInt64(&m.requests, 1)
+	}
+}
+
+// countFailure records a purchase that did not complete
+func countFailure(mode string) {
+	atomic.AddInt64(&FailCount, 1)
+	if m, ok := modes[mode]; ok {
+		atomic.AddInt64(&m.failed, 1)
+	}
+}
+
+// countFallback records a Redis-mode purchase that fell back to the row lock
+func countFallback() {
+	atomic.AddInt64(&FallbackCount, 1)
+}
+
+// enterInFlight counts a purchase request starting and raises the high-water
+// mark if needed; the caller must call exitInFlight when it finishes
+func enterInFlight() {
+	n := atomic.AddInt64(&InFlightCount, 1)
+	for {
+		peak := atomic.LoadInt64(&MaxInFlightCount)
+		if n <= peak || atomic.CompareAndSwapInt64(&MaxInFlightCount, peak, n) {
+			return
+		}
+	}
+}
+
+func exitInFlight() {
+	atomic.AddInt64(&InFlightCount, -1)
+}
+
+// InFlight tracks the purchase requests being served for /stats' in_flight
+// and max_in_flight; the count drops even if the handler panics
+func InFlight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enterInFlight()
+		defer exitInFlight()
+		c.Next()
+	}
+}
+
+// countLockContended records a NOWAIT purchase that found the row locked
+func countLockContended() {
+	atomic.AddInt64(&LockContendedCount, 1)
+}
+
+// countOverloaded records a purchase turned away by the concurrency limit
+func countOverloaded() {
+	atomic.AddInt64(&OverloadedCount, 1)
+}
+
+// countPoolSaturated records a purchase shed by the pool high-water mark
+func countPoolSaturated() {
+	atomic.AddInt64(&PoolSaturatedCount, 1)
+}
+
+// countSerializationRetries records the retries one SERIALIZABLE purchase took
+func countSerializationRetries(n int) {
+	atomic.AddInt64(&SerializationRetryCount, int64(n))
+}
+
+// recordSuccess records a completed purchase: its latency, and an oversell
+// if it pushed the DB quantity below zero
+func recordSuccess(mode string, remaining int, d time.Duration) {
+	atomic.AddInt64(&SuccessCount, 1)
+	atomic.AddInt64(&TotalLatencyMs, d.Milliseconds())
+	if remaining < 0 {
+		atomic.AddInt64(&OversellCount, 1)
+	}
+
+	m, ok := modes[mode]
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&m.success, 1)
+	if remaining < 0 {
+		atomic.AddInt64(&m.oversells, 1)
+	}
+
+	ms := float64(d.Microseconds()) / 1000
+	bucket := sort.SearchFloat64s(latencyBucketsMs, ms)
+	atomic.AddInt64(&m.buckets[bucket], 1)
+	atomic.AddInt64(&m.latencySumUs, d.Microseconds())
+	m.window.record(d)
+}
+
+// percentile returns the nearest-rank percentile (0-100) of sorted samples, in milliseconds
+func percentile(sorted []int64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1]) / 1000
+}
+
+// latencySummary computes p50/p95/p99 for a set of samples (sorts in place)
+func latencySummary(samples []int64) map[string]interface{} {
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	return map[string]interface{}{
+		"samples":        len(samples),
+		"p50_latency_ms": percentile(samples, 50),
+		"p95_latency_ms": percentile(samples, 95),
+		"p99_latency_ms": percentile(samples, 99),
+	}
+}
+
+func ResetStats() {
+	atomic.StoreInt64(&TotalRequests, 0)
+	atomic.StoreInt64(&SuccessCount, 0)
+	atomic.StoreInt64(&FailCount, 0)
+	atomic.StoreInt64(&OversellCount, 0)
+	atomic.StoreInt64(&TotalLatencyMs, 0)
+	atomic.StoreInt64(&FallbackCount, 0)
+	atomic.StoreInt64(&LockContendedCount, 0)
+	atomic.StoreInt64(&OverloadedCount, 0)
+	atomic.StoreInt64(&PoolSaturatedCount, 0)
+	atomic.StoreInt64(&SerializationRetryCount, 0)
+	// Requests still running stay in flight; the peak restarts from them
+	atomic.StoreInt64(&MaxInFlightCount, atomic.LoadInt64(&InFlightCount))
+	atomic.StoreInt64(&statsSinceNs, time.Now().UnixNano())
+
+	for _, m := range modes {
+		m.reset()
+	}
+}
+
+func GetStats() map[string]interface{} {
+	total := atomic.LoadInt64(&TotalRequests)
+	success := atomic.LoadInt64(&SuccessCount)
+	fail := atomic.LoadInt64(&FailCount)
+	oversell := atomic.LoadInt64(&OversellCount)
+	latency := atomic.LoadInt64(&TotalLatencyMs)
+
+	avgLatency := float64(0)
+	if total > 0 {
+		avgLatency = float64(latency) / float64(total)
+	}
+
+	// Counters and percentiles per mode, plus percentiles across all modes combined
+	var all []int64
+	byMode := map[string]interface{}{}
+	latencyByMode := map[string]interface{}{}
+	for name, m := range modes {
+		byMode[name] = map[string]int64{
+			"requests":  atomic.LoadInt64(&m.requests),
+			"success":   atomic.LoadInt64(&m.success),
+			"failed":    atomic.LoadInt64(&m.failed),
+			"oversells": atomic.LoadInt64(&m.oversells),
+		}
+		samples := m.window.snapshot()
+		all = append(all, samples...)
+		latencyByMode[name] = latencySummary(samples)
+	}
+	overall := latencySummary(all)
+
+	return map[string]interface{}{
+		"total_requests":        total,
+		"success":               success,
+		"failed":                fail,
+		"oversells":             oversell,
+		"fallback_count":        atomic.LoadInt64(&FallbackCount),
+		"lock_contended":        atomic.LoadInt64(&LockContendedCount),
+		"overloaded":            atomic.LoadInt64(&OverloadedCount),
+		"pool_saturated":        atomic.LoadInt64(&PoolSaturatedCount),
+		"serialization_retries": atomic.LoadInt64(&SerializationRetryCount),
+		"in_flight":             atomic.LoadInt64(&InFlightCount),
+		"max_in_flight":         atomic.LoadInt64(&MaxInFlightCount),
+		"avg_latency_ms":        avgLatency,
+		"p50_latency_ms":        overall["p50_latency_ms"],
+		"p95_latency_ms":        overall["p95_latency_ms"],
+		"p99_latency_ms":        overall["p99_latency_ms"],
+		"by_mode":               byMode,
+		"latency_by_mode":       latencyByMode,
+	}
+}
+
+// modeComparison is one row of /stats/compare
+type modeComparison struct {
+	Mode         string  `json:"mode"`
+	Requests     int64   `json:"requests"`
+	Success      int64   `json:"success"`
+	SuccessRate  float64 `json:"success_rate"`
+	Oversells    int64   `json:"oversells"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+	Safe         bool    `json:"safe"`
+}
+
+// compareModes ranks the modes by average successful-purchase latency,
+// fastest first; modes with no successful purchases yet go last
+func compareModes() []modeComparison {
+	rows := make([]modeComparison, 0, len(modes))
+	for _, name := range modeNames() {
+		m := modes[name]
+		row := modeComparison{
+			Mode:      name,
+			Requests:  atomic.LoadInt64(&m.requests),
+			Success:   atomic.LoadInt64(&m.success),
+			Oversells: atomic.LoadInt64(&m.oversells),
+		}
+		if row.Requests > 0 {
+			row.SuccessRate = float64(row.Success) / float64(row.Requests)
+		}
+		if row.Success > 0 {
+			row.AvgLatencyMs = float64(atomic.LoadInt64(&m.latencySumUs)) / float64(row.Success) / 1000
+		}
+		samples := m.window.snapshot()
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		row.P95LatencyMs = percentile(samples, 95)
+		row.Safe = row.Oversells == 0
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if (rows[i].Success == 0) != (rows[j].Success == 0) {
+			return rows[i].Success > 0
+		}
+		return rows[i].AvgLatencyMs < rows[j].AvgLatencyMs
+	})
+	return rows
+}
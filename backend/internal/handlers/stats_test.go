@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// msSamples returns 1..n milliseconds as microsecond samples, shuffled
+func msSamples(n int) []int64 {
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = int64(i+1) * 1000
+	}
+	rand.Shuffle(len(samples), func(i, j int) { samples[i], samples[j] = samples[j], samples[i] })
+	return samples
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int64
+		p       float64
+		want    float64
+	}{
+		{"empty", nil, 95, 0},
+		{"single", []int64{7500}, 50, 7.5},
+		{"single p99", []int64{7500}, 99, 7.5},
+		{"p0 is the minimum", []int64{1000, 2000, 3000}, 0, 1},
+		{"p100 is the maximum", []int64{1000, 2000, 3000}, 100, 3},
+		{"nearest rank rounds up", []int64{1000, 2000, 3000, 4000}, 50, 2},
+		{"p95 of 10 is the 10th", msSamples(10), 95, 10},
+	}
+	for _, tt := range tests {
+		sorted := slices.Clone(tt.samples)
+		slices.Sort(sorted)
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("%s: percentile(p%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLatencySummary(t *testing.T) {
+	tests := []struct {
+		name          string
+		samples       []int64
+		n             int
+		p50, p95, p99 float64
+	}{
+		{"empty", nil, 0, 0, 0, 0},
+		{"1..100ms", msSamples(100), 100, 50, 95, 99},
+		{"1..1000ms", msSamples(1000), 1000, 500, 950, 990},
+		{"tail", append(slices.Repeat([]int64{1000}, 95), 500000, 500000, 500000, 500000, 500000), 100, 1, 1, 500},
+	}
+	for _, tt := range tests {
+		got := latencySummary(tt.samples)
+		if got["samples"] != tt.n || got["p50_latency_ms"] != tt.p50 || got["p95_latency_ms"] != tt.p95 || got["p99_latency_ms"] != tt.p99 {
+			t.Errorf("%s: summary = %v, want %d samples, p50 %v, p95 %v, p99 %v", tt.name, got, tt.n, tt.p50, tt.p95, tt.p99)
+		}
+	}
+}
+
+func TestLatencyWindowWrapAround(t *testing.T) {
+	w := newLatencyWindow(3)
+	for ms := 1; ms <= 5; ms++ {
+		w.record(time.Duration(ms) * time.Millisecond)
+	}
+
+	// 1ms and 2ms were overwritten by 4ms and 5ms
+	got := w.snapshot()
+	slices.Sort(got)
+	if !slices.Equal(got, []int64{3000, 4000, 5000}) {
+		t.Fatalf("samples = %v, want the latest three", got)
+	}
+	if s := latencySummary(w.snapshot()); s["p50_latency_ms"] != 4.0 || s["p99_latency_ms"] != 5.0 {
+		t.Fatalf("summary = %v, want p50 4 and p99 5", s)
+	}
+
+	w.reset()
+	if got := w.snapshot(); len(got) != 0 {
+		t.Fatalf("after reset: %v, want no samples", got)
+	}
+	w.record(time.Millisecond)
+	if got := w.snapshot(); !slices.Equal(got, []int64{1000}) {
+		t.Fatalf("after reset and one sample: %v", got)
+	}
+}
+
+func TestGetStatsLatencyByMode(t *testing.T) {
+	ResetStats()
+	t.Cleanup(ResetStats)
+	for ms := 1; ms <= 100; ms++ {
+		recordSuccess(ModeRedisPostgres, 1, time.Duration(ms)*time.Millisecond)
+	}
+	recordSuccess(ModeNaive, -1, 200*time.Millisecond)
+
+	stats := GetStats()
+	redis := stats["latency_by_mode"].(map[string]interface{})[ModeRedisPostgres].(map[string]interface{})
+	if redis["p50_latency_ms"] != 50.0 || redis["p95_latency_ms"] != 95.0 || redis["p99_latency_ms"] != 99.0 {
+		t.Fatalf("redis_postgres latency = %v, want p50 50, p95 95, p99 99", redis)
+	}
+	if stats["p99_latency_ms"] != 100.0 || stats["oversells"] != int64(1) {
+		t.Fatalf("overall p99 = %v, oversells %v; want 100 and 1", stats["p99_latency_ms"], stats["oversells"])
+	}
+}
+
+func TestCompareStats(t *testing.T) {
+	resetStats(t)
+	// naive: fast but oversold; redis: 2ms; postgres_lock: 8ms, one failure
+	for _, d := range []time.Duration{time.Millisecond, time.Millisecond} {
+		countRequest(ModeNaive)
+		recordSuccess(ModeNaive, -1, d)
+	}
+	for range 4 {
+		countRequest(ModeRedisPostgres)
+		recordSuccess(ModeRedisPostgres, 5, 2*time.Millisecond)
+	}
+	countRequest(ModePostgresLock)
+	recordSuccess(ModePostgresLock, 5, 8*time.Millisecond)
+	countRequest(ModePostgresLock)
+	countFailure(ModePostgresLock)
+
+	r := gin.New()
+	r.GET("/stats/compare", CompareStats)
+	rec := serve(r, http.MethodGet, "/stats/compare", "")
+	var body struct {
+		Modes []modeComparison `json:"modes"`
+	}
+	decode(t, rec, &body)
+	if len(body.Modes) != len(modes) {
+		t.Fatalf("%d rows, want one per mode (%d)", len(body.Modes), len(modes))
+	}
+
+	want := []modeComparison{
+		{Mode: ModeNaive, Requests: 2, Success: 2, SuccessRate: 1, Oversells: 2, AvgLatencyMs: 1, P95LatencyMs: 1, Safe: false},
+		{Mode: ModeRedisPostgres, Requests: 4, Success: 4, SuccessRate: 1, AvgLatencyMs: 2, P95LatencyMs: 2, Safe: true},
+		{Mode: ModePostgresLock, Requests: 2, Success: 1, SuccessRate: 0.5, AvgLatencyMs: 8, P95LatencyMs: 8, Safe: true},
+	}
+	for i, w := range want {
+		if body.Modes[i] != w {
+			t.Errorf("row %d = %+v, want %+v", i, body.Modes[i], w)
+		}
+	}
+	// Modes with no sales trail, and count as safe
+	for _, row := range body.Modes[len(want):] {
+		if row.Success != 0 || !row.Safe {
+			t.Errorf("idle mode row = %+v, want no sales and safe", row)
+		}
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	resetStats(t)
+	const held = 4
+	arrived := make(chan struct{})
+	unblock := make(chan struct{})
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+	r.POST("/purchase", InFlight(), func(c *gin.Context) {
+		arrived <- struct{}{}
+		<-unblock
+		if c.Query("panic") == "true" {
+			panic("boom")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+	for i := range held {
+		path := "/purchase"
+		if i == 0 {
+			path += "?panic=true" // a panic must still leave the gauge
+		}
+		wg.Go(func() { serve(r, http.MethodPost, path, "") })
+	}
+	for range held {
+		<-arrived
+	}
+	stats := GetStats()
+	if stats["in_flight"] != int64(held) || stats["max_in_flight"] != int64(held) {
+		t.Fatalf("while held: in_flight %v, max_in_flight %v; want %d and %d",
+			stats["in_flight"], stats["max_in_flight"], held, held)
+	}
+
+	close(unblock)
+	wg.Wait()
+	stats = GetStats()
+	if stats["in_flight"] != int64(0) || stats["max_in_flight"] != int64(held) {
+		t.Fatalf("after: in_flight %v, max_in_flight %v; want 0 and the peak of %d",
+			stats["in_flight"], stats["max_in_flight"], held)
+	}
+
+	// A reset restarts the peak from what is running now
+	ResetStats()
+	if got := GetStats()["max_in_flight"]; got != int64(0) {
+		t.Fatalf("max_in_flight after a reset = %v, want 0", got)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// 📡 LIVE PUSH FOR THE DASHBOARD
+// ============================================
+
+// statsStreamEvery is how often /stats/stream pushes a snapshot
+const statsStreamEvery = time.Second
+
+// StatsStream pushes the GetStats snapshot as a Server-Sent Event every
+// second until the client disconnects, so the dashboard doesn't have to poll.
+// Live hub events (orders, stock changes) are relayed as they happen, named
+// by their "type".
+func StatsStream(c *gin.Context) {
+	client := liveHub.subscribe()
+	if client == nil {
+		respondError(c, http.StatusServiceUnavailable, CodeInternal, "Server is shutting down")
+		return
+	}
+	defer liveHub.unsubscribe(client)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // don't let nginx buffer the stream
+
+	ticker := time.NewTicker(statsStreamEvery)
+	defer ticker.Stop()
+
+	// Send one immediately so the dashboard doesn't start blank
+	c.SSEvent("stats", GetStats())
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			c.SSEvent("stats", GetStats())
+			return true
+		case msg, ok := <-client.send:
+			if !ok {
+				return false // dropped by the hub
+			}
+			var event struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(msg, &event)
+			c.SSEvent(event.Type, string(msg))
+			return true
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startHub swaps in a fresh running event hub for the test
+func startHub(t *testing.T) {
+	t.Helper()
+	prev := liveHub
+	liveHub = newEventHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	go liveHub.run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-liveHub.done
+		liveHub = prev
+	})
+}
+
+// readEvent reads one Server-Sent Event
+func readEvent(t *testing.T, r *bufio.Reader) (name, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if name != "" || data != "" {
+				return name, data
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestStatsStream(t *testing.T) {
+	resetStats(t)
+	startHub(t)
+	recordSuccess(ModePostgresLock, 9, 4*time.Millisecond)
+
+	r := gin.New()
+	r.GET("/stats/stream", StatsStream)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stats/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+
+	// One snapshot straight away, the next on the first tick
+	start := time.Now()
+	for i := range 2 {
+		name, data := readEvent(t, body)
+		var stats struct {
+			Success int64 `json:"success"`
+			ByMode  map[string]struct {
+				Success int64 `json:"success"`
+			} `json:"by_mode"`
+		}
+		if name != "stats" || json.Unmarshal([]byte(data), &stats) != nil {
+			t.Fatalf("event %d = %q %q, want stats JSON", i, name, data)
+		}
+		if stats.Success != 1 || stats.ByMode[ModePostgresLock].Success != 1 {
+			t.Fatalf("event %d = %s, want the one postgres_lock success", i, data)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < statsStreamEvery/2 {
+		t.Fatalf("second snapshot after %s, want about %s", elapsed, statsStreamEvery)
+	}
+
+	// Hub events are relayed under their own type
+	publishOrder(ModeNaive, 7, 1, 1, 1, 9)
+	for {
+		name, data := readEvent(t, body)
+		if name == "stats" {
+			continue
+		}
+		if name != "order_created" || !strings.Contains(data, `"order_id":7`) {
+			t.Fatalf("event = %q %q, want the order", name, data)
+		}
+		break
+	}
+}
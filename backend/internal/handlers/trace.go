@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"flash-sale-backend/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// purchaseTrace times the steps of one purchase. The timers always run (they
+// cost nothing next to a network call); with ?trace=true the breakdown is
+// added to a successful response as "trace", showing where each mode spends
+// its time. Each step is also recorded as an OpenTelemetry span under the
+// request's server span (a no-op unless OTEL_EXPORTER_OTLP_ENDPOINT is set).
+type purchaseTrace struct {
+	on    bool
+	start time.Time
+	c     *gin.Context
+	mode  string
+
+	redis       time.Duration // Lua scripts and other Redis calls
+	dbTx        time.Duration // Postgres work other than the order insert
+	orderInsert time.Duration // INSERT INTO orders
+	sleep       time.Duration // Naive mode's race window, fair mode's wait
+	payment     time.Duration // simulated payment provider
+
+	// Open Postgres transaction span; step spans nest under it while set
+	txCtx  context.Context
+	txSpan trace.Span
+}
+
+func newPurchaseTrace(c *gin.Context, mode string, start time.Time) *purchaseTrace {
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(tracing.PurchaseAttributes(mode, 0)...)
+	return &purchaseTrace{on: c.Query("trace") == "true", start: start, c: c, mode: mode}
+}
+
+// stepName is the span name for one of the step timers
+func (t *purchaseTrace) stepName(step *time.Duration) string {
+	switch step {
+	case &t.redis:
+		return "redis"
+	case &t.orderInsert:
+		return "postgres.insert_order"
+	case &t.sleep:
+		return "wait"
+	case &t.payment:
+		return "payment"
+	default:
+		return "postgres.query"
+	}
+}
+
+// spanOptions are the attributes every purchase span carries
+func (t *purchaseTrace) spanOptions(opts ...trace.SpanStartOption) []trace.SpanStartOption {
+	productID := 0
+	if tag, ok := t.c.Get(ctxPurchase); ok {
+		productID = tag.(purchaseTag).productID
+	}
+	return append(opts, trace.WithAttributes(tracing.PurchaseAttributes(t.mode, productID)...))
+}
+
+// add charges the time since from to one of the step timers, and records the
+// step as a span (inside the open transaction, if any)
+func (t *purchaseTrace) add(step *time.Duration, from time.Time) {
+	now := time.Now()
+	*step += now.Sub(from)
+
+	parent := t.c.Request.Context()
+	if t.txCtx != nil {
+		parent = t.txCtx
+	}
+	_, span := tracing.Tracer().Start(parent, t.stepName(step), t.spanOptions(trace.WithTimestamp(from))...)
+	span.End(trace.WithTimestamp(now))
+}
+
+// beginTx opens the Postgres transaction span, started at from
+func (t *purchaseTrace) beginTx(from time.Time) {
+	t.txCtx, t.txSpan = tracing.Tracer().Start(t.c.Request.Context(), "postgres.tx",
+		t.spanOptions(trace.WithTimestamp(from))...)
+}
+
+// endTx closes the transaction span after a commit
+func (t *purchaseTrace) endTx() {
+	if t.txSpan != nil {
+		t.txSpan.End()
+		t.txCtx, t.txSpan = nil, nil
+	}
+}
+
+// end closes a transaction span left open by a failed purchase; handlers
+// defer it
+func (t *purchaseTrace) end() {
+	if t.txSpan != nil {
+		t.txSpan.SetStatus(codes.Error, "transaction rolled back")
+	}
+	t.endTx()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// attach adds the breakdown to resp when tracing was asked for. other_ms is
+// whatever the steps don't cover: binding, sale-window checks, stats.
+func (t *purchaseTrace) attach(resp gin.H) gin.H {
+	if !t.on {
+		return resp
+	}
+	total := time.Since(t.start)
+	steps := t.redis + t.dbTx + t.orderInsert + t.sleep + t.payment
+	breakdown := gin.H{
+		"redis_ms":        durationMs(t.redis),
+		"db_tx_ms":        durationMs(t.dbTx),
+		"order_insert_ms": durationMs(t.orderInsert),
+		"sleep_ms":        durationMs(t.sleep),
+		"other_ms":        durationMs(max(total-steps, 0)),
+		"total_ms":        durationMs(total),
+	}
+	if t.payment > 0 {
+		breakdown["payment_ms"] = durationMs(t.payment)
+	}
+	resp["trace"] = breakdown
+	return resp
+}
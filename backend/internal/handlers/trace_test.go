@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/testutil"
+	"flash-sale-backend/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// traceBreakdown is the "trace" object of a traced purchase response
+type traceBreakdown struct {
+	RedisMs       *float64 `json:"redis_ms"`
+	DBTxMs        *float64 `json:"db_tx_ms"`
+	OrderInsertMs *float64 `json:"order_insert_ms"`
+	SleepMs       *float64 `json:"sleep_ms"`
+	OtherMs       *float64 `json:"other_ms"`
+	TotalMs       *float64 `json:"total_ms"`
+}
+
+// checkBreakdown fails unless every field is present and the steps add up
+// to the total, give or take rounding to the microsecond
+func checkBreakdown(t *testing.T, b traceBreakdown) {
+	t.Helper()
+	for name, v := range map[string]*float64{
+		"redis_ms": b.RedisMs, "db_tx_ms": b.DBTxMs, "order_insert_ms": b.OrderInsertMs,
+		"sleep_ms": b.SleepMs, "other_ms": b.OtherMs, "total_ms": b.TotalMs,
+	} {
+		if v == nil {
+			t.Fatalf("breakdown has no %s", name)
+		}
+		if *v < 0 {
+			t.Fatalf("%s = %v, want >= 0", name, *v)
+		}
+	}
+	sum := *b.RedisMs + *b.DBTxMs + *b.OrderInsertMs + *b.SleepMs + *b.OtherMs
+	if math.Abs(sum-*b.TotalMs) > 0.01 {
+		t.Fatalf("steps sum to %vms, total_ms = %v", sum, *b.TotalMs)
+	}
+}
+
+func TestPurchaseTraceAttach(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  bool
+	}{
+		{"?trace=true", true},
+		{"?trace=1", false},
+		{"", false},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/purchase"+tc.query, nil)
+		tr := newPurchaseTrace(c, ModeRedisPostgres, time.Now().Add(-20*time.Millisecond))
+		tr.redis = 2 * time.Millisecond
+		tr.dbTx = 5 * time.Millisecond
+		tr.orderInsert = 3 * time.Millisecond
+
+		resp := tr.attach(gin.H{"message": "ok"})
+		breakdown, ok := resp["trace"].(gin.H)
+		if ok != tc.want {
+			t.Fatalf("%q: trace attached = %t, want %t", tc.query, ok, tc.want)
+		}
+		if !ok {
+			continue
+		}
+		if breakdown["redis_ms"] != 2.0 || breakdown["db_tx_ms"] != 5.0 || breakdown["order_insert_ms"] != 3.0 {
+			t.Fatalf("breakdown = %v, want redis 2, db_tx 5, order_insert 3", breakdown)
+		}
+		if _, ok := breakdown["payment_ms"]; ok {
+			t.Fatalf("breakdown = %v, want no payment_ms without a payment step", breakdown)
+		}
+		if total := breakdown["total_ms"].(float64); total < 20 {
+			t.Fatalf("total_ms = %v, want at least 20", total)
+		}
+	}
+}
+
+func TestPurchaseTraceResponse(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Traced", 10)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	for i, m := range saleModes {
+		r := gin.New()
+		r.POST("/purchase", Authenticate(), m.handler)
+		t.Run(m.name, func(t *testing.T) {
+			rec := serve(r, http.MethodPost, "/purchase?trace=true", body, "Authorization", bearer(t, i+1))
+			var res struct {
+				Trace *traceBreakdown `json:"trace"`
+			}
+			decode(t, rec, &res)
+			if rec.Code != http.StatusOK || res.Trace == nil {
+				t.Fatalf("status = %d: %s; want 200 with a trace", rec.Code, rec.Body)
+			}
+			checkBreakdown(t, *res.Trace)
+
+			rec = serve(r, http.MethodPost, "/purchase", body, "Authorization", bearer(t, i+100))
+			res.Trace = nil
+			decode(t, rec, &res)
+			if rec.Code != http.StatusOK || res.Trace != nil {
+				t.Fatalf("untraced: status = %d: %s; want 200 without a trace", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// recordSpans installs a tracer provider that keeps every ended span in
+// memory, restoring the previous one when the test ends
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// spansByName indexes the recorded spans, failing if a name repeats
+func spansByName(t *testing.T, exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	t.Helper()
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		if _, ok := spans[s.Name]; ok {
+			t.Fatalf("more than one %q span", s.Name)
+		}
+		spans[s.Name] = s
+	}
+	return spans
+}
+
+// checkHierarchy fails unless each child span's parent is the named span,
+// and every span but the root carries the purchase attributes
+func checkHierarchy(t *testing.T, spans map[string]tracetest.SpanStub, parents map[string]string, mode string, productID int) {
+	t.Helper()
+	for child, parent := range parents {
+		c, ok := spans[child]
+		if !ok {
+			t.Fatalf("no %q span; got %v", child, keys(spans))
+		}
+		p, ok := spans[parent]
+		if !ok {
+			t.Fatalf("no %q span; got %v", parent, keys(spans))
+		}
+		if c.Parent.SpanID() != p.SpanContext.SpanID() || c.SpanContext.TraceID() != p.SpanContext.TraceID() {
+			t.Fatalf("%q is not a child of %q", child, parent)
+		}
+		attrs := attribute.NewSet(c.Attributes...)
+		if v, _ := attrs.Value("purchase.mode"); v.AsString() != mode {
+			t.Fatalf("%q: purchase.mode = %q, want %q", child, v.AsString(), mode)
+		}
+		if v, _ := attrs.Value("product.id"); v.AsInt64() != int64(productID) {
+			t.Fatalf("%q: product.id = %d, want %d", child, v.AsInt64(), productID)
+		}
+	}
+}
+
+func keys(spans map[string]tracetest.SpanStub) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestPurchaseTraceSpans(t *testing.T) {
+	exporter := recordSpans(t)
+
+	// A stand-in for a purchase handler that runs each step once
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.POST("/purchase", func(c *gin.Context) {
+		c.Set(ctxPurchase, purchaseTag{mode: ModeRedisPostgres, productID: 7})
+		tr := newPurchaseTrace(c, ModeRedisPostgres, time.Now())
+		defer tr.end()
+		tr.add(&tr.redis, time.Now())
+		tr.beginTx(time.Now())
+		tr.add(&tr.dbTx, time.Now())
+		tr.add(&tr.orderInsert, time.Now())
+		tr.endTx()
+		c.Status(http.StatusOK)
+	})
+	serve(r, http.MethodPost, "/purchase", "")
+
+	spans := spansByName(t, exporter)
+	root, ok := spans["POST /purchase"]
+	if !ok || root.Parent.IsValid() {
+		t.Fatalf("want a root POST /purchase span; got %v", keys(spans))
+	}
+	checkHierarchy(t, spans, map[string]string{
+		"redis":                 "POST /purchase",
+		"postgres.tx":           "POST /purchase",
+		"postgres.query":        "postgres.tx",
+		"postgres.insert_order": "postgres.tx",
+	}, ModeRedisPostgres, 7)
+}
+
+func TestPurchaseSpans(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	resetStats(t)
+	productID := testutil.Product(t, "Traced", 10)
+	exporter := recordSpans(t)
+
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.POST("/purchase", Authenticate(), PurchaseRedisPostgres)
+	rec := serve(r, http.MethodPost, "/purchase", fmt.Sprintf(`{"product_id": %d}`, productID),
+		"Authorization", bearer(t, 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s; want 200", rec.Code, rec.Body)
+	}
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		byName[s.Name] = s // repeated step names share a parent, one of each will do
+	}
+	if root, ok := byName["POST /purchase"]; !ok || root.Parent.IsValid() {
+		t.Fatalf("want a root POST /purchase span; got %v", keys(byName))
+	}
+	checkHierarchy(t, byName, map[string]string{
+		"redis":                 "POST /purchase",
+		"postgres.tx":           "POST /purchase",
+		"postgres.insert_order": "postgres.tx",
+	}, ModeRedisPostgres, productID)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Report validation failures by JSON name (user_id) rather than Go name (UserID)
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// bindPurchase decodes a purchase body, sets the buyer to the token's user
+// (see authUserID) and only then runs the binding tags. The buyer never
+// comes from the body.
+func bindPurchase(c *gin.Context, req any, userID *int) error {
+	if c.Request.Body == nil {
+		return errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body is empty")
+		}
+		return err
+	}
+	if *userID = authUserID(c); *userID == 0 {
+		return errors.New("no authenticated user; the route is missing Authenticate")
+	}
+	return binding.Validator.ValidateStruct(req)
+}
+
+// validationDetail turns a bind error into the APIError detail, listing each
+// failing field, e.g. "product_id is required; quantity must be at least 1"
+func validationDetail(err error) string {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err.Error()
+	}
+
+	msgs := make([]string, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		field := fe.Field()
+		switch fe.Tag() {
+		case "required":
+			msgs = append(msgs, field+" is required")
+		case "min":
+			msgs = append(msgs, fmt.Sprintf("%s must be at least %s", field, fe.Param()))
+		case "max":
+			msgs = append(msgs, fmt.Sprintf("%s must be at most %s", field, fe.Param()))
+		case "email":
+			msgs = append(msgs, field+" must be an email address")
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s failed %s", field, fe.Tag()))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindContext is a purchase request with body, authenticated as userID (0 for none)
+func bindContext(body string, userID int) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/purchase", strings.NewReader(body))
+	if userID != 0 {
+		c.Set(ctxUserID, userID)
+	}
+	return c
+}
+
+func TestBindPurchase(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		userID     int
+		detail     string // "" when the bind succeeds
+	}{
+		{"valid", `{"product_id": 1, "quantity": 2}`, 7, ""},
+		{"missing product_id", `{"quantity": 2}`, 7, "product_id is required"},
+		{"zero product_id", `{"product_id": 0}`, 7, "product_id is required"},
+		{"negative product_id", `{"product_id": -4}`, 7, "product_id must be at least 1"},
+		{"every failing field", `{"product_id": -4, "quantity": 101}`, 7,
+			"product_id must be at least 1; quantity must be at most 100"},
+		{"zero user_id", `{"product_id": 1}`, 0, "no authenticated user"},
+		{"empty body", ``, 7, "request body is empty"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var req PurchaseRequest
+			err := bindPurchase(bindContext(tc.body, tc.userID), &req, &req.UserID)
+			if tc.detail == "" {
+				if err != nil || req.UserID != tc.userID {
+					t.Fatalf("err = %v, user %d; want user %d", err, req.UserID, tc.userID)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(validationDetail(err), tc.detail) {
+				t.Fatalf("err = %v (detail %q), want %q", err, validationDetail(err), tc.detail)
+			}
+		})
+	}
+}
+
+func TestBindPurchaseIgnoresBodyUserID(t *testing.T) {
+	var req PurchaseRequest
+	err := bindPurchase(bindContext(`{"product_id": 1, "user_id": 99}`, 7), &req, &req.UserID)
+	if err != nil || req.UserID != 7 {
+		t.Fatalf("err = %v, user %d; the buyer must come from the token (7), not the body", err, req.UserID)
+	}
+}
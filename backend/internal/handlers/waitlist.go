@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 📋 WAITLIST
+// ============================================
+// A buyer who finds a product sold out can join its waitlist, a Redis list in
+// arrival order. When an admin restocks the product, one waitlisted user per
+// unit added is popped off the front and told it's their turn with a
+// WaitlistEvent on the stock channel, so every instance's /ws/orders clients
+// hear it. Being told is not a reservation: they still have to buy.
+
+// WaitlistRequest is the body of POST /waitlist; UserID comes from the
+// Bearer token
+type WaitlistRequest struct {
+	UserID    int `json:"-"`
+	ProductID int `json:"product_id" binding:"required,min=1"`
+}
+
+// WaitlistEvent tells a waitlisted user that stock came back
+type WaitlistEvent struct {
+	Type      string `json:"type"`
+	ProductID int    `json:"product_id"`
+	UserID    int    `json:"user_id"`
+	Stock     int    `json:"stock"`
+}
+
+// waitlistKey is the product's waitlist, user ids oldest first
+func waitlistKey(productID int) string {
+	return database.Key("product", strconv.Itoa(productID), "waitlist")
+}
+
+// joinWaitlistScript appends the user unless they're already waiting, and
+// returns their 1-based position either way.
+// KEYS[1] = waitlist, ARGV[1] = user id
+var joinWaitlistScript = redis.NewScript(`
+	local pos = redis.call('LPOS', KEYS[1], ARGV[1])
+	if pos then
+		return pos + 1
+	end
+	return redis.call('RPUSH', KEYS[1], ARGV[1])
+`)
+
+// JoinWaitlist puts the user on a sold-out product's waitlist and returns
+// their position. Joining twice keeps the original place.
+func JoinWaitlist(c *gin.Context) {
+	var req WaitlistRequest
+	if err := bindPurchase(c, &req, &req.UserID); err != nil {
+		respondErrorDetail(c, http.StatusBadRequest, CodeInvalidInput, "Invalid input", validationDetail(err))
+		return
+	}
+
+	var stock int
+	err := database.DB.QueryRow(c, "SELECT quantity FROM products WHERE id=$1", req.ProductID).Scan(&stock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeDBError, "Failed to load product")
+		return
+	}
+	// Redis is the live count; PostgreSQL stands in when it can't answer
+	if live, err := database.GetStock(c, req.ProductID); err == nil {
+		stock = live
+	}
+	if stock > 0 {
+		respondErrorDetail(c, http.StatusConflict, CodeInStock, "Product is in stock, buy it instead",
+			strconv.Itoa(stock)+" left")
+		return
+	}
+
+	position, err := joinWaitlistScript.Run(c, database.Rdb, []string{waitlistKey(req.ProductID)}, req.UserID).Int()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeRedisError, "Failed to join the waitlist")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "You're on the waitlist",
+		"user_id":    req.UserID,
+		"product_id": req.ProductID,
+		"position":   position,
+	})
+}
+
+// notifyWaitlist pops up to n users off the product's waitlist and publishes
+// a WaitlistEvent for each, returning who was notified
+func notifyWaitlist(ctx context.Context, productID, n, stock int) []int {
+	if n <= 0 {
+		return nil
+	}
+	popped, err := database.Rdb.LPopCount(ctx, waitlistKey(productID), n).Result()
+	if err != nil {
+		if err != redis.Nil {
+			slog.Warn("⚠️ Failed to pop the waitlist", "product_id", productID, "error", err)
+		}
+		return nil
+	}
+
+	notified := make([]int, 0, len(popped))
+	for _, member := range popped {
+		userID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		msg, err := json.Marshal(WaitlistEvent{Type: "waitlist_turn", ProductID: productID, UserID: userID, Stock: stock})
+		if err != nil {
+			continue
+		}
+		if err := database.Rdb.Publish(ctx, stockChannel, msg).Err(); err != nil {
+			slog.Warn("⚠️ Failed to notify waitlisted user", "user_id", userID, "product_id", productID, "error", err)
+		}
+		notified = append(notified, userID)
+	}
+	return notified
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/testutil"
+)
+
+// waitlistEvents collects the waitlist_turn events published while the test runs
+func waitlistEvents(t testing.TB) <-chan WaitlistEvent {
+	t.Helper()
+	sub := database.Rdb.Subscribe(t.Context(), stockChannel)
+	if _, err := sub.Receive(t.Context()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	t.Cleanup(func() { sub.Close() })
+
+	events := make(chan WaitlistEvent, 16)
+	go func() {
+		for msg := range sub.Channel() {
+			var ev WaitlistEvent
+			if json.Unmarshal([]byte(msg.Payload), &ev) == nil && ev.Type == "waitlist_turn" {
+				events <- ev
+			}
+		}
+	}()
+	return events
+}
+
+func nextWaitlistEvent(t testing.TB, events <-chan WaitlistEvent) WaitlistEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no waitlist_turn event")
+		return WaitlistEvent{}
+	}
+}
+
+func TestNotifyWaitlist(t *testing.T) {
+	mr := testutil.Redis(t)
+	events := waitlistEvents(t)
+	for _, userID := range []string{"7", "8", "9"} {
+		mr.RPush(waitlistKey(1), userID)
+	}
+
+	if got := notifyWaitlist(t.Context(), 1, 1, 1); !slices.Equal(got, []int{7}) {
+		t.Fatalf("notified %v, want the head user 7", got)
+	}
+	if ev := nextWaitlistEvent(t, events); ev != (WaitlistEvent{"waitlist_turn", 1, 7, 1}) {
+		t.Fatalf("event = %+v, want user 7's turn on product 1", ev)
+	}
+	if left, _ := mr.List(waitlistKey(1)); !slices.Equal(left, []string{"8", "9"}) {
+		t.Fatalf("waitlist = %v, want [8 9]", left)
+	}
+
+	if got := notifyWaitlist(t.Context(), 2, 3, 3); len(got) != 0 {
+		t.Fatalf("empty waitlist notified %v", got)
+	}
+}
+
+func TestWaitlist(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	r := adminRouter(t)
+	r.POST("/waitlist", Authenticate(), JoinWaitlist)
+	events := waitlistEvents(t)
+	productID := testutil.Product(t, "Sold Out", 0)
+	body := fmt.Sprintf(`{"product_id": %d}`, productID)
+
+	join := func(userID int) (int, int) {
+		t.Helper()
+		rec := serve(r, http.MethodPost, "/waitlist", body, "Authorization", bearer(t, userID))
+		var resp struct {
+			Position int `json:"position"`
+		}
+		decode(t, rec, &resp)
+		return rec.Code, resp.Position
+	}
+	for i, userID := range []int{1, 2, 3} {
+		if code, position := join(userID); code != http.StatusOK || position != i+1 {
+			t.Fatalf("user %d: status = %d, position %d; want 200 at %d", userID, code, position, i+1)
+		}
+	}
+	if code, position := join(1); code != http.StatusOK || position != 1 {
+		t.Fatalf("joining twice: status = %d, position %d; want the original place 1", code, position)
+	}
+
+	rec := serve(r, http.MethodPost, fmt.Sprintf("/admin/products/%d/stock", productID), `{"delta": 1}`, AdminTokenHeader, "secret")
+	var resp struct {
+		Notified []int `json:"waitlist_notified"`
+	}
+	decode(t, rec, &resp)
+	if rec.Code != http.StatusOK || !slices.Equal(resp.Notified, []int{1}) {
+		t.Fatalf("restock: status = %d: %s; want user 1 notified", rec.Code, rec.Body)
+	}
+	if ev := nextWaitlistEvent(t, events); ev.UserID != 1 || ev.ProductID != productID || ev.Stock != 1 {
+		t.Fatalf("event = %+v, want user 1's turn with 1 in stock", ev)
+	}
+	if left, _ := mr.List(waitlistKey(productID)); !slices.Equal(left, []string{"2", "3"}) {
+		t.Fatalf("waitlist = %v, want [2 3]", left)
+	}
+
+	rec = serve(r, http.MethodPost, "/waitlist", body, "Authorization", bearer(t, 4))
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Code != CodeInStock {
+		t.Fatalf("in stock: status = %d: %s; want 409 %s", rec.Code, rec.Body, CodeInStock)
+	}
+}
@@ -0,0 +1,135 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+)
+
+// ProductDrift compares one product's Redis stock with its Postgres quantity
+type ProductDrift struct {
+	ProductID  int  `json:"product_id"`
+	DBQuantity int  `json:"db_quantity"`
+	RedisStock *int `json:"redis_stock"` // nil when the key is missing
+	Delta      int  `json:"delta"`       // redis - db
+	Drifted    bool `json:"drifted"`
+	Healed     bool `json:"healed"`
+}
+
+// Result is the outcome of one reconciliation pass
+type Result struct {
+	RanAt      time.Time      `json:"ran_at"`
+	Products   []ProductDrift `json:"products"`
+	DriftCount int            `json:"drift_count"`
+	Error      string         `json:"error,omitempty"`
+}
+
+var (
+	mu   sync.RWMutex
+	last *Result
+)
+
+// LastResult returns the most recent pass, or nil if none has run yet
+func LastResult() *Result {
+	mu.RLock()
+	defer mu.RUnlock()
+	return last
+}
+
+// Run reconciles every RECONCILE_INTERVAL_SEC seconds (default 30, 0 disables)
+// until ctx is cancelled. With AUTO_HEAL=true drifted Redis keys are reset to
+// the Postgres value.
+func Run(ctx context.Context) {
+	interval := time.Duration(config.Int("RECONCILE_INTERVAL_SEC", 30)) * time.Second
+	if interval <= 0 {
+		slog.Info("ℹ️ Reconciliation job disabled")
+		return
+	}
+	autoHeal := config.Bool("AUTO_HEAL", false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			RunOnce(ctx, autoHeal)
+		}
+	}
+}
+
+// RunOnce compares every product's Redis stock to Postgres and records the result.
+// NOTE: purchases in flight decrement Redis before Postgres commits, so a
+// small transient delta under load is expected; persistent drift is the signal.
+func RunOnce(ctx context.Context, autoHeal bool) *Result {
+	result := &Result{RanAt: time.Now()}
+	defer func() {
+		mu.Lock()
+		last = result
+		mu.Unlock()
+	}()
+
+	rows, err := database.DB.Query(ctx, "SELECT id, quantity FROM products ORDER BY id")
+	if err != nil {
+		result.Error = fmt.Sprintf("load products: %v", err)
+		slog.Warn("⚠️ Reconcile failed", "error", result.Error)
+		return result
+	}
+	for rows.Next() {
+		var p ProductDrift
+		if err := rows.Scan(&p.ProductID, &p.DBQuantity); err != nil {
+			continue
+		}
+		result.Products = append(result.Products, p)
+	}
+	rows.Close()
+	if len(result.Products) == 0 {
+		return result
+	}
+
+	keys := make([]string, len(result.Products))
+	for i, p := range result.Products {
+		keys[i] = database.StockKey(p.ProductID)
+	}
+	values, err := database.Rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		result.Error = fmt.Sprintf("read redis stock: %v", err)
+		slog.Warn("⚠️ Reconcile failed", "error", result.Error)
+		return result
+	}
+
+	for i := range result.Products {
+		p := &result.Products[i]
+		if s, ok := values[i].(string); ok {
+			if stock, err := strconv.Atoi(s); err == nil {
+				p.RedisStock = &stock
+				p.Delta = stock - p.DBQuantity
+			}
+		}
+		p.Drifted = p.RedisStock == nil || p.Delta != 0
+		if !p.Drifted {
+			continue
+		}
+
+		result.DriftCount++
+		slog.Warn("⚠️ Stock drift between Redis and PostgreSQL", "product_id", p.ProductID, "redis", values[i], "db", p.DBQuantity)
+
+		if autoHeal {
+			// Same rule as /sync-redis: never seed Redis with negative stock
+			healed := max(p.DBQuantity, 0)
+			if err := database.Rdb.Set(ctx, keys[i], healed, 0).Err(); err == nil {
+				p.Healed = true
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,73 @@
+package reconcile_test
+
+import (
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/reconcile"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestRunOnceReportsDrift(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	inSync := testutil.Product(t, "In sync", 10)
+	drifted := testutil.Product(t, "Drifted", 10)
+	missing := testutil.Product(t, "Missing", 10)
+	mr.Set(database.StockKey(drifted), "7") // e.g. a compensating INCR that failed
+	mr.Del(database.StockKey(missing))
+
+	result := reconcile.RunOnce(t.Context(), false)
+	if result.Error != "" || result.DriftCount != 2 || len(result.Products) != 3 {
+		t.Fatalf("result = %+v, want 2 of 3 products drifted", result)
+	}
+	byID := map[int]reconcile.ProductDrift{}
+	for _, p := range result.Products {
+		byID[p.ProductID] = p
+	}
+	if p := byID[inSync]; p.Drifted || p.Delta != 0 || p.RedisStock == nil || *p.RedisStock != 10 {
+		t.Fatalf("in-sync product = %+v", p)
+	}
+	if p := byID[drifted]; !p.Drifted || p.Delta != -3 || p.DBQuantity != 10 || p.Healed {
+		t.Fatalf("drifted product = %+v, want delta -3, not healed", p)
+	}
+	if p := byID[missing]; !p.Drifted || p.RedisStock != nil {
+		t.Fatalf("product without a key = %+v, want drifted with no Redis stock", p)
+	}
+	if got, _ := mr.Get(database.StockKey(drifted)); got != "7" {
+		t.Fatalf("Redis stock = %s; without AUTO_HEAL it must be left alone", got)
+	}
+	if reconcile.LastResult() != result {
+		t.Fatal("LastResult doesn't return the latest pass")
+	}
+}
+
+func TestRunOnceAutoHeal(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	drifted := testutil.Product(t, "Drifted", 10)
+	oversold := testutil.Product(t, "Oversold", 0)
+	mr.Set(database.StockKey(drifted), "7")
+	if _, err := database.DB.Exec(t.Context(), "UPDATE products SET quantity=-2 WHERE id=$1", oversold); err != nil {
+		t.Fatal(err)
+	}
+
+	result := reconcile.RunOnce(t.Context(), true)
+	for _, p := range result.Products {
+		if !p.Healed {
+			t.Fatalf("product %d not healed: %+v", p.ProductID, p)
+		}
+	}
+	if got, _ := mr.Get(database.StockKey(drifted)); got != "10" {
+		t.Fatalf("healed stock = %s, want the DB's 10", got)
+	}
+	// Negative DB quantities (Naive oversells) heal to 0, never below
+	if got, _ := mr.Get(database.StockKey(oversold)); got != "0" {
+		t.Fatalf("healed stock of an oversold product = %s, want 0", got)
+	}
+
+	if again := reconcile.RunOnce(t.Context(), false); again.DriftCount != 1 {
+		// The oversold product still differs (0 vs -2); the other is fixed
+		t.Fatalf("after healing: %d drifted, want 1", again.DriftCount)
+	}
+}
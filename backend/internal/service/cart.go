@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================
+// 🛒 CART: several products in one atomic purchase
+// ============================================
+// ReserveCart holds every item in Redis with one Lua script, all or nothing;
+// PersistCart then takes the stock and records one order per item in a single
+// Postgres transaction, releasing the whole reservation if it fails.
+
+// CartItem is one product of a cart. ReserveCart expects each product once.
+type CartItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// CartItemError names the cart item a reservation failed on. Err is
+// ErrSoldOut, a *UserLimitError, ErrNotSeeded or ErrProductNotFound.
+type CartItemError struct {
+	ProductID int
+	Err       error
+}
+
+func (e *CartItemError) Error() string {
+	return fmt.Sprintf("product %d: %v", e.ProductID, e.Err)
+}
+
+func (e *CartItemError) Unwrap() error {
+	return e.Err
+}
+
+// CartReservation is a whole cart held in Redis until it is persisted or
+// released
+type CartReservation struct {
+	UserID int
+	Items  []CartItem
+}
+
+// CartResult is a persisted cart: one order per item, in the cart's order
+type CartResult struct {
+	OrderIDs  []int
+	Remaining []int // Postgres stock left per item
+}
+
+// LowestRemaining is the smallest stock left across the cart; below zero
+// means an item was oversold
+func (r CartResult) LowestRemaining() int {
+	return slices.Min(r.Remaining)
+}
+
+// ReserveCart reserves every item's stock and allowance, or none of them. A
+// missing stock key is seeded (see SeedStock) and the cart tried once more.
+// An item refused on its merits comes back as a *CartItemError.
+func (s PurchaseService) ReserveCart(ctx context.Context, userID int, items []CartItem) (CartReservation, error) {
+	r := CartReservation{UserID: userID, Items: items}
+	limits := make(map[int]int, len(items))
+	for _, item := range items {
+		limits[item.ProductID] = UserLimit(ctx, item.ProductID)
+	}
+	keys, args := cartScriptArgs(userID, items, limits)
+
+	step := time.Now()
+	res, err := ReserveCartScript.Run(ctx, database.Rdb, keys, args...).Int64Slice()
+	if err == nil && len(res) == 2 && res[0] == LuaNotSeeded {
+		missing := int(res[1])
+		seeded, seedErr := SeedStock(ctx, missing)
+		if !seeded {
+			return r, &CartItemError{ProductID: missing, Err: notSeededError(seedErr)}
+		}
+		res, err = ReserveCartScript.Run(ctx, database.Rdb, keys, args...).Int64Slice()
+	}
+	s.obs().Redis(step)
+	if err != nil {
+		return r, err
+	}
+	if len(res) != 2 {
+		return r, fmt.Errorf("reserve cart: unexpected reply %v", res)
+	}
+
+	productID := int(res[1])
+	switch res[0] {
+	case LuaSoldOut:
+		return r, &CartItemError{ProductID: productID, Err: ErrSoldOut}
+	case LuaUserLimit:
+		return r, &CartItemError{ProductID: productID, Err: &UserLimitError{Limit: limits[productID]}}
+	case LuaNotSeeded:
+		return r, &CartItemError{ProductID: productID, Err: ErrNotSeeded}
+	}
+	return r, nil
+}
+
+// cartScriptArgs lays out ReserveCartScript's keys and arguments
+func cartScriptArgs(userID int, items []CartItem, limits map[int]int) ([]string, []interface{}) {
+	keys := make([]string, 0, 2*len(items))
+	args := make([]interface{}, 0, 3*len(items))
+	for _, item := range items {
+		keys = append(keys, database.StockKey(item.ProductID))
+		args = append(args, item.Quantity)
+	}
+	for _, item := range items {
+		keys = append(keys, database.UserPurchaseKey(userID, item.ProductID))
+		args = append(args, limits[item.ProductID])
+	}
+	for _, item := range items {
+		args = append(args, item.ProductID)
+	}
+	return keys, args
+}
+
+// Release hands the whole cart back to Redis when the Postgres step fails.
+// Each command that fails is dead-lettered (RecordCompensationFailure).
+func (r CartReservation) Release() {
+	pipe := database.Rdb.Pipeline()
+	type undo struct {
+		productID int
+		key       string
+		delta     int64
+		cmd       *redis.IntCmd
+	}
+	var undos []undo
+	for _, item := range r.Items {
+		for _, u := range []undo{
+			{productID: item.ProductID, key: database.StockKey(item.ProductID), delta: int64(item.Quantity)},
+			{productID: item.ProductID, key: database.UserPurchaseKey(r.UserID, item.ProductID), delta: -int64(item.Quantity)},
+		} {
+			u.cmd = pipe.IncrBy(context.Background(), u.key, u.delta)
+			undos = append(undos, u)
+		}
+	}
+	pipe.Exec(context.Background()) // per-command errors are checked below
+	for _, u := range undos {
+		if err := u.cmd.Err(); err != nil {
+			RecordCompensationFailure(u.productID, r.UserID, u.key, u.delta, err)
+		}
+	}
+}
+
+// PersistCart takes every item's stock and records its order in one
+// transaction. On any failure the whole reservation is released and a
+// *StepError returned.
+func (s PurchaseService) PersistCart(ctx context.Context, r CartReservation) (res CartResult, err error) {
+	defer func() {
+		if err != nil {
+			r.Release()
+		}
+	}()
+
+	s.obs().BeginTx(time.Now())
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return res, &StepError{StepBegin, err}
+	}
+	defer tx.Rollback(context.Background()) // still runs if ctx expired
+
+	res.OrderIDs = make([]int, 0, len(r.Items))
+	res.Remaining = make([]int, 0, len(r.Items))
+	for _, item := range r.Items {
+		var remaining int
+		err = tx.QueryRow(ctx,
+			"UPDATE products SET quantity = quantity - $1 WHERE id=$2 RETURNING quantity",
+			item.Quantity, item.ProductID).Scan(&remaining)
+		if err != nil {
+			return res, &StepError{StepUpdateStock, fmt.Errorf("product %d: %w", item.ProductID, err)}
+		}
+
+		var orderID int
+		step := time.Now()
+		orderID, err = InsertOrder(ctx, tx, r.UserID, item.ProductID, item.Quantity, OrderStatusSuccess)
+		s.obs().InsertOrder(step)
+		if err != nil {
+			return res, &StepError{StepInsertOrder, err}
+		}
+		res.OrderIDs = append(res.OrderIDs, orderID)
+		res.Remaining = append(res.Remaining, remaining)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, &StepError{StepCommit, err}
+	}
+	s.obs().EndTx()
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestReserveCartSoldOut(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	plenty := testutil.Product(t, "Plenty", 10)
+	scarce := testutil.Product(t, "Scarce", 1)
+
+	_, err := service.PurchaseService{}.ReserveCart(t.Context(), 1, []service.CartItem{
+		{ProductID: plenty, Quantity: 2},
+		{ProductID: scarce, Quantity: 2},
+	})
+	var itemErr *service.CartItemError
+	if !errors.As(err, &itemErr) || itemErr.ProductID != scarce || !errors.Is(err, service.ErrSoldOut) {
+		t.Fatalf("err = %v, want product %d sold out", err, scarce)
+	}
+	if got, _ := mr.Get(database.StockKey(plenty)); got != "10" {
+		t.Fatalf("first item's stock = %s, want it untouched at 10", got)
+	}
+}
+
+func TestCartSuccess(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	a := testutil.Product(t, "A", 10)
+	b := testutil.Product(t, "B", 1)
+
+	svc := service.PurchaseService{}
+	cart, err := svc.ReserveCart(t.Context(), 1, []service.CartItem{{ProductID: a, Quantity: 2}, {ProductID: b, Quantity: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.PersistCart(t.Context(), cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.OrderIDs) != 2 || !slices.Equal(res.Remaining, []int{8, 0}) || res.LowestRemaining() != 0 {
+		t.Fatalf("result = %+v, want two orders leaving 8 and 0", res)
+	}
+	if got, _ := mr.Get(database.StockKey(a)); got != "8" {
+		t.Fatalf("Redis stock of A = %s, want 8", got)
+	}
+	if got := testutil.Quantity(t, b); got != 0 {
+		t.Fatalf("PostgreSQL quantity of B = %d, want 0", got)
+	}
+}
+
+func TestPersistCartFailureReleases(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "A", 10)
+
+	svc := service.PurchaseService{}
+	cart, err := svc.ReserveCart(t.Context(), 1, []service.CartItem{{ProductID: productID, Quantity: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Postgres sold the stock elsewhere; the CHECK constraint rejects ours
+	if _, err := database.DB.Exec(t.Context(), "UPDATE products SET quantity=0 WHERE id=$1", productID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = svc.PersistCart(t.Context(), cart)
+	var stepErr *service.StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != service.StepUpdateStock {
+		t.Fatalf("err = %v, want an update_stock StepError", err)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "10" {
+		t.Fatalf("Redis stock = %s, want the reservation released (10)", got)
+	}
+	if got, _ := mr.Get(database.UserPurchaseKey(1, productID)); got != "0" {
+		t.Fatalf("user counter = %s, want 0", got)
+	}
+}
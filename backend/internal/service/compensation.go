@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"flash-sale-backend/internal/database"
+)
+
+// deadLetterTimeout bounds the dead-letter insert; it runs after the request
+// context may already be gone
+const deadLetterTimeout = 2 * time.Second
+
+// RecordCompensationFailure is called when undoing a reservation in Redis
+// fails: adding delta to key never happened, so the key has drifted. It is
+// logged and written to compensation_failures, where the reconcile job (for
+// stock keys) or an operator can put it right.
+func RecordCompensationFailure(productID, userID int, key string, delta int64, err error) {
+	slog.Error("🚨 Redis compensation failed, key has drifted",
+		"product_id", productID, "user_id", userID, "key", key, "delta", delta, "error", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	_, dbErr := database.DB.Exec(ctx,
+		"INSERT INTO compensation_failures (product_id, user_id, redis_key, delta, error) VALUES ($1, $2, $3, $4, $5)",
+		productID, userID, key, delta, err.Error())
+	if dbErr != nil {
+		slog.Error("❌ Failed to record compensation failure",
+			"product_id", productID, "key", key, "delta", delta, "error", dbErr)
+	}
+}
@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+// deadLetter is a compensation_failures row
+type deadLetter struct {
+	productID, userID int
+	key               string
+	delta             int64
+	err               string
+}
+
+func deadLetters(t *testing.T) []deadLetter {
+	t.Helper()
+	rows, err := database.DB.Query(t.Context(),
+		"SELECT product_id, user_id, redis_key, delta, error FROM compensation_failures ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []deadLetter
+	for rows.Next() {
+		var d deadLetter
+		if err := rows.Scan(&d.productID, &d.userID, &d.key, &d.delta, &d.err); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFailedCompensationIsDeadLettered(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	svc := service.PurchaseService{}
+	r, err := svc.Reserve(t.Context(), 1, productID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Postgres fails, and so does Redis when the reservation is handed back
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := svc.Persist(ctx, r, true); err == nil {
+		t.Fatal("Persist succeeded with a cancelled context")
+	}
+	mr.SetError("")
+
+	got := deadLetters(t)
+	want := []deadLetter{
+		{productID, 1, database.StockKey(productID), 2, ""},
+		{productID, 1, database.UserPurchaseKey(1, productID), -2, ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("dead letters = %+v, want %d", got, len(want))
+	}
+	for i := range want {
+		if got[i].err == "" {
+			t.Fatalf("dead letter %+v has no error", got[i])
+		}
+		got[i].err = ""
+		if got[i] != want[i] {
+			t.Fatalf("dead letter %d = %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+
+	// Redis still holds the reservation: the drift the dead letter describes
+	if stock, _ := mr.Get(database.StockKey(productID)); stock != "8" {
+		t.Fatalf("Redis stock = %s, want 8", stock)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("quantity = %d, want 10", got)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================
+// 🎫 FAIR MODE: first come, first served
+// ============================================
+// ReserveFair adds the buyer to a per-product sorted set scored by arrival
+// time, waits FairWindow, then settles arrivals strictly by score: the
+// earliest ones get the stock, the rest are sold out. The reservation it
+// returns is persisted like Mode 3's (Persist).
+
+// FairWindow is how long an arrival waits before it is settled, so one that
+// arrived first but reached Redis late still takes its place in line
+var FairWindow = time.Duration(config.Int("FAIR_WINDOW_MS", 20)) * time.Millisecond
+
+// fairOutcomeTTL keeps unclaimed outcomes (the request gave up) from piling up
+const fairOutcomeTTL = 60 // seconds
+
+// ErrPlaceLost is an arrival whose place in line vanished before it was
+// settled, e.g. /reset mid-request
+var ErrPlaceLost = errors.New("place in line was lost")
+
+// FairKeys returns a product's arrivals sorted set, outcome hash and rank
+// counter
+func FairKeys(productID int) (arrivals, outcomes, rank string) {
+	id := strconv.Itoa(productID)
+	return database.Key("fair", id, "arrivals"), database.Key("fair", id, "outcomes"), database.Key("fair", id, "rank")
+}
+
+// FairReservation is one unit granted in arrival order
+type FairReservation struct {
+	Reservation
+	Rank int64 // 1 for the first buyer served, 2 for the next, ...
+}
+
+// ReserveFair queues one unit for the buyer, arrived at the given time, and
+// settles the line once FairWindow has passed. As in Reserve, a product
+// Postgres doesn't have is ErrProductNotFound before it joins the line, and a
+// missing stock key is seeded (see SeedStock) before joining and again if it
+// expired while waiting. Joining counts the unit
+// against the per-user limit; a buyer who doesn't get one has it handed
+// back, and one who gives up (ctx done) puts back a unit another request's
+// settle may already have granted them.
+func (s PurchaseService) ReserveFair(ctx context.Context, userID, productID int, arrived time.Time) (FairReservation, error) {
+	r := FairReservation{Reservation: Reservation{UserID: userID, ProductID: productID, Quantity: 1}}
+	arrivals, outcomes, rankKey := FairKeys(productID)
+	stockKey := database.StockKey(productID)
+	userKey := database.UserPurchaseKey(userID, productID)
+	member := rand.Text()
+
+	limit := MaxPerUser
+	rules, err := loadProductRules(ctx, productID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return r, ErrProductNotFound
+	case err == nil:
+		limit = rules.userLimit()
+	}
+	if exists, err := database.Rdb.Exists(ctx, stockKey).Result(); err == nil && exists == 0 {
+		if seeded, err := SeedStock(ctx, productID); !seeded {
+			return r, notSeededError(err)
+		}
+	}
+
+	// 📥 Take a place in line, within the per-user limit
+	step := time.Now()
+	joined, err := JoinFairScript.Run(ctx, database.Rdb, []string{userKey, arrivals}, limit, arrived.UnixMicro(), member).Int64()
+	s.obs().Redis(step)
+	if err != nil {
+		return r, err
+	}
+	if joined == LuaUserLimit {
+		return r, &UserLimitError{Limit: limit}
+	}
+
+	// leave steps out of line, putting back a unit already granted to us
+	leave := func() {
+		err := LeaveFairScript.Run(context.Background(), database.Rdb,
+			[]string{arrivals, outcomes, stockKey, userKey}, member).Err()
+		if err != nil {
+			slog.Warn("⚠️ Failed to leave the fair line, stock or allowance may be held", "product_id", productID, "user_id", userID, "error", err)
+		}
+	}
+	// giveBack returns the allowance of a buyer who got no unit
+	giveBack := func() {
+		if err := database.Rdb.Decr(context.Background(), userKey).Err(); err != nil {
+			RecordCompensationFailure(productID, userID, userKey, -1, err)
+		}
+	}
+
+	// ⏳ Let earlier arrivals that are still in flight catch up
+	step = time.Now()
+	select {
+	case <-time.After(time.Until(arrived.Add(FairWindow))):
+	case <-ctx.Done():
+		leave()
+		return r, ctx.Err()
+	}
+	s.obs().Wait(step)
+
+	// ⚖️ Settle everyone who arrived up to now, earliest first. Another
+	// request's settle may already have decided ours; either way the outcome
+	// is waiting in the hash.
+	cutoff := time.Now().Add(-FairWindow).UnixMicro()
+	settle := func() (int64, error) {
+		return SettleFairScript.Run(ctx, database.Rdb,
+			[]string{arrivals, stockKey, outcomes, rankKey},
+			max(cutoff, arrived.UnixMicro()), member, fairOutcomeTTL).Int64()
+	}
+	step = time.Now()
+	rank, err := settle()
+	if err == nil && rank == LuaNotSeeded {
+		// The key expired while we waited; reload it and settle again
+		var seeded bool
+		seeded, err = SeedStock(ctx, productID)
+		if !seeded {
+			s.obs().Redis(step)
+			leave()
+			return r, notSeededError(err)
+		}
+		rank, err = settle()
+	}
+	s.obs().Redis(step)
+	if err != nil {
+		// The settle may or may not have run; leave undoes either
+		leave()
+		return r, err
+	}
+	switch rank {
+	case FairSoldOut:
+		giveBack()
+		return r, ErrSoldOut
+	case LuaNotSeeded:
+		leave()
+		return r, ErrNotSeeded
+	case FairPending:
+		// Only reachable if our own member vanished
+		giveBack()
+		return r, ErrPlaceLost
+	}
+	r.Rank = rank
+	return r, nil
+}
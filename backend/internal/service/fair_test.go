@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestReserveFairArrivalOrder(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Fair", 2)
+
+	// Started latest-arrival first: the arrival time decides, not who
+	// reaches Redis first
+	base := time.Now()
+	arrivals := []struct {
+		userID int
+		at     time.Duration
+	}{{3, 30 * time.Microsecond}, {1, 10 * time.Microsecond}, {2, 20 * time.Microsecond}}
+
+	var wg sync.WaitGroup
+	ranks := make(map[int]int64)
+	errs := make(map[int]error)
+	var mu sync.Mutex
+	for _, a := range arrivals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := service.PurchaseService{}.ReserveFair(t.Context(), a.userID, productID, base.Add(a.at))
+			mu.Lock()
+			ranks[a.userID], errs[a.userID] = r.Rank, err
+			mu.Unlock()
+		}()
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+
+	if ranks[1] != 1 || ranks[2] != 2 {
+		t.Fatalf("ranks = %v, want user 1 first and user 2 second", ranks)
+	}
+	if !errors.Is(errs[3], service.ErrSoldOut) {
+		t.Fatalf("latest arrival: err = %v, want ErrSoldOut", errs[3])
+	}
+	if got, _ := mr.Get(database.UserPurchaseKey(3, productID)); got != "0" {
+		t.Fatalf("sold-out buyer's counter = %s, want the allowance back (0)", got)
+	}
+}
+
+func TestReserveFairTimeoutLeavesLine(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Fair", 5)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err := service.PurchaseService{}.ReserveFair(ctx, 1, productID, time.Now())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	arrivals, _, _ := service.FairKeys(productID)
+	if mr.Exists(arrivals) {
+		t.Fatal("the request is still in line")
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "5" {
+		t.Fatalf("stock = %s, want 5", got)
+	}
+	if got, _ := mr.Get(database.UserPurchaseKey(1, productID)); got != "0" {
+		t.Fatalf("user counter = %s, want 0", got)
+	}
+}
+
+func TestReserveFairUnknownProduct(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Fair", 5) + 1
+	service.ForgetProductRules(productID) // ids restart per test; drop rules cached under this one
+	prev := service.FairWindow
+	service.FairWindow = time.Minute
+	t.Cleanup(func() { service.FairWindow = prev })
+
+	// Refused up front, not after waiting out FairWindow
+	start := time.Now()
+	_, err := service.PurchaseService{}.ReserveFair(t.Context(), 1, productID, start)
+	if !errors.Is(err, service.ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %s, want no wait in line", elapsed)
+	}
+	arrivals, _, _ := service.FairKeys(productID)
+	if mr.Exists(arrivals) || mr.Exists(database.UserPurchaseKey(1, productID)) {
+		t.Fatal("an unknown product's buyer joined the line")
+	}
+}
+
+func TestReserveFairReloadsExpiredKey(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	prev := database.StockKeyTTL
+	database.StockKeyTTL = 2 * time.Second
+	t.Cleanup(func() { database.StockKeyTTL = prev })
+	productID := testutil.Product(t, "Fair", 5)
+	key := database.StockKey(productID)
+	mr.SetTTL(key, database.StockKeyTTL)
+
+	mr.FastForward(3 * time.Second)
+	if mr.Exists(key) {
+		t.Fatal("key outlived its TTL")
+	}
+	r, err := service.PurchaseService{}.ReserveFair(t.Context(), 1, productID, time.Now())
+	if err != nil || r.Rank != 1 {
+		t.Fatalf("rank = %d, err = %v; want the expired key reloaded and rank 1", r.Rank, err)
+	}
+	if got, _ := mr.Get(key); got != "4" || mr.TTL(key) != database.StockKeyTTL {
+		t.Fatalf("stock key = %s with TTL %s, want 4 with %s", got, mr.TTL(key), database.StockKeyTTL)
+	}
+}
+
+func TestFairSuccess(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Fair", 5)
+
+	svc := service.PurchaseService{}
+	r, err := svc.ReserveFair(t.Context(), 1, productID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.Persist(t.Context(), r.Reservation, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Rank != 1 || res.Remaining != 4 {
+		t.Fatalf("rank %d, %d left; want rank 1 and 4 left", r.Rank, res.Remaining)
+	}
+	if n := testutil.Orders(t, productID, service.OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d successful orders, want 1", n)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is what InsertOrder writes through: the pool for Mode 1, a
+// transaction everywhere else
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// InsertOrder records an order with the given status and returns its id.
+// Every purchase flow writes its orders through here.
+func InsertOrder(ctx context.Context, q Querier, userID, productID, quantity int, status string) (int, error) {
+	var orderID int
+	err := q.QueryRow(ctx,
+		"INSERT INTO orders (user_id, product_id, quantity, status) VALUES ($1, $2, $3, $4) RETURNING id",
+		userID, productID, quantity, status).Scan(&orderID)
+	return orderID, err
+}
@@ -0,0 +1,56 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestInsertOrder(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	for _, status := range []string{service.OrderStatusSuccess, "pending", "failed", service.OrderStatusPaymentFailed} {
+		id, err := service.InsertOrder(t.Context(), database.DB, 1, productID, 2, status)
+		if err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+		var got string
+		var quantity int
+		if err := database.DB.QueryRow(t.Context(),
+			"SELECT status, quantity FROM orders WHERE id = $1", id).Scan(&got, &quantity); err != nil {
+			t.Fatal(err)
+		}
+		if got != status || quantity != 2 {
+			t.Fatalf("order %d: status %q, quantity %d; want %q, 2", id, got, quantity, status)
+		}
+	}
+}
+
+func TestInsertOrderInTx(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	tx, err := database.DB.Begin(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(context.Background())
+	if _, err := service.InsertOrder(t.Context(), tx, 1, productID, 1, "pending"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.Orders(t, productID, "pending"); n != 0 {
+		t.Fatalf("%d pending orders visible before the commit, want 0", n)
+	}
+	if err := tx.Commit(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.Orders(t, productID, "pending"); n != 1 {
+		t.Fatalf("%d pending orders after the commit, want 1", n)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"flash-sale-backend/internal/database"
+)
+
+// ============================================
+// 💳 PURCHASE WITH PAYMENT
+// ============================================
+// Mode 3 with a charge between the reservation and the Postgres step:
+// Reserve, Charge, then Persist. The charge runs while only the Redis
+// reservation is held, so a slow provider never keeps a row locked.
+
+// OrderStatusPaymentFailed records a declined charge; no stock is held
+const OrderStatusPaymentFailed = "payment_failed"
+
+// ErrPaymentDeclined is a charge the payment provider turned down
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// PaymentFunc charges the buyer, returning ErrPaymentDeclined (or wrapping
+// it) when the provider says no
+type PaymentFunc func(ctx context.Context) error
+
+// Charge runs pay for a reservation. If it fails the reservation is
+// released, and a decline is recorded as a 'payment_failed' order so the
+// attempt shows up in /orders.
+func (s PurchaseService) Charge(ctx context.Context, r Reservation, pay PaymentFunc) error {
+	step := time.Now()
+	err := pay(ctx)
+	s.obs().Payment(step)
+	if err == nil {
+		return nil
+	}
+
+	r.Release()
+	if errors.Is(err, ErrPaymentDeclined) {
+		recordFailedPayment(r)
+	}
+	return err
+}
+
+// recordFailedPayment keeps a 'payment_failed' order for the audit trail. A
+// failure here is only logged; the purchase has already failed.
+func recordFailedPayment(r Reservation) {
+	_, err := InsertOrder(context.Background(), database.DB, r.UserID, r.ProductID, r.Quantity, OrderStatusPaymentFailed)
+	if err != nil {
+		slog.Warn("⚠️ Failed to record payment failure", "user_id", r.UserID, "product_id", r.ProductID, "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestChargeSuccessKeepsReservation(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.Set(database.StockKey(1), "9")
+	mr.Set(database.UserPurchaseKey(1, 1), "1")
+	r := service.Reservation{UserID: 1, ProductID: 1, Quantity: 1}
+
+	err := service.PurchaseService{}.Charge(t.Context(), r, func(context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.Get(database.StockKey(1)); got != "9" {
+		t.Fatalf("stock = %s, want the reservation still held (9)", got)
+	}
+}
+
+func TestChargeFailureReleases(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.Set(database.StockKey(1), "9")
+	mr.Set(database.UserPurchaseKey(1, 1), "1")
+	r := service.Reservation{UserID: 1, ProductID: 1, Quantity: 1}
+
+	err := service.PurchaseService{}.Charge(t.Context(), r, func(context.Context) error { return context.DeadlineExceeded })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the provider's error", err)
+	}
+	if got, _ := mr.Get(database.StockKey(1)); got != "10" {
+		t.Fatalf("stock = %s, want the unit back (10)", got)
+	}
+	if got, _ := mr.Get(database.UserPurchaseKey(1, 1)); got != "0" {
+		t.Fatalf("user counter = %s, want 0", got)
+	}
+}
+
+func TestChargeDeclineRecordsFailedPayment(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	svc := service.PurchaseService{}
+	r, err := svc.Reserve(t.Context(), 1, productID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.Charge(t.Context(), r, func(context.Context) error { return service.ErrPaymentDeclined })
+	if !errors.Is(err, service.ErrPaymentDeclined) || !service.Refused(err) {
+		t.Fatalf("err = %v, want ErrPaymentDeclined", err)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "10" {
+		t.Fatalf("Redis stock = %s, want 10", got)
+	}
+	if n := testutil.Orders(t, productID, service.OrderStatusPaymentFailed); n != 1 {
+		t.Fatalf("%d payment_failed orders, want 1", n)
+	}
+	if got := testutil.Quantity(t, productID); got != 10 {
+		t.Fatalf("PostgreSQL quantity = %d, want 10", got)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Row-lock refusals: NOWAIT found the row taken, or LOCK_TIMEOUT_MS expired
+// waiting for it. Both wrap the Postgres error.
+var (
+	ErrLockContended = errors.New("product row is locked")
+	ErrLockTimeout   = errors.New("row lock not granted in time")
+)
+
+// lockNotAvailable is Postgres SQLSTATE lock_not_available (lock_timeout, NOWAIT)
+const lockNotAvailable = "55P03"
+
+// LockTimeout bounds how long Mode 2 waits for the product row lock
+// (LOCK_TIMEOUT_MS; 0 = wait as long as it takes)
+var LockTimeout = time.Duration(config.Int("LOCK_TIMEOUT_MS", 0)) * time.Millisecond
+
+// isLockNotAvailable reports whether err is Postgres giving up on a row lock
+func isLockNotAvailable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable
+}
+
+// ============================================
+// MODE 1: NAIVE (No Protection - Shows Race Condition)
+// ============================================
+
+// Naive reads the stock, waits delay, then decrements it and records the
+// order, with no lock at all: concurrent buyers oversell, which is the point
+func (s PurchaseService) Naive(ctx context.Context, userID, productID, quantity int, delay time.Duration) (res Result, err error) {
+	// DANGER: No locking! Just read and write - WILL cause overselling
+	step := time.Now()
+	var stock int
+	err = database.DB.QueryRow(ctx, "SELECT quantity FROM products WHERE id=$1", productID).Scan(&stock)
+	s.obs().Query(step)
+	if err != nil {
+		return res, &StepError{StepReadStock, err}
+	}
+
+	if stock < quantity {
+		return res, ErrSoldOut
+	}
+
+	// 🚨 INTENTIONAL DELAY: Widen the race condition window for demo purposes
+	// In real apps, this delay exists due to network latency, processing, etc.
+	step = time.Now()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return res, ctx.Err()
+	}
+	s.obs().Wait(step)
+
+	// DANGER: Race condition window - another request could read same quantity!
+	step = time.Now()
+	err = database.DB.QueryRow(ctx,
+		"UPDATE products SET quantity = quantity - $2 WHERE id=$1 RETURNING quantity",
+		productID, quantity).Scan(&res.Remaining)
+	s.obs().Query(step)
+	if err != nil {
+		return res, &StepError{StepUpdateStock, err}
+	}
+
+	step = time.Now()
+	res.OrderID, err = InsertOrder(ctx, database.DB, userID, productID, quantity, OrderStatusSuccess)
+	s.obs().InsertOrder(step)
+	if err != nil {
+		return res, &StepError{StepInsertOrder, err}
+	}
+	return res, nil
+}
+
+// ============================================
+// MODE 2: PostgreSQL Pessimistic Locking (Safe but Slower)
+// ============================================
+
+// PostgresLock buys under SELECT ... FOR UPDATE in one transaction, queueing
+// behind whoever holds the row (for at most LockTimeout)
+func (s PurchaseService) PostgresLock(ctx context.Context, userID, productID, quantity int) (Result, error) {
+	return s.rowLock(ctx, userID, productID, quantity, false)
+}
+
+// PostgresNoWait is PostgresLock with FOR UPDATE NOWAIT: a buyer who finds
+// the row locked gets ErrLockContended at once instead of queueing
+func (s PurchaseService) PostgresNoWait(ctx context.Context, userID, productID, quantity int) (Result, error) {
+	return s.rowLock(ctx, userID, productID, quantity, true)
+}
+
+func (s PurchaseService) rowLock(ctx context.Context, userID, productID, quantity int, noWait bool) (res Result, err error) {
+	s.obs().BeginTx(time.Now())
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return res, &StepError{StepBegin, err}
+	}
+	defer tx.Rollback(context.Background()) // still runs if ctx expired
+
+	// Under heavy contention, give up on the lock rather than queue forever
+	if LockTimeout > 0 {
+		_, err = tx.Exec(ctx, "SELECT set_config('lock_timeout', $1, true)", fmt.Sprintf("%dms", LockTimeout.Milliseconds()))
+		if err != nil {
+			return res, &StepError{StepSetLockTimeout, err}
+		}
+	}
+
+	// SAFE: SELECT FOR UPDATE locks the row! NOWAIT errors out instead of
+	// waiting when someone else holds it.
+	lockSQL := "SELECT quantity FROM products WHERE id=$1 FOR UPDATE"
+	if noWait {
+		lockSQL += " NOWAIT"
+	}
+	var stock int
+	err = tx.QueryRow(ctx, lockSQL, productID).Scan(&stock)
+	if noWait && isLockNotAvailable(err) {
+		return res, fmt.Errorf("%w: %w", ErrLockContended, err)
+	}
+	if isLockNotAvailable(err) {
+		return res, fmt.Errorf("%w: %w", ErrLockTimeout, err)
+	}
+	if err != nil {
+		return res, &StepError{StepLock, err}
+	}
+
+	if stock < quantity {
+		return res, ErrSoldOut
+	}
+
+	err = tx.QueryRow(ctx,
+		"UPDATE products SET quantity = quantity - $2 WHERE id=$1 RETURNING quantity",
+		productID, quantity).Scan(&res.Remaining)
+	if err != nil {
+		return res, &StepError{StepUpdateStock, err}
+	}
+
+	step := time.Now()
+	res.OrderID, err = InsertOrder(ctx, tx, userID, productID, quantity, OrderStatusSuccess)
+	s.obs().InsertOrder(step)
+	if err != nil {
+		return res, &StepError{StepInsertOrder, err}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, &StepError{StepCommit, err}
+	}
+	s.obs().EndTx()
+	return res, nil
+}
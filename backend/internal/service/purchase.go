@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================
+// 🛒 REDIS + POSTGRES PURCHASE, TRANSPORT-FREE
+// ============================================
+// Mode 3's core: reserve stock and the buyer's limit in Redis with one Lua
+// script, then take the stock and record the order in one Postgres
+// transaction, handing the reservation back if Postgres fails. The HTTP
+// handler and the gRPC server both sell through here.
+
+// OrderStatusSuccess is what a completed purchase is recorded as
+const OrderStatusSuccess = "success"
+
+// MaxPerUser caps how many units of one product a user may buy (0 = no
+// limit), for products without their own max_per_user
+var MaxPerUser = config.Int("MAX_PER_USER", 2)
+
+// redisAutoSeed copies stock from Postgres when a product's Redis key is missing
+var redisAutoSeed = config.Bool("REDIS_AUTO_SEED", false)
+
+// Purchases refused on their merits. Any other error from Reserve is Redis
+// failing; from the Postgres steps, a *StepError saying which one failed.
+var (
+	ErrSoldOut         = errors.New("out of stock")
+	ErrUserLimit       = errors.New("per-user purchase limit reached")
+	ErrProductNotFound = errors.New("product not found")
+	ErrNotSeeded       = errors.New("stock is not loaded into Redis")
+)
+
+// UserLimitError is ErrUserLimit with the cap that applied to the product
+type UserLimitError struct {
+	Limit int
+}
+
+func (e *UserLimitError) Error() string {
+	return fmt.Sprintf("%v (%d per user)", ErrUserLimit, e.Limit)
+}
+
+func (e *UserLimitError) Is(target error) bool {
+	return target == ErrUserLimit
+}
+
+// UserLimit is how many units of the product one user may buy: its own
+// max_per_user when set, else MaxPerUser. 0 means no limit. If the rules
+// can't be read (or the product doesn't exist), MaxPerUser applies.
+func UserLimit(ctx context.Context, productID int) int {
+	r, err := loadProductRules(ctx, productID)
+	if err != nil {
+		return MaxPerUser
+	}
+	return r.userLimit()
+}
+
+// Postgres steps of a purchase, as reported in StepError
+const (
+	StepReadStock      = "read_stock"
+	StepBegin          = "begin"
+	StepSetLockTimeout = "set_lock_timeout"
+	StepLock           = "lock"
+	StepUpdateStock    = "update_stock"
+	StepInsertOrder    = "insert_order"
+	StepCommit         = "commit"
+)
+
+// StepError is a Postgres failure during a purchase. Any Redis reservation
+// has already been released when it is returned.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Refused reports whether err is a purchase turned down on its merits: sold
+// out, over the limit, an unknown product, outside the sale window, a busy
+// row or a declined payment. Anything else is Redis or Postgres failing.
+func Refused(err error) bool {
+	var closed *SaleClosedError
+	return errors.Is(err, ErrSoldOut) || errors.Is(err, ErrUserLimit) || errors.Is(err, ErrProductNotFound) ||
+		errors.Is(err, ErrPaymentDeclined) ||
+		errors.Is(err, ErrLockContended) || errors.Is(err, ErrLockTimeout) || errors.Is(err, ErrSerializationConflict) ||
+		errors.As(err, &closed)
+}
+
+// Observer is told how long each step took, for callers that time them (the
+// HTTP handlers' ?trace=true breakdown and spans)
+type Observer interface {
+	Redis(from time.Time)       // the reservation script, seeding included
+	Query(from time.Time)       // a Postgres statement outside a transaction
+	InsertOrder(from time.Time) // INSERT INTO orders
+	Wait(from time.Time)        // Naive mode's race window, fair mode's wait
+	Payment(from time.Time)     // the charge (Charge)
+	BeginTx(from time.Time)     // the Postgres transaction started
+	EndTx()                     // ...and committed
+}
+
+type noObserver struct{}
+
+func (noObserver) Redis(time.Time)       {}
+func (noObserver) Query(time.Time)       {}
+func (noObserver) InsertOrder(time.Time) {}
+func (noObserver) Wait(time.Time)        {}
+func (noObserver) Payment(time.Time)     {}
+func (noObserver) BeginTx(time.Time)     {}
+func (noObserver) EndTx()                {}
+
+// PurchaseService runs the purchase modes without any transport: each method
+// takes the buyer, product and quantity and returns a Result or an error
+// (see Refused and StepError). The zero value is ready to use.
+type PurchaseService struct {
+	Observer Observer // optional step timings
+}
+
+func (s PurchaseService) obs() Observer {
+	if s.Observer == nil {
+		return noObserver{}
+	}
+	return s.Observer
+}
+
+// Reservation is stock and per-user allowance held in Redis until the
+// purchase is persisted or released
+type Reservation struct {
+	UserID    int
+	ProductID int
+	Quantity  int
+	Stock     int64 // Redis stock left after the reservation
+}
+
+// Result is a persisted purchase. OrderID is 0 when the caller writes the
+// order row itself (ORDER_BATCH).
+type Result struct {
+	OrderID   int
+	Remaining int   // Postgres stock left
+	Retries   int   // serialization failures retried (Serializable only)
+	Reserved  int64 // Redis stock left by the reservation (RedisPostgres only)
+}
+
+// Reserve runs the reservation script, seeding a missing stock key from
+// Postgres when that is allowed (see SeedStock) and trying once more.
+//
+// A product Postgres doesn't have is ErrProductNotFound before any key is
+// touched, so a stale stock key left in Redis can't sell it. If Postgres
+// can't answer, the reservation goes ahead under MaxPerUser.
+func (s PurchaseService) Reserve(ctx context.Context, userID, productID, quantity int) (Reservation, error) {
+	r := Reservation{UserID: userID, ProductID: productID, Quantity: quantity}
+	keys := []string{database.StockKey(productID), database.UserPurchaseKey(userID, productID)}
+
+	limit := MaxPerUser
+	rules, err := loadProductRules(ctx, productID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return r, ErrProductNotFound
+	case err == nil:
+		limit = rules.userLimit()
+	}
+
+	step := time.Now()
+	stock, err := ReserveStockScript.Run(ctx, database.Rdb, keys, limit, quantity).Int64()
+	if err == nil && stock == LuaNotSeeded {
+		var seeded bool
+		seeded, err = SeedStock(ctx, productID)
+		if !seeded {
+			return r, notSeededError(err)
+		}
+		stock, err = ReserveStockScript.Run(ctx, database.Rdb, keys, limit, quantity).Int64()
+	}
+	s.obs().Redis(step)
+	if err != nil {
+		return r, err
+	}
+
+	switch stock {
+	case LuaSoldOut:
+		return r, ErrSoldOut
+	case LuaUserLimit:
+		return r, &UserLimitError{Limit: limit}
+	case LuaNotSeeded:
+		return r, ErrNotSeeded
+	}
+	r.Stock = stock
+	return r, nil
+}
+
+// notSeededError is why a missing stock key couldn't be seeded, given what
+// SeedStock returned: ErrProductNotFound, or ErrNotSeeded with any error
+func notSeededError(err error) error {
+	switch {
+	case err == nil:
+		return ErrNotSeeded
+	case errors.Is(err, ErrProductNotFound):
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrNotSeeded, err)
+}
+
+// Release hands a reservation back to Redis when the Postgres step fails.
+// A command that fails is dead-lettered (RecordCompensationFailure).
+func (r Reservation) Release() {
+	stockKey := database.StockKey(r.ProductID)
+	if err := database.Rdb.IncrBy(context.Background(), stockKey, int64(r.Quantity)).Err(); err != nil {
+		RecordCompensationFailure(r.ProductID, r.UserID, stockKey, int64(r.Quantity), err)
+	}
+	userKey := database.UserPurchaseKey(r.UserID, r.ProductID)
+	if err := database.Rdb.DecrBy(context.Background(), userKey, int64(r.Quantity)).Err(); err != nil {
+		RecordCompensationFailure(r.ProductID, r.UserID, userKey, -int64(r.Quantity), err)
+	}
+}
+
+// Persist takes the reserved stock in Postgres and, with writeOrder, records
+// the order in the same transaction. On any failure the reservation is
+// released and a *StepError returned.
+func (s PurchaseService) Persist(ctx context.Context, r Reservation, writeOrder bool) (res Result, err error) {
+	defer func() {
+		if err != nil {
+			r.Release()
+		}
+	}()
+
+	s.obs().BeginTx(time.Now())
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return res, &StepError{StepBegin, err}
+	}
+	defer tx.Rollback(context.Background()) // still runs if ctx expired
+
+	err = tx.QueryRow(ctx,
+		"UPDATE products SET quantity = quantity - $2 WHERE id=$1 RETURNING quantity",
+		r.ProductID, r.Quantity).Scan(&res.Remaining)
+	if err != nil {
+		return res, &StepError{StepUpdateStock, err}
+	}
+
+	if writeOrder {
+		step := time.Now()
+		res.OrderID, err = InsertOrder(ctx, tx, r.UserID, r.ProductID, r.Quantity, OrderStatusSuccess)
+		s.obs().InsertOrder(step)
+		if err != nil {
+			return res, &StepError{StepInsertOrder, err}
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, &StepError{StepCommit, err}
+	}
+	s.obs().EndTx()
+	return res, nil
+}
+
+// RedisPostgres is Mode 3: Reserve, then Persist with the order row written
+// inside the transaction
+func (s PurchaseService) RedisPostgres(ctx context.Context, userID, productID, quantity int) (Result, error) {
+	r, err := s.Reserve(ctx, userID, productID, quantity)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := s.Persist(ctx, r, true)
+	res.Reserved = r.Stock
+	return res, err
+}
+
+// Purchase sells quantity units of a product to a user the way the gRPC
+// server does: CheckSaleWindow, then Mode 3
+func Purchase(ctx context.Context, userID, productID, quantity int) (Result, error) {
+	if err := CheckSaleWindow(ctx, productID); err != nil {
+		return Result{}, err
+	}
+	return PurchaseService{}.RedisPostgres(ctx, userID, productID, quantity)
+}
+
+// SeedStock is called when a product's Redis stock key is missing. A
+// product that doesn't exist in Postgres is ErrProductNotFound. With
+// STOCK_KEY_TTL_SEC the key simply expired, so it is reloaded quietly.
+// Otherwise Redis was never seeded (or was flushed), which is an operator
+// error worth shouting about. With REDIS_AUTO_SEED (or a TTL) it copies the
+// Postgres stock over (SETNX, so a concurrent seed wins) and reports true so
+// the caller can retry.
+func SeedStock(ctx context.Context, productID int) (bool, error) {
+	var quantity int
+	err := database.DB.QueryRow(ctx, "SELECT quantity FROM products WHERE id=$1", productID).Scan(&quantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrProductNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if database.StockKeyTTL > 0 {
+		slog.Info("♻️ Stock key expired, reloading from PostgreSQL", "product_id", productID, "db_quantity", quantity)
+	} else {
+		slog.Error("🚨 Redis stock key missing for a product that exists in PostgreSQL; run POST /sync-redis",
+			"product_id", productID, "db_quantity", quantity, "auto_seed", redisAutoSeed)
+		if !redisAutoSeed {
+			return false, nil
+		}
+	}
+	if err := database.Rdb.SetNX(ctx, database.StockKey(productID), max(quantity, 0), database.StockKeyTTL).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+)
+
+func TestRedisPostgresSuccess(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	res, err := service.PurchaseService{}.RedisPostgres(t.Context(), 1, productID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OrderID == 0 || res.Remaining != 8 {
+		t.Fatalf("result = %+v, want an order and 8 left", res)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "8" {
+		t.Fatalf("Redis stock = %s, want 8", got)
+	}
+	if got, _ := mr.Get(database.UserPurchaseKey(1, productID)); got != "2" {
+		t.Fatalf("user counter = %s, want 2", got)
+	}
+	if n := testutil.Orders(t, productID, service.OrderStatusSuccess); n != 1 {
+		t.Fatalf("%d successful orders, want 1", n)
+	}
+}
+
+func TestRedisPostgresSoldOut(t *testing.T) {
+	testutil.Postgres(t)
+	mr := testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 1)
+
+	_, err := service.PurchaseService{}.RedisPostgres(t.Context(), 1, productID, 2)
+	if !errors.Is(err, service.ErrSoldOut) || !service.Refused(err) {
+		t.Fatalf("err = %v, want ErrSoldOut", err)
+	}
+	if got, _ := mr.Get(database.StockKey(productID)); got != "1" {
+		t.Fatalf("Redis stock = %s, want 1", got)
+	}
+	if mr.Exists(database.UserPurchaseKey(1, productID)) {
+		t.Fatal("user counter was bumped for a refused purchase")
+	}
+	if got := testutil.Quantity(t, productID); got != 1 {
+		t.Fatalf("PostgreSQL quantity = %d, want 1", got)
+	}
+}
+
+func TestReserveUserLimit(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+	productID := testutil.Product(t, "Widget", 10)
+
+	svc := service.PurchaseService{}
+	if _, err := svc.Reserve(t.Context(), 1, productID, service.MaxPerUser); err != nil {
+		t.Fatal(err)
+	}
+	_, err := svc.Reserve(t.Context(), 1, productID, 1)
+	var limitErr *service.UserLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != service.MaxPerUser {
+		t.Fatalf("err = %v, want a UserLimitError of %d", err, service.MaxPerUser)
+	}
+}
+
+func TestReserveUnknownProduct(t *testing.T) {
+	testutil.Postgres(t)
+	testutil.Redis(t)
+
+	if _, err := (service.PurchaseService{}).Reserve(t.Context(), 1, 999, 1); !errors.Is(err, service.ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+}
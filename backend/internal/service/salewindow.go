@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================
+// ⏰ SALE WINDOW
+// ============================================
+// products.sale_start / sale_end bound when a product may be bought; NULL
+// means no bound on that side. Purchases check the window (and read the
+// product's max_per_user, see UserLimit) from a short-lived in-memory cache
+// so the hot path doesn't pay an extra query per request.
+
+// productRulesTTL is how long a product's rules are cached
+const productRulesTTL = 5 * time.Second
+
+// productRules is the per-product purchase policy stored on the products row
+type productRules struct {
+	Start      *time.Time
+	End        *time.Time
+	MaxPerUser *int // NULL = the global MAX_PER_USER
+	fetched    time.Time
+}
+
+var productRulesCache sync.Map // product id -> productRules
+
+// userLimit is the product's max_per_user, or MaxPerUser when it has none
+func (r productRules) userLimit() int {
+	if r.MaxPerUser == nil {
+		return MaxPerUser
+	}
+	return *r.MaxPerUser
+}
+
+// SaleClosedError is a purchase outside the product's sale window: before
+// sale_start, or (Ended) at or after sale_end
+type SaleClosedError struct {
+	Ended bool
+	At    time.Time // sale_start, or sale_end when Ended
+}
+
+func (e *SaleClosedError) Error() string {
+	if e.Ended {
+		return fmt.Sprintf("sale ended at %s", e.At.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("sale starts at %s", e.At.UTC().Format(time.RFC3339))
+}
+
+// loadProductRules returns the product's rules, from cache when fresh.
+// pgx.ErrNoRows means the product doesn't exist.
+func loadProductRules(ctx context.Context, productID int) (productRules, error) {
+	if cached, ok := productRulesCache.Load(productID); ok {
+		if r := cached.(productRules); time.Since(r.fetched) < productRulesTTL {
+			return r, nil
+		}
+	}
+
+	var r productRules
+	err := database.DB.QueryRow(ctx,
+		"SELECT sale_start, sale_end, max_per_user FROM products WHERE id=$1", productID).
+		Scan(&r.Start, &r.End, &r.MaxPerUser)
+	if err != nil {
+		return productRules{}, err
+	}
+	r.fetched = time.Now()
+	productRulesCache.Store(productID, r)
+	return r, nil
+}
+
+// ForgetProductRules drops a product's cached rules so this instance sees an
+// admin change at once (other instances within productRulesTTL)
+func ForgetProductRules(productID int) {
+	productRulesCache.Delete(productID)
+}
+
+// CheckSaleWindow returns a *SaleClosedError outside the product's window.
+// Unknown products pass; the purchase itself reports them.
+func CheckSaleWindow(ctx context.Context, productID int) error {
+	w, err := loadProductRules(ctx, productID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if w.Start != nil && now.Before(*w.Start) {
+		return &SaleClosedError{At: *w.Start}
+	}
+	if w.End != nil && !now.Before(*w.End) {
+		return &SaleClosedError{Ended: true, At: *w.End}
+	}
+	return nil
+}
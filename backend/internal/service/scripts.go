@@ -0,0 +1,146 @@
+package service
+
+import "github.com/redis/go-redis/v9"
+
+// ============================================
+// 📜 LUA SCRIPTS
+// ============================================
+// Every purchase step that has to be atomic in Redis. The handlers preload
+// them at startup (handlers.LoadScripts).
+
+// Results of the reservation scripts other than success. Every script that
+// checks stock or the per-user limit answers with these.
+const (
+	LuaSoldOut   = -1
+	LuaUserLimit = -2
+	LuaNotSeeded = -3
+)
+
+// ReserveStockScript atomically checks stock and the per-user limit, then
+// decrements stock and bumps the user's counter by the quantity.
+// KEYS[1] = stock key, KEYS[2] = user counter key
+// ARGV[1] = max per user (0 = no limit), ARGV[2] = quantity
+// Returns the stock left, or LuaNotSeeded / LuaSoldOut / LuaUserLimit
+var ReserveStockScript = redis.NewScript(`
+	local stock = redis.call('GET', KEYS[1])
+	if stock == false then
+		return -3
+	end
+	stock = tonumber(stock)
+	local qty = tonumber(ARGV[2])
+	if stock < qty then
+		return -1
+	end
+	local limit = tonumber(ARGV[1])
+	local bought = tonumber(redis.call('GET', KEYS[2]) or '0')
+	if limit > 0 and bought + qty > limit then
+		return -2
+	end
+	redis.call('INCRBY', KEYS[2], qty)
+	return redis.call('DECRBY', KEYS[1], qty)
+`)
+
+// ReserveCartScript checks every item's stock and the user's per-product limit,
+// and only if ALL pass decrements them. Returns {0, 0} on success, or
+// {reason, product id} for the first failing item, the reason being
+// LuaNotSeeded, LuaSoldOut or LuaUserLimit.
+// KEYS = n stock keys then n user counter keys
+// ARGV = n quantities, then n per-user limits (0 = no limit), then n product ids
+var ReserveCartScript = redis.NewScript(`
+	local n = #KEYS / 2
+	for i = 1, n do
+		local qty = tonumber(ARGV[i])
+		local limit = tonumber(ARGV[n + i])
+		local product = tonumber(ARGV[2 * n + i])
+		local stock = redis.call('GET', KEYS[i])
+		if stock == false then
+			return {-3, product}
+		end
+		if tonumber(stock) < qty then
+			return {-1, product}
+		end
+		local bought = tonumber(redis.call('GET', KEYS[n + i]) or '0')
+		if limit > 0 and bought + qty > limit then
+			return {-2, product}
+		end
+	end
+	for i = 1, n do
+		redis.call('DECRBY', KEYS[i], ARGV[i])
+		redis.call('INCRBY', KEYS[n + i], ARGV[i])
+	end
+	return {0, 0}
+`)
+
+// JoinFairScript checks the buyer's per-user limit, counts the unit against
+// it and takes a place in line, so nobody can queue past their cap.
+// KEYS[1] = user counter, KEYS[2] = arrivals
+// ARGV[1] = max per user (0 = no limit), ARGV[2] = arrival score, ARGV[3] = member
+// Returns 1, or LuaUserLimit when the limit is reached
+var JoinFairScript = redis.NewScript(`
+	local limit = tonumber(ARGV[1])
+	local bought = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if limit > 0 and bought + 1 > limit then
+		return -2
+	end
+	redis.call('INCR', KEYS[1])
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[3])
+	return 1
+`)
+
+// LeaveFairScript takes a request that gave up out of line and hands back
+// the buyer's allowance. Another request's settle may already have granted
+// it a unit; that unit goes back on sale instead of leaking.
+// KEYS[1] = arrivals, KEYS[2] = outcomes, KEYS[3] = stock key, KEYS[4] = user counter
+// ARGV[1] = member
+// Returns 1 if a granted unit was put back, else 0
+var LeaveFairScript = redis.NewScript(`
+	redis.call('DECR', KEYS[4])
+	if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 then
+		return 0
+	end
+	local outcome = redis.call('HGET', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[2], ARGV[1])
+	if outcome and tonumber(outcome) > 0 then
+		redis.call('INCR', KEYS[3])
+		return 1
+	end
+	return 0
+`)
+
+// Results of SettleFairScript other than a granted rank (and LuaNotSeeded)
+const (
+	FairSoldOut = 0
+	FairPending = -4
+)
+
+// SettleFairScript settles every arrival scored at or before the cutoff in
+// score order: while stock lasts each gets the next rank (1, 2, ...), after
+// that 0 (sold out). Outcomes wait in a hash for their request to collect.
+// KEYS[1] = arrivals, KEYS[2] = stock key, KEYS[3] = outcomes, KEYS[4] = rank
+// ARGV[1] = cutoff score, ARGV[2] = this request's member, ARGV[3] = outcome TTL (s)
+// Returns this request's rank, FairSoldOut, LuaNotSeeded if the stock key is
+// missing, or FairPending if it isn't settled yet
+var SettleFairScript = redis.NewScript(`
+	local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+	for _, member in ipairs(due) do
+		local stock = redis.call('GET', KEYS[2])
+		if stock == false then
+			return -3
+		end
+		local outcome = 0
+		if tonumber(stock) > 0 then
+			redis.call('DECR', KEYS[2])
+			outcome = redis.call('INCR', KEYS[4])
+		end
+		redis.call('HSET', KEYS[3], member, outcome)
+		redis.call('ZREM', KEYS[1], member)
+	end
+	redis.call('EXPIRE', KEYS[3], ARGV[3])
+
+	local mine = redis.call('HGET', KEYS[3], ARGV[2])
+	if mine == false then
+		return -4
+	end
+	redis.call('HDEL', KEYS[3], ARGV[2])
+	return tonumber(mine)
+`)
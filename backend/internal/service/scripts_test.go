@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"flash-sale-backend/internal/database"
+	"flash-sale-backend/internal/service"
+	"flash-sale-backend/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReserveStockScript(t *testing.T) {
+	mr := testutil.Redis(t)
+	mr.Set(database.StockKey(1), "10")
+	reserve := func(userID, limit, qty int) int64 {
+		t.Helper()
+		keys := []string{database.StockKey(1), database.UserPurchaseKey(userID, 1)}
+		res, err := service.ReserveStockScript.Run(context.Background(), database.Rdb, keys, limit, qty).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// User 1 buys up to a limit of 2, then is refused; user 2 still gets one
+	steps := []struct {
+		userID, limit, qty int
+		want               int64
+	}{
+		{1, 2, 1, 9},
+		{1, 2, 1, 8},
+		{1, 2, 1, service.LuaUserLimit},
+		{2, 2, 1, 7},
+		{2, 2, 2, service.LuaUserLimit}, // 1 + 2 > 2, even though stock is there
+		{3, 0, 7, 0},                    // 0 = no limit
+		{4, 0, 1, service.LuaSoldOut},
+	}
+	for i, s := range steps {
+		if got := reserve(s.userID, s.limit, s.qty); got != s.want {
+			t.Fatalf("step %d (user %d buys %d): got %d, want %d", i, s.userID, s.qty, got, s.want)
+		}
+	}
+	for userID, want := range map[int]string{1: "2", 2: "1", 3: "7"} {
+		if got, _ := mr.Get(database.UserPurchaseKey(userID, 1)); got != want {
+			t.Fatalf("user %d counter = %s, want %s; refusals must not count", userID, got, want)
+		}
+	}
+
+	mr.Del(database.StockKey(1))
+	if got := reserve(5, 0, 1); got != service.LuaNotSeeded {
+		t.Fatalf("missing stock key: got %d, want LuaNotSeeded", got)
+	}
+}
+
+func TestReserveCartScript(t *testing.T) {
+	const userID = 7
+	items := []service.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 3}}
+	reserve := func(limits map[int]int) []int64 {
+		t.Helper()
+		keys := []string{
+			database.StockKey(1), database.StockKey(2),
+			database.UserPurchaseKey(userID, 1), database.UserPurchaseKey(userID, 2),
+		}
+		args := []any{2, 3, limits[1], limits[2], 1, 2}
+		res, err := service.ReserveCartScript.Run(context.Background(), database.Rdb, keys, args...).Int64Slice()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		stock2 string // product 2's stock key, "" for missing
+		limits map[int]int
+		want   []int64
+	}{
+		{"second item sold out", "2", nil, []int64{service.LuaSoldOut, 2}},
+		{"second item over the user limit", "10", map[int]int{2: 2}, []int64{service.LuaUserLimit, 2}},
+		{"second item not seeded", "", nil, []int64{service.LuaNotSeeded, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := testutil.Redis(t)
+			mr.Set(database.StockKey(1), "10")
+			if tt.stock2 != "" {
+				mr.Set(database.StockKey(2), tt.stock2)
+			}
+
+			if got := reserve(tt.limits); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			// Nothing is reserved, not even the first item that fit
+			if got, _ := mr.Get(database.StockKey(1)); got != "10" {
+				t.Fatalf("first item's stock = %s, want it untouched at 10", got)
+			}
+			if got, _ := mr.Get(database.StockKey(2)); got != tt.stock2 {
+				t.Fatalf("second item's stock = %q, want %q", got, tt.stock2)
+			}
+			for _, item := range items {
+				if mr.Exists(database.UserPurchaseKey(userID, item.ProductID)) {
+					t.Fatalf("user counter for product %d was bumped", item.ProductID)
+				}
+			}
+		})
+	}
+
+	t.Run("all fit", func(t *testing.T) {
+		mr := testutil.Redis(t)
+		mr.Set(database.StockKey(1), "10")
+		mr.Set(database.StockKey(2), "3")
+		if got := reserve(nil); !slices.Equal(got, []int64{0, 0}) {
+			t.Fatalf("got %v, want {0, 0}", got)
+		}
+		for _, want := range []struct {
+			key, value string
+		}{
+			{database.StockKey(1), "8"},
+			{database.StockKey(2), "0"},
+			{database.UserPurchaseKey(userID, 1), "2"},
+			{database.UserPurchaseKey(userID, 2), "3"},
+		} {
+			if got, _ := mr.Get(want.key); got != want.value {
+				t.Fatalf("%s = %s, want %s", want.key, got, want.value)
+			}
+		}
+	})
+}
+
+// settle runs SettleFairScript for one member of product 1's line
+func settle(t *testing.T, cutoff int64, member string) int64 {
+	t.Helper()
+	arrivals, outcomes, rankKey := service.FairKeys(1)
+	rank, err := service.SettleFairScript.Run(context.Background(), database.Rdb,
+		[]string{arrivals, database.StockKey(1), outcomes, rankKey}, cutoff, member, 60 /* outcome TTL */).Int64()
+	if err != nil {
+		t.Fatalf("settle %s: %v", member, err)
+	}
+	return rank
+}
+
+func TestSettleFairArrivalOrder(t *testing.T) {
+	mr := testutil.Redis(t)
+	ctx := context.Background()
+	arrivals, _, _ := service.FairKeys(1)
+	mr.Set(database.StockKey(1), "2")
+
+	// Joined the set late-first; the arrival time decides, not the ZADD
+	for _, z := range []redis.Z{{Score: 30, Member: "late"}, {Score: 10, Member: "first"}, {Score: 20, Member: "second"}} {
+		if err := database.Rdb.ZAdd(ctx, arrivals, z).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rank := settle(t, 30, "late"); rank != service.FairSoldOut {
+		t.Fatalf("late arrival: rank = %d, want sold out", rank)
+	}
+	if rank := settle(t, 30, "first"); rank != 1 {
+		t.Fatalf("first arrival: rank = %d, want 1", rank)
+	}
+	if rank := settle(t, 30, "second"); rank != 2 {
+		t.Fatalf("second arrival: rank = %d, want 2", rank)
+	}
+	if got, _ := mr.Get(database.StockKey(1)); got != "0" {
+		t.Fatalf("stock = %s, want 0", got)
+	}
+}
+
+func TestSettleFairWaitsForCutoff(t *testing.T) {
+	mr := testutil.Redis(t)
+	arrivals, _, _ := service.FairKeys(1)
+	mr.Set(database.StockKey(1), "5")
+	database.Rdb.ZAdd(context.Background(), arrivals, redis.Z{Score: 50, Member: "future"})
+
+	if rank := settle(t, 40, "future"); rank != service.FairPending {
+		t.Fatalf("rank = %d, want pending for an arrival after the cutoff", rank)
+	}
+	mr.Del(database.StockKey(1))
+	if rank := settle(t, 50, "future"); rank != service.LuaNotSeeded {
+		t.Fatalf("rank = %d, want not seeded without a stock key", rank)
+	}
+}
+
+func TestJoinFairScript(t *testing.T) {
+	mr := testutil.Redis(t)
+	arrivals, _, _ := service.FairKeys(1)
+	userKey := database.UserPurchaseKey(7, 1)
+
+	join := func(limit int, member string) int64 {
+		t.Helper()
+		joined, err := service.JoinFairScript.Run(context.Background(), database.Rdb,
+			[]string{userKey, arrivals}, limit, 100, member).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return joined
+	}
+
+	for i := range 2 {
+		if got := join(2, fmt.Sprint("m", i)); got != 1 {
+			t.Fatalf("join %d: %d, want 1", i+1, got)
+		}
+	}
+	if got := join(2, "m2"); got != service.LuaUserLimit {
+		t.Fatalf("third join with a limit of 2: %d, want %d", got, service.LuaUserLimit)
+	}
+	if got, _ := mr.Get(userKey); got != "2" {
+		t.Fatalf("user counter = %s, want 2", got)
+	}
+	if members, _ := mr.ZMembers(arrivals); len(members) != 2 {
+		t.Fatalf("line = %v, want the two admitted joins", members)
+	}
+	if got := join(0, "m3"); got != 1 {
+		t.Fatalf("join with no limit: %d, want 1", got)
+	}
+}
+
+func TestLeaveFairScript(t *testing.T) {
+	tests := []struct {
+		name      string
+		inLine    bool
+		outcome   string // settled outcome, "" if none
+		want      int64
+		wantStock string
+	}{
+		{"still in line", true, "", 0, "0"},
+		{"granted a unit", false, "3", 1, "1"},
+		{"settled sold out", false, "0", 0, "0"},
+		{"already collected", false, "", 0, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := testutil.Redis(t)
+			arrivals, outcomes, _ := service.FairKeys(1)
+			userKey := database.UserPurchaseKey(7, 1)
+			mr.Set(database.StockKey(1), "0")
+			mr.Set(userKey, "1")
+			if tt.inLine {
+				mr.ZAdd(arrivals, 10, "me")
+			}
+			if tt.outcome != "" {
+				mr.HSet(outcomes, "me", tt.outcome)
+			}
+
+			got, err := service.LeaveFairScript.Run(context.Background(), database.Rdb,
+				[]string{arrivals, outcomes, database.StockKey(1), userKey}, "me").Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("returned %d, want %d", got, tt.want)
+			}
+			if stock, _ := mr.Get(database.StockKey(1)); stock != tt.wantStock {
+				t.Fatalf("stock = %s, want %s", stock, tt.wantStock)
+			}
+			if n, _ := mr.Get(userKey); n != "0" {
+				t.Fatalf("user counter = %s, want the allowance back (0)", n)
+			}
+			if mr.Exists(arrivals) || mr.HGet(outcomes, "me") != "" {
+				t.Fatal("member is still in the line or the outcomes")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"flash-sale-backend/internal/config"
+	"flash-sale-backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ============================================
+// SERIALIZABLE: Optimistic MVCC, retried on conflict
+// ============================================
+// No row lock: each buyer reads the stock and decrements it in a SERIALIZABLE
+// transaction. When two overlap, Postgres aborts one with a serialization
+// failure (40001), and it starts over from a fresh snapshot.
+
+// SerializableRetries is how many times a purchase that hit a serialization
+// failure is retried before giving up (SERIALIZABLE_MAX_RETRIES)
+var SerializableRetries = max(config.Int("SERIALIZABLE_MAX_RETRIES", 5), 0)
+
+// ErrSerializationConflict means every attempt lost to a concurrent buyer.
+// It wraps the last Postgres error.
+var ErrSerializationConflict = errors.New("serialization kept failing")
+
+// serializationFailure is Postgres SQLSTATE serialization_failure
+const serializationFailure = "40001"
+
+// isSerializationFailure reports whether err is Postgres aborting a
+// transaction that conflicted with a concurrent one
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == serializationFailure
+}
+
+// Serializable buys in a SERIALIZABLE transaction, retrying serialization
+// failures up to SerializableRetries times with a short jittered backoff.
+// Result.Retries says how many retries it took, on failure too.
+func (s PurchaseService) Serializable(ctx context.Context, userID, productID, quantity int) (Result, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := s.serializableOnce(ctx, userID, productID, quantity)
+		res.Retries = attempt
+		if !isSerializationFailure(err) {
+			return res, err
+		}
+		if attempt == SerializableRetries {
+			return res, fmt.Errorf("%w after %d retries: %w", ErrSerializationConflict, attempt, err)
+		}
+
+		// Back off a little (more each time) so the losers don't collide again
+		backoff := time.Duration(attempt+1) * time.Duration(1+rand.IntN(5)) * time.Millisecond
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return res, ctx.Err()
+		}
+	}
+}
+
+func (s PurchaseService) serializableOnce(ctx context.Context, userID, productID, quantity int) (res Result, err error) {
+	s.obs().BeginTx(time.Now())
+	tx, err := database.DB.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return res, &StepError{StepBegin, err}
+	}
+	defer tx.Rollback(context.Background()) // still runs if ctx expired
+
+	// Plain read: SERIALIZABLE, not a lock, keeps it honest
+	var stock int
+	err = tx.QueryRow(ctx, "SELECT quantity FROM products WHERE id=$1", productID).Scan(&stock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, ErrProductNotFound
+	}
+	if err != nil {
+		return res, &StepError{StepReadStock, err}
+	}
+
+	if stock < quantity {
+		return res, ErrSoldOut
+	}
+
+	err = tx.QueryRow(ctx,
+		"UPDATE products SET quantity = quantity - $2 WHERE id=$1 RETURNING quantity",
+		productID, quantity).Scan(&res.Remaining)
+	if err != nil {
+		return res, &StepError{StepUpdateStock, err}
+	}
+
+	step := time.Now()
+	res.OrderID, err = InsertOrder(ctx, tx, userID, productID, quantity, OrderStatusSuccess)
+	s.obs().InsertOrder(step)
+	if err != nil {
+		return res, &StepError{StepInsertOrder, err}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, &StepError{StepCommit, err}
+	}
+	s.obs().EndTx()
+	return res, nil
+}
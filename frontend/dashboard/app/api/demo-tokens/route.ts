@@ -0,0 +1,29 @@
+import { NextResponse } from "next/server";
+
+// Mints Bearer tokens for the dashboard's simulated buyers. The backend's
+// ADMIN_TOKEN stays on the server: the browser only asks for a number of
+// tokens, and the user ids are picked here from a range reserved for
+// synthetic buyers, so a visitor can't get a token for a real account.
+const BACKEND_URL = process.env.BACKEND_URL ?? "http://localhost:8080";
+const ADMIN_TOKEN = process.env.ADMIN_TOKEN ?? "";
+const MAX_TOKENS = 5000; // POST /admin/tokens takes at most this many
+const SYNTHETIC_USERS_START = 800_000_000; // clear of real users and /demo/stampede's
+const SYNTHETIC_USERS = 10_000;
+
+export async function POST(request: Request) {
+  const body = await request.json().catch(() => ({}));
+  const count = Math.min(Math.max(Math.floor(Number(body?.count) || 0), 1), MAX_TOKENS);
+  const userIds = Array.from({ length: count }, () => SYNTHETIC_USERS_START + Math.floor(Math.random() * SYNTHETIC_USERS));
+
+  try {
+    const res = await fetch(`${BACKEND_URL}/admin/tokens`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json", "X-Admin-Token": ADMIN_TOKEN },
+      body: JSON.stringify({ user_ids: userIds }),
+      cache: "no-store",
+    });
+    return NextResponse.json(await res.json(), { status: res.status });
+  } catch {
+    return NextResponse.json({ error: "Backend unreachable" }, { status: 502 });
+  }
+}
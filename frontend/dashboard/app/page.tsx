@@ -29,6 +29,8 @@ import {
 
 // --- Types & Constants ---
 const API_URL = "http://localhost:8080";
+// Purchases need a Bearer token per buyer; /api/demo-tokens mints them for
+// synthetic buyers server-side, so the admin token never reaches the browser
 const PRODUCT_IMAGE = "https://images.unsplash.com/photo-1695048133142-1a20484d2569?q=80&w=1000&auto=format&fit=crop";
 
 type Mode = "naive" | "postgres" | "redis";
@@ -290,13 +292,26 @@ export default function Dashboard() {
     let failCount = 0;
     let totalLatency = 0;
 
-    const makeRequest = async () => {
+    let tokens: string[] = [];
+    try {
+      const res = await fetch("/api/demo-tokens", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ count: Math.min(requestCount, 5000) }),
+      });
+      if (res.ok) {
+        const data = await res.json();
+        tokens = data.tokens.map((t: { token: string }) => t.token);
+      }
+    } catch (e) { console.error(e); }
+
+    const makeRequest = async (i: number) => {
       const start = Date.now();
       try {
         const res = await fetch(`${API_URL}${config.endpoint}`, {
           method: "POST",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ user_id: Math.floor(Math.random() * 10000), product_id: 1 }),
+          headers: { "Content-Type": "application/json", Authorization: `Bearer ${tokens[i % Math.max(tokens.length, 1)] ?? ""}` },
+          body: JSON.stringify({ product_id: 1 }),
         });
         totalLatency += Date.now() - start;
         if (res.ok) successCount++; else failCount++;
@@ -312,7 +327,7 @@ export default function Dashboard() {
       }
     };
 
-    const tasks = Array(requestCount).fill(null).map(() => makeRequest);
+    const tasks = Array(requestCount).fill(null).map((_, i) => () => makeRequest(i));
     await runBatch(tasks, concurrency);
 
     const duration = Date.now() - startTime;
@@ -3,52 +3,661 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
+	"sort"
 	"sync"
 	"time"
 )
 
-func main() {
-	// 1. Configuration
-	totalRequests := 500 // Let's try to buy 500 times (Stock is only 100)
-	url := "http://localhost:8080/purchase"
+// modePaths maps -mode to the purchase route it attacks
+var modePaths = map[string]string{
+	"default":         "/purchase",
+	"naive":           "/purchase/naive",
+	"postgres":        "/purchase/postgres",
+	"postgres-nowait": "/purchase/postgres-nowait",
+	"redis":           "/purchase/redis",
+	"fair":            "/purchase/fair",
+	"serializable":    "/purchase/serializable",
+}
+
+// serverModes maps -mode to the mode name /stats reports it under
+var serverModes = map[string]string{
+	"default":         "redis_postgres",
+	"naive":           "naive",
+	"postgres":        "postgres_lock",
+	"postgres-nowait": "postgres_nowait",
+	"redis":           "redis_postgres",
+	"fair":            "fair",
+	"serializable":    "serializable",
+}
+
+// result is what one request observed
+type result struct {
+	status    int           // 0 if the request never got a response
+	latency   time.Duration // client-side round trip
+	serverMs  int64         // "latency_ms" from the response body, -1 if absent
+	errorCode string        // "error.code" from the response body
+}
+
+// summary aggregates the results of a whole attack
+type summary struct {
+	Total       int
+	Success     int
+	OutOfStock  int
+	Errors      int
+	ByStatus    map[int]int
+	P50, P95    time.Duration
+	P99         time.Duration
+	AvgServerMs float64
+}
+
+// summarize tallies results into a summary. A 2xx is a success, an
+// OUT_OF_STOCK error is a sold-out rejection, anything else is an error.
+func summarize(results []result) summary {
+	s := summary{Total: len(results), ByStatus: map[int]int{}}
+
+	latencies := make([]time.Duration, 0, len(results))
+	var serverTotal, serverCount int64
+	for _, r := range results {
+		s.ByStatus[r.status]++
+		switch {
+		case r.status >= 200 && r.status < 300:
+			s.Success++
+		case r.errorCode == "OUT_OF_STOCK":
+			s.OutOfStock++
+		default:
+			s.Errors++
+		}
+		if r.status != 0 {
+			latencies = append(latencies, r.latency)
+		}
+		if r.serverMs >= 0 {
+			serverTotal += r.serverMs
+			serverCount++
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.P50 = percentile(latencies, 50)
+	s.P95 = percentile(latencies, 95)
+	s.P99 = percentile(latencies, 99)
+	if serverCount > 0 {
+		s.AvgServerMs = float64(serverTotal) / float64(serverCount)
+	}
+	return s
+}
+
+// percentile returns the nearest-rank percentile (0-100) of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// snapshot is the server state -verify compares before and after the attack
+type snapshot struct {
+	Quantity  int              // product 1's quantity in PostgreSQL
+	Success   map[string]int64 // successful purchases per mode
+	Oversells map[string]int64 // purchases that drove stock negative, per mode
+}
+
+// check is one invariant's outcome
+type check struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// checkInvariants compares the snapshots taken before and after an attack:
+// per mode, no purchase may oversell and successes can't exceed the starting
+// stock; overall, stock never ends negative and every unit sold must have
+// come out of PostgreSQL.
+func checkInvariants(before, after snapshot) []check {
+	names := make([]string, 0, len(after.Success))
+	for name := range after.Success {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var checks []check
+	var sold int64
+	for _, name := range names {
+		success := after.Success[name] - before.Success[name]
+		oversells := after.Oversells[name] - before.Oversells[name]
+		sold += success
+		if success == 0 && oversells == 0 {
+			continue
+		}
+		checks = append(checks, check{
+			Name:   "oversell (" + name + ")",
+			OK:     oversells == 0 && success <= int64(before.Quantity),
+			Detail: fmt.Sprintf("%d sold from %d in stock, %d oversells", success, before.Quantity, oversells),
+		})
+	}
+
+	checks = append(checks, check{
+		Name:   "non-negative stock",
+		OK:     after.Quantity >= 0,
+		Detail: fmt.Sprintf("final quantity %d", after.Quantity),
+	})
+	checks = append(checks, check{
+		Name:   "stock conservation",
+		OK:     int64(after.Quantity)+sold == int64(before.Quantity),
+		Detail: fmt.Sprintf("final %d + sold %d, started with %d", after.Quantity, sold, before.Quantity),
+	})
+	return checks
+}
+
+// getJSON decodes a GET response into v
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// takeSnapshot reads product 1's stock and the per-mode counters from the backend
+func takeSnapshot(client *http.Client, baseURL string) (snapshot, error) {
+	var product struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := getJSON(client, baseURL+"/products/1", &product); err != nil {
+		return snapshot{}, err
+	}
+
+	var stats struct {
+		ByMode map[string]struct {
+			Success   int64 `json:"success"`
+			Oversells int64 `json:"oversells"`
+		} `json:"by_mode"`
+	}
+	if err := getJSON(client, baseURL+"/stats?product_id=1", &stats); err != nil {
+		return snapshot{}, err
+	}
+
+	snap := snapshot{Quantity: product.Quantity, Success: map[string]int64{}, Oversells: map[string]int64{}}
+	for name, m := range stats.ByMode {
+		snap.Success[name] = m.Success
+		snap.Oversells[name] = m.Oversells
+	}
+	return snap, nil
+}
+
+// recordedRequest is one line of a -record / -replay file
+type recordedRequest struct {
+	Timestamp time.Time `json:"timestamp"`
+	UserID    int       `json:"user_id"`
+	ProductID int       `json:"product_id"`
+}
+
+// recorder appends every request sent to a JSONL file (-record)
+type recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *recorder) record(req recordedRequest) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(req)
+}
 
-	fmt.Printf("⚠️  Starting Attack: %d requests targeting 100 iPhones...\n", totalRequests)
+// readRecording loads a -record file, ordered by when each request was sent
+func readRecording(path string) ([]recordedRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs []recordedRequest
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var req recordedRequest
+		if err := dec.Decode(&req); err != nil {
+			return nil, fmt.Errorf("%s: request %d: %w", path, len(reqs)+1, err)
+		}
+		reqs = append(reqs, req)
+	}
+	// Workers write lines as they go, so the file is only roughly in order
+	sort.SliceStable(reqs, func(i, j int) bool { return reqs[i].Timestamp.Before(reqs[j].Timestamp) })
+	return reqs, nil
+}
+
+// scheduleReplay calls send for every request at the same offset from start
+// as it had from the first recorded request, each on its own goroutine so a
+// slow response doesn't delay the ones after it. Returns once all have
+// returned. reqs must be sorted by Timestamp.
+func scheduleReplay(reqs []recordedRequest, start time.Time, send func(i int, req recordedRequest)) {
+	if len(reqs) == 0 {
+		return
+	}
+	first := reqs[0].Timestamp
 
 	var wg sync.WaitGroup
-	wg.Add(totalRequests)
+	for i, req := range reqs {
+		time.Sleep(time.Until(start.Add(req.Timestamp.Sub(first))))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send(i, req)
+		}()
+	}
+	wg.Wait()
+}
 
-	// 2. Launch Concurrent Requests
-	// This loop runs INSTANTLY. It doesn't wait for the previous one to finish.
+// runReplay sends a recorded sequence to url, preserving its relative timing
+func runReplay(client *http.Client, url string, reqs []recordedRequest, tokens map[int]string, rec *recorder) ([]result, time.Duration) {
+	results := make([]result, len(reqs))
 	start := time.Now()
-	for i := 0; i < totalRequests; i++ {
-		go func(userID int) {
-			defer wg.Done()
+	scheduleReplay(reqs, start, func(i int, req recordedRequest) {
+		results[i] = purchase(client, url, tokens[req.UserID], req.UserID, req.ProductID, rec)
+	})
+	return results, time.Since(start)
+}
+
+// purchase sends one purchase as the token's user and records what came back
+func purchase(client *http.Client, url, token string, userID, productID int, rec *recorder) result {
+	payload := map[string]int{"product_id": productID}
+	jsonData, _ := json.Marshal(payload)
+
+	start := time.Now()
+	rec.record(recordedRequest{Timestamp: start, UserID: userID, ProductID: productID})
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), serverMs: -1}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	r := result{status: resp.StatusCode, latency: time.Since(start), serverMs: -1}
+
+	var parsed struct {
+		LatencyMs *int64 `json:"latency_ms"`
+		Error     struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		if parsed.LatencyMs != nil {
+			r.serverMs = *parsed.LatencyMs
+		}
+		r.errorCode = parsed.Error.Code
+	}
+	return r
+}
 
-			// Create JSON payload
-			payload := map[string]int{"user_id": userID, "product_id": 1}
-			jsonData, _ := json.Marshal(payload)
+// runAttack sends total purchases to url from a bounded pool of workers, the
+// i-th as user i+1
+func runAttack(client *http.Client, url string, total, concurrency int, tokens map[int]string, rec *recorder) ([]result, time.Duration) {
+	// Bounded worker pool: concurrency workers pull request numbers off a channel
+	jobs := make(chan int)
+	results := make([]result, total)
 
-			// Send POST Request
-			resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-			if err != nil {
-				fmt.Printf("Request failed: %v\n", err)
-				return
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = purchase(client, url, tokens[i+1], i+1, 1, rec)
 			}
-			defer resp.Body.Close()
-			
-			// We just discard the response, we only care about the server state
-			io.Copy(io.Discard, resp.Body)
-		}(i)
+		}()
+	}
+	for i := 0; i < total; i++ {
+		jobs <- i
 	}
+	close(jobs)
 
-	// 3. Wait for all requests to finish
+	// Wait for all requests to finish
 	wg.Wait()
-	elapsed := time.Since(start)
+	return results, time.Since(start)
+}
+
+func printSummary(s summary, elapsed time.Duration) {
+	fmt.Printf("⏱️  Time taken: %s (%.0f req/s)\n", elapsed, float64(s.Total)/elapsed.Seconds())
+	fmt.Printf("✅ Success:      %d\n", s.Success)
+	fmt.Printf("📦 Out of stock: %d\n", s.OutOfStock)
+	fmt.Printf("❌ Errors:       %d\n", s.Errors)
 
+	statuses := make([]int, 0, len(s.ByStatus))
+	for status := range s.ByStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	fmt.Println("📊 Status codes:")
+	for _, status := range statuses {
+		label := fmt.Sprint(status)
+		if status == 0 {
+			label = "no response"
+		}
+		fmt.Printf("   %-12s %d\n", label, s.ByStatus[status])
+	}
+
+	fmt.Printf("⏱️  Client latency: p50=%s p95=%s p99=%s\n", s.P50, s.P95, s.P99)
+	fmt.Printf("⏱️  Avg server latency_ms: %.1f\n", s.AvgServerMs)
+}
+
+// printChecks prints each check and reports whether all passed. When
+// mayFail is set (naive mode) failures are printed as EXPECTED instead.
+func printChecks(checks []check, mayFail bool) bool {
+	passed := true
+	for _, chk := range checks {
+		verdict := "PASS"
+		if !chk.OK {
+			verdict = "FAIL"
+			if mayFail {
+				verdict = "EXPECTED"
+			} else {
+				passed = false
+			}
+		}
+		fmt.Printf("   %-8s %-30s %s\n", verdict, chk.Name, chk.Detail)
+	}
+	return passed
+}
+
+// mintBatch is the most user ids POST /admin/tokens takes at once
+const mintBatch = 5000
+
+// mintTokens gets a Bearer token for each user id from POST /admin/tokens,
+// since the purchase routes take the buyer from the token alone
+func mintTokens(client *http.Client, baseURL, adminToken string, userIDs []int) (map[int]string, error) {
+	tokens := make(map[int]string, len(userIDs))
+	for len(userIDs) > 0 {
+		batch := userIDs[:min(mintBatch, len(userIDs))]
+		userIDs = userIDs[len(batch):]
+
+		body, _ := json.Marshal(map[string][]int{"user_ids": batch})
+		req, _ := http.NewRequest(http.MethodPost, baseURL+"/admin/tokens", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Token", adminToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var minted struct {
+			Tokens []struct {
+				UserID int    `json:"user_id"`
+				Token  string `json:"token"`
+			} `json:"tokens"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&minted)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("POST /admin/tokens: %s (is -admin-token / ADMIN_TOKEN set?)", resp.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range minted.Tokens {
+			tokens[t.UserID] = t.Token
+		}
+	}
+	return tokens, nil
+}
+
+// userRange returns the user ids 1..n that runAttack buys as
+func userRange(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
+
+// resetProduct restocks product 1 and clears its orders and the stats
+func resetProduct(client *http.Client, baseURL string) error {
+	resp, err := client.Post(baseURL+"/reset?product_id=1", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST /reset: %s", resp.Status)
+	}
+	return nil
+}
+
+// sweepModes are attacked in order by -sweep; naive is allowed to oversell
+var sweepModes = []string{"naive", "postgres", "redis"}
+
+// modeReport is one mode's line in the -report file
+type modeReport struct {
+	Mode          string  `json:"mode"`
+	Requests      int     `json:"requests"`
+	Concurrency   int     `json:"concurrency"`
+	Success       int     `json:"success"`
+	OutOfStock    int     `json:"out_of_stock"`
+	Errors        int     `json:"errors"`
+	ThroughputRPS float64 `json:"throughput_rps"`
+	P50Ms         float64 `json:"p50_ms"`
+	P95Ms         float64 `json:"p95_ms"`
+	P99Ms         float64 `json:"p99_ms"`
+	Oversells     int64   `json:"oversells"`
+	Passed        bool    `json:"passed"`
+}
+
+// sweepReport is what -sweep -report writes: every mode under the same load
+type sweepReport struct {
+	Timestamp time.Time    `json:"timestamp"`
+	URL       string       `json:"url"`
+	Modes     []modeReport `json:"modes"`
+	Passed    bool         `json:"passed"`
+}
+
+// newModeReport condenses one mode's attack and invariant checks
+func newModeReport(mode string, concurrency int, s summary, elapsed time.Duration, before, after snapshot, checks []check) modeReport {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	r := modeReport{
+		Mode:          mode,
+		Requests:      s.Total,
+		Concurrency:   concurrency,
+		Success:       s.Success,
+		OutOfStock:    s.OutOfStock,
+		Errors:        s.Errors,
+		ThroughputRPS: float64(s.Total) / elapsed.Seconds(),
+		P50Ms:         ms(s.P50),
+		P95Ms:         ms(s.P95),
+		P99Ms:         ms(s.P99),
+		Oversells:     after.Oversells[serverModes[mode]] - before.Oversells[serverModes[mode]],
+		Passed:        true,
+	}
+	for _, chk := range checks {
+		r.Passed = r.Passed && chk.OK
+	}
+	return r
+}
+
+// writeReport saves the sweep as indented JSON
+func writeReport(path string, report sweepReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// runSweep resets product 1 before each mode, attacks it, and checks the
+// invariants. report.Passed is false if any mode other than naive broke one.
+func runSweep(client *http.Client, baseURL string, total, concurrency int, tokens map[int]string) (sweepReport, error) {
+	report := sweepReport{Timestamp: time.Now().UTC(), URL: baseURL, Passed: true}
+	for _, mode := range sweepModes {
+		if err := resetProduct(client, baseURL); err != nil {
+			return report, fmt.Errorf("reset before %s: %w", mode, err)
+		}
+		before, err := takeSnapshot(client, baseURL)
+		if err != nil {
+			return report, fmt.Errorf("read starting state: %w", err)
+		}
+
+		fmt.Printf("\n⚠️  %s: %d requests (%d concurrent) against %d in stock\n", mode, total, concurrency, before.Quantity)
+		results, elapsed := runAttack(client, baseURL+modePaths[mode], total, concurrency, tokens, nil)
+		s := summarize(results)
+		printSummary(s, elapsed)
+
+		after, err := takeSnapshot(client, baseURL)
+		if err != nil {
+			return report, fmt.Errorf("read final state: %w", err)
+		}
+		checks := checkInvariants(before, after)
+		if !printChecks(checks, mode == "naive") {
+			report.Passed = false
+		}
+		report.Modes = append(report.Modes, newModeReport(mode, concurrency, s, elapsed, before, after, checks))
+	}
+	return report, nil
+}
+
+func main() {
+	// 1. Configuration
+	total := flag.Int("n", 500, "total requests to send")
+	concurrency := flag.Int("c", 50, "requests in flight at once")
+	baseURL := flag.String("url", "http://localhost:8080", "backend base URL")
+	mode := flag.String("mode", "default", "purchase mode: default, naive, postgres, postgres-nowait, redis, fair or serializable")
+	verify := flag.Bool("verify", false, "check /stats and /products/1 for overselling afterwards")
+	sweep := flag.Bool("sweep", false, "reset product 1 and attack naive, postgres and redis in turn, verifying each")
+	recordFile := flag.String("record", "", "append every request sent (timestamp, user_id, product_id) to this JSONL file")
+	reportFile := flag.String("report", "", "with -sweep, write throughput, latency and oversells per mode to this JSON file")
+	replayFile := flag.String("replay", "", "send the requests in this -record file with their original relative timing instead of -n/-c")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "X-Admin-Token used to mint a Bearer token per simulated buyer (default $ADMIN_TOKEN)")
+	flag.Parse()
+
+	path, ok := modePaths[*mode]
+	if !ok || *total < 1 || *concurrency < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	if *sweep {
+		tokens, err := mintTokens(client, *baseURL, *adminToken, userRange(*total))
+		if err != nil {
+			fmt.Printf("❌ Could not mint buyer tokens: %v\n", err)
+			os.Exit(1)
+		}
+		report, err := runSweep(client, *baseURL, *total, *concurrency, tokens)
+		if err != nil {
+			fmt.Printf("❌ Sweep aborted: %v\n", err)
+			os.Exit(1)
+		}
+		if *reportFile != "" {
+			if err := writeReport(*reportFile, report); err != nil {
+				fmt.Printf("❌ Could not write report: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("\n📄 Report written to %s\n", *reportFile)
+		}
+		if !report.Passed {
+			fmt.Println("\n❌ A safe mode oversold or lost stock")
+			os.Exit(1)
+		}
+		fmt.Println("\n✅ postgres and redis never oversold")
+		return
+	}
+
+	var rec *recorder
+	if *recordFile != "" {
+		f, err := os.OpenFile(*recordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Printf("❌ Could not open recording: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		rec = &recorder{enc: json.NewEncoder(f)}
+	}
+
+	var replay []recordedRequest
+	if *replayFile != "" {
+		var err error
+		if replay, err = readRecording(*replayFile); err != nil {
+			fmt.Printf("❌ Could not read recording: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	userIDs := userRange(*total)
+	if replay != nil {
+		userIDs = userIDs[:0]
+		seen := map[int]bool{}
+		for _, req := range replay {
+			if !seen[req.UserID] {
+				seen[req.UserID] = true
+				userIDs = append(userIDs, req.UserID)
+			}
+		}
+	}
+	tokens, err := mintTokens(client, *baseURL, *adminToken, userIDs)
+	if err != nil {
+		fmt.Printf("❌ Could not mint buyer tokens: %v\n", err)
+		os.Exit(1)
+	}
+
+	url := *baseURL + path
+	if replay != nil {
+		fmt.Printf("⚠️  Replaying %d requests from %s against %s\n", len(replay), *replayFile, url)
+	} else {
+		fmt.Printf("⚠️  Starting Attack: %d requests (%d concurrent) against %s\n", *total, *concurrency, url)
+	}
+
+	var before snapshot
+	if *verify {
+		var err error
+		if before, err = takeSnapshot(client, *baseURL); err != nil {
+			fmt.Printf("❌ Could not read starting state: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 2. Fire the requests
+	var results []result
+	var elapsed time.Duration
+	if replay != nil {
+		results, elapsed = runReplay(client, url, replay, tokens, rec)
+	} else {
+		results, elapsed = runAttack(client, url, *total, *concurrency, tokens, rec)
+	}
+
+	// 3. Report
 	fmt.Printf("\n💥 Attack Complete!\n")
-	fmt.Printf("⏱️  Time taken: %s\n", elapsed)
-	fmt.Println("👉 Now check your Database: SELECT quantity FROM products;")
-}
\ No newline at end of file
+	printSummary(summarize(results), elapsed)
+
+	if !*verify {
+		fmt.Println("👉 Run again with -verify to check for overselling")
+		return
+	}
+
+	// 4. Closed loop: compare server state with what we started from
+	after, err := takeSnapshot(client, *baseURL)
+	if err != nil {
+		fmt.Printf("❌ Could not read final state: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n🔍 Verification (%s mode attacked):\n", serverModes[*mode])
+	if !printChecks(checkInvariants(before, after), false) {
+		os.Exit(1)
+	}
+}
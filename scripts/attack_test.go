@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	ms := time.Millisecond
+	var results []result
+	for i := 1; i <= 100; i++ {
+		results = append(results, result{status: 200, latency: time.Duration(i) * ms, serverMs: 2})
+	}
+	results = append(results,
+		result{status: 400, latency: 3 * ms, serverMs: 4, errorCode: "OUT_OF_STOCK"},
+		result{status: 429, latency: 3 * ms, serverMs: -1, errorCode: "USER_LIMIT_EXCEEDED"},
+		result{status: 0, latency: 30 * time.Second, serverMs: -1}, // never answered
+	)
+
+	s := summarize(results)
+	if s.Total != 103 || s.Success != 100 || s.OutOfStock != 1 || s.Errors != 2 {
+		t.Fatalf("summary = %+v, want 100 successes, 1 sold out, 2 errors", s)
+	}
+	if s.ByStatus[200] != 100 || s.ByStatus[400] != 1 || s.ByStatus[429] != 1 || s.ByStatus[0] != 1 {
+		t.Fatalf("by status = %v", s.ByStatus)
+	}
+	// 102 answered latencies (1..100ms plus two extra 3ms); the timeout is left out
+	if s.P50 != 49*ms || s.P95 != 95*ms || s.P99 != 99*ms {
+		t.Fatalf("p50/p95/p99 = %s/%s/%s, want 49ms/95ms/99ms", s.P50, s.P95, s.P99)
+	}
+	if want := 204.0 / 101; s.AvgServerMs != want {
+		t.Fatalf("avg server latency = %v, want %v", s.AvgServerMs, want)
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	s := summarize(nil)
+	if s.Total != 0 || s.P99 != 0 || s.AvgServerMs != 0 {
+		t.Fatalf("summary of nothing = %+v", s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{{0, 1}, {25, 1}, {50, 2}, {51, 3}, {99, 4}, {100, 4}} {
+		if got := percentile(sorted, tc.p); got != tc.want {
+			t.Errorf("p%v = %d, want %d", tc.p, got, tc.want)
+		}
+	}
+}
+
+// checksByName indexes checkInvariants' results
+func checksByName(checks []check) map[string]check {
+	byName := map[string]check{}
+	for _, c := range checks {
+		byName[c.Name] = c
+	}
+	return byName
+}
+
+func TestCheckInvariantsPass(t *testing.T) {
+	before := snapshot{
+		Quantity:  100,
+		Success:   map[string]int64{"redis_postgres": 40, "postgres_lock": 7},
+		Oversells: map[string]int64{},
+	}
+	after := snapshot{
+		Quantity:  0,
+		Success:   map[string]int64{"redis_postgres": 140, "postgres_lock": 7},
+		Oversells: map[string]int64{},
+	}
+
+	checks := checkInvariants(before, after)
+	for _, c := range checks {
+		if !c.OK {
+			t.Errorf("%s failed: %s", c.Name, c.Detail)
+		}
+	}
+	byName := checksByName(checks)
+	if _, ok := byName["oversell (postgres_lock)"]; ok {
+		t.Error("a mode that sold nothing during the attack was checked")
+	}
+	if c := byName["oversell (redis_postgres)"]; c.Detail != "100 sold from 100 in stock, 0 oversells" {
+		t.Errorf("redis_postgres detail = %q", c.Detail)
+	}
+	if len(checks) != 3 {
+		t.Errorf("%d checks, want oversell, non-negative stock and conservation", len(checks))
+	}
+}
+
+func TestCheckInvariantsOversell(t *testing.T) {
+	before := snapshot{Quantity: 100, Success: map[string]int64{}, Oversells: map[string]int64{}}
+	after := snapshot{
+		Quantity:  -5,
+		Success:   map[string]int64{"naive": 105},
+		Oversells: map[string]int64{"naive": 5},
+	}
+
+	byName := checksByName(checkInvariants(before, after))
+	for _, name := range []string{"oversell (naive)", "non-negative stock"} {
+		if c, ok := byName[name]; !ok || c.OK {
+			t.Errorf("%s = %+v, want FAIL", name, c)
+		}
+	}
+	// 105 sold and -5 left still adds up to the 100 it started with
+	if c := byName["stock conservation"]; !c.OK {
+		t.Errorf("stock conservation failed: %s", c.Detail)
+	}
+}
+
+func TestCheckInvariantsLostStock(t *testing.T) {
+	// 10 units left PostgreSQL without a successful purchase to show for it
+	before := snapshot{Quantity: 100, Success: map[string]int64{}, Oversells: map[string]int64{}}
+	after := snapshot{Quantity: 50, Success: map[string]int64{"redis_postgres": 40}, Oversells: map[string]int64{}}
+
+	c := checksByName(checkInvariants(before, after))["stock conservation"]
+	if c.OK || !strings.Contains(c.Detail, "final 50 + sold 40, started with 100") {
+		t.Fatalf("stock conservation = %+v, want FAIL", c)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var mu sync.Mutex
+	var buyers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		buyers = append(buyers, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Write([]byte(`{"latency_ms": 1}`))
+	}))
+	defer srv.Close()
+	tokens := map[int]string{1: "a", 2: "b", 3: "c", 4: "d", 5: "e"}
+
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runAttack(srv.Client(), srv.URL, 5, 1, tokens, &recorder{enc: json.NewEncoder(f)})
+	f.Close()
+
+	reqs, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 5 {
+		t.Fatalf("recorded %d requests, want 5", len(reqs))
+	}
+	for i, req := range reqs {
+		if req.UserID != i+1 || req.ProductID != 1 {
+			t.Fatalf("request %d = %+v, want user %d buying product 1", i, req, i+1)
+		}
+	}
+
+	buyers = nil
+	results, _ := runReplay(srv.Client(), srv.URL, reqs, tokens, nil)
+	if s := summarize(results); s.Success != 5 {
+		t.Fatalf("replay summary = %+v, want 5 successes", s)
+	}
+	if len(buyers) != 5 {
+		t.Fatalf("server saw %d replayed requests, want 5", len(buyers))
+	}
+}
+
+func TestReadRecordingSortsByTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	lines := `{"timestamp":"2025-01-01T00:00:00.002Z","user_id":3,"product_id":1}
+{"timestamp":"2025-01-01T00:00:00.000Z","user_id":1,"product_id":1}
+{"timestamp":"2025-01-01T00:00:00.001Z","user_id":2,"product_id":1}
+`
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, req := range reqs {
+		if req.UserID != i+1 {
+			t.Fatalf("request %d is user %d, want the file ordered by timestamp", i, req.UserID)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{not json}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRecording(path); err == nil {
+		t.Fatal("a malformed recording was read without error")
+	}
+}
+
+func TestScheduleReplayKeepsTiming(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 30 * time.Millisecond, 30 * time.Millisecond, 90 * time.Millisecond}
+	reqs := make([]recordedRequest, len(offsets))
+	for i, off := range offsets {
+		reqs[i] = recordedRequest{Timestamp: t0.Add(off), UserID: i + 1, ProductID: 1}
+	}
+
+	var mu sync.Mutex
+	sent := make([]time.Duration, len(reqs))
+	var order []int
+	start := time.Now()
+	scheduleReplay(reqs, start, func(i int, req recordedRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[i] = time.Since(start)
+		order = append(order, req.UserID)
+	})
+
+	if len(order) != len(reqs) {
+		t.Fatalf("sent %d requests, want %d", len(order), len(reqs))
+	}
+	for i, off := range offsets {
+		if sent[i] < off || sent[i] > off+50*time.Millisecond {
+			t.Errorf("request %d sent at %s, want %s after the start", i, sent[i], off)
+		}
+	}
+	// Requests recorded at the same instant may go in either order
+	if order[0] != 1 || order[3] != 4 {
+		t.Errorf("send order = %v, want 1 first and 4 last", order)
+	}
+}